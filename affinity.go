@@ -0,0 +1,120 @@
+package clirunner
+
+// AffinityKeyer is an optional interface for a Commander whose command
+// must run on the same CLI as others, e.g. those using the same temporary
+// table.  A ProcRunnerPool runs all Commanders with a given key on the
+// same runner, waiting for it if it's busy, while Commanders without a
+// key, or with other keys, spread across the pool.  A key's runner is the
+// one its first Commander ran on, until that runner is closed, e.g. for
+// being idle too long, or forgets the key, per MaxAffinityKeys; then the
+// next Commander with the key gets another.  See WithAffinity.
+type AffinityKeyer interface {
+	// AffinityKey returns the Commander's key, or "" for none.
+	AffinityKey() string
+}
+
+// affinityKey returns the affinity key of the given Commander, or "".
+func affinityKey(c Commander) string {
+	for ; c != nil; c = unwrap(c) {
+		if k, ok := c.(AffinityKeyer); ok {
+			return k.AffinityKey()
+		}
+	}
+	return ""
+}
+
+// bind makes the runner the one for the key, if any.
+// The caller must hold mu.
+func (p *ProcRunnerPool) bind(key string, pr *ProcRunner) {
+	if key == "" || p.affinity[key] != nil {
+		return
+	}
+	p.affinity[key] = pr
+	p.keys[pr] = append(p.keys[pr], key)
+	p.trimKeys(pr)
+}
+
+// touch notes a run with the key is to use the runner, making the key its
+// most recently used.  The caller must hold mu.
+func (p *ProcRunnerPool) touch(key string, pr *ProcRunner) {
+	keys := p.keys[pr]
+	for i, k := range keys {
+		if k == key {
+			p.keys[pr] = append(append(keys[:i], keys[i+1:]...), key)
+			return
+		}
+	}
+}
+
+// trimKeys forgets the runner's least recently used keys beyond
+// MaxAffinityKeys, other than its most recent one and those that runs
+// are waiting on.  The caller must hold mu.
+func (p *ProcRunnerPool) trimKeys(pr *ProcRunner) {
+	limit := p.params.MaxAffinityKeys
+	if limit == 0 {
+		limit = defaultMaxAffinityKeys
+	}
+	keys := p.keys[pr]
+	for i := 0; len(keys) > limit && i < len(keys)-1; {
+		if len(p.affine[keys[i]]) > 0 {
+			i++
+			continue
+		}
+		delete(p.affinity, keys[i])
+		keys = append(keys[:i], keys[i+1:]...)
+	}
+	p.keys[pr] = keys
+}
+
+// unbind forgets the key if it has no runner yet, having the runs waiting
+// for one try again.  The caller must hold mu.
+func (p *ProcRunnerPool) unbind(key string) {
+	if pr, ok := p.affinity[key]; !ok || pr != nil {
+		return
+	}
+	delete(p.affinity, key)
+	for _, w := range p.affine[key] {
+		w <- nil
+	}
+	delete(p.affine, key)
+}
+
+// takeIdle removes the runner from the idle runners, returning false if
+// it isn't idle.  The caller must hold mu.
+func (p *ProcRunnerPool) takeIdle(pr *ProcRunner) bool {
+	for i, r := range p.idle {
+		if r.pr == pr {
+			p.idle = append(p.idle[:i], p.idle[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// affineWaiting returns the number of runs waiting for their key's
+// runner.  The caller must hold mu.
+func (p *ProcRunnerPool) affineWaiting() int {
+	n := 0
+	for _, ws := range p.affine {
+		n += len(ws)
+	}
+	return n
+}
+
+// removeTurn removes the turn from the key's waiting runs, returning
+// false if it isn't there.
+func removeTurn(m map[string][]chan *ProcRunner, key string,
+	turn chan *ProcRunner) bool {
+	ws := m[key]
+	for i, w := range ws {
+		if w == turn {
+			if len(ws) == 1 {
+				delete(m, key)
+			} else {
+				m[key] = append(ws[:i], ws[i+1:]...)
+			}
+			return true
+		}
+	}
+	return false
+}
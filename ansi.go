@@ -0,0 +1,21 @@
+package clirunner
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// ansiEscape matches ANSI escape sequences: control sequences, e.g. colors
+// and cursor movement, operating system commands, e.g. window titles, and
+// the two and three byte escapes, e.g. character set selection.
+var ansiEscape = regexp.MustCompile(
+	"\x1b\\[[0-?]*[ -/]*[@-~]|\x1b\\][^\x07\x1b]*(?:\x07|\x1b\\\\)|" +
+		"\x1b[()*+].|\x1b[ -/]*[0-~]")
+
+// stripANSI returns the line less any ANSI escape sequences.
+func stripANSI(line []byte) []byte {
+	if bytes.IndexByte(line, 0x1b) < 0 {
+		return line
+	}
+	return ansiEscape.ReplaceAll(line, nil)
+}
@@ -0,0 +1,29 @@
+package clirunner_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	. "github.com/monopole/clirunner/internal/testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunner_StripANSI(t *testing.T) {
+	h := makeHarness(t, func(p *Parameters) {
+		p.StripANSI = true
+		p.ErrPrefix = "E:"
+	})
+	c := NewHoardingCommander("select")
+	result := runAsync(h, c, time.Minute)
+	expectCommands(t, h, "select", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Err("\x1b[1;31mwarning\x1b[0m"))
+	assert.NoError(t, h.Out(
+		"\x1b]0;db\x07\x1b[2K\x1b[32mid\x1b[0m\tname",
+		"\x1b(B\x1b[?25h1\tbob\x1b[m",
+		"\x1b[32mRumpelstiltskin\x1b[0m"))
+	assert.NoError(t, <-result)
+	AssertEqualAnyOrder(t, "E:warning\nid\tname\n1\tbob\n", c.Result())
+	assert.NoError(t, h.Runner.Close())
+}
@@ -0,0 +1,205 @@
+package clirunner
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Auth has a ProcRunner log in to its CLI as the CLI starts, answering
+// the prompts it shows, e.g. for a password, a pasted token or a one-time
+// code, before running SetupCommands or anything else.
+//
+// Prompts are looked for on stdOut, or on stdErr for steps saying so, as
+// for CLIs that do their whole handshake on stdErr.  CLIs that prompt on
+// their terminal rather than either (e.g. psql, mysql) need UsePty.
+type Auth struct {
+	// Steps are answered in order, each once.
+	Steps []AuthStep
+
+	// TimeOut limits the wait for all the Steps to be answered.  If zero,
+	// a default of a few seconds is used.
+	TimeOut time.Duration
+}
+
+// AuthStep answers one prompt of a CLI logging in.
+type AuthStep struct {
+	// Prompt matches the prompt: the CLI's unfinished line of output, i.e.
+	// what it shows while it waits for input, or a complete line.  The
+	// line is removed from the output.
+	// Example: regexp.MustCompile(`^Password: ?$`)
+	Prompt *regexp.Regexp
+
+	// Answer returns what to type at the prompt, without a linefeed, given
+	// the prompt's line.  It's called when the prompt shows up, so it can
+	// fetch a token, or ask a person for a one-time code.  An error fails
+	// the CLI's start.  Answers aren't logged.
+	Answer func(prompt string) (string, error)
+
+	// Stream is where the prompt shows up: StreamOut, the default, or
+	// StreamErr.
+	Stream Stream
+}
+
+// PasswordStep returns an AuthStep answering the prompt matched by the
+// given regular expression with the given password.
+func PasswordStep(prompt, password string) AuthStep {
+	return AuthStep{
+		Prompt: regexp.MustCompile(prompt),
+		Answer: func(string) (string, error) { return password, nil },
+	}
+}
+
+// CallbackStep returns an AuthStep answering the prompt matched by the
+// given regular expression with whatever the callback returns, e.g. a
+// token read from a vault, or a one-time code.
+func CallbackStep(
+	prompt string, answer func(prompt string) (string, error)) AuthStep {
+	return AuthStep{Prompt: regexp.MustCompile(prompt), Answer: answer}
+}
+
+// PsqlPasswordAuth returns an Auth answering psql's password prompt, for
+// use with UsePty.
+func PsqlPasswordAuth(password string) *Auth {
+	return &Auth{Steps: []AuthStep{
+		PasswordStep(`^Password( for user \S+)?: ?$`, password)}}
+}
+
+// MysqlPasswordAuth returns an Auth answering mysql's password prompt, for
+// use with UsePty.
+func MysqlPasswordAuth(password string) *Auth {
+	return &Auth{Steps: []AuthStep{
+		PasswordStep(`^Enter password: ?$`, password)}}
+}
+
+// LoginAuth returns an Auth answering "login:" and "password:" prompts,
+// in either case, on the given stream, e.g. StreamErr for CLIs that do
+// their handshake there.
+func LoginAuth(stream Stream, user, password string) *Auth {
+	login := PasswordStep(`(?i)login: ?$`, user)
+	pass := PasswordStep(`(?i)password: ?$`, password)
+	login.Stream, pass.Stream = stream, stream
+	return &Auth{Steps: []AuthStep{login, pass}}
+}
+
+// validate looks for trouble.
+func (a *Auth) validate() error {
+	for i, s := range a.Steps {
+		if s.Prompt == nil {
+			return fmt.Errorf("Auth step %d has no Prompt", i)
+		}
+		if s.Answer == nil {
+			return fmt.Errorf("Auth step %d has no Answer", i)
+		}
+		if s.Stream != StreamOut && s.Stream != StreamErr {
+			return fmt.Errorf("Auth step %d has unknown Stream %d", i, int(s.Stream))
+		}
+	}
+	if a.TimeOut < 0 {
+		return fmt.Errorf("Auth TimeOut %s can't be negative", a.TimeOut)
+	}
+	return nil
+}
+
+// authWatch answers the prompts of the Auth steps on the CLI's stdIn as
+// the CLI starts, in order, each once.
+type authWatch struct {
+	stdIn io.Writer
+	m     sync.Mutex // guards steps and err, as stdOut and stdErr are read apart
+	steps []AuthStep // not yet answered
+	// done is closed once all the steps are answered, or one fails, per
+	// err.
+	done chan struct{}
+	err  error
+}
+
+// newAuthWatch returns a watch answering the given Auth's prompts, or nil
+// if there's nothing to answer.
+func newAuthWatch(stdIn io.Writer, a *Auth) *authWatch {
+	if a == nil || len(a.Steps) == 0 {
+		return nil
+	}
+	return &authWatch{stdIn: stdIn, steps: a.Steps, done: make(chan struct{})}
+}
+
+// watch returns r, which is the given stream, wrapped to answer the
+// prompts of the steps watching it.
+func (w *authWatch) watch(r io.Reader, stream Stream) io.Reader {
+	if w == nil {
+		return r
+	}
+	return &promptWatch{r: r, active: w.active,
+		answer: func(line []byte) (bool, error) { return w.answer(stream, line) }}
+}
+
+// active returns true while there are steps to answer.
+func (w *authWatch) active() bool {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return len(w.steps) > 0
+}
+
+// answer answers the next step, if the line, from the given stream, is its
+// prompt.
+func (w *authWatch) answer(stream Stream, line []byte) (bool, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	if len(w.steps) == 0 {
+		return false, nil
+	}
+	s := w.steps[0]
+	if s.Stream != stream || !s.Prompt.Match(line) {
+		return false, nil
+	}
+	a, err := s.Answer(string(line))
+	if err == nil {
+		_, err = io.WriteString(w.stdIn, a+string(lineFeed))
+	}
+	if err != nil {
+		err = fmt.Errorf("answering prompt %q; %w", s.Prompt, err)
+		w.finish(err)
+		return false, err
+	}
+	w.steps = w.steps[1:]
+	if len(w.steps) == 0 {
+		w.finish(nil)
+	}
+	return true, nil
+}
+
+// finish ends the login with the given outcome.  The caller must hold m.
+func (w *authWatch) finish(err error) {
+	w.err = err
+	w.steps = nil
+	close(w.done)
+}
+
+// awaitAuth waits for the CLI to log in, per Parameters.Auth.  The caller
+// must hold mutexState.
+func (pr *ProcRunner) awaitAuth() error {
+	w := pr.auth
+	if w == nil {
+		return nil
+	}
+	d := pr.params.Auth.TimeOut
+	if d == 0 {
+		d = defaultSentinelDuration
+	}
+	t := pr.filter.clock.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-w.done:
+		w.m.Lock()
+		defer w.m.Unlock()
+		if w.err != nil {
+			return fmt.Errorf("logging in; %w", w.err)
+		}
+		return nil
+	case <-pr.exited:
+		return fmt.Errorf("CLI exited while logging in")
+	case <-t.C():
+		return fmt.Errorf("CLI didn't finish logging in within %s", d)
+	}
+}
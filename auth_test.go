@@ -0,0 +1,135 @@
+package clirunner_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunner_Auth(t *testing.T) {
+	var otpPrompt string
+	h := makeHarness(t, func(p *Parameters) {
+		p.Auth = &Auth{Steps: []AuthStep{
+			PasswordStep(`^Password:$`, "s3cret"),
+			CallbackStep(`^Code for (\w+):$`, func(p string) (string, error) {
+				otpPrompt = p
+				return "123456", nil
+			}),
+		}}
+	})
+	c := NewHoardingCommander("list")
+	result := runAsync(h, c, time.Hour)
+	assert.NoError(t, h.Out("Welcome", "Password:"))
+	expectCommands(t, h, "s3cret")
+	assert.NoError(t, h.Out("Code for alice:"))
+	expectCommands(t, h, "123456", "list", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("tables", "Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	assert.Equal(t, "Code for alice:", otpPrompt)
+	// The prompts don't show up in the output.
+	assert.Equal(t, "Welcome\ntables\n", c.Result())
+	assert.NoError(t, h.Runner.Close())
+}
+
+func TestRunner_AuthTimeout(t *testing.T) {
+	h := makeHarness(t, func(p *Parameters) {
+		p.Auth = &Auth{
+			Steps:   []AuthStep{PasswordStep(`^Password:$`, "s3cret")},
+			TimeOut: time.Minute,
+		}
+	})
+	result := runAsync(h, NewHoardingCommander("list"), time.Hour)
+	assert.NoError(t, h.Out("Welcome"))
+	h.Clock.AwaitTimers(1)
+	h.Clock.Advance(time.Minute)
+	err := <-result
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "didn't finish logging in within 1m0s")
+	_ = h.Runner.Close()
+}
+
+func TestRunner_AuthAnswerFails(t *testing.T) {
+	h := makeHarness(t, func(p *Parameters) {
+		p.Auth = &Auth{Steps: []AuthStep{
+			CallbackStep(`^Token:$`, func(string) (string, error) {
+				return "", fmt.Errorf("vault is sealed")
+			}),
+		}}
+	})
+	result := runAsync(h, NewHoardingCommander("list"), time.Hour)
+	assert.NoError(t, h.Out("Token:"))
+	err := <-result
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "vault is sealed")
+	_ = h.Runner.Close()
+}
+
+func TestRunner_AuthUnfinishedLine(t *testing.T) {
+	// The prompt has no linefeed, as the CLI waits for the answer on the
+	// same line.
+	script := strings.Join([]string{
+		`printf "Password: "`,
+		`read p`,
+		`[ "$p" = s3cret ] && exec sh`,
+	}, "; ")
+	runner, err := NewProcRunner(&Parameters{
+		Path:        "sh",
+		Args:        []string{"-c", script},
+		ExitCommand: "exit",
+		OutSentinel: &SimpleSentinelCommander{
+			Command: "echo Rumpelstiltskin",
+			Value:   "Rumpelstiltskin",
+		},
+		Auth: PsqlPasswordAuth("s3cret"),
+	})
+	assert.NoError(t, err)
+	c := NewHoardingCommander("echo in")
+	assert.NoError(t, runner.RunIt(c, testingTimeout))
+	assert.Equal(t, "in\n", c.Result())
+	assert.NoError(t, runner.Close())
+}
+
+func TestRunner_AuthOnStdErr(t *testing.T) {
+	script := strings.Join([]string{
+		`printf "login: " >&2`,
+		`read u`,
+		`printf "Password: " >&2`,
+		`read p`,
+		`[ "$u" = alice ] && [ "$p" = s3cret ] && exec sh`,
+	}, "; ")
+	runner, err := NewProcRunner(&Parameters{
+		Path:        "sh",
+		Args:        []string{"-c", script},
+		ExitCommand: "exit",
+		OutSentinel: &SimpleSentinelCommander{
+			Command: "echo Rumpelstiltskin",
+			Value:   "Rumpelstiltskin",
+		},
+		Auth: LoginAuth(StreamErr, "alice", "s3cret"),
+	})
+	assert.NoError(t, err)
+	c := NewHoardingCommander("echo in")
+	assert.NoError(t, runner.RunIt(c, testingTimeout))
+	assert.Equal(t, "in\n", c.Result())
+	assert.NoError(t, runner.Close())
+}
+
+func TestAuth_BadStream(t *testing.T) {
+	a := LoginAuth(Stream(7), "alice", "s3cret")
+	_, err := NewProcRunner(&Parameters{
+		Path:        "sh",
+		ExitCommand: "exit",
+		OutSentinel: &SimpleSentinelCommander{
+			Command: "echo Rumpelstiltskin",
+			Value:   "Rumpelstiltskin",
+		},
+		Auth: a,
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Auth step 0 has unknown Stream 7")
+}
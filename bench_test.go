@@ -0,0 +1,100 @@
+package clirunner_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+)
+
+// benchLinesPerRun is how many lines each benchmarked run produces, enough
+// that the cost of a run's sentinel round trip is in the noise.
+const benchLinesPerRun = 1000
+
+// countingCommander counts what it's given, and does nothing else, so
+// that benchmarks measure the runner, not the Commander.
+type countingCommander struct {
+	lines, bytes int
+}
+
+func (c *countingCommander) String() string { return "produce" }
+
+func (c *countingCommander) Write(data []byte) (int, error) {
+	c.lines++
+	c.bytes += len(data)
+	return len(data), nil
+}
+
+func (c *countingCommander) Success() bool { return c.lines > 0 }
+
+func (c *countingCommander) Reset() { c.lines, c.bytes = 0, 0 }
+
+// BenchmarkRunner_Lines measures lines per second through the runner, from
+// the scanners, through the filter, to the Commander, for various line
+// sizes.  The CLI is simulated by a Harness, so no subprocess's speed is
+// measured.  See hack/bench.sh for comparing runs against the baseline.
+func BenchmarkRunner_Lines(b *testing.B) {
+	for _, size := range []int{16, 128, 1024, 8192} {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			benchmarkLines(b, size, &countingCommander{})
+		})
+	}
+}
+
+// BenchmarkRunner_Discarded is like BenchmarkRunner_Lines, for a Commander
+// that discards its output.
+func BenchmarkRunner_Discarded(b *testing.B) {
+	for _, size := range []int{16, 128, 1024, 8192} {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			benchmarkLines(b, size, &discardingCommander{})
+		})
+	}
+}
+
+// discardingCommander is a countingCommander that says it discards its
+// output, so it gets nothing.
+type discardingCommander struct {
+	countingCommander
+}
+
+func (c *discardingCommander) Discard() bool { return true }
+
+func benchmarkLines(b *testing.B, size int, c Commander) {
+	h := makeHarness(b)
+	lines := make([]string, benchLinesPerRun, benchLinesPerRun+1)
+	for i := range lines {
+		lines[i] = strings.Repeat("x", size)
+	}
+	lines = append(lines, "Rumpelstiltskin")
+	b.SetBytes(int64(benchLinesPerRun * (size + 1)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		c.Reset()
+		result := make(chan error, 1)
+		go func() { result <- h.Runner.RunIt(c, time.Hour) }()
+		for j := 0; j < 2; j++ {
+			if _, err := h.ReadCommand(); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if err := h.Out(lines...); err != nil {
+			b.Fatal(err)
+		}
+		if err := <-result; err != nil {
+			b.Fatal(err)
+		}
+		if r, _ := h.Runner.LastRunReport(); r.LinesOut != benchLinesPerRun {
+			b.Fatalf("got %d lines, want %d", r.LinesOut, benchLinesPerRun)
+		}
+	}
+	b.StopTimer()
+	b.ReportMetric(
+		float64(b.N*benchLinesPerRun)/time.Since(start).Seconds(), "lines/s")
+	if err := h.Runner.Close(); err != nil {
+		b.Fatal(err)
+	}
+}
@@ -0,0 +1,28 @@
+package clirunner
+
+// Checkpointer is an optional interface for a Commander whose state, e.g.
+// totals aggregated from the output of its command, should survive the
+// process running it.
+//
+// A WorkSet with a Journal checkpoints the Commander of each item that
+// succeeds, keeping the checkpoint in the Journal, and restores the
+// Commanders of the items it resumes from their checkpoints, so that an
+// aggregation across hundreds of items survives restarts.  An item whose
+// Commander can't be restored is run again.
+type Checkpointer interface {
+	// Checkpoint returns the Commander's state.
+	Checkpoint() ([]byte, error)
+	// Restore sets the Commander's state to that of a Checkpoint.
+	Restore(data []byte) error
+}
+
+// checkpointerOf returns the Commander, or one it wraps, that's a
+// Checkpointer, or nil if none is.
+func checkpointerOf(c Commander) Checkpointer {
+	for ; c != nil; c = unwrap(c) {
+		if cp, ok := c.(Checkpointer); ok {
+			return cp
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+// Package cliruntest runs clirunner sessions inside Go tests, for
+// integration tests against real CLIs.  StartRunner ties a ProcRunner to a
+// test, closing it as the test ends, and logging what it knows of the
+// session if the test failed.
+//
+//	r := cliruntest.StartRunner(t, &clirunner.Parameters{...})
+//	out := r.RunAndExpect("status", clirunner.Expectation{
+//		Match: []*regexp.Regexp{regexp.MustCompile(`^ready$`)},
+//	})
+package cliruntest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/monopole/clirunner"
+	"github.com/monopole/clirunner/cmdrs"
+)
+
+// DefaultTimeOut is the TimeOut of a Runner from StartRunner.
+const DefaultTimeOut = time.Minute
+
+// Runner is a ProcRunner belonging to a test.
+type Runner struct {
+	*clirunner.ProcRunner
+
+	// TimeOut limits each run of Run and RunAndExpect.
+	TimeOut time.Duration
+
+	t     testing.TB
+	debug *debugLog
+}
+
+// StartRunner returns a Runner with the given Parameters, failing the test
+// now if they're bad.  As with any ProcRunner, the CLI starts on the first
+// run.
+//
+// The runner is closed in the test's Cleanup, which shuts the CLI down,
+// forcibly if need be, so no subprocess outlives the test.  An error
+// closing fails the test.  If the test failed, the runner's SessionReport
+// and debug output are logged first.  The debug output is captured as well
+// as sent to the Parameters' DebugWriter, if any.  The Parameters aren't
+// changed.
+func StartRunner(t testing.TB, params *clirunner.Parameters) *Runner {
+	t.Helper()
+	p := *params
+	debug := &debugLog{next: p.DebugWriter}
+	p.DebugWriter = debug
+	pr, err := clirunner.NewProcRunner(&p)
+	if err != nil {
+		t.Fatalf("making runner for %s: %v", params.Path, err)
+	}
+	r := &Runner{ProcRunner: pr, TimeOut: DefaultTimeOut, t: t, debug: debug}
+	t.Cleanup(r.cleanup)
+	return r
+}
+
+// cleanup logs the session if the test failed, then closes the runner.
+func (r *Runner) cleanup() {
+	if r.t.Failed() {
+		r.logDiagnostics()
+	}
+	if err := r.Close(); err != nil {
+		r.t.Errorf("closing runner %s: %v", r.Name(), err)
+	}
+}
+
+// logDiagnostics logs the runner's SessionReport and debug output.
+func (r *Runner) logDiagnostics() {
+	report, err := json.MarshalIndent(r.Report(), "", "  ")
+	if err != nil {
+		r.t.Logf("runner %s: reporting: %v", r.Name(), err)
+	} else {
+		r.t.Logf("runner %s session:\n%s", r.Name(), report)
+	}
+	if log := r.debug.String(); log != "" {
+		r.t.Logf("runner %s debug output:\n%s", r.Name(), log)
+	}
+}
+
+// Run runs the command, returning its output on stdOut and stdErr, one
+// line per line.  An error from the run fails the test.
+func (r *Runner) Run(command string) string {
+	r.t.Helper()
+	c := cmdrs.NewHoardingCommander(command)
+	if err := r.RunIt(c, r.TimeOut); err != nil {
+		r.t.Errorf("running %q: %v", command, err)
+	}
+	return c.Result()
+}
+
+// RunAndExpect is Run, failing the test if the output doesn't meet the
+// Expectation too.
+func (r *Runner) RunAndExpect(command string, e clirunner.Expectation) string {
+	r.t.Helper()
+	c := cmdrs.NewHoardingCommander(command)
+	if err := r.RunIt(clirunner.WithExpectation(c, e), r.TimeOut); err != nil {
+		r.t.Errorf("running %q: %v\noutput:\n%s", command, err, c.Result())
+	}
+	return c.Result()
+}
+
+// debugLog keeps a runner's debug output, passing it on to next, if not
+// nil.
+type debugLog struct {
+	m    sync.Mutex
+	buf  bytes.Buffer
+	next io.Writer
+}
+
+func (d *debugLog) Write(p []byte) (int, error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	d.buf.Write(p)
+	if d.next != nil {
+		return d.next.Write(p)
+	}
+	return len(p), nil
+}
+
+func (d *debugLog) String() string {
+	d.m.Lock()
+	defer d.m.Unlock()
+	return d.buf.String()
+}
@@ -0,0 +1,79 @@
+package cliruntest_test
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cliruntest"
+	"github.com/monopole/clirunner/internal/testcli/tstcli"
+	"github.com/stretchr/testify/assert"
+)
+
+func testCliParams() *clirunner.Parameters {
+	return &clirunner.Parameters{
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+		ErrSentinel: tstcli.MakeErrSentinelCommander(),
+	}
+}
+
+// fakeT is a test whose failures and Cleanups are recorded rather than
+// acted on.
+type fakeT struct {
+	testing.TB
+	failed   bool
+	logs     []string
+	cleanups []func()
+}
+
+func (f *fakeT) Helper()           {}
+func (f *fakeT) Failed() bool      { return f.failed }
+func (f *fakeT) Cleanup(fn func()) { f.cleanups = append(f.cleanups, fn) }
+
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.failed = true
+	f.Logf(format, args...)
+}
+
+func (f *fakeT) Logf(format string, args ...interface{}) {
+	f.logs = append(f.logs, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeT) cleanUp() {
+	for i := len(f.cleanups) - 1; i >= 0; i-- {
+		f.cleanups[i]()
+	}
+}
+
+func TestStartRunner(t *testing.T) {
+	r := StartRunner(t, testCliParams())
+	out := r.RunAndExpect(tstcli.CmdQuery+" limit 2", clirunner.Expectation{
+		Match:    []*regexp.Regexp{regexp.MustCompile(`_\|_`)},
+		MinLines: 2,
+		MaxLines: 2,
+	})
+	assert.Contains(t, out, "_|_00000000000000000000000000000002\n")
+	assert.Equal(t, "hello\n", r.Run(tstcli.CmdEcho+" hello"))
+}
+
+func TestStartRunner_Failure(t *testing.T) {
+	ft := &fakeT{}
+	r := StartRunner(ft, testCliParams())
+	r.RunAndExpect(tstcli.CmdEcho+" hello", clirunner.Expectation{
+		Match: []*regexp.Regexp{regexp.MustCompile(`goodbye`)}})
+	assert.True(t, ft.failed)
+	assert.Contains(t, ft.logs[0], `no line matched "goodbye"`)
+	assert.Contains(t, ft.logs[0], "output:\nhello\n")
+	assert.Len(t, ft.cleanups, 1)
+
+	ft.cleanUp()
+	assert.Len(t, ft.logs, 3)
+	assert.Contains(t, ft.logs[1], `"runCount": 1`)
+	assert.Contains(t, ft.logs[2], "debug output")
+	// Closed.
+	assert.Equal(t, "uninitialized", r.Report().State)
+}
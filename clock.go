@@ -0,0 +1,145 @@
+package clirunner
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells time for a ProcRunner, i.e. when runs start and when their
+// time limits expire, so that tests can control it.  See FakeClock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTimer returns a Timer whose channel gets the time once d has
+	// passed.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a single event from a Clock, like time.Timer.
+type Timer interface {
+	// C returns the channel getting the time when the Timer fires.
+	C() <-chan time.Time
+	// Stop keeps the Timer from firing, returning false if it already
+	// fired or was stopped.
+	Stop() bool
+}
+
+// realClock is the Clock of the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+// realTimer is a time.Timer.
+type realTimer struct {
+	t *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time { return t.t.C }
+
+func (t realTimer) Stop() bool { return t.t.Stop() }
+
+// clockOrReal returns the given Clock, or the real one if it's nil.
+func clockOrReal(c Clock) Clock {
+	if c == nil {
+		return realClock{}
+	}
+	return c
+}
+
+// FakeClock is a Clock that only moves when told to, for tests.
+type FakeClock struct {
+	m       sync.Mutex
+	now     time.Time
+	timers  []*fakeTimer // pending, in no particular order
+	changed *sync.Cond
+}
+
+// fakeTimer is a Timer of a FakeClock.
+type fakeTimer struct {
+	c  *FakeClock
+	at time.Time
+	ch chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTimer) Stop() bool {
+	t.c.m.Lock()
+	defer t.c.m.Unlock()
+	for i, p := range t.c.timers {
+		if p == t {
+			t.c.timers = append(t.c.timers[:i], t.c.timers[i+1:]...)
+			t.c.changed.Broadcast()
+			return true
+		}
+	}
+	return false
+}
+
+// NewFakeClock returns a FakeClock showing the given time.
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.changed = sync.NewCond(&c.m)
+	return c
+}
+
+// Now returns the clock's time.
+func (c *FakeClock) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.now
+}
+
+// NewTimer returns a Timer firing once the clock is advanced by at least
+// d.  If d isn't positive, it fires at once.
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	c.m.Lock()
+	defer c.m.Unlock()
+	t := &fakeTimer{c: c, at: c.now.Add(d), ch: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.ch <- c.now
+		return t
+	}
+	c.timers = append(c.timers, t)
+	c.changed.Broadcast()
+	return t
+}
+
+// Advance moves the clock forward by d, firing the timers that come due.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.now = c.now.Add(d)
+	var pending []*fakeTimer
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.ch <- c.now
+	}
+	c.timers = pending
+	c.changed.Broadcast()
+}
+
+// Timers returns the number of Timers that haven't fired or been stopped.
+func (c *FakeClock) Timers() int {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return len(c.timers)
+}
+
+// AwaitTimers blocks until at least n Timers haven't fired or been
+// stopped, e.g. until a run is waiting for its sentinels, so that advancing
+// the clock expires it.
+func (c *FakeClock) AwaitTimers(n int) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	for len(c.timers) < n {
+		c.changed.Wait()
+	}
+}
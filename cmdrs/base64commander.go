@@ -0,0 +1,136 @@
+package cmdrs
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+)
+
+// Base64Commander decodes blocks of base64 data in a command's output,
+// writing the decoded bytes to an io.Writer (e.g. a file).  This allows
+// binary artifacts to be retrieved through a CLI that only emits text.
+//
+// A block starts after a line equal to Begin, and ends at a line equal to
+// End.  Lines outside blocks are ignored.  The decoded bytes of all blocks
+// are written to the same Writer, in order.
+type Base64Commander struct {
+	Command string // the command, e.g. "select to_base64(image) ..."
+	Begin   string // the line before a block, e.g. "-----BEGIN DATA-----"
+	End     string // the line after a block, e.g. "-----END DATA-----"
+	out     io.Writer
+	inBlock bool
+	pending []byte // base64 characters short of a full quantum
+	blocks  int    // blocks decoded before any trouble
+	written int    // bytes written to out
+	err     error  // the first trouble seen
+	Tally
+}
+
+// NewBase64Commander returns a new instance of Base64Commander.
+func NewBase64Commander(
+	c string, begin string, end string, out io.Writer) *Base64Commander {
+	return &Base64Commander{Command: c, Begin: begin, End: end, out: out}
+}
+
+func (c *Base64Commander) String() string { return c.Command }
+
+// Write decodes lines inside a block.  Trouble decoding or writing is
+// noted, rather than returned, since the CLI itself is fine; see Err and
+// Problems.
+// Nothing more is decoded after trouble.
+//
+// For a SuccessPolicy, the lines of a block, including Begin and End, are
+// parsed, and an End that completes a block matches.
+func (c *Base64Commander) Write(b []byte) (int, error) {
+	blocks, inBlock, hadErr := c.blocks, c.inBlock, c.err != nil
+	defer func() {
+		c.count(b, inBlock || c.inBlock, c.blocks > blocks)
+		if !hadErr && c.err != nil {
+			c.problem(b, c.err.Error())
+		}
+	}()
+	line := string(bytes.TrimSpace(b))
+	if !c.inBlock {
+		if line == c.Begin {
+			c.inBlock = true
+			c.pending = nil
+		}
+		return 0, nil
+	}
+	if line == c.End {
+		c.inBlock = false
+		if len(c.pending) > 0 {
+			c.noteErr(fmt.Errorf(
+				"block %d ends with partial base64 %q", c.blocks+1, c.pending))
+			return 0, nil
+		}
+		if c.err == nil {
+			c.blocks++
+		}
+		return 0, nil
+	}
+	c.pending = append(c.pending, line...)
+	n := len(c.pending) / 4 * 4
+	if n == 0 || c.err != nil {
+		return 0, nil
+	}
+	decoded := make([]byte, base64.StdEncoding.DecodedLen(n))
+	m, err := base64.StdEncoding.Decode(decoded, c.pending[:n])
+	c.pending = c.pending[n:]
+	if err != nil {
+		c.noteErr(fmt.Errorf("decoding block %d; %w", c.blocks+1, err))
+		return 0, nil
+	}
+	m, err = c.out.Write(decoded[:m])
+	c.written += m
+	if err != nil {
+		c.noteErr(fmt.Errorf("writing block %d; %w", c.blocks+1, err))
+	}
+	return 0, nil
+}
+
+// noteErr keeps the first error seen.
+func (c *Base64Commander) noteErr(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// Reset forgets the blocks seen, so the instance can be used in another
+// run.  Bytes already written to the Writer stay written.
+func (c *Base64Commander) Reset() {
+	c.inBlock = false
+	c.pending = nil
+	c.blocks = 0
+	c.written = 0
+	c.err = nil
+	c.resetTally()
+}
+
+// Success returns true if at least one block was decoded, and there was
+// no trouble, unless the Policy says otherwise.
+func (c *Base64Commander) Success() bool {
+	return c.succeeded(c.blocks > 0 && !c.inBlock && c.err == nil)
+}
+
+// Blocks returns the number of blocks decoded before any trouble.
+func (c *Base64Commander) Blocks() int { return c.blocks }
+
+// Written returns the number of decoded bytes written to the Writer.
+func (c *Base64Commander) Written() int { return c.written }
+
+// Err returns the first trouble seen decoding or writing, if any.
+func (c *Base64Commander) Err() error { return c.err }
+
+// ResultKind returns "base64".
+func (c *Base64Commander) ResultKind() string { return "base64" }
+
+// ResultData returns a Base64Data.
+func (c *Base64Commander) ResultData() interface{} {
+	d := Base64Data{Blocks: c.blocks, Written: c.written}
+	if c.err != nil {
+		d.Err = c.err.Error()
+	}
+	return d
+}
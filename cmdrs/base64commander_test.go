@@ -0,0 +1,84 @@
+package cmdrs_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBase64Commander(t *testing.T) {
+	const (
+		begin = "-----BEGIN-----"
+		end   = "-----END-----"
+	)
+	binary := []byte{0, 1, 2, 0xfe, 0xff, '\n', 42}
+	encoded := base64.StdEncoding.EncodeToString(binary)
+	var testCases = map[string]struct {
+		input     []string
+		expected  []byte
+		blocks    int
+		expectErr bool
+		success   bool
+	}{
+		"oneBlock": {
+			input:    []string{"noise", begin, encoded, end, "more noise"},
+			expected: binary,
+			blocks:   1,
+			success:  true,
+		},
+		"splitAcrossLines": {
+			input:    []string{begin, encoded[:3], encoded[3:7], encoded[7:], end},
+			expected: binary,
+			blocks:   1,
+			success:  true,
+		},
+		"twoBlocks": {
+			input: []string{
+				begin, "aGVs", end, "noise", begin, " bG8= ", end},
+			expected: []byte("hello"),
+			blocks:   2,
+			success:  true,
+		},
+		"noBlocks": {
+			input: []string{"noise", encoded},
+		},
+		"unterminated": {
+			input:    []string{begin, "aGVs"},
+			expected: []byte("hel"),
+		},
+		"partial": {
+			input:     []string{begin, "aGVsb", end},
+			expected:  []byte("hel"),
+			expectErr: true,
+		},
+		"corrupt": {
+			input:     []string{begin, "a!Vs", end},
+			expectErr: true,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			var out bytes.Buffer
+			c := NewBase64Commander("fetch", begin, end, &out)
+			assert.Equal(t, "fetch", c.String())
+			for i := range tc.input {
+				assert.NoError(t, WriteString(c, tc.input[i]))
+			}
+			assert.Equal(t, tc.expected, out.Bytes())
+			assert.Equal(t, len(tc.expected), c.Written())
+			assert.Equal(t, tc.blocks, c.Blocks())
+			if tc.expectErr {
+				assert.Error(t, c.Err())
+			} else {
+				assert.NoError(t, c.Err())
+			}
+			assert.Equal(t, tc.success, c.Success())
+			c.Reset()
+			assert.False(t, c.Success())
+			assert.NoError(t, c.Err())
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package cmdrs
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+)
+
+// FileCommander writes a command's output to files, one line per line,
+// rather than keeping it in memory, e.g. to archive a large export.
+//
+// The output goes to Path, until it holds MaxBytes; then to Path.1,
+// Path.2 etc.  Lines aren't split across files.  With Compress, the files
+// are gzipped, and named with ".gz" appended.  Existing files are
+// overwritten.
+//
+// The last file is finished by Close, or Result.
+type FileCommander struct {
+	Command string // the command, e.g. "export --all"
+	Path    string // the first file, e.g. "/tmp/export.csv"
+
+	// MaxBytes, if positive, is the most bytes of output, including
+	// linefeeds, in a file before the next one is started.  A longer line
+	// gets a file of its own.  With Compress, it's the bytes before
+	// compression.
+	MaxBytes int64
+
+	// Compress, if true, gzips the files.
+	Compress bool
+
+	f       *os.File
+	buf     *bufio.Writer
+	w       io.Writer // buf, or a gzip.Writer on it
+	size    int64     // bytes written to the current file
+	paths   []string
+	written int64 // bytes written to all files
+	err     error // the first trouble seen
+	Tally
+}
+
+var newline = []byte{'\n'}
+
+// NewFileCommander returns a new instance of FileCommander.
+func NewFileCommander(c string, path string) *FileCommander {
+	return &FileCommander{Command: c, Path: path}
+}
+
+func (c *FileCommander) String() string { return c.Command }
+
+// Write writes the line to the current file, starting the next one first
+// if the line doesn't fit.  Trouble writing is noted, rather than
+// returned, as for a Base64Commander; see Err and Problems.  Nothing more
+// is written after trouble.
+func (c *FileCommander) Write(b []byte) (int, error) {
+	c.count(b, true, false)
+	if c.err != nil {
+		return 0, nil
+	}
+	n := int64(len(b)) + 1
+	if c.f != nil && c.MaxBytes > 0 && c.size > 0 && c.size+n > c.MaxBytes {
+		c.closeFile()
+	}
+	if c.f == nil && c.err == nil {
+		c.openFile()
+	}
+	if c.err == nil {
+		_, err := c.w.Write(b)
+		if err == nil {
+			_, err = c.w.Write(newline)
+		}
+		if err != nil {
+			c.noteErr(fmt.Errorf("writing %s; %w", c.f.Name(), err))
+		}
+		c.size += n
+		c.written += n
+	}
+	if c.err != nil {
+		c.problem(b, c.err.Error())
+	}
+	return 0, nil
+}
+
+// fileName returns the name of the n'th file, from 0.
+func (c *FileCommander) fileName(n int) string {
+	name := c.Path
+	if n > 0 {
+		name = fmt.Sprintf("%s.%d", name, n)
+	}
+	if c.Compress {
+		name += ".gz"
+	}
+	return name
+}
+
+// openFile starts the next file.
+func (c *FileCommander) openFile() {
+	name := c.fileName(len(c.paths))
+	f, err := os.Create(name)
+	if err != nil {
+		c.noteErr(err)
+		return
+	}
+	c.f, c.size = f, 0
+	c.buf = bufio.NewWriter(f)
+	c.w = c.buf
+	if c.Compress {
+		c.w = gzip.NewWriter(c.buf)
+	}
+	c.paths = append(c.paths, name)
+}
+
+// closeFile finishes the current file, if any.
+func (c *FileCommander) closeFile() {
+	if c.f == nil {
+		return
+	}
+	name := c.f.Name()
+	if z, ok := c.w.(*gzip.Writer); ok {
+		if err := z.Close(); err != nil {
+			c.noteErr(fmt.Errorf("compressing %s; %w", name, err))
+		}
+	}
+	if err := c.buf.Flush(); err != nil {
+		c.noteErr(fmt.Errorf("writing %s; %w", name, err))
+	}
+	if err := c.f.Close(); err != nil {
+		c.noteErr(fmt.Errorf("closing %s; %w", name, err))
+	}
+	c.f, c.buf, c.w = nil, nil, nil
+}
+
+// noteErr keeps the first error seen.
+func (c *FileCommander) noteErr(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// Close finishes the current file, returning the first trouble seen, if
+// any.  Output written afterwards goes to the next file.
+func (c *FileCommander) Close() error {
+	c.closeFile()
+	return c.err
+}
+
+// Result finishes the current file, and returns the paths of the files
+// written, in order.
+func (c *FileCommander) Result() []string {
+	c.closeFile()
+	return append([]string(nil), c.paths...)
+}
+
+// Reset finishes the current file, and forgets the files written, so the
+// instance can be used in another run, which writes its files afresh.
+func (c *FileCommander) Reset() {
+	c.closeFile()
+	c.paths = nil
+	c.written = 0
+	c.err = nil
+	c.resetTally()
+}
+
+// Success returns true if there was no trouble, unless the Policy says
+// otherwise.
+func (c *FileCommander) Success() bool { return c.succeeded(c.err == nil) }
+
+// Written returns the number of bytes written to the files, before any
+// compression.
+func (c *FileCommander) Written() int64 { return c.written }
+
+// Err returns the first trouble seen writing, if any.
+func (c *FileCommander) Err() error { return c.err }
+
+// ResultKind returns "file".
+func (c *FileCommander) ResultKind() string { return "file" }
+
+// ResultData returns a FileData.
+func (c *FileCommander) ResultData() interface{} {
+	d := FileData{Paths: append([]string{}, c.paths...), Written: c.written}
+	if c.err != nil {
+		d.Err = c.err.Error()
+	}
+	return d
+}
@@ -0,0 +1,109 @@
+package cmdrs_test
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+// readFile returns the contents of the file, gunzipped if need be.
+func readFile(t *testing.T, path string, gzipped bool) string {
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	var r io.Reader = f
+	if gzipped {
+		z, err := gzip.NewReader(f)
+		assert.NoError(t, err)
+		r = z
+	}
+	b, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	return string(b)
+}
+
+func TestFileCommander(t *testing.T) {
+	var testCases = map[string]struct {
+		maxBytes int64
+		compress bool
+		input    []string
+		files    []string // the contents of the files written, in order
+	}{
+		"oneFile": {
+			input: []string{"a", "bb", "ccc"},
+			files: []string{"a\nbb\nccc\n"},
+		},
+		"rotated": {
+			maxBytes: 5,
+			input:    []string{"a", "bb", "ccc", "d"},
+			files:    []string{"a\nbb\n", "ccc\n", "d\n"},
+		},
+		"longLine": {
+			maxBytes: 3,
+			input:    []string{"a", "bbbbb", "c"},
+			files:    []string{"a\n", "bbbbb\n", "c\n"},
+		},
+		"compressed": {
+			maxBytes: 5,
+			compress: true,
+			input:    []string{"a", "bb", "ccc"},
+			files:    []string{"a\nbb\n", "ccc\n"},
+		},
+		"noOutput": {},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "export.csv")
+			c := NewFileCommander("export", path)
+			c.MaxBytes, c.Compress = tc.maxBytes, tc.compress
+			for _, l := range tc.input {
+				_, err := c.Write([]byte(l))
+				assert.NoError(t, err)
+			}
+			assert.True(t, c.Success())
+			assert.NoError(t, c.Err())
+			paths := c.Result()
+			assert.Equal(t, len(tc.files), len(paths))
+			for i, want := range tc.files {
+				if i >= len(paths) {
+					break
+				}
+				assert.Equal(t, want, readFile(t, paths[i], tc.compress))
+			}
+			if len(paths) > 1 {
+				suffix := ".1"
+				if tc.compress {
+					suffix += ".gz"
+				}
+				assert.Equal(t, path+suffix, paths[1])
+			}
+		})
+	}
+}
+
+func TestFileCommander_Trouble(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "export.csv")
+	c := NewFileCommander("export", path)
+	for _, l := range []string{"a", "b"} {
+		_, err := c.Write([]byte(l))
+		assert.NoError(t, err)
+	}
+	assert.False(t, c.Success())
+	assert.Error(t, c.Err())
+	assert.Error(t, c.Close())
+	assert.Empty(t, c.Result())
+	assert.Len(t, c.Problems(), 1)
+	assert.Equal(t, 2, c.LineTally().Lines)
+
+	c.Reset()
+	c.Path = filepath.Join(t.TempDir(), "export.csv")
+	_, _ = c.Write([]byte("a"))
+	assert.True(t, c.Success())
+	assert.Equal(t, []string{c.Path}, c.Result())
+	assert.Equal(t, int64(2), c.Written())
+}
@@ -2,13 +2,30 @@ package cmdrs
 
 import (
 	"bytes"
+	"strings"
 )
 
 // HoardingCommander keeps everything sent into Write.
 // Handy for tests, debugging etc.
+//
+// Against a chatty CLI, bound what it keeps with MaxLines or MaxBytes.
 type HoardingCommander struct {
 	data bytes.Buffer
 	KondoCommander
+
+	// MaxLines and MaxBytes, if positive, bound the lines kept, and the
+	// bytes in them, not counting linefeeds.  Lines beyond the bounds are
+	// dropped, and counted by Dropped.
+	MaxLines, MaxBytes int
+
+	// KeepFirst, if true, keeps the first lines, dropping those that
+	// follow.  Otherwise the newest lines are kept, dropping the oldest.
+	KeepFirst bool
+
+	// lines and size hold what's kept, if bounded.
+	lines   [][]byte
+	size    int
+	dropped int
 }
 
 // NewHoardingCommander returns a new instance of HoardingCommander.
@@ -18,8 +35,24 @@ func NewHoardingCommander(c string) *HoardingCommander {
 	}
 }
 
+// bounded returns true if MaxLines or MaxBytes is set.
+func (c *HoardingCommander) bounded() bool {
+	return c.MaxLines > 0 || c.MaxBytes > 0
+}
+
+// fits returns true if another n lines, of the given bytes, fit the bounds.
+func (c *HoardingCommander) fits(n, size int) bool {
+	return (c.MaxLines <= 0 || len(c.lines)+n <= c.MaxLines) &&
+		(c.MaxBytes <= 0 || c.size+size <= c.MaxBytes)
+}
+
 // Write accepts input to store in a buffer.
 func (c *HoardingCommander) Write(b []byte) (int, error) {
+	c.count(b, true, false)
+	if c.bounded() {
+		c.keep(b)
+		return 0, nil
+	}
 	_, err := c.data.Write(b)
 	if err != nil {
 		return 0, err
@@ -28,8 +61,57 @@ func (c *HoardingCommander) Write(b []byte) (int, error) {
 	return 0, c.data.WriteByte('\n')
 }
 
-// Reset clears the internal buffer.
-func (c *HoardingCommander) Reset() { c.data.Reset() }
+// keep adds a line to those kept, dropping lines per the bounds.
+func (c *HoardingCommander) keep(b []byte) {
+	tooBig := c.MaxBytes > 0 && len(b) > c.MaxBytes
+	if tooBig || (c.KeepFirst && !c.fits(1, len(b))) {
+		c.dropped++
+		return
+	}
+	for !c.fits(1, len(b)) {
+		c.size -= len(c.lines[0])
+		c.lines[0] = nil
+		c.lines = c.lines[1:]
+		c.dropped++
+	}
+	c.lines = append(c.lines, append([]byte(nil), b...))
+	c.size += len(b)
+}
+
+// Dropped returns the number of lines dropped per MaxLines and MaxBytes.
+func (c *HoardingCommander) Dropped() int { return c.dropped }
+
+// Discard returns false, since the output is kept.
+func (c *HoardingCommander) Discard() bool { return false }
+
+// Reset clears the internal buffer and line counts.
+func (c *HoardingCommander) Reset() {
+	c.data.Reset()
+	c.lines, c.size, c.dropped = nil, 0, 0
+	c.KondoCommander.Reset()
+}
 
 // Result returns the buffer contents as a string.
-func (c *HoardingCommander) Result() string { return c.data.String() }
+func (c *HoardingCommander) Result() string {
+	if !c.bounded() {
+		return c.data.String()
+	}
+	var b strings.Builder
+	for _, l := range c.lines {
+		b.Write(l)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// ResultKind returns "hoarding".
+func (c *HoardingCommander) ResultKind() string { return "hoarding" }
+
+// ResultData returns a LinesData.
+func (c *HoardingCommander) ResultData() interface{} {
+	lines := []string{}
+	if r := c.Result(); len(r) > 0 {
+		lines = strings.Split(strings.TrimSuffix(r, "\n"), "\n")
+	}
+	return LinesData{Lines: lines}
+}
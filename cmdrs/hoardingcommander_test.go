@@ -41,3 +41,54 @@ there
 		})
 	}
 }
+
+func TestHoardingCommander_Bounded(t *testing.T) {
+	var testCases = map[string]struct {
+		maxLines, maxBytes int
+		keepFirst          bool
+		expected           string
+		dropped            int
+	}{
+		"newestLines": {
+			maxLines: 2,
+			expected: "dddd\neeeee\n",
+			dropped:  3,
+		},
+		"firstLines": {
+			maxLines:  2,
+			keepFirst: true,
+			expected:  "a\nbb\n",
+			dropped:   3,
+		},
+		"newestBytes": {
+			maxBytes: 8,
+			expected: "eeeee\n",
+			dropped:  4,
+		},
+		"firstBytes": {
+			maxBytes:  8,
+			keepFirst: true,
+			expected:  "a\nbb\nccc\n",
+			dropped:   2,
+		},
+		"tooBig": {
+			maxBytes: 4,
+			expected: "dddd\n",
+			dropped:  4,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			c := NewHoardingCommander("tail")
+			c.MaxLines, c.MaxBytes, c.KeepFirst = tc.maxLines, tc.maxBytes, tc.keepFirst
+			for _, l := range []string{"a", "bb", "ccc", "dddd", "eeeee"} {
+				assert.NoError(t, WriteString(c, l))
+			}
+			assert.Equal(t, tc.expected, c.Result())
+			assert.Equal(t, tc.dropped, c.Dropped())
+			c.Reset()
+			assert.Equal(t, "", c.Result())
+			assert.Equal(t, 0, c.Dropped())
+		})
+	}
+}
@@ -1,25 +1,40 @@
 package cmdrs
 
 // KondoCommander quietly discards everything sent to Write
-// and always reports Success true.
+// and reports Success true, unless its Policy says otherwise.
 // Use this when you just want to run a command and don't care
 // about the command's output.
 type KondoCommander struct {
 	Command string
+	Tally
 }
 
 // Write accepts input to discard.
 // Great place to debugging output.
 func (c *KondoCommander) Write(s []byte) (int, error) {
 	// For debugging: fmt.Printf("Kondo saw: %q\n", string(s))
+	c.count(s, true, false)
 	return 0, nil
 }
 
-// Success always returns true.
-func (c *KondoCommander) Success() bool { return true }
+// Discard returns true, for clirunner.Discarder, unless a Policy or IsError
+// needs to see the output.  A Commander that embeds a KondoCommander, but
+// uses its output, must override Discard.
+func (c *KondoCommander) Discard() bool {
+	return c.Policy == nil && c.IsError == nil
+}
+
+// Success returns true, unless the Policy says otherwise.
+func (c *KondoCommander) Success() bool { return c.succeeded(true) }
 
-// Reset does nothing.
-func (c *KondoCommander) Reset() {}
+// Reset forgets the line counts.
+func (c *KondoCommander) Reset() { c.resetTally() }
 
 // String returns the command string.
 func (c *KondoCommander) String() string { return c.Command }
+
+// ResultKind returns "kondo".
+func (c *KondoCommander) ResultKind() string { return "kondo" }
+
+// ResultData returns nil, since nothing is kept.
+func (c *KondoCommander) ResultData() interface{} { return nil }
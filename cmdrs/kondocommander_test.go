@@ -34,3 +34,9 @@ func TestKondoCommander(t *testing.T) {
 		})
 	}
 }
+
+func TestKondoCommander_Discard(t *testing.T) {
+	assert.True(t, (&KondoCommander{Command: "x"}).Discard())
+	assert.False(t, (&KondoCommander{Tally: Tally{Policy: NoErrorLines}}).Discard())
+	assert.False(t, NewHoardingCommander("x").Discard())
+}
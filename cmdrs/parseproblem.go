@@ -0,0 +1,19 @@
+package cmdrs
+
+import "fmt"
+
+// ParseProblem describes a line of output that a Commander couldn't make
+// sense of.  Such problems are noted rather than returned from Write, since
+// they don't mean the CLI is unusable.
+type ParseProblem struct {
+	// Line is the number of the line in the run's output, counting from 1.
+	Line int `json:"line"`
+	// Content is the offending line.
+	Content string `json:"content"`
+	// Reason says what's wrong with it.
+	Reason string `json:"reason"`
+}
+
+func (p ParseProblem) String() string {
+	return fmt.Sprintf("line %d: %s: %q", p.Line, p.Reason, p.Content)
+}
@@ -22,5 +22,12 @@ func NewPrintingCommander(c string, o io.Writer) *PrintingCommander {
 
 // Write accepts input to print.
 func (c *PrintingCommander) Write(b []byte) (int, error) {
+	c.count(b, true, false)
 	return fmt.Fprintln(c.out, string(b))
 }
+
+// Discard returns false, since the output is printed.
+func (c *PrintingCommander) Discard() bool { return false }
+
+// ResultKind returns "printing".
+func (c *PrintingCommander) ResultKind() string { return "printing" }
@@ -0,0 +1,175 @@
+package cmdrs
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// RiskyPromptLength is the length below which a prompt is thought too
+// short to tell apart from command output; NewPromptSentinel warns about
+// such prompts.
+const RiskyPromptLength = 6
+
+// PromptSentinelCommander is a sentinel Commander that asserts Success if
+// it sees the CLI's prompt, optionally anchored to the start or end of a
+// line.  Make one with NewPromptSentinel, which checks that the prompt is
+// plausibly unambiguous.
+//
+// It relies on the CLI sending its prompt on a line of its own after every
+// command.  Many CLIs don't prompt when stdIn is a pipe, and a prompt
+// that's left unfinished (with no newline after it) is only seen once
+// something else is written on its line.  So, where there's a choice,
+// prefer a sentinel command with a characteristic output, e.g. a
+// SimpleSentinelCommander that echoes a nonsense phrase.
+type PromptSentinelCommander struct {
+	// Command, if not empty, is issued to make the CLI prompt anew, e.g. an
+	// empty statement like ";".  Usually it's empty, since the CLI prompts
+	// after every command anyway.
+	Command string
+	// Prompt is the prompt to look for, e.g. "mysql> ".
+	Prompt string
+	// AnchorStart, if true, requires the prompt at the start of a line.
+	AnchorStart bool
+	// AnchorEnd, if true, requires the prompt at the end of a line.
+	AnchorEnd bool
+	success   bool     // internal state
+	match     string   // the winning line
+	warnings  []string // risks noted by NewPromptSentinel
+	Tally
+}
+
+// PromptSentinelOption is an option for NewPromptSentinel.
+type PromptSentinelOption func(c *PromptSentinelCommander, strict *bool)
+
+// AnchorToLineStart requires the prompt at the start of a line.
+func AnchorToLineStart() PromptSentinelOption {
+	return func(c *PromptSentinelCommander, _ *bool) { c.AnchorStart = true }
+}
+
+// AnchorToLineEnd requires the prompt at the end of a line.
+func AnchorToLineEnd() PromptSentinelOption {
+	return func(c *PromptSentinelCommander, _ *bool) { c.AnchorEnd = true }
+}
+
+// PromptCommand sets the command issued to make the CLI prompt anew.
+func PromptCommand(cmd string) PromptSentinelOption {
+	return func(c *PromptSentinelCommander, _ *bool) { c.Command = cmd }
+}
+
+// StrictPrompt makes NewPromptSentinel fail, rather than warn, if the
+// prompt looks risky.
+func StrictPrompt() PromptSentinelOption {
+	return func(_ *PromptSentinelCommander, strict *bool) { *strict = true }
+}
+
+// NewPromptSentinel returns a PromptSentinelCommander looking for the
+// prompt.  It fails if the prompt could never be matched, i.e. if it's
+// blank or holds a newline.  If the prompt is risky, i.e. short or
+// made of nothing but punctuation, so that command output might
+// be mistaken for it, the risks are noted in Warnings, or, given
+// StrictPrompt, returned as an error.
+func NewPromptSentinel(
+	prompt string, opts ...PromptSentinelOption) (*PromptSentinelCommander, error) {
+	if strings.TrimSpace(prompt) == "" {
+		return nil, fmt.Errorf("prompt %q is blank", prompt)
+	}
+	if strings.ContainsAny(prompt, "\r\n") {
+		return nil, fmt.Errorf(
+			"prompt %q holds a line break, so it can't be found in a line", prompt)
+	}
+	c := &PromptSentinelCommander{Prompt: prompt}
+	strict := false
+	for _, opt := range opts {
+		opt(c, &strict)
+	}
+	c.warnings = promptRisks(prompt, c.AnchorStart || c.AnchorEnd)
+	if strict && len(c.warnings) > 0 {
+		return nil, fmt.Errorf("risky prompt: %s", strings.Join(c.warnings, "; "))
+	}
+	return c, nil
+}
+
+// promptRisks returns the reasons a prompt might be mistaken for output.
+func promptRisks(prompt string, anchored bool) (risks []string) {
+	if n := len(strings.TrimSpace(prompt)); n < RiskyPromptLength {
+		risks = append(risks, fmt.Sprintf(
+			"prompt %q has only %d non-blank characters", prompt, n))
+	}
+	if strings.IndexFunc(prompt, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	}) < 0 {
+		risks = append(risks, fmt.Sprintf(
+			"prompt %q has no letters or digits", prompt))
+	}
+	if len(risks) > 0 && !anchored {
+		risks = append(risks, "prompt isn't anchored to a line start or end")
+	}
+	return risks
+}
+
+func (c *PromptSentinelCommander) String() string { return c.Command }
+
+// Warnings returns the risks NewPromptSentinel saw in the prompt, if any.
+func (c *PromptSentinelCommander) Warnings() []string { return c.warnings }
+
+// matches returns true if the line holds the prompt where it's anchored.
+func (c *PromptSentinelCommander) matches(line []byte) bool {
+	p := []byte(c.Prompt)
+	switch {
+	case c.AnchorStart && c.AnchorEnd:
+		return bytes.Equal(line, p)
+	case c.AnchorStart:
+		return bytes.HasPrefix(line, p)
+	case c.AnchorEnd:
+		return bytes.HasSuffix(line, p)
+	default:
+		return bytes.Contains(line, p)
+	}
+}
+
+// Write looks for the prompt in the line.
+func (c *PromptSentinelCommander) Write(b []byte) (int, error) {
+	matched := c.matches(b)
+	if matched {
+		c.match = string(b)
+		c.success = true
+	}
+	c.count(b, true, matched)
+	return 0, nil
+}
+
+// Screen returns a function passing only lines holding the prompt, for
+// clirunner.SentinelScreener.  It returns nil if a Policy or IsError
+// needs to see every line.
+func (c *PromptSentinelCommander) Screen() func(line []byte) bool {
+	if c.Policy != nil || c.IsError != nil {
+		return nil
+	}
+	return c.matches
+}
+
+// Reset resets everything but the Warnings.
+func (c *PromptSentinelCommander) Reset() {
+	c.match = ""
+	c.success = false
+	c.resetTally()
+}
+
+// Success returns true if the prompt was found, unless the Policy says
+// otherwise.
+func (c *PromptSentinelCommander) Success() bool {
+	return c.succeeded(c.success)
+}
+
+// Match returns the winning line.
+func (c *PromptSentinelCommander) Match() string { return c.match }
+
+// ResultKind returns "prompt-sentinel".
+func (c *PromptSentinelCommander) ResultKind() string { return "prompt-sentinel" }
+
+// ResultData returns a MatchData.
+func (c *PromptSentinelCommander) ResultData() interface{} {
+	return MatchData{Match: c.match}
+}
@@ -0,0 +1,116 @@
+package cmdrs_test
+
+import (
+	"testing"
+
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPromptSentinel(t *testing.T) {
+	var testCases = map[string]struct {
+		prompt      string
+		opts        []PromptSentinelOption
+		errMsg      string
+		numWarnings int
+	}{
+		"blank": {
+			prompt: "  ",
+			errMsg: `prompt "  " is blank`,
+		},
+		"lineBreak": {
+			prompt: "db>\n",
+			errMsg: "holds a line break",
+		},
+		"specific": {
+			prompt: "sillydb> ",
+		},
+		"short": {
+			prompt:      "db> ",
+			numWarnings: 2,
+		},
+		"shortAnchored": {
+			prompt:      "db> ",
+			opts:        []PromptSentinelOption{AnchorToLineStart()},
+			numWarnings: 1,
+		},
+		"punctuation": {
+			prompt:      ">>> ",
+			opts:        []PromptSentinelOption{AnchorToLineEnd()},
+			numWarnings: 2,
+		},
+		"strict": {
+			prompt: ">",
+			opts:   []PromptSentinelOption{StrictPrompt()},
+			errMsg: `risky prompt: prompt ">" has only 1 non-blank characters`,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			c, err := NewPromptSentinel(tc.prompt, tc.opts...)
+			if tc.errMsg != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.errMsg)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, c.Warnings(), tc.numWarnings)
+		})
+	}
+}
+
+func TestPromptSentinelCommander(t *testing.T) {
+	var testCases = map[string]struct {
+		opts    []PromptSentinelOption
+		input   []string
+		success bool
+	}{
+		"anywhere": {
+			input:   []string{"row 1", "see sillydb> here", "row 2"},
+			success: true,
+		},
+		"start": {
+			opts:    []PromptSentinelOption{AnchorToLineStart()},
+			input:   []string{"see sillydb> here", "sillydb> "},
+			success: true,
+		},
+		"notStart": {
+			opts:  []PromptSentinelOption{AnchorToLineStart()},
+			input: []string{"see sillydb> here"},
+		},
+		"end": {
+			opts:    []PromptSentinelOption{AnchorToLineEnd()},
+			input:   []string{"row 1", "...sillydb> "},
+			success: true,
+		},
+		"notEnd": {
+			opts:  []PromptSentinelOption{AnchorToLineEnd()},
+			input: []string{"sillydb> here"},
+		},
+		"whole": {
+			opts: []PromptSentinelOption{
+				AnchorToLineStart(), AnchorToLineEnd()},
+			input:   []string{"sillydb> x", "sillydb> "},
+			success: true,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			c, err := NewPromptSentinel("sillydb> ", tc.opts...)
+			assert.NoError(t, err)
+			screen := c.Screen()
+			matched := 0
+			for _, line := range tc.input {
+				if screen([]byte(line)) {
+					matched++
+				}
+				_, _ = c.Write([]byte(line))
+			}
+			assert.Equal(t, tc.success, c.Success())
+			assert.Equal(t, matched, c.LineTally().Matched)
+			c.Reset()
+			assert.False(t, c.Success())
+			assert.Equal(t, "", c.Match())
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package cmdrs
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ResultVersion is the version of the encoding made by EncodeResult.  It
+// changes only if the encoding changes in a way old readers can't handle;
+// new fields don't change it.
+const ResultVersion = 1
+
+// Result is a Commander whose parsed results have a stable JSON encoding,
+// made by EncodeResult, so that they can be handed to other programs
+// without bespoke serialization.  The Commanders in this package are
+// Results.
+type Result interface {
+	fmt.Stringer
+	Success() bool
+	// ResultKind names the kind of the data, e.g. "hoarding", telling
+	// readers how to read it.
+	ResultKind() string
+	// ResultData returns the parsed results, to encode as JSON, or nil if
+	// there are none.
+	ResultData() interface{}
+}
+
+// EncodedResult is the JSON form of a Result, e.g.
+//
+//	{"version":1,"kind":"hoarding","command":"ls","success":true,
+//	 "tally":{"lines":1,"parsed":1,"errors":0,"matched":0},
+//	 "data":{"lines":["a.txt"]}}
+type EncodedResult struct {
+	// Version is the ResultVersion of the encoding.
+	Version int `json:"version"`
+	// Kind is the Result's ResultKind.
+	Kind string `json:"kind"`
+	// Command is the Result's command.
+	Command string `json:"command"`
+	// Success is the Result's Success.
+	Success bool `json:"success"`
+	// Tally is the Result's LineTally, if it has one.
+	Tally *LineTally `json:"tally,omitempty"`
+	// Problems are the Result's ParseProblems, if it has any.
+	Problems []ParseProblem `json:"problems,omitempty"`
+	// Data is the encoded ResultData, if any.
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// EncodeResult returns the JSON encoding of the Result, as an
+// EncodedResult.
+func EncodeResult(r Result) ([]byte, error) {
+	e := EncodedResult{
+		Version: ResultVersion,
+		Kind:    r.ResultKind(),
+		Command: r.String(),
+		Success: r.Success(),
+	}
+	if t, ok := r.(interface{ LineTally() LineTally }); ok {
+		tally := t.LineTally()
+		e.Tally = &tally
+	}
+	if p, ok := r.(interface{ Problems() []ParseProblem }); ok {
+		e.Problems = p.Problems()
+	}
+	if d := r.ResultData(); d != nil {
+		b, err := json.Marshal(d)
+		if err != nil {
+			return nil, fmt.Errorf("encoding %s result data; %w", e.Kind, err)
+		}
+		e.Data = b
+	}
+	return json.Marshal(e)
+}
+
+// DecodeResult decodes an encoded Result, leaving its Data for the
+// caller to decode per its Kind.  It fails on a version it doesn't know.
+func DecodeResult(b []byte) (*EncodedResult, error) {
+	var e EncodedResult
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, fmt.Errorf("decoding result; %w", err)
+	}
+	if e.Version < 1 || e.Version > ResultVersion {
+		return nil, fmt.Errorf(
+			"result version %d unknown; expected at most %d",
+			e.Version, ResultVersion)
+	}
+	return &e, nil
+}
+
+// LinesData is the data of a HoardingCommander's Result.
+type LinesData struct {
+	// Lines are the lines of output, without linefeeds.
+	Lines []string `json:"lines"`
+}
+
+// MatchData is the data of a sentinel Commander's Result.
+type MatchData struct {
+	// Match is the winning line, or empty if none.
+	Match string `json:"match"`
+}
+
+// Base64Data is the data of a Base64Commander's Result.
+type Base64Data struct {
+	// Blocks is the number of blocks decoded before any trouble.
+	Blocks int `json:"blocks"`
+	// Written is the number of decoded bytes written.
+	Written int `json:"written"`
+	// Err is the first trouble seen, if any.
+	Err string `json:"error,omitempty"`
+}
+
+// FileData is the data of a FileCommander's Result.
+type FileData struct {
+	// Paths are the files written, in order.
+	Paths []string `json:"paths"`
+	// Written is the number of bytes written, before any compression.
+	Written int64 `json:"written"`
+	// Err is the first trouble seen, if any.
+	Err string `json:"error,omitempty"`
+}
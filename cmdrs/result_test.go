@@ -0,0 +1,95 @@
+package cmdrs_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeResult(t *testing.T) {
+	c := NewHoardingCommander("ls")
+	_, _ = c.Write([]byte("a.txt"))
+	_, _ = c.Write([]byte("b.txt"))
+	b, err := EncodeResult(c)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+"version": 1, "kind": "hoarding", "command": "ls", "success": true,
+"tally": {"lines": 2, "parsed": 2, "errors": 0, "matched": 0},
+"data": {"lines": ["a.txt", "b.txt"]}
+}`, string(b))
+
+	e, err := DecodeResult(b)
+	assert.NoError(t, err)
+	assert.Equal(t, "hoarding", e.Kind)
+	var d LinesData
+	assert.NoError(t, json.Unmarshal(e.Data, &d))
+	assert.Equal(t, []string{"a.txt", "b.txt"}, d.Lines)
+
+	c.Reset()
+	b, err = EncodeResult(c)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"data":{"lines":[]}`)
+}
+
+func TestEncodeResult_Kinds(t *testing.T) {
+	sentinel := &SimpleSentinelCommander{Command: "echo hi", Value: "hi"}
+	_, _ = sentinel.Write([]byte("hi"))
+	b64 := NewBase64Commander("cat", "BEGIN", "END", io.Discard)
+	for _, l := range []string{"BEGIN", "!!!!", "END"} {
+		_, _ = b64.Write([]byte(l))
+	}
+	var testCases = map[string]struct {
+		r    Result
+		kind string
+		json string
+	}{
+		"kondo": {
+			r:    &KondoCommander{Command: "set x"},
+			kind: "kondo",
+		},
+		"printing": {
+			r:    NewPrintingCommander("set x", &bytes.Buffer{}),
+			kind: "printing",
+		},
+		"sentinel": {
+			r:    sentinel,
+			kind: "sentinel",
+			json: `{"match":"hi"}`,
+		},
+		"file": {
+			r:    NewFileCommander("export", "export.csv"),
+			kind: "file",
+			json: `{"paths":[],"written":0}`,
+		},
+		"base64": {
+			r:    b64,
+			kind: "base64",
+			json: `{"blocks":0,"written":0,"error":"decoding block 1; illegal base64 data at input byte 0"}`,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			b, err := EncodeResult(tc.r)
+			assert.NoError(t, err)
+			e, err := DecodeResult(b)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.kind, e.Kind)
+			if tc.json == "" {
+				assert.Empty(t, e.Data)
+				return
+			}
+			assert.JSONEq(t, tc.json, string(e.Data))
+		})
+	}
+}
+
+func TestDecodeResult_Version(t *testing.T) {
+	_, err := DecodeResult([]byte(`{"version":2,"kind":"hoarding"}`))
+	assert.EqualError(t, err, "result version 2 unknown; expected at most 1")
+	_, err = DecodeResult([]byte(`{"kind":"hoarding"}`))
+	assert.Error(t, err)
+}
@@ -5,7 +5,7 @@ import (
 )
 
 // SimpleSentinelCommander is a Commander that asserts Success if it sees
-// Value anywhere in the output of Command.
+// Value anywhere in the output of Command, unless its Policy says otherwise.
 type SimpleSentinelCommander struct {
 	Command string // the command, e.g. "echo Rumplestilskin"
 	Value   string // the sentinel value to look for, e.g. "Rumplestilskin".
@@ -13,27 +13,52 @@ type SimpleSentinelCommander struct {
 	// match stores the entire winning line that contains Value.
 	// Handy for debugging.
 	match string
+	Tally
 }
 
 func (c *SimpleSentinelCommander) String() string { return c.Command }
 
 // Write looks for Value anywhere in the line (so it had better be unambiguous).
 func (c *SimpleSentinelCommander) Write(b []byte) (int, error) {
-	if bytes.Contains(b, []byte(c.Value)) {
+	matched := bytes.Contains(b, []byte(c.Value))
+	if matched {
 		c.match = string(b)
 		c.success = true
 	}
+	c.count(b, true, matched)
 	return 0, nil
 }
 
+// Screen returns a function passing only lines holding Value, for
+// clirunner.SentinelScreener.  It returns nil if a Policy or IsError
+// needs to see every line.
+func (c *SimpleSentinelCommander) Screen() func(line []byte) bool {
+	if c.Policy != nil || c.IsError != nil {
+		return nil
+	}
+	value := []byte(c.Value)
+	return func(line []byte) bool { return bytes.Contains(line, value) }
+}
+
 // Reset resets everything.
 func (c *SimpleSentinelCommander) Reset() {
 	c.match = ""
 	c.success = false
+	c.resetTally()
 }
 
-// Success returns true if Value found.
-func (c *SimpleSentinelCommander) Success() bool { return c.success }
+// Success returns true if Value found, unless the Policy says otherwise.
+func (c *SimpleSentinelCommander) Success() bool {
+	return c.succeeded(c.success)
+}
 
 // Match returns the winning line.
 func (c *SimpleSentinelCommander) Match() string { return c.match }
+
+// ResultKind returns "sentinel".
+func (c *SimpleSentinelCommander) ResultKind() string { return "sentinel" }
+
+// ResultData returns a MatchData.
+func (c *SimpleSentinelCommander) ResultData() interface{} {
+	return MatchData{Match: c.match}
+}
@@ -76,3 +76,12 @@ nisi convallis, ac finibus ipsum eleifend.
 		})
 	}
 }
+
+func TestSimpleSentinelCommander_Screen(t *testing.T) {
+	c := &SimpleSentinelCommander{Command: "echo PROMPT>", Value: "PROMPT>"}
+	screen := c.Screen()
+	assert.True(t, screen([]byte("nulla PROMPT>Mauris")))
+	assert.False(t, screen([]byte("nulla semper bibendum")))
+	c.Policy = MatchedAtLeast(2)
+	assert.Nil(t, c.Screen())
+}
@@ -0,0 +1,82 @@
+package cmdrs
+
+// LineTally counts the lines of output a Commander has seen.
+type LineTally struct {
+	Lines   int `json:"lines"`   // every line
+	Parsed  int `json:"parsed"`  // lines the Commander understood
+	Errors  int `json:"errors"`  // lines recognized as reporting errors
+	Matched int `json:"matched"` // lines the Commander was looking for, e.g. a sentinel
+}
+
+// SuccessPolicy decides a Commander's Success from its LineTally.
+// Use one of AllLinesParsed, NoErrorLines or MatchedAtLeast, or any
+// function of the right type.
+type SuccessPolicy func(t LineTally) bool
+
+// AllLinesParsed succeeds if the Commander understood every line.
+func AllLinesParsed(t LineTally) bool { return t.Parsed == t.Lines }
+
+// NoErrorLines succeeds if no line reported an error.
+func NoErrorLines(t LineTally) bool { return t.Errors == 0 }
+
+// MatchedAtLeast returns a SuccessPolicy that succeeds if at least n lines
+// matched.
+func MatchedAtLeast(n int) SuccessPolicy {
+	return func(t LineTally) bool { return t.Matched >= n }
+}
+
+// Tally counts the lines a Commander sees, so that its Success can be
+// decided by a SuccessPolicy, and keeps its ParseProblems.  The Commanders
+// in this package embed one.
+type Tally struct {
+	// Policy, if not nil, decides Success, replacing the Commander's own
+	// notion of it.
+	Policy SuccessPolicy
+	// IsError, if not nil, recognizes lines reporting errors, e.g. lines
+	// starting with "Error:".  Each is also noted as a ParseProblem.
+	IsError  func(line []byte) bool
+	tally    LineTally
+	problems []ParseProblem
+}
+
+// LineTally returns the counts so far.
+func (t *Tally) LineTally() LineTally { return t.tally }
+
+// Problems returns the problems noted so far, in order.
+func (t *Tally) Problems() []ParseProblem { return t.problems }
+
+// problem notes a problem with the line most recently counted.
+func (t *Tally) problem(line []byte, reason string) {
+	t.problems = append(t.problems, ParseProblem{
+		Line: t.tally.Lines, Content: string(line), Reason: reason})
+}
+
+// count counts a line.
+func (t *Tally) count(line []byte, parsed, matched bool) {
+	t.tally.Lines++
+	if parsed {
+		t.tally.Parsed++
+	}
+	if matched {
+		t.tally.Matched++
+	}
+	if t.IsError != nil && t.IsError(line) {
+		t.tally.Errors++
+		t.problem(line, "error reported")
+	}
+}
+
+// succeeded applies the Policy, if any, else returns the Commander's own
+// verdict.
+func (t *Tally) succeeded(own bool) bool {
+	if t.Policy == nil {
+		return own
+	}
+	return t.Policy(t.tally)
+}
+
+// resetTally forgets the counts and problems.
+func (t *Tally) resetTally() {
+	t.tally = LineTally{}
+	t.problems = nil
+}
@@ -0,0 +1,121 @@
+package cmdrs_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+func isError(line []byte) bool {
+	return bytes.HasPrefix(line, []byte("Error:"))
+}
+
+func TestSuccessPolicy(t *testing.T) {
+	var testCases = map[string]struct {
+		policy   SuccessPolicy
+		input    []string
+		expected bool
+	}{
+		"noPolicy": {
+			input:    []string{"Error: oops", "Value"},
+			expected: true,
+		},
+		"allLinesParsed": {
+			policy:   AllLinesParsed,
+			input:    []string{"hello", "Error: oops"},
+			expected: true,
+		},
+		"noErrorLines": {
+			policy:   NoErrorLines,
+			input:    []string{"hello", "Error: oops"},
+			expected: false,
+		},
+		"noErrorLinesClean": {
+			policy:   NoErrorLines,
+			input:    []string{"hello"},
+			expected: true,
+		},
+		"matchedAtLeast": {
+			policy:   MatchedAtLeast(2),
+			input:    []string{"Value", "hello", "Value again"},
+			expected: true,
+		},
+		"matchedTooFew": {
+			policy:   MatchedAtLeast(2),
+			input:    []string{"Value", "hello"},
+			expected: false,
+		},
+		"custom": {
+			policy:   func(t LineTally) bool { return t.Lines == 3 },
+			input:    []string{"a", "b", "c"},
+			expected: true,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			c := &SimpleSentinelCommander{Command: "echo Value", Value: "Value"}
+			c.Policy = tc.policy
+			c.IsError = isError
+			for i := range tc.input {
+				assert.NoError(t, WriteString(c, tc.input[i]))
+			}
+			assert.Equal(t, tc.expected, c.Success())
+			assert.Equal(t, len(tc.input), c.LineTally().Lines)
+			c.Reset()
+			assert.Equal(t, LineTally{}, c.LineTally())
+		})
+	}
+}
+
+func TestSuccessPolicy_Commanders(t *testing.T) {
+	k := &KondoCommander{Command: "whatever"}
+	k.IsError = isError
+	k.Policy = NoErrorLines
+	assert.True(t, k.Success())
+	assert.NoError(t, WriteString(k, "Error: oops"))
+	assert.False(t, k.Success())
+	k.Reset()
+	assert.True(t, k.Success())
+
+	h := NewHoardingCommander("whatever")
+	h.Policy = MatchedAtLeast(1)
+	assert.NoError(t, WriteString(h, "hello"))
+	assert.False(t, h.Success(), "a hoarder matches nothing")
+
+	b := NewBase64Commander("whatever", "BEGIN", "END", io.Discard)
+	b.Policy = AllLinesParsed
+	for _, l := range []string{"BEGIN", "aGk=", "END"} {
+		assert.NoError(t, WriteString(b, l))
+	}
+	assert.True(t, b.Success())
+	assert.Equal(t, LineTally{Lines: 3, Parsed: 3, Matched: 1}, b.LineTally())
+	assert.NoError(t, WriteString(b, "chatter"))
+	assert.False(t, b.Success())
+}
+
+func TestTally_Problems(t *testing.T) {
+	k := &KondoCommander{Command: "whatever"}
+	k.IsError = isError
+	for _, l := range []string{"hello", "Error: oops", "bye"} {
+		assert.NoError(t, WriteString(k, l))
+	}
+	assert.Equal(t, []ParseProblem{
+		{Line: 2, Content: "Error: oops", Reason: "error reported"},
+	}, k.Problems())
+	assert.Equal(t, `line 2: error reported: "Error: oops"`, k.Problems()[0].String())
+	k.Reset()
+	assert.Empty(t, k.Problems())
+
+	b := NewBase64Commander("whatever", "BEGIN", "END", io.Discard)
+	for _, l := range []string{"chatter", "BEGIN", "aGk=", "!!!!", "aGk=", "END"} {
+		assert.NoError(t, WriteString(b, l))
+	}
+	if assert.Len(t, b.Problems(), 1) {
+		assert.Equal(t, 4, b.Problems()[0].Line)
+		assert.Equal(t, "!!!!", b.Problems()[0].Content)
+		assert.Contains(t, b.Problems()[0].Reason, "decoding block 1")
+	}
+}
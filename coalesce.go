@@ -0,0 +1,152 @@
+package clirunner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ReadOnlyMarker is an optional interface for a Commander whose command
+// only reads, e.g. "show tables", so that running it once on behalf of
+// several callers does them no harm.  With Parameters.CoalesceReadOnly,
+// runs of such a command waiting for their turn together are collapsed
+// into one.  See WithReadOnly.
+type ReadOnlyMarker interface {
+	// ReadOnly returns true if the Commander's command only reads.
+	ReadOnly() bool
+}
+
+// readOnly returns true if the given Commander's command only reads.
+func readOnly(c Commander) bool {
+	for ; c != nil; c = unwrap(c) {
+		if m, ok := c.(ReadOnlyMarker); ok {
+			return m.ReadOnly()
+		}
+	}
+	return false
+}
+
+// flight is a run of a read-only command shared by the runs of the same
+// command that joined it while it waited for its turn.
+type flight struct {
+	// done is closed once the run is over, or gave up its turn.
+	done chan struct{}
+	// ran is true if the command was run, and not canceled; only then are
+	// lines and err the outcome to share.
+	ran   bool
+	lines []Line
+	marks []lineMark
+	err   error
+}
+
+// flights holds the shared runs waiting for their turn, by command.
+type flights struct {
+	m       sync.Mutex
+	waiting map[string]*flight
+	riders  int // runs waiting on another's run
+}
+
+// join returns the flight waiting to run the command, with true, or else
+// a new one, which the caller must run, with false.  A true result
+// obliges the caller to call alight.
+func (fs *flights) join(command string) (*flight, bool) {
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	if f, ok := fs.waiting[command]; ok {
+		fs.riders++
+		return f, true
+	}
+	if fs.waiting == nil {
+		fs.waiting = make(map[string]*flight)
+	}
+	f := &flight{done: make(chan struct{})}
+	fs.waiting[command] = f
+	return f, false
+}
+
+// alight notes a run is done waiting on another's run.
+func (fs *flights) alight() {
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	fs.riders--
+}
+
+// length returns the number of runs waiting on another's run.
+func (fs *flights) length() int {
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	return fs.riders
+}
+
+// depart stops the flight taking on more runs, as it's about to run.
+func (fs *flights) depart(command string, f *flight) {
+	fs.m.Lock()
+	defer fs.m.Unlock()
+	if fs.waiting[command] == f {
+		delete(fs.waiting, command)
+	}
+}
+
+// runShared runs the read-only Commander, sharing a run of its command
+// with the runs of the same command waiting for their turn alongside it.
+// The first of them runs the command; the rest get a copy of its output,
+// and its error.  If that run gives up its turn, or is canceled, the rest
+// try again on their own.
+func (pr *ProcRunner) runShared(
+	ctx context.Context, cmdr Commander, timeOut time.Duration) error {
+	command := cmdr.String()
+	f, joined := pr.flights.join(command)
+	if joined {
+		select {
+		case <-f.done:
+			pr.flights.alight()
+		case <-ctx.Done():
+			pr.flights.alight()
+			return &RunCanceledError{Command: command, Cause: ctx.Err()}
+		}
+		if !f.ran {
+			return pr.runShared(ctx, cmdr, timeOut)
+		}
+		for i, l := range f.lines {
+			if err := replayShared(cmdr, l, f.marks[i]); err != nil {
+				return fmt.Errorf(
+					"in command %q, Commander failed; %w", command, err)
+			}
+		}
+		return f.err
+	}
+	defer close(f.done)
+	defer pr.flights.depart(command, f)
+	q := newLineRecorder()
+	var turn bool
+	f.err = pr.runTurn(ctx, cmdr, timeOut, q, func() {
+		turn = true
+		pr.flights.depart(command, f)
+	})
+	var rce *RunCanceledError
+	f.ran = turn && !errors.As(f.err, &rce)
+	f.lines, f.marks = q.taken()
+	return f.err
+}
+
+// replayShared passes a line of a shared run to the Commander, as the
+// filter would have passed it had the Commander's own run read it.
+func replayShared(cmdr Commander, l Line, mark lineMark) error {
+	l.Data = append([]byte(nil), l.Data...)
+	if w, ok := cmdr.(ContinuedWriter); ok && mark.continued {
+		return w.WriteContinued(l.Data)
+	}
+	if w, ok := cmdr.(LineWriter); ok {
+		l.Data = l.Data[mark.cut:]
+		return w.WriteLine(l)
+	}
+	if c2, ok := cmdr.(Commander2); ok && l.Stream != StreamExtra {
+		if l.Stream == StreamErr {
+			return c2.WriteErr(l.Data[mark.cut:])
+		}
+		return c2.WriteOut(l.Data)
+	}
+	return replayLine(cmdr, l)
+}
@@ -0,0 +1,134 @@
+package clirunner_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunner_CoalesceReadOnly(t *testing.T) {
+	h := makeHarness(t, func(p *Parameters) { p.CoalesceReadOnly = true })
+	busy := runAsync(h, NewHoardingCommander("busy"), time.Minute)
+	expectCommands(t, h, "busy", "echo Rumpelstiltskin")
+
+	// Read-only runs of a command, waiting together, share a run.
+	var shared []*HoardingCommander
+	var results []<-chan error
+	for i := 0; i < 3; i++ {
+		c := NewHoardingCommander("show tables")
+		shared = append(shared, c)
+		results = append(results, runAsync(h, WithReadOnly(c), time.Minute))
+	}
+	awaitQueued(h, 3)
+	// A run that doesn't say it only reads gets its own.
+	own := NewHoardingCommander("show tables")
+	ownResult := runAsync(h, own, time.Minute)
+	awaitQueued(h, 4)
+
+	assert.NoError(t, h.Out("Rumpelstiltskin"))
+	assert.NoError(t, <-busy)
+	expectCommands(t, h, "show tables", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("users", "orders", "Rumpelstiltskin"))
+	for i, c := range shared {
+		assert.NoError(t, <-results[i])
+		assert.Equal(t, "users\norders\n", c.Result())
+	}
+	expectCommands(t, h, "show tables", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("users", "Rumpelstiltskin"))
+	assert.NoError(t, <-ownResult)
+	assert.Equal(t, "users\n", own.Result())
+	assert.Equal(t, 3, h.Runner.Report().RunCount)
+	assert.NoError(t, h.Runner.Close())
+}
+
+// readOnlyLines is a lineRecorder whose command only reads.
+type readOnlyLines struct{ *lineRecorder }
+
+func (readOnlyLines) ReadOnly() bool { return true }
+
+// readOnlySplit is a splitCommander whose command only reads.
+type readOnlySplit struct{ *splitCommander }
+
+func (readOnlySplit) ReadOnly() bool { return true }
+
+func TestRunner_CoalesceReadOnlyDispatch(t *testing.T) {
+	h := makeHarness(t, func(p *Parameters) { p.CoalesceReadOnly = true })
+	busy := runAsync(h, NewHoardingCommander("busy"), time.Minute)
+	expectCommands(t, h, "busy", "echo Rumpelstiltskin")
+
+	// The runs sharing another's get its lines as they would their own.
+	newLines := func() readOnlyLines {
+		return readOnlyLines{&lineRecorder{
+			HoardingCommander: NewHoardingCommander("show tables"),
+			got:               make(chan struct{}, 2)}}
+	}
+	first, lines := newLines(), newLines()
+	split := readOnlySplit{
+		&splitCommander{HoardingCommander: NewHoardingCommander("show tables")}}
+	var results []<-chan error
+	for _, c := range []Commander{first, lines, split} {
+		results = append(results, runAsync(h, c, time.Minute))
+		awaitQueued(h, len(results))
+	}
+
+	assert.NoError(t, h.Out("Rumpelstiltskin"))
+	assert.NoError(t, <-busy)
+	expectCommands(t, h, "show tables", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Err("warning"))
+	<-first.got
+	h.Clock.Advance(time.Second)
+	assert.NoError(t, h.Out("users", "Rumpelstiltskin"))
+	for _, result := range results {
+		assert.NoError(t, <-result)
+	}
+	assert.Equal(t, "users\n", split.out.String())
+	assert.Equal(t, "warning\n", split.err.String())
+	assert.Empty(t, split.Result())
+	assert.Equal(t, first.lines, lines.lines)
+	if assert.Len(t, lines.lines, 2) {
+		assert.Equal(t, StreamErr, lines.lines[0].Stream)
+		assert.Equal(t, StreamOut, lines.lines[1].Stream)
+		assert.Greater(t, lines.lines[1].Seq, lines.lines[0].Seq)
+		assert.Equal(t, time.Second,
+			lines.lines[1].Time.Sub(lines.lines[0].Time))
+	}
+	assert.Empty(t, lines.Result())
+	assert.Equal(t, 2, h.Runner.Report().RunCount)
+	assert.NoError(t, h.Runner.Close())
+}
+
+func TestRunner_CoalesceReadOnlyCanceled(t *testing.T) {
+	h := makeHarness(t, func(p *Parameters) { p.CoalesceReadOnly = true })
+	busy := runAsync(h, NewHoardingCommander("busy"), time.Minute)
+	expectCommands(t, h, "busy", "echo Rumpelstiltskin")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		first <- h.Runner.RunContext(
+			ctx, WithReadOnly(NewHoardingCommander("show tables")))
+	}()
+	awaitQueued(h, 1)
+	c := NewHoardingCommander("show tables")
+	result := runAsync(h, WithReadOnly(c), time.Minute)
+	awaitQueued(h, 2)
+
+	// The run the other was waiting on gives up its turn, so the other
+	// waits for one of its own.
+	cancel()
+	var rce *RunCanceledError
+	assert.True(t, errors.As(<-first, &rce))
+	awaitQueued(h, 1)
+	assert.NoError(t, h.Out("Rumpelstiltskin"))
+	assert.NoError(t, <-busy)
+	expectCommands(t, h, "show tables", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("users", "Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	assert.Equal(t, "users\n", c.Result())
+	assert.NoError(t, h.Runner.Close())
+}
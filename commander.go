@@ -32,3 +32,35 @@ type Commander interface {
 	// used in another Run.
 	Reset()
 }
+
+// SentinelSwapper is an optional interface for a Commander whose command
+// changes how the CLI signals completion, e.g. "use database" or "set prompt"
+// commands that change the CLI's prompt.
+//
+// If the Commander handed to RunIt implements SentinelSwapper, the sentinels
+// it returns replace the current sentinels immediately after its command is
+// issued.  They're used to detect completion of that very command, and remain
+// in effect for subsequent runs.  Restarting the subprocess restores the
+// sentinels specified in Parameters, since a fresh CLI has a fresh prompt.
+type SentinelSwapper interface {
+	// NewSentinels returns the out and err sentinels to use from now on.
+	// A nil value leaves the corresponding current sentinel in place.
+	NewSentinels() (out Commander, err Commander)
+}
+
+// Wrapper is implemented by a Commander that wraps another, e.g. one made by
+// WithFilter.  When looking for the optional interfaces of a Commander
+// (SentinelSwapper, OutputLimiter, etc.), the ProcRunner looks through its
+// wrappers, outermost first.
+type Wrapper interface {
+	// Unwrap returns the wrapped Commander.
+	Unwrap() Commander
+}
+
+// unwrap returns the Commander wrapped by c, or nil if c isn't a Wrapper.
+func unwrap(c Commander) Commander {
+	if w, ok := c.(Wrapper); ok {
+		return w.Unwrap()
+	}
+	return nil
+}
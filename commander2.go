@@ -0,0 +1,107 @@
+package clirunner
+
+import "bytes"
+
+// Commander2 is a Commander that takes the lines of stdOut and stdErr
+// separately, so that it needn't tell data from diagnostics by an
+// ErrPrefix.  If the Commander handed to RunIt implements Commander2, lines
+// of stdOut go to WriteOut, and lines of stdErr to WriteErr, less the
+// Parameters' ErrPrefix.  Its Write gets only lines of neither, i.e. those
+// of ExtraStreams, if it isn't an ExtraStreamWriter.  Pieces of split lines
+// go to WriteContinued if it's a ContinuedWriter, as for any Commander.
+type Commander2 interface {
+	Commander
+	// WriteOut accepts a line of stdOut.  Like Write, it should return an
+	// error only on some sort of catastrophe.
+	WriteOut(line []byte) error
+	// WriteErr accepts a line of stdErr.  Like Write, it should return an
+	// error only on some sort of catastrophe.
+	WriteErr(line []byte) error
+}
+
+// AsCommander2 returns the Commander as a Commander2: c itself, if it is
+// one, or else an adapter passing the lines of both streams to c's Write,
+// e.g. for code handling Commander2s that must handle legacy Commanders
+// too.  Handed to RunIt, the adapter is a Commander2, so c gets the lines
+// of stdErr without the ErrPrefix.
+func AsCommander2(c Commander) Commander2 {
+	if c2, ok := c.(Commander2); ok {
+		return c2
+	}
+	return legacyCommander{c}
+}
+
+// legacyCommander adapts a Commander to Commander2.
+type legacyCommander struct {
+	Commander
+}
+
+func (c legacyCommander) WriteOut(line []byte) error {
+	_, err := c.Write(line)
+	return err
+}
+
+func (c legacyCommander) WriteErr(line []byte) error {
+	_, err := c.Write(line)
+	return err
+}
+
+// Unwrap returns the adapted Commander, so that its optional interfaces
+// are found.
+func (c legacyCommander) Unwrap() Commander { return c.Commander }
+
+// WithErrPrefix returns a Commander2 passing the lines of both streams to
+// c's Write, those of stdErr with the prefix, as the Parameters' ErrPrefix
+// would, for a Commander that tells stdErr apart by a prefix.  Unlike
+// ErrPrefix, the prefix is only seen by c: not by the sentinels, the
+// OutputCheck or other Commanders.  Each piece of a line of stdErr split
+// per LongLinesSplit gets the prefix.
+func WithErrPrefix(c Commander, prefix string) Commander2 {
+	return &errPrefixed{wrapper: wrapper{c}, prefix: []byte(prefix)}
+}
+
+// errPrefixed renders an ErrPrefix for the Commander it wraps.
+type errPrefixed struct {
+	wrapper
+	prefix []byte
+}
+
+func (c *errPrefixed) WriteOut(line []byte) error {
+	_, err := c.Commander.Write(line)
+	return err
+}
+
+func (c *errPrefixed) WriteErr(line []byte) error {
+	l := make([]byte, 0, len(c.prefix)+len(line))
+	_, err := c.Commander.Write(append(append(l, c.prefix...), line...))
+	return err
+}
+
+// write passes a line of the given stream to the current Commander, as a
+// Line if it's a LineWriter, or by stream if it's a Commander2.  For
+// either, a line of stdErr that isn't continuing a split line loses its
+// ErrPrefix.  A Spooler's lines of stdOut are spooled instead.  The caller
+// must hold cmdrLock.
+func (cw *sentinelFilter) write(stream Stream, line []byte, first bool) error {
+	if cw.spool != nil && stream != StreamErr {
+		cw.spool.add(line, false)
+		return nil
+	}
+	w, isLW := cw.theCmdr.(LineWriter)
+	c2, isC2 := cw.theCmdr.(Commander2)
+	if !isLW && !isC2 {
+		_, err := cw.theCmdr.Write(line)
+		return err
+	}
+	data := line
+	if stream == StreamErr && first {
+		data = bytes.TrimPrefix(line, cw.errPrefix)
+	}
+	if isLW {
+		return cw.writeLine(w, line, Line{Data: data, Stream: stream})
+	}
+	if stream != StreamErr {
+		return c2.WriteOut(data)
+	}
+	return c2.WriteErr(data)
+}
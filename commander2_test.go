@@ -0,0 +1,72 @@
+package clirunner_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+// splitCommander is a Commander2 keeping data and diagnostics apart.
+type splitCommander struct {
+	*HoardingCommander
+	out, err bytes.Buffer
+}
+
+func (c *splitCommander) WriteOut(line []byte) error {
+	c.out.Write(line)
+	c.out.WriteByte('\n')
+	return nil
+}
+
+func (c *splitCommander) WriteErr(line []byte) error {
+	c.err.Write(line)
+	c.err.WriteByte('\n')
+	return nil
+}
+
+func TestRunner_Commander2(t *testing.T) {
+	h := makeHarness(t, func(p *Parameters) {
+		p.ErrPrefix = "E:"
+		p.MaxLineBytes = 16
+		p.LongLines = LongLinesSplit
+	})
+	c := &splitCommander{HoardingCommander: NewHoardingCommander("select")}
+	result := runAsync(h, c, time.Minute)
+	expectCommands(t, h, "select", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("id", "42"))
+	// Only the first piece of a split line had the prefix to lose.
+	assert.NoError(t, h.Err("warning", "E:E:E:E:E:E:E:E:E:"))
+	assert.NoError(t, h.Out("Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	assert.Equal(t, "id\n42\n", c.out.String())
+	assert.Equal(t, "warning\nE:E:E:E:E:E:E:E:\nE:\n", c.err.String())
+	assert.Equal(t, "", c.Result())
+	assert.NoError(t, h.Runner.Close())
+}
+
+func TestAsCommander2(t *testing.T) {
+	c := &splitCommander{HoardingCommander: NewHoardingCommander("select")}
+	assert.Same(t, c, AsCommander2(c))
+
+	legacy := NewHoardingCommander("select")
+	c2 := AsCommander2(legacy)
+	assert.NoError(t, c2.WriteOut([]byte("data")))
+	assert.NoError(t, c2.WriteErr([]byte("oops")))
+	assert.Equal(t, "data\noops\n", legacy.Result())
+	assert.Equal(t, "select", c2.String())
+	assert.Same(t, legacy, c2.(Wrapper).Unwrap())
+}
+
+func TestWithErrPrefix(t *testing.T) {
+	legacy := NewHoardingCommander("select")
+	c := WithErrPrefix(legacy, "Err: ")
+	assert.NoError(t, c.WriteOut([]byte("data")))
+	assert.NoError(t, c.WriteErr([]byte("oops")))
+	assert.Equal(t, "data\nErr: oops\n", legacy.Result())
+	assert.Equal(t, "select", c.String())
+	assert.Same(t, legacy, c.(Wrapper).Unwrap())
+}
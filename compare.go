@@ -0,0 +1,227 @@
+package clirunner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/monopole/clirunner/cmdrs"
+)
+
+// Comparison is the outcome of CompareRunners: how the same command fared
+// on two runners, e.g. the old and new versions of a CLI.
+type Comparison struct {
+	// Command is the command compared.
+	Command string
+	// A and B are the runs on the first and second runner.
+	A, B ComparedRun
+	// Diffs are the differences between the runs' outcomes, i.e. their
+	// errors and parsed results, but not their timings.
+	Diffs []Difference
+}
+
+// ComparedRun is one side of a Comparison.
+type ComparedRun struct {
+	// Duration is how long the run took.
+	Duration time.Duration
+	// Err is what the run returned.
+	Err error
+	// Result is the run's parsed results, if its Commander is a
+	// cmdrs.Result, else nil.
+	Result *cmdrs.EncodedResult
+}
+
+// Difference is a way two runs differ.
+type Difference struct {
+	// Path locates what differs, e.g. "error", "success" or
+	// "data.lines[2]".
+	Path string
+	// A and B are the JSON renderings of the values, or empty where one
+	// side has nothing at the Path.
+	A, B string
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf("%s: %s != %s", d.Path, orAbsent(d.A), orAbsent(d.B))
+}
+
+func orAbsent(s string) string {
+	if s == "" {
+		return "<absent>"
+	}
+	return s
+}
+
+// Same returns true if the runs' outcomes don't differ.
+func (c *Comparison) Same() bool { return len(c.Diffs) == 0 }
+
+// Slowdown returns how much longer the run on B took than the run on A;
+// negative if B was faster.
+func (c *Comparison) Slowdown() time.Duration { return c.B.Duration - c.A.Duration }
+
+func (c *Comparison) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%q: A took %s, B took %s", c.Command,
+		c.A.Duration, c.B.Duration)
+	if c.Same() {
+		b.WriteString("; same outcome")
+	}
+	for _, d := range c.Diffs {
+		b.WriteString("\n  " + d.String())
+	}
+	return b.String()
+}
+
+// CompareRunners runs the same command on two runners at once, e.g. the
+// old and new versions of a CLI or backend during an upgrade, and compares
+// the outcomes.  Since a Commander holds the results of its run, newCmdr
+// is called for a fresh one per runner.  Commanders that are cmdrs.Results
+// have their parsed results compared field by field, per their JSON
+// encoding, e.g. "data.lines[2]"; others only their Success values.  An
+// error is returned only if the results can't be encoded; the runs' own
+// errors are part of the Comparison.
+func CompareRunners(ctx context.Context,
+	a, b Runner, newCmdr func() Commander) (*Comparison, error) {
+	ca, cb := newCmdr(), newCmdr()
+	c := &Comparison{Command: ca.String()}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go compareRun(ctx, &wg, a, ca, &c.A)
+	go compareRun(ctx, &wg, b, cb, &c.B)
+	wg.Wait()
+	if errText(c.A.Err) != errText(c.B.Err) {
+		c.Diffs = append(c.Diffs, Difference{Path: "error",
+			A: jsonText(errText(c.A.Err)), B: jsonText(errText(c.B.Err))})
+	}
+	va, err := comparable(ca, &c.A)
+	if err != nil {
+		return nil, err
+	}
+	vb, err := comparable(cb, &c.B)
+	if err != nil {
+		return nil, err
+	}
+	c.Diffs = append(c.Diffs, diffValues("", va, vb)...)
+	return c, nil
+}
+
+// compareRun runs the Commander, noting how it went.
+func compareRun(ctx context.Context,
+	wg *sync.WaitGroup, r Runner, c Commander, run *ComparedRun) {
+	defer wg.Done()
+	start := time.Now()
+	run.Err = r.RunContext(ctx, c)
+	run.Duration = time.Since(start)
+}
+
+func errText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func jsonText(s string) string {
+	if s == "" {
+		return ""
+	}
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// comparable returns the Commander's outcome as decoded JSON, keeping its
+// encoded Result in the run.  The command and encoding version are left
+// out, as they're the same on both sides.
+func comparable(c Commander, run *ComparedRun) (interface{}, error) {
+	r, ok := c.(cmdrs.Result)
+	if !ok {
+		return map[string]interface{}{"success": c.Success()}, nil
+	}
+	b, err := cmdrs.EncodeResult(r)
+	if err != nil {
+		return nil, err
+	}
+	if run.Result, err = cmdrs.DecodeResult(b); err != nil {
+		return nil, err
+	}
+	var v map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err = d.Decode(&v); err != nil {
+		return nil, err
+	}
+	delete(v, "version")
+	delete(v, "command")
+	return v, nil
+}
+
+// diffValues returns the differences between two decoded JSON values.
+func diffValues(path string, a, b interface{}) []Difference {
+	switch ta := a.(type) {
+	case map[string]interface{}:
+		if tb, ok := b.(map[string]interface{}); ok {
+			return diffMaps(path, ta, tb)
+		}
+	case []interface{}:
+		if tb, ok := b.([]interface{}); ok {
+			return diffSlices(path, ta, tb)
+		}
+	}
+	ja, jb := render(a), render(b)
+	if ja == jb {
+		return nil
+	}
+	return []Difference{{Path: path, A: ja, B: jb}}
+}
+
+func diffMaps(path string, a, b map[string]interface{}) []Difference {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var result []Difference
+	for _, k := range keys {
+		p := k
+		if path != "" {
+			p = path + "." + k
+		}
+		result = append(result, diffValues(p, a[k], b[k])...)
+	}
+	return result
+}
+
+func diffSlices(path string, a, b []interface{}) []Difference {
+	var result []Difference
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var va, vb interface{}
+		if i < len(a) {
+			va = a[i]
+		}
+		if i < len(b) {
+			vb = b[i]
+		}
+		result = append(result,
+			diffValues(fmt.Sprintf("%s[%d]", path, i), va, vb)...)
+	}
+	return result
+}
+
+// render returns the value as JSON, or empty if it's absent.
+func render(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,50 @@
+package clirunner_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/monopole/clirunner/mockrunner"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareRunners(t *testing.T) {
+	old := mockrunner.New(mockrunner.Response{
+		Command: "show tables", Out: []string{"parts", "orders", "users"}})
+	cur := mockrunner.New(mockrunner.Response{
+		Command: "show tables", Out: []string{"parts", "invoices"}})
+	c, err := CompareRunners(context.Background(), old, cur,
+		func() Commander { return NewHoardingCommander("show tables") })
+	assert.NoError(t, err)
+	assert.False(t, c.Same())
+	assert.Equal(t, "show tables", c.Command)
+	assert.Equal(t, []Difference{
+		{Path: "data.lines[1]", A: `"orders"`, B: `"invoices"`},
+		{Path: "data.lines[2]", A: `"users"`},
+		{Path: "tally.lines", A: "3", B: "2"},
+		{Path: "tally.parsed", A: "3", B: "2"},
+	}, c.Diffs)
+	assert.Equal(t, "hoarding", c.A.Result.Kind)
+	assert.Equal(t, "data.lines[2]: \"users\" != <absent>", c.Diffs[1].String())
+
+	c, err = CompareRunners(context.Background(), old, old,
+		func() Commander { return NewHoardingCommander("show tables") })
+	assert.NoError(t, err)
+	assert.True(t, c.Same())
+	assert.Contains(t, c.String(), "same outcome")
+}
+
+func TestCompareRunners_Errors(t *testing.T) {
+	ok := mockrunner.New(mockrunner.Response{Command: "ping"})
+	bad := mockrunner.New(
+		mockrunner.Response{Command: "ping", Err: errors.New("refused")})
+	c, err := CompareRunners(context.Background(), ok, bad,
+		func() Commander { return &KondoCommander{Command: "ping"} })
+	assert.NoError(t, err)
+	assert.Equal(t,
+		[]Difference{{Path: "error", B: `"refused"`}}, c.Diffs)
+	assert.EqualError(t, c.B.Err, "refused")
+}
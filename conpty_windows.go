@@ -0,0 +1,239 @@
+//go:build windows
+// +build windows
+
+package clirunner
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	kernel32                      = windows.NewLazySystemDLL("kernel32.dll")
+	procCreatePseudoConsole       = kernel32.NewProc("CreatePseudoConsole")
+	procClosePseudoConsole        = kernel32.NewProc("ClosePseudoConsole")
+	procUpdateProcThreadAttribute = kernel32.NewProc("UpdateProcThreadAttribute")
+)
+
+// procThreadAttributePseudoConsole is PROC_THREAD_ATTRIBUTE_PSEUDOCONSOLE.
+const procThreadAttributePseudoConsole = 0x00020016
+
+// consoleCols and consoleRows are the size of a pseudo console.  It's wide,
+// as the console wraps longer lines.
+const (
+	consoleCols = 8192
+	consoleRows = 50
+)
+
+// conptyProcess is a CLI subprocess attached to a pseudo console (ConPTY)
+// of its own, for CLIs that only behave interactively in a console, e.g.
+// sqlcmd or diskpart.  Its stdIn and stdOut, and its stdErr, are the
+// console's.
+type conptyProcess struct {
+	path, dir string
+	args, env []string
+	// extras is the number of ExtraStreams.
+	extras int
+	// inR and outW are the console's ends of its pipes, and inW and outR
+	// the runner's.
+	inR, inW, outR, outW *os.File
+	hpc                  windows.Handle // the pseudo console
+	proc                 *os.Process
+	// exited is closed once the subprocess exits, and done once the
+	// console is closed too, with the result of waiting in err.
+	exited, done chan struct{}
+	err          error
+}
+
+// newConsoleProcess returns a subprocess attached to a pseudo console, if
+// the Parameters ask for a pty.
+func newConsoleProcess(p *Parameters) (process, bool) {
+	if !p.UsePty {
+		return nil, false
+	}
+	return &conptyProcess{path: p.Path, dir: p.WorkingDir, args: p.Args,
+		env: p.environ(), extras: len(p.ExtraStreams)}, true
+}
+
+func (p *conptyProcess) console() {}
+
+// pipes returns the console's streams.  There's no stdErr apart from
+// stdOut, so it's empty.
+func (p *conptyProcess) pipes() (
+	stdIn io.WriteCloser, stdOut, stdErr io.ReadCloser, err error) {
+	if p.inR, p.inW, err = os.Pipe(); err != nil {
+		return nil, nil, nil, fmt.Errorf("getting stdIn; %w", err)
+	}
+	if p.outR, p.outW, err = os.Pipe(); err != nil {
+		p.closePipes()
+		return nil, nil, nil, fmt.Errorf("getting stdOut; %w", err)
+	}
+	out := newConsoleReader(p.outR)
+	return consoleInput{w: p.inW, echo: out}, ioutil.NopCloser(out),
+		ioutil.NopCloser(strings.NewReader("")), nil
+}
+
+func (p *conptyProcess) closePipes() {
+	for _, f := range []*os.File{p.inR, p.inW, p.outR, p.outW} {
+		if f != nil {
+			_ = f.Close()
+		}
+	}
+}
+
+// extraPipes reports that ExtraStreams aren't supported.
+func (p *conptyProcess) extraPipes() ([]io.ReadCloser, error) {
+	if p.extras > 0 {
+		return nil, fmt.Errorf("ExtraStreams aren't supported with a pty on windows")
+	}
+	return nil, nil
+}
+
+// start creates the console, then the subprocess in it.  The console
+// gets copies of its ends of the pipes, so they're closed here, as are the
+// runner's if there's no subprocess.
+func (p *conptyProcess) start() (err error) {
+	defer func() {
+		if err != nil {
+			p.closePipes()
+			return
+		}
+		_ = p.inR.Close()
+		_ = p.outW.Close()
+	}()
+	path, err := exec.LookPath(p.path)
+	if err != nil {
+		return err
+	}
+	size := windows.Coord{X: consoleCols, Y: consoleRows}
+	hr, _, _ := procCreatePseudoConsole.Call(
+		uintptr(*(*uint32)(unsafe.Pointer(&size))), p.inR.Fd(), p.outW.Fd(),
+		0, uintptr(unsafe.Pointer(&p.hpc)))
+	if hr != 0 {
+		return fmt.Errorf("creating pseudo console; HRESULT 0x%x", hr)
+	}
+	if err = p.create(path); err != nil {
+		_, _, _ = procClosePseudoConsole.Call(uintptr(p.hpc))
+		return err
+	}
+	p.exited, p.done = make(chan struct{}), make(chan struct{})
+	go p.await()
+	return nil
+}
+
+// create creates the subprocess, attached to the console.
+func (p *conptyProcess) create(path string) error {
+	attrs, err := windows.NewProcThreadAttributeList(1)
+	if err != nil {
+		return err
+	}
+	defer attrs.Delete()
+	// The attribute's value is the console's handle itself, rather than
+	// a pointer to it, which ProcThreadAttributeListContainer.Update
+	// can't pass.
+	r, _, err := procUpdateProcThreadAttribute.Call(
+		uintptr(unsafe.Pointer(attrs.List())), 0,
+		procThreadAttributePseudoConsole, uintptr(p.hpc),
+		unsafe.Sizeof(p.hpc), 0, 0)
+	if r == 0 {
+		return fmt.Errorf("attaching pseudo console; %w", err)
+	}
+	si := &windows.StartupInfoEx{ProcThreadAttributeList: attrs.List()}
+	si.Cb = uint32(unsafe.Sizeof(*si))
+	cmdLine, err := windows.UTF16PtrFromString(
+		windows.ComposeCommandLine(append([]string{path}, p.args...)))
+	if err != nil {
+		return err
+	}
+	var dir *uint16
+	if p.dir != "" {
+		if dir, err = windows.UTF16PtrFromString(p.dir); err != nil {
+			return err
+		}
+	}
+	env, err := envBlock(p.env)
+	if err != nil {
+		return err
+	}
+	var pi windows.ProcessInformation
+	if err = windows.CreateProcess(nil, cmdLine, nil, nil, false,
+		windows.EXTENDED_STARTUPINFO_PRESENT|windows.CREATE_UNICODE_ENVIRONMENT,
+		env, dir, &si.StartupInfo, &pi); err != nil {
+		return err
+	}
+	defer func() {
+		_ = windows.CloseHandle(pi.Thread)
+		_ = windows.CloseHandle(pi.Process)
+	}()
+	p.proc, err = os.FindProcess(int(pi.ProcessId))
+	return err
+}
+
+// envBlock returns the environment as CreateProcess wants it, or nil to
+// inherit this process'.  For duplicate keys, the last value is used, as
+// by exec.Cmd.  Keys are case-insensitive.
+func envBlock(env []string) (*uint16, error) {
+	if env == nil {
+		return nil, nil
+	}
+	seen := map[string]bool{}
+	var kept []string
+	for i := len(env) - 1; i >= 0; i-- {
+		k := strings.ToUpper(strings.SplitN(env[i], "=", 2)[0])
+		if !seen[k] {
+			seen[k] = true
+			kept = append([]string{env[i]}, kept...)
+		}
+	}
+	var block []uint16
+	for _, kv := range kept {
+		u, err := windows.UTF16FromString(kv)
+		if err != nil {
+			return nil, err
+		}
+		block = append(block, u...)
+	}
+	block = append(block, 0)
+	return &block[0], nil
+}
+
+// await waits for the subprocess to exit, then closes the console, which
+// ends its output once it's read.
+func (p *conptyProcess) await() {
+	state, err := p.proc.Wait()
+	close(p.exited)
+	if err == nil && !state.Success() {
+		err = &exec.ExitError{ProcessState: state}
+	}
+	_, _, _ = procClosePseudoConsole.Call(uintptr(p.hpc))
+	p.err = err
+	close(p.done)
+}
+
+func (p *conptyProcess) started() bool { return p.proc != nil }
+
+// wait waits for the subprocess to exit, then closes the runner's ends of
+// the pipes, as exec.Cmd.Wait does.
+func (p *conptyProcess) wait() error {
+	<-p.done
+	_ = p.inW.Close()
+	_ = p.outR.Close()
+	return p.err
+}
+
+func (p *conptyProcess) signal(sig os.Signal) error { return p.proc.Signal(sig) }
+
+func (p *conptyProcess) kill() error { return p.proc.Kill() }
+
+func (p *conptyProcess) watchExit() <-chan struct{} { return p.exited }
+
+func (p *conptyProcess) String() string {
+	return strings.Join(append([]string{p.path}, p.args...), " ")
+}
@@ -0,0 +1,216 @@
+package clirunner
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// consoleReader reads a console's output, e.g. that of a Windows pseudo
+// console, as the CLI wrote it: less the escape sequences the console
+// writes to redraw itself, and less its echo of input, as a console in
+// line mode prints whatever's typed.  Input is typed via its consoleInput.
+type consoleReader struct {
+	r   io.Reader
+	buf []byte
+	out []byte // filtered output not yet read
+	err error  // from r, returned once out is read
+
+	vt    vtState
+	param int // of the control sequence underway
+
+	m       sync.Mutex // guards typed and partial, from the consoleInput
+	typed   [][]byte   // lines typed, not yet echoed
+	partial []byte     // typed since the last linefeed
+	held    []byte     // output that starts the echo of a typed line
+	ending  bool       // true after an echo, until its line ending
+}
+
+// vtState is where a consoleReader is in an escape sequence.
+type vtState int
+
+const (
+	vtText     vtState = iota
+	vtEscape           // after ESC
+	vtControl          // in a control sequence, after ESC [
+	vtCommand          // in an operating system command, after ESC ]
+	vtCommandE         // after ESC in an operating system command
+	vtCharset          // after ESC ( and the like
+)
+
+// echoWindow is how many typed lines the echo of a line may skip, e.g.
+// as the console didn't echo a password.
+const echoWindow = 4
+
+func newConsoleReader(r io.Reader) *consoleReader {
+	return &consoleReader{r: r, buf: make([]byte, 4096)}
+}
+
+func (c *consoleReader) Read(b []byte) (int, error) {
+	for len(c.out) == 0 && c.err == nil {
+		n, err := c.r.Read(c.buf)
+		c.filter(c.buf[:n])
+		if err != nil {
+			c.m.Lock()
+			c.out = append(c.out, c.held...)
+			c.held = nil
+			c.m.Unlock()
+			c.err = err
+		}
+	}
+	if len(c.out) == 0 {
+		return 0, c.err
+	}
+	n := copy(b, c.out)
+	c.out = c.out[n:]
+	return n, nil
+}
+
+// filter adds the text in data to out.
+func (c *consoleReader) filter(data []byte) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	for _, b := range data {
+		switch c.vt {
+		case vtText:
+			if b == 0x1b {
+				c.vt = vtEscape
+				continue
+			}
+			c.text(b)
+		case vtEscape:
+			switch b {
+			case '[':
+				c.vt, c.param = vtControl, 0
+			case ']':
+				c.vt = vtCommand
+			case '(', ')', '*', '+':
+				c.vt = vtCharset
+			default:
+				c.vt = vtText
+			}
+		case vtControl:
+			switch {
+			case b >= '0' && b <= '9':
+				c.param = c.param*10 + int(b-'0')
+			case b >= 0x40 && b <= 0x7e:
+				c.vt = vtText
+				if b == 'C' {
+					// The console moves its cursor forward over spaces.
+					c.spaces()
+				}
+			}
+		case vtCommand:
+			if b == 0x07 {
+				c.vt = vtText
+			} else if b == 0x1b {
+				c.vt = vtCommandE
+			}
+		case vtCommandE, vtCharset:
+			c.vt = vtText
+		}
+	}
+}
+
+// spaces adds the spaces the cursor moved forward over.
+func (c *consoleReader) spaces() {
+	n := c.param
+	if n == 0 {
+		n = 1
+	}
+	for i := 0; i < n; i++ {
+		c.text(' ')
+	}
+}
+
+// text adds a byte of text to out, unless it's part of an echo.  The
+// caller must hold m.
+func (c *consoleReader) text(b byte) {
+	if c.ending {
+		if b == '\r' {
+			return
+		}
+		c.ending = false
+		if b == '\n' {
+			return
+		}
+	}
+	if len(c.typed) == 0 {
+		c.out = append(c.out, b)
+		return
+	}
+	c.held = append(c.held, b)
+	if c.echoes() {
+		return
+	}
+	// Perhaps the echo starts here instead.
+	c.out = append(c.out, c.held[:len(c.held)-1]...)
+	c.held = append(c.held[:0], b)
+	if c.echoes() {
+		return
+	}
+	c.held = c.held[:0]
+	c.out = append(c.out, b)
+}
+
+// echoes returns true if the held output starts the echo of a typed line,
+// dropping the echo, and any lines typed before it, once it's whole.
+func (c *consoleReader) echoes() bool {
+	for i, line := range c.typed {
+		if i == echoWindow {
+			break
+		}
+		if !bytes.HasPrefix(line, c.held) {
+			continue
+		}
+		if len(line) == len(c.held) {
+			c.typed = c.typed[i+1:]
+			c.held = c.held[:0]
+			c.ending = true
+		}
+		return true
+	}
+	return false
+}
+
+// noteTyped notes what's typed, to drop its echo.  Empty lines are
+// ignored, as their echo is a blank line, which can't be told from output.
+func (c *consoleReader) noteTyped(p []byte) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	for _, b := range p {
+		if b != '\n' {
+			c.partial = append(c.partial, b)
+			continue
+		}
+		if line := dropCR(c.partial); len(line) > 0 {
+			c.typed = append(c.typed, line)
+		}
+		c.partial = nil
+	}
+}
+
+// ctrlZ is the character that, typed at the start of a line and followed
+// by Enter, ends a Windows console's input.
+const ctrlZ = 0x1a
+
+// consoleInput types into a console.  Closing it sends an EOF, as a human
+// would with ctrl-Z, rather than closing the console's input, which is
+// closed once the CLI exits.
+type consoleInput struct {
+	w    io.Writer
+	echo *consoleReader
+}
+
+// Write notes what's typed first, as the echo can beat Write's return.
+func (in consoleInput) Write(p []byte) (int, error) {
+	in.echo.noteTyped(p)
+	return in.w.Write(p)
+}
+
+// Close sends the EOF.  It fails only if the console is gone, along with
+// the CLI, so that's no error.
+func (in consoleInput) Close() error {
+	_, _ = in.w.Write([]byte{ctrlZ, '\r', '\n'})
+	return nil
+}
@@ -0,0 +1,45 @@
+package clirunner
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsoleReader_Escapes(t *testing.T) {
+	out := "\x1b[?25l\x1b[2J\x1b[m\x1b[H\x1b]0;C:\\sqlcmd.exe\x07" +
+		"1>\x1b[3Cid\x1b[4Cname\x1b[K\r\n\x1b(Bdone\x1b]0;x\x1b\\\x1b[?25h\r\n"
+	// Escape sequences survive being split across reads.
+	r := newConsoleReader(iotest.OneByteReader(strings.NewReader(out)))
+	got, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "1>   id    name\r\ndone\r\n", string(got))
+}
+
+func TestConsoleReader_Echo(t *testing.T) {
+	pr, pw := io.Pipe()
+	r := newConsoleReader(pr)
+	var typed bytes.Buffer
+	in := consoleInput{w: &typed, echo: r}
+	go func() {
+		_, _ = in.Write([]byte("select 1\r\nsecret\r\n"))
+		_, _ = in.Write([]byte("echo Rumpel"))
+		_, _ = in.Write([]byte("stiltskin\r\n"))
+		// The password isn't echoed, and the sentinel's echo follows the
+		// first command's output.
+		_, _ = pw.Write([]byte("1> select 1\r\n1\r\nselect\r\n1> ech"))
+		_, _ = pw.Write([]byte("o Rumpelstiltskin\r\nRumpelstiltskin\r\n"))
+		_ = pw.Close()
+	}()
+	got, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "1> 1\r\nselect\r\n1> Rumpelstiltskin\r\n", string(got))
+	assert.NoError(t, in.Close())
+	assert.Equal(t, "select 1\r\nsecret\r\necho Rumpelstiltskin\r\n\x1a\r\n",
+		typed.String())
+}
@@ -0,0 +1,158 @@
+package clirunner
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// ContextRule recognizes a command that changes the CLI's session context,
+// e.g. the current database, namespace or directory.
+type ContextRule struct {
+	// Key names the piece of context, e.g. "database".
+	Key string
+
+	// Pattern matches a context-changing command.  It must have exactly one
+	// capture group, which captures the new value of the context.
+	// Example: `^use\s+(\S+?);?$`
+	Pattern *regexp.Regexp
+
+	// Replay, if not empty, is a fmt format string with one %s verb that
+	// builds a command to re-establish the context from the captured value.
+	// If empty, the original command is replayed verbatim.
+	// Example: "use %s"
+	Replay string
+}
+
+// ContextTracker records the effect of context-changing commands run
+// by a ProcRunner, so that the context can be inspected, and re-established
+// when the CLI subprocess is restarted.
+//
+// A ContextTracker is safe for concurrent use.
+type ContextTracker struct {
+	rules    []ContextRule
+	m        sync.Mutex
+	values   map[string]string // key -> current value
+	commands map[string]string // key -> command to re-establish the value
+	order    []string          // keys in the order they were first set
+}
+
+// NewContextTracker returns a ContextTracker using the given rules, or an error
+// if a rule is malformed.
+func NewContextTracker(rules ...ContextRule) (*ContextTracker, error) {
+	for i, r := range rules {
+		if r.Key == "" {
+			return nil, fmt.Errorf("context rule %d has no Key", i)
+		}
+		if r.Pattern == nil {
+			return nil, fmt.Errorf("context rule %q has no Pattern", r.Key)
+		}
+		if r.Pattern.NumSubexp() != 1 {
+			return nil, fmt.Errorf(
+				"context rule %q pattern must have one capture group", r.Key)
+		}
+	}
+	return &ContextTracker{
+		rules:    rules,
+		values:   make(map[string]string),
+		commands: make(map[string]string),
+	}, nil
+}
+
+// Observe examines a command that ran successfully, recording any context
+// change.  It returns true if the command changed the context.
+func (ct *ContextTracker) Observe(cmd string) bool {
+	ct.m.Lock()
+	defer ct.m.Unlock()
+	changed := false
+	for _, r := range ct.rules {
+		match := r.Pattern.FindStringSubmatch(cmd)
+		if match == nil {
+			continue
+		}
+		if _, seen := ct.values[r.Key]; !seen {
+			ct.order = append(ct.order, r.Key)
+		}
+		ct.values[r.Key] = match[1]
+		if r.Replay == "" {
+			ct.commands[r.Key] = cmd
+		} else {
+			ct.commands[r.Key] = fmt.Sprintf(r.Replay, match[1])
+		}
+		changed = true
+	}
+	return changed
+}
+
+// Current returns a copy of the current context.
+func (ct *ContextTracker) Current() map[string]string {
+	ct.m.Lock()
+	defer ct.m.Unlock()
+	result := make(map[string]string, len(ct.values))
+	for k, v := range ct.values {
+		result[k] = v
+	}
+	return result
+}
+
+// ReplayCommands returns the commands needed to re-establish the current
+// context in a fresh CLI, in the order the context was first established.
+func (ct *ContextTracker) ReplayCommands() []string {
+	ct.m.Lock()
+	defer ct.m.Unlock()
+	result := make([]string, len(ct.order))
+	for i, k := range ct.order {
+		result[i] = ct.commands[k]
+	}
+	return result
+}
+
+// ContextEntry is one piece of the context a ContextTracker tracks.
+type ContextEntry struct {
+	// Key names the piece of context, per its ContextRule.
+	Key string `json:"key"`
+	// Value is its current value.
+	Value string `json:"value"`
+	// Command re-establishes the value in a fresh CLI.
+	Command string `json:"command"`
+}
+
+// Entries returns the current context, in the order it was first
+// established.
+func (ct *ContextTracker) Entries() []ContextEntry {
+	ct.m.Lock()
+	defer ct.m.Unlock()
+	result := make([]ContextEntry, len(ct.order))
+	for i, k := range ct.order {
+		result[i] = ContextEntry{
+			Key: k, Value: ct.values[k], Command: ct.commands[k]}
+	}
+	return result
+}
+
+// withEntries returns a new ContextTracker with the same rules, holding
+// the given context.
+func (ct *ContextTracker) withEntries(entries []ContextEntry) *ContextTracker {
+	result := &ContextTracker{
+		rules:    ct.rules,
+		values:   make(map[string]string),
+		commands: make(map[string]string),
+	}
+	for _, e := range entries {
+		if _, seen := result.values[e.Key]; !seen {
+			result.order = append(result.order, e.Key)
+		}
+		result.values[e.Key] = e.Value
+		result.commands[e.Key] = e.Command
+	}
+	return result
+}
+
+// Clear forgets all context.
+func (ct *ContextTracker) Clear() {
+	ct.m.Lock()
+	defer ct.m.Unlock()
+	ct.values = make(map[string]string)
+	ct.commands = make(map[string]string)
+	ct.order = nil
+}
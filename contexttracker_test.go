@@ -0,0 +1,85 @@
+package clirunner_test
+
+import (
+	"regexp"
+	"testing"
+
+	. "github.com/monopole/clirunner"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTestContextTracker(t *testing.T) *ContextTracker {
+	ct, err := NewContextTracker(
+		ContextRule{
+			Key:     "database",
+			Pattern: regexp.MustCompile(`^use\s+(\S+?);?$`),
+		},
+		ContextRule{
+			Key:     "namespace",
+			Pattern: regexp.MustCompile(`^set\s+ns\s+(\S+?);?$`),
+			Replay:  "set ns %s",
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ct
+}
+
+func TestNewContextTracker_BadRules(t *testing.T) {
+	testCases := map[string]struct {
+		rule     ContextRule
+		expected string
+	}{
+		"noKey": {
+			rule:     ContextRule{Pattern: regexp.MustCompile(`^use (\S+)$`)},
+			expected: "has no Key",
+		},
+		"noPattern": {
+			rule:     ContextRule{Key: "database"},
+			expected: "has no Pattern",
+		},
+		"noGroup": {
+			rule: ContextRule{
+				Key: "database", Pattern: regexp.MustCompile(`^use \S+$`)},
+			expected: "one capture group",
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			_, err := NewContextTracker(tc.rule)
+			if !assert.Error(t, err) {
+				t.Fatal("expecting an error")
+			}
+			assert.Contains(t, err.Error(), tc.expected)
+		})
+	}
+}
+
+func TestContextTracker(t *testing.T) {
+	ct := makeTestContextTracker(t)
+	assert.Empty(t, ct.Current())
+	assert.Empty(t, ct.ReplayCommands())
+
+	assert.False(t, ct.Observe("select * from users;"))
+	assert.True(t, ct.Observe("set ns kube-system;"))
+	assert.True(t, ct.Observe("use inventory;"))
+	assert.True(t, ct.Observe("set ns default;"))
+	assert.Equal(t, map[string]string{
+		"database":  "inventory",
+		"namespace": "default",
+	}, ct.Current())
+	assert.Equal(t, []string{
+		"set ns default",
+		"use inventory;",
+	}, ct.ReplayCommands())
+	assert.Equal(t, []ContextEntry{
+		{Key: "namespace", Value: "default", Command: "set ns default"},
+		{Key: "database", Value: "inventory", Command: "use inventory;"},
+	}, ct.Entries())
+
+	ct.Clear()
+	assert.Empty(t, ct.Current())
+	assert.Empty(t, ct.ReplayCommands())
+	assert.Empty(t, ct.Entries())
+}
@@ -0,0 +1,69 @@
+package clirunner
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"sync"
+)
+
+// debugLogFlags are the flags used by every debug logger.
+const debugLogFlags = log.Ldate | log.Ltime | log.Lshortfile
+
+// newDebugLogger returns a logger writing to w, or discarding everything
+// if w is nil.
+func newDebugLogger(w io.Writer) *log.Logger {
+	if w == nil {
+		w = io.Discard
+	}
+	return log.New(w, "DEBUG: ", debugLogFlags)
+}
+
+// DebugSink multiplexes debug output from many ProcRunners into one
+// io.Writer, tagging every line with the name of the runner that wrote it.
+// Use it as the DebugWriter of each runner's Parameters, via Writer:
+//
+//	sink := NewDebugSink(os.Stderr)
+//	p1.DebugWriter = sink.Writer("inventory")
+//	p2.DebugWriter = sink.Writer("billing")
+//
+// Lines from different runners never interleave mid-line.
+type DebugSink struct {
+	m   sync.Mutex
+	out io.Writer
+}
+
+// NewDebugSink returns a DebugSink writing to the given writer.
+func NewDebugSink(w io.Writer) *DebugSink {
+	return &DebugSink{out: w}
+}
+
+// Writer returns an io.Writer that tags each line written to it with
+// the given name before sending it to the sink.
+func (s *DebugSink) Writer(name string) io.Writer {
+	return &taggedWriter{sink: s, tag: []byte("[" + name + "] ")}
+}
+
+// taggedWriter prefixes lines with a tag.
+type taggedWriter struct {
+	sink *DebugSink
+	tag  []byte
+}
+
+// Write tags each line in p.  A log.Logger calls this once per log entry.
+func (w *taggedWriter) Write(p []byte) (int, error) {
+	var buff bytes.Buffer
+	for _, line := range bytes.SplitAfter(p, []byte{lineFeed}) {
+		if len(line) == 0 {
+			continue
+		}
+		buff.Write(w.tag)
+		buff.Write(line)
+	}
+	w.sink.m.Lock()
+	defer w.sink.m.Unlock()
+	if _, err := w.sink.out.Write(buff.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
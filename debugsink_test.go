@@ -0,0 +1,68 @@
+package clirunner_test
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sync"
+	"testing"
+
+	. "github.com/monopole/clirunner"
+	"github.com/monopole/clirunner/internal/testcli/tstcli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugSink_Writer(t *testing.T) {
+	var out bytes.Buffer
+	sink := NewDebugSink(&out)
+	w1 := sink.Writer("one")
+	w2 := sink.Writer("two")
+	_, err := fmt.Fprint(w1, "hello\n")
+	assert.NoError(t, err)
+	_, err = fmt.Fprint(w2, "first\nsecond\n")
+	assert.NoError(t, err)
+	assert.Equal(t, `
+[one] hello
+[two] first
+[two] second
+`[1:], out.String())
+}
+
+func TestDebugSink_ConcurrentLoggers(t *testing.T) {
+	var out bytes.Buffer
+	sink := NewDebugSink(&out)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			l := log.New(sink.Writer(name), "", 0)
+			for j := 0; j < 100; j++ {
+				l.Println("the quick brown fox")
+			}
+		}(fmt.Sprintf("r%d", i))
+	}
+	wg.Wait()
+	for _, line := range bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n")) {
+		assert.Regexp(t, `^\[r\d\] the quick brown fox$`, string(line))
+	}
+}
+
+func TestRunner_DebugWriter(t *testing.T) {
+	var out bytes.Buffer
+	sink := NewDebugSink(&out)
+	runner, err := NewProcRunner(&Parameters{
+		Name:        "silly",
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+		DebugWriter: sink.Writer("silly"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "silly", runner.Name())
+	assert.NoError(t, runner.RunIgnoringOutput(tstcli.CmdQuery+" limit 1"))
+	assert.NoError(t, runner.Close())
+	assert.Contains(t, out.String(), "[silly] DEBUG: ")
+	assert.Contains(t, out.String(), `created new ProcRunner "silly"`)
+}
@@ -0,0 +1,257 @@
+package clirunner
+
+import (
+	"regexp"
+	"time"
+)
+
+// TimeoutHinter is an optional interface for a Commander that knows how long
+// its command should take, e.g. one that's known to be slow.  The hint is
+// used in place of the default timeout, i.e. when RunIt is given a zero
+// duration, or RunContext a context without a deadline.
+type TimeoutHinter interface {
+	// TimeoutHint returns the time limit for the Commander's runs, or zero
+	// for the default.
+	TimeoutHint() time.Duration
+}
+
+// timeoutFor returns the time limit for a run of the given Commander, given
+// the time limit asked for.
+func timeoutFor(c Commander, timeOut time.Duration) time.Duration {
+	for ; timeOut == 0 && c != nil; c = unwrap(c) {
+		if h, ok := c.(TimeoutHinter); ok {
+			return h.TimeoutHint()
+		}
+	}
+	return timeOut
+}
+
+// The With functions decorate a Commander with some behavior, returning a
+// Commander that wraps it.  They compose, e.g.
+//
+//	WithTimeoutHint(WithFilter(c, notBlank), time.Minute)
+//
+// The command, Success and Reset are those of the wrapped Commander, and
+// the ProcRunner finds its optional interfaces through the wrappers.
+
+// wrapper is the basis of the decorators.
+type wrapper struct {
+	Commander
+}
+
+// Unwrap returns the wrapped Commander.
+func (w *wrapper) Unwrap() Commander { return w.Commander }
+
+// filtered passes only the lines its keep function accepts.
+type filtered struct {
+	wrapper
+	keep func(line []byte) bool
+}
+
+// WithFilter returns a Commander passing to c only the lines for which
+// keep returns true.
+func WithFilter(c Commander, keep func(line []byte) bool) Commander {
+	return &filtered{wrapper: wrapper{c}, keep: keep}
+}
+
+func (f *filtered) Write(line []byte) (int, error) {
+	if !f.keep(line) {
+		return 0, nil
+	}
+	return f.Commander.Write(line)
+}
+
+// transformed rewrites lines with its transform function.
+type transformed struct {
+	wrapper
+	transform func(line []byte) []byte
+}
+
+// WithTransform returns a Commander passing to c each line as rewritten by
+// transform.  If transform returns nil, the line is dropped.
+func WithTransform(
+	c Commander, transform func(line []byte) []byte) Commander {
+	return &transformed{wrapper: wrapper{c}, transform: transform}
+}
+
+func (t *transformed) Write(line []byte) (int, error) {
+	line = t.transform(line)
+	if line == nil {
+		return 0, nil
+	}
+	return t.Commander.Write(line)
+}
+
+// WithPromptStripped returns a Commander passing to c each line with any
+// leading prompts removed, for CLIs that can't be told not to prompt.  The
+// pattern matches one prompt, e.g. `hey<\d+>`; it's applied at the start of
+// the line, repeatedly, since a line can follow several prompts.  Lines
+// that are nothing but prompts are dropped.
+func WithPromptStripped(c Commander, prompt *regexp.Regexp) Commander {
+	leading := regexp.MustCompile(`^(?:` + prompt.String() + `)`)
+	return WithTransform(c, func(line []byte) []byte {
+		stripped := false
+		for {
+			loc := leading.FindIndex(line)
+			if loc == nil || loc[1] == 0 {
+				break
+			}
+			line, stripped = line[loc[1]:], true
+		}
+		if stripped && len(line) == 0 {
+			return nil
+		}
+		return line
+	})
+}
+
+// limited is an OutputLimiter.
+type limited struct {
+	wrapper
+	limit OutputLimit
+}
+
+// WithLimit returns a Commander whose runs have the given OutputLimit,
+// regardless of Parameters.OutputLimit.
+func WithLimit(c Commander, limit OutputLimit) Commander {
+	return &limited{wrapper: wrapper{c}, limit: limit}
+}
+
+// OutputLimit returns the limit.
+func (l *limited) OutputLimit() *OutputLimit {
+	limit := l.limit
+	return &limit
+}
+
+// hinted is a TimeoutHinter.
+type hinted struct {
+	wrapper
+	hint time.Duration
+}
+
+// WithTimeoutHint returns a Commander whose runs, unless told otherwise,
+// have the given time limit.  See TimeoutHinter.
+func WithTimeoutHint(c Commander, d time.Duration) Commander {
+	return &hinted{wrapper: wrapper{c}, hint: d}
+}
+
+// TimeoutHint returns the hint.
+func (h *hinted) TimeoutHint() time.Duration { return h.hint }
+
+// expecting is an Expecter.
+type expecting struct {
+	wrapper
+	expect Expectation
+}
+
+// WithExpectation returns a Commander whose runs have the given
+// Expectation, e.g.
+//
+//	WithExpectation(c, Expectation{
+//		Match:   []*regexp.Regexp{regexp.MustCompile(`^ok$`)},
+//		NoMatch: []*regexp.Regexp{regexp.MustCompile(`(?i)error`)},
+//	})
+func WithExpectation(c Commander, e Expectation) Commander {
+	return &expecting{wrapper: wrapper{c}, expect: e}
+}
+
+// Expectation returns the expectation.
+func (e *expecting) Expectation() *Expectation {
+	expect := e.expect
+	return &expect
+}
+
+// exiting is an ExitExpecter.
+type exiting struct {
+	wrapper
+}
+
+// WithExpectedExit returns a Commander whose command makes the CLI exit,
+// e.g. "quit".  See ExitExpecter.
+func WithExpectedExit(c Commander) Commander {
+	return &exiting{wrapper: wrapper{c}}
+}
+
+// ExpectsExit returns true.
+func (e *exiting) ExpectsExit() bool { return true }
+
+// affine is an AffinityKeyer.
+type affine struct {
+	wrapper
+	key string
+}
+
+// WithAffinity returns a Commander that a ProcRunnerPool runs on the same
+// runner as the others with the given key.  See AffinityKeyer.
+func WithAffinity(c Commander, key string) Commander {
+	return &affine{wrapper: wrapper{c}, key: key}
+}
+
+// AffinityKey returns the key.
+func (a *affine) AffinityKey() string { return a.key }
+
+// readOnlyCmdr is a ReadOnlyMarker.
+type readOnlyCmdr struct {
+	wrapper
+}
+
+// WithReadOnly returns a Commander whose command only reads, e.g. "show
+// tables".  See ReadOnlyMarker.
+func WithReadOnly(c Commander) Commander {
+	return &readOnlyCmdr{wrapper: wrapper{c}}
+}
+
+// ReadOnly returns true.
+func (r *readOnlyCmdr) ReadOnly() bool { return true }
+
+// responding is a Responder.
+type responding struct {
+	wrapper
+	responses []Response
+}
+
+// WithResponses returns a Commander whose runs answer the given prompts.
+// See Responder.
+func WithResponses(c Commander, responses ...Response) Commander {
+	return &responding{wrapper: wrapper{c}, responses: responses}
+}
+
+// Responses returns the responses.
+func (r *responding) Responses() []Response { return r.responses }
+
+// errPoliced is an ErrSentinelPolicer.
+type errPoliced struct {
+	wrapper
+	policy ErrSentinelPolicy
+}
+
+// WithErrSentinelPolicy returns a Commander whose runs have the given
+// ErrSentinelPolicy, regardless of Parameters.ErrSentinelPolicy.
+func WithErrSentinelPolicy(c Commander, p ErrSentinelPolicy) Commander {
+	return &errPoliced{wrapper: wrapper{c}, policy: p}
+}
+
+// ErrSentinelPolicy returns the policy.
+func (e *errPoliced) ErrSentinelPolicy() *ErrSentinelPolicy {
+	policy := e.policy
+	return &policy
+}
+
+// overlaid is an Overlayer.
+type overlaid struct {
+	wrapper
+	overlay CommandOverlay
+}
+
+// WithOverlay returns a Commander whose runs issue the pre commands before
+// its command, and the post commands after it.  See CommandOverlay.
+func WithOverlay(c Commander, pre, post []string) Commander {
+	return &overlaid{wrapper: wrapper{c},
+		overlay: CommandOverlay{Pre: pre, Post: post}}
+}
+
+// CommandOverlay returns the overlay.
+func (o *overlaid) CommandOverlay() *CommandOverlay {
+	overlay := o.overlay
+	return &overlay
+}
@@ -0,0 +1,118 @@
+package clirunner_test
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/monopole/clirunner/internal/testcli/tstcli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecorators(t *testing.T) {
+	notBlank := func(line []byte) bool { return len(line) > 0 }
+	upper := func(line []byte) []byte { return bytes.ToUpper(line) }
+	dropX := func(line []byte) []byte {
+		if bytes.Equal(line, []byte("x")) {
+			return nil
+		}
+		return line
+	}
+	testCases := map[string]struct {
+		decorate func(c Commander) Commander
+		expected string
+	}{
+		"none": {
+			decorate: func(c Commander) Commander { return c },
+			expected: "a\n\nx\nb\n",
+		},
+		"filter": {
+			decorate: func(c Commander) Commander { return WithFilter(c, notBlank) },
+			expected: "a\nx\nb\n",
+		},
+		"transform": {
+			decorate: func(c Commander) Commander { return WithTransform(c, upper) },
+			expected: "A\n\nX\nB\n",
+		},
+		"transformDrops": {
+			decorate: func(c Commander) Commander { return WithTransform(c, dropX) },
+			expected: "a\n\nb\n",
+		},
+		"promptStripped": {
+			decorate: func(c Commander) Commander {
+				return WithPromptStripped(c, regexp.MustCompile(`[ax]`))
+			},
+			expected: "\nb\n",
+		},
+		"composed": {
+			decorate: func(c Commander) Commander {
+				return WithTimeoutHint(WithTransform(
+					WithFilter(c, notBlank), upper), time.Minute)
+			},
+			expected: "A\nX\nB\n",
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			h := NewHoardingCommander("cmd")
+			c := tc.decorate(h)
+			assert.Equal(t, "cmd", c.String())
+			for _, l := range []string{"a", "", "x", "b"} {
+				_, err := c.Write([]byte(l))
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expected, h.Result())
+			assert.True(t, c.Success())
+			c.Reset()
+			assert.Equal(t, "", h.Result())
+		})
+	}
+}
+
+func TestRunner_Run_Decorated(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+	})
+	assert.NoError(t, err)
+
+	// The runner finds the limit through the other wrappers.
+	h := NewHoardingCommander(tstcli.CmdQuery + " limit 5")
+	err = runner.RunIt(WithFilter(
+		WithLimit(h, OutputLimit{MaxLines: 2}),
+		func([]byte) bool { return true }), testingTimeout)
+	var le *OutputLimitError
+	assert.True(t, errors.As(err, &le), "got %v", err)
+	assert.Equal(t, 2, bytes.Count([]byte(h.Result()), []byte("\n")))
+
+	assert.NoError(t, runner.Close())
+
+	// Prompts are stripped, however many there are.
+	runner, err = NewProcRunner(&Parameters{
+		Path:        tstcli.TestCliPath,
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+	})
+	assert.NoError(t, err)
+	h = NewHoardingCommander(tstcli.CmdQuery + " limit 1")
+	assert.NoError(t, runner.RunIt(
+		WithPromptStripped(h, regexp.MustCompile(`hey<\d+>`)), testingTimeout))
+	assert.Equal(t, `
+Cempedak_|_Bamberga_|_4_|_00000000000000000000000000000001
+`[1:], h.Result())
+
+	// The hint replaces the default timeout, but not an explicit one.
+	h = NewHoardingCommander(tstcli.CmdSleep + " 300ms")
+	assert.NoError(t, runner.RunIt(
+		WithTimeoutHint(h, 10*time.Millisecond), testingTimeout))
+	start := time.Now()
+	assert.Error(t, runner.RunIt(WithTimeoutHint(h, 10*time.Millisecond), 0))
+	assert.Less(t, int64(time.Since(start)), int64(250*time.Millisecond))
+	assert.NoError(t, runner.Restart())
+}
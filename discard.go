@@ -0,0 +1,149 @@
+package clirunner
+
+import (
+	"sync"
+)
+
+// Discarder is an optional interface for a Commander that ignores the
+// output of its command, e.g. a cmdrs.KondoCommander.
+//
+// If the Commander handed to RunIt says it discards output, the ProcRunner
+// drops the lines that can't hold a sentinel as soon as they're read, rather
+// than copying each and passing it through the filter to the Commander.  That
+// makes fire-and-forget commands with huge output much cheaper.  The dropped
+// lines are still counted in the RunReport, but the Commander never sees
+// them, and a timeout error can't quote them.
+//
+// The fast path is taken only if the sentinels can say which lines might
+// be theirs (see SentinelScreener), and nothing else wants the lines, i.e.
+// there's no OutputCheck, OutputLimit, Expectation, FatalLinePatterns,
+// TruncationPatterns, SentinelPhaseCommander, OutputSink, or Stream.
+// Otherwise the Commander gets its lines as usual.
+type Discarder interface {
+	// Discard returns true if the Commander has no use for its output.
+	Discard() bool
+}
+
+// discards returns true if the Commander, or one it wraps, says it
+// discards output.
+func discards(c Commander) bool {
+	for ; c != nil; c = unwrap(c) {
+		if d, ok := c.(Discarder); ok {
+			return d.Discard()
+		}
+	}
+	return false
+}
+
+// SentinelScreener is an optional interface for a SentinelStrategy that
+// can tell cheaply which lines can't possibly match, e.g. those lacking a
+// token.  The strategies made by StrategyFromCommander, NewTokenStrategy and
+// NewExitCodeSentinel implement it, the first if its sentinel Commander does.
+type SentinelScreener interface {
+	// Screen returns a function that returns false for a line that can't
+	// match, given the command last issued.  The function may be called
+	// from another goroutine, so mustn't use the strategy's state beyond
+	// what it captures.  Screen returns nil if the strategy can't tell.
+	Screen() func(line []byte) bool
+}
+
+// screenFor returns the strategy's screen, or nil if it hasn't one.
+func screenFor(s SentinelStrategy) func([]byte) bool {
+	if sc, ok := s.(SentinelScreener); ok {
+		return sc.Screen()
+	}
+	return nil
+}
+
+// dropAll is the screen of an absent sentinel.
+func dropAll([]byte) bool { return false }
+
+// discardSlot holds the screens of a run that discards its output, so that
+// the stream scanners can drop the lines that can't hold a sentinel.  Like
+// framingSlot, it's shared with any warm standby.
+type discardSlot struct {
+	mu       sync.Mutex
+	out, err func([]byte) bool // nil unless discarding
+	counts   lineCounts        // lines dropped since open
+}
+
+// open starts dropping lines that fail the screens.
+func (s *discardSlot) open(out, err func([]byte) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.out, s.err = out, err
+	s.counts = lineCounts{}
+}
+
+// close stops dropping lines, returning the counts of those dropped.
+func (s *discardSlot) close() lineCounts {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.out, s.err = nil, nil
+	c := s.counts
+	s.counts = lineCounts{}
+	return c
+}
+
+// admit returns true if a line read from the given stream is to be passed
+// on, and false, counting it, if it's to be dropped.
+func (s *discardSlot) admit(stream Stream, line []byte) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stream == StreamErr {
+		if s.err == nil || s.err(line) {
+			return true
+		}
+		s.counts.linesErr++
+		s.counts.bytesErr += len(line)
+		return false
+	}
+	if s.out == nil || s.out(line) {
+		return true
+	}
+	s.counts.linesOut++
+	s.counts.bytesOut += len(line)
+	return false
+}
+
+// startDiscarding opens the filter's discardSlot, if the current run's
+// Commander discards its output and nothing else wants the lines.  It's
+// called once the sentinels are issued, so their screens know what to look
+// for.  It returns true if it opened the slot.
+func (cw *sentinelFilter) startDiscarding() bool {
+	if cw.discard == nil || !discards(cw.theCmdr) || cw.check != nil ||
+		len(cw.fatal) > 0 || len(cw.truncation) > 0 || cw.phaseCmdr != nil {
+		return false
+	}
+	cw.cmdrLock.Lock()
+	wanted := cw.tap != nil || cw.runLimit != nil || cw.sink != nil ||
+		cw.expect != nil
+	cw.cmdrLock.Unlock()
+	if wanted {
+		return false
+	}
+	out := screenFor(cw.outSentinel)
+	if out == nil {
+		return false
+	}
+	es := dropAll
+	if cw.errSentinel != nil {
+		if es = screenFor(cw.errSentinel); es == nil {
+			return false
+		}
+	}
+	cw.discard.open(out, es)
+	return true
+}
+
+// stopDiscarding closes the filter's discardSlot, counting the lines it
+// dropped as delivered.
+func (cw *sentinelFilter) stopDiscarding() {
+	c := cw.discard.close()
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	cw.counts.linesOut += c.linesOut
+	cw.counts.linesErr += c.linesErr
+	cw.counts.bytesOut += c.bytesOut
+	cw.counts.bytesErr += c.bytesErr
+}
@@ -0,0 +1,27 @@
+package clirunner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscardSlot(t *testing.T) {
+	var s discardSlot
+	assert.True(t, s.admit(StreamOut, []byte("anything")))
+
+	ts, err := NewTokenStrategy("echo " + TokenPlaceholder)
+	assert.NoError(t, err)
+	assert.Nil(t, screenFor(ts))
+	cmd := ts.IssueAfter("ls")
+	s.open(screenFor(ts), dropAll)
+	assert.False(t, s.admit(StreamOut, []byte("hello")))
+	assert.False(t, s.admit(StreamErr, []byte("oops")))
+	assert.True(t, s.admit(StreamOut, []byte(cmd[len("echo "):])))
+	assert.Equal(t, lineCounts{
+		linesOut: 1, linesErr: 1, bytesOut: 5, bytesErr: 4}, s.close())
+
+	// A closed slot passes everything.
+	assert.True(t, s.admit(StreamOut, []byte("hello")))
+	assert.Equal(t, lineCounts{}, s.close())
+}
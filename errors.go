@@ -0,0 +1,292 @@
+package clirunner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrRunnerClosed is the cause of a run canceled by Close.
+var ErrRunnerClosed = errors.New("runner closed")
+
+// TimeoutButRecoveredError is returned by RunIt when a command failed to
+// complete in the allotted time, but interrupting it (see
+// Parameters.InterruptSignal) brought the CLI back to a usable state.
+//
+// The ProcRunner remains usable.  The Commander saw every line of output
+// that arrived before the deadline, and whatever the interrupt provoked,
+// so its results are likely incomplete.
+type TimeoutButRecoveredError struct {
+	// Command is the command that timed out.
+	Command string
+	// TimeOut is the duration that expired.
+	TimeOut time.Duration
+	// Tail holds the most recent lines of output before the deadline, up
+	// to Parameters.TimeoutTailLines.
+	Tail []Line
+}
+
+func (e *TimeoutButRecoveredError) Error() string {
+	return fmt.Sprintf(
+		"in command %q, time %s expired; command interrupted, session recovered; %s",
+		e.Command, e.TimeOut, describeTail(e.Tail))
+}
+
+// RunCanceledError is returned by RunIt when a command was canceled before
+// its sentinels were seen, e.g. by a call to Close.  The Commander saw
+// every line of output that arrived before cancellation, and none after.
+type RunCanceledError struct {
+	// Command is the command that was canceled.
+	Command string
+	// Cause says why, e.g. ErrRunnerClosed.
+	Cause error
+}
+
+func (e *RunCanceledError) Error() string {
+	return fmt.Sprintf("command %q canceled; %v", e.Command, e.Cause)
+}
+
+// Unwrap returns the Cause.
+func (e *RunCanceledError) Unwrap() error {
+	return e.Cause
+}
+
+// SpoolError is returned by RunIt when a Spooler's output couldn't be
+// spooled, or the Spooler failed reading it.  The command itself
+// completed, and the ProcRunner remains usable.
+type SpoolError struct {
+	// Command is the command whose output was spooled.
+	Command string
+	// Cause says what failed.
+	Cause error
+}
+
+func (e *SpoolError) Error() string {
+	return fmt.Sprintf("spooling output of command %q; %v", e.Command, e.Cause)
+}
+
+// Unwrap returns the Cause.
+func (e *SpoolError) Unwrap() error {
+	return e.Cause
+}
+
+// KeepaliveError is the error a runner enters its error state with when
+// a Keepalive probe fails, e.g. times out; the CLI is killed.  The next
+// run fails over to a warm standby, if there is one, or fails at once.
+type KeepaliveError struct {
+	// Command is the probe's command.
+	Command string
+	// Cause says why the probe failed.
+	Cause error
+}
+
+func (e *KeepaliveError) Error() string {
+	return fmt.Sprintf("keepalive probe %q failed; %v", e.Command, e.Cause)
+}
+
+// Unwrap returns the Cause.
+func (e *KeepaliveError) Unwrap() error {
+	return e.Cause
+}
+
+// OutputMismatchError is returned by RunIt when, per Parameters.OutputCheck,
+// the CLI reported a different amount of output than the Commander
+// received, or no report was seen.  The command itself completed, and the
+// ProcRunner remains usable, but the Commander's results are suspect.
+type OutputMismatchError struct {
+	// Command is the command whose output was checked.
+	Command string
+	// Reported is what the CLI reported, or nil if no report was seen.
+	Reported *OutputTally
+	// Received is what the Commander received.
+	Received OutputTally
+}
+
+func (e *OutputMismatchError) Error() string {
+	if e.Reported == nil {
+		return fmt.Sprintf(
+			"in command %q, no output report seen; received %d lines, %d bytes",
+			e.Command, e.Received.Lines, e.Received.Bytes)
+	}
+	return fmt.Sprintf(
+		"in command %q, CLI reported %d lines, %d bytes; "+
+			"received %d lines, %d bytes",
+		e.Command, e.Reported.Lines, e.Reported.Bytes,
+		e.Received.Lines, e.Received.Bytes)
+}
+
+// OutputTruncatedError is returned by RunIt when, per
+// Parameters.FailOnTruncation, the CLI said it cut a command's output short,
+// per Parameters.TruncationPatterns.  The command itself completed, and the
+// ProcRunner remains usable, but the Commander's results are incomplete.
+type OutputTruncatedError struct {
+	// Command is the command whose output was truncated.
+	Command string
+	// Line is the first line saying so.
+	Line Line
+	// Pattern is the pattern it matched.
+	Pattern string
+}
+
+func (e *OutputTruncatedError) Error() string {
+	return fmt.Sprintf("in command %q, output truncated per std%s: %q (matched %q)",
+		e.Command, e.Line.Stream, e.Line.Data, e.Pattern)
+}
+
+// ExpectationError is returned by RunIt when a command's output falls
+// short of its Expectation.  The command itself completed, and the
+// ProcRunner remains usable.
+type ExpectationError struct {
+	// Command is the command whose output was checked.
+	Command string
+	// Missing holds the Match patterns no line matched.
+	Missing []string
+	// Forbidden holds the first few lines that matched NoMatch patterns.
+	Forbidden []Line
+	// Lines is the number of lines of output on stdOut.
+	Lines int
+	// MinLines and MaxLines are the Expectation's range of lines.
+	MinLines, MaxLines int
+}
+
+func (e *ExpectationError) Error() string {
+	var problems []string
+	for _, m := range e.Missing {
+		problems = append(problems, fmt.Sprintf("no line matched %q", m))
+	}
+	for _, l := range e.Forbidden {
+		problems = append(problems, fmt.Sprintf(
+			"unwanted line on std%s %q", l.Stream, string(l.Data)))
+	}
+	if e.Lines < e.MinLines || (e.MaxLines > 0 && e.Lines > e.MaxLines) {
+		want := fmt.Sprintf("at least %d", e.MinLines)
+		if e.MaxLines > 0 {
+			want = fmt.Sprintf("%d to %d", e.MinLines, e.MaxLines)
+		}
+		problems = append(problems, fmt.Sprintf(
+			"%d lines of output, expected %s", e.Lines, want))
+	}
+	return fmt.Sprintf("in command %q, %s",
+		e.Command, strings.Join(problems, "; "))
+}
+
+// ExpectTimeoutError is returned by an ExpectSession's Expect when no line
+// matched its patterns in time.
+type ExpectTimeoutError struct {
+	// Patterns are the patterns expected.
+	Patterns []string
+	// TimeOut is how long the Expect waited.
+	TimeOut time.Duration
+	// Unmatched holds the lines received but not yet consumed.
+	Unmatched []Line
+}
+
+func (e *ExpectTimeoutError) Error() string {
+	return fmt.Sprintf("no line matched %q within %s; %d unmatched lines",
+		e.Patterns, e.TimeOut, len(e.Unmatched))
+}
+
+// OutputLimitError is returned by RunIt when a command's output exceeded
+// its OutputLimit.  The Commander received the output up to the limit.
+// Whether the ProcRunner remains usable depends on the limit's Policy.
+type OutputLimitError struct {
+	// Command is the command whose output was limited.
+	Command string
+	// Limit is the limit that was exceeded.
+	Limit OutputLimit
+}
+
+func (e *OutputLimitError) Error() string {
+	return fmt.Sprintf(
+		"in command %q, output exceeded limit of %d lines, %d bytes",
+		e.Command, e.Limit.MaxLines, e.Limit.MaxBytes)
+}
+
+// FatalLineError is returned by RunIt when a line of output matched one of
+// Parameters.FatalLinePatterns, meaning the session is dead, e.g. "server
+// has gone away".  The Commander saw the output up to and including the
+// line.  The subprocess is killed, and the ProcRunner enters its error
+// state, unless Parameters.RestartOnFatal is true, in which case the next
+// run starts a new CLI.
+type FatalLineError struct {
+	// Command is the command that was running.
+	Command string
+	// Line is the line that matched.
+	Line Line
+	// Pattern is the pattern it matched.
+	Pattern string
+}
+
+func (e *FatalLineError) Error() string {
+	return fmt.Sprintf("in command %q, fatal output on std%s: %q (matched %q)",
+		e.Command, e.Line.Stream, e.Line.Data, e.Pattern)
+}
+
+// SubprocessExitedError is returned by RunIt when the CLI subprocess exited
+// before its sentinels were seen, but its output streams stayed open, e.g.
+// because the CLI left behind a descendant holding them.  The Commander
+// saw the output that arrived before the exit.  The ProcRunner enters its
+// error state; see Restart.
+type SubprocessExitedError struct {
+	// Command is the command that was running.
+	Command string
+}
+
+func (e *SubprocessExitedError) Error() string {
+	return fmt.Sprintf(
+		"subprocess exited while running %q, no sentinel detected", e.Command)
+}
+
+// StdOutClosedError is returned by RunIt when the CLI closed its stdOut but
+// kept running, so the out sentinel can't be seen.  With a required
+// ErrSentinel, runs end on it alone instead, with a warning.  The Commander
+// saw the output that arrived before stdOut closed.  The ProcRunner enters
+// its error state; see Restart.
+type StdOutClosedError struct {
+	// Command is the command that was running.
+	Command string
+}
+
+func (e *StdOutClosedError) Error() string {
+	return fmt.Sprintf(
+		"stdOut closed while running %q, but the subprocess is running", e.Command)
+}
+
+// RestartBudgetExhaustedError is returned by RunIt once a supervised
+// runner has relaunched its CLI as often as its Supervision's
+// RestartBudget allows, and the CLI exited again.  The runner stays in its
+// error state until Restart.
+type RestartBudgetExhaustedError struct {
+	// Restarts is the number of relaunches within the Window.
+	Restarts int
+	// Window is the Supervision's RestartWindow.
+	Window time.Duration
+}
+
+func (e *RestartBudgetExhaustedError) Error() string {
+	return fmt.Sprintf("restart budget exhausted; CLI relaunched %d times within %s",
+		e.Restarts, e.Window)
+}
+
+// ReplayMismatchError is returned by a ReplayRunner when a command isn't
+// the one next in its Transcript.  Nothing is replayed, and the runner
+// still expects the same command.
+type ReplayMismatchError struct {
+	// Index is the index of the exchange expected next.
+	Index int
+	// Want is the command expected, or empty if the transcript is done.
+	Want string
+	// Got is the command given.
+	Got string
+}
+
+func (e *ReplayMismatchError) Error() string {
+	if e.Want == "" {
+		return fmt.Sprintf(
+			"command %q given after all %d exchanges were replayed",
+			e.Got, e.Index)
+	}
+	return fmt.Sprintf("exchange %d is of command %q, not %q",
+		e.Index, e.Want, e.Got)
+}
@@ -10,7 +10,7 @@ type errorTracker struct {
 }
 
 func (et *errorTracker) log(err error) {
-	if err == nil {
+	if et == nil || err == nil {
 		return
 	}
 	et.m.Lock()
@@ -19,7 +19,12 @@ func (et *errorTracker) log(err error) {
 }
 
 func (et *errorTracker) lastError() error {
-	if et == nil || len(et.errs) == 0 {
+	if et == nil {
+		return nil
+	}
+	et.m.Lock()
+	defer et.m.Unlock()
+	if len(et.errs) == 0 {
 		return nil
 	}
 	return et.errs[len(et.errs)-1]
@@ -0,0 +1,127 @@
+package clirunner
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultErrSentinelGrace is the default for ErrSentinelPolicy.Grace.
+const DefaultErrSentinelGrace = 100 * time.Millisecond
+
+// ErrSentinelPolicy says how a run uses the ErrSentinel (or ErrStrategy),
+// since CLIs flush stdErr with different timing.  It has no effect without
+// one.
+type ErrSentinelPolicy struct {
+	// IssueFirst, if true, issues the ErrSentinel's command before the
+	// OutSentinel's, rather than after.  Don't use it with sentinels that
+	// must follow the command, e.g. those made by NewExitCodeSentinel.
+	IssueFirst bool
+
+	// Optional, if true, lets a run whose OutSentinel was seen succeed even
+	// if its ErrSentinel doesn't show up within Grace, with a warning in
+	// its RunReport, rather than waiting out the time limit and failing.
+	// Lines arriving on stdErr after that go to the run's Commander until
+	// the next run begins, so a late sentinel's output might too.
+	Optional bool
+
+	// Grace is how long after the OutSentinel an optional ErrSentinel is
+	// awaited.  If zero, DefaultErrSentinelGrace.
+	Grace time.Duration
+}
+
+// ErrSentinelPolicer is an optional interface for a Commander whose runs
+// need an ErrSentinelPolicy other than the one specified in Parameters.
+type ErrSentinelPolicer interface {
+	// ErrSentinelPolicy returns the policy for the Commander's runs, or nil
+	// for the usual one: ErrSentinel issued last, and required.
+	ErrSentinelPolicy() *ErrSentinelPolicy
+}
+
+// errPolicyFor returns the policy for a run of the given Commander, given
+// the default policy, either of which might be nil.
+func errPolicyFor(c Commander, dflt *ErrSentinelPolicy) *ErrSentinelPolicy {
+	for ; c != nil; c = unwrap(c) {
+		if p, ok := c.(ErrSentinelPolicer); ok {
+			return p.ErrSentinelPolicy()
+		}
+	}
+	return dflt
+}
+
+// validate looks for trouble.
+func (p *ErrSentinelPolicy) validate() error {
+	if p.Grace < 0 {
+		return fmt.Errorf("ErrSentinelPolicy Grace %s can't be negative", p.Grace)
+	}
+	return nil
+}
+
+func (p *ErrSentinelPolicy) issueFirst() bool { return p != nil && p.IssueFirst }
+
+func (p *ErrSentinelPolicy) optional() bool { return p != nil && p.Optional }
+
+func (p *ErrSentinelPolicy) grace() time.Duration {
+	if p == nil || p.Grace == 0 {
+		return DefaultErrSentinelGrace
+	}
+	return p.Grace
+}
+
+// awaitErrSentinel waits out the grace period for an optional ErrSentinel,
+// once the OutSentinel was seen.  If it's missing, the stdErr filter, which
+// closes errDone when it returns with errErr, is stopped by closing
+// errStop, the lines that already arrived on stdErr are delivered, and the
+// rest are passed through until the passThru stop channel is closed.
+func (cw *sentinelFilter) awaitErrSentinel(
+	errDone, errStop chan struct{}, errErr *error,
+	chErr <-chan []byte, stop chan struct{}) {
+	grace := cw.runErrPolicy.grace()
+	t := cw.clock.NewTimer(grace)
+	defer t.Stop()
+	select {
+	case <-errDone:
+		return
+	case <-t.C():
+	}
+	close(errStop)
+	<-errDone
+	var sce *streamClosedError
+	if !errors.As(*errErr, &sce) {
+		// It showed up just in time, or the filter failed on its own.
+		return
+	}
+	*errErr = nil
+	cw.warn(fmt.Sprintf("no err sentinel within %s of the out sentinel", grace))
+	for {
+		select {
+		case line, ok := <-chErr:
+			if !ok {
+				return
+			}
+			if err := cw.deliver(StreamErr, line); err != nil {
+				*errErr = err
+				return
+			}
+		default:
+			go cw.passThru(StreamErr, new(error),
+				&lineSource{ch: chErr, stop: stop}, make(chan struct{}))
+			return
+		}
+	}
+}
+
+// warn notes a warning about the current run, for its RunReport.
+func (cw *sentinelFilter) warn(w string) {
+	cw.logger.Printf("warning: %s\n", w)
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	cw.warnings = append(cw.warnings, w)
+}
+
+// runWarnings returns the warnings about the current run.
+func (cw *sentinelFilter) runWarnings() []string {
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	return append([]string(nil), cw.warnings...)
+}
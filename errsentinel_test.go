@@ -0,0 +1,76 @@
+package clirunner_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeErrSentinelHarness(t *testing.T, policy *ErrSentinelPolicy) *Harness {
+	return makeHarness(t, func(p *Parameters) {
+		p.ErrSentinel = &SimpleSentinelCommander{
+			Command: "oops",
+			Value:   "unknown command oops",
+		}
+		p.ErrSentinelPolicy = policy
+	})
+}
+
+func TestRunner_ErrSentinelPolicy(t *testing.T) {
+	h := makeErrSentinelHarness(t, nil)
+
+	// By default, the err sentinel comes last, and is required.
+	result := runAsync(h, NewHoardingCommander("list"), time.Hour)
+	expectCommands(t, h, "list", "echo Rumpelstiltskin", "oops")
+	assert.NoError(t, h.Out("Rumpelstiltskin"))
+	assert.NoError(t, h.Err("unknown command oops"))
+	assert.NoError(t, <-result)
+
+	// A Commander can have it issued first.
+	c := WithErrSentinelPolicy(
+		NewHoardingCommander("list"), ErrSentinelPolicy{IssueFirst: true})
+	result = runAsync(h, c, time.Hour)
+	expectCommands(t, h, "list", "oops", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Err("unknown command oops"))
+	assert.NoError(t, h.Out("Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	assert.NoError(t, h.Runner.Close())
+}
+
+func TestRunner_ErrSentinelOptional(t *testing.T) {
+	h := makeErrSentinelHarness(t,
+		&ErrSentinelPolicy{Optional: true, Grace: time.Second})
+
+	// A missing err sentinel makes for a warning, not a failure.
+	c := NewHoardingCommander("list")
+	result := runAsync(h, c, time.Hour)
+	expectCommands(t, h, "list", "echo Rumpelstiltskin", "oops")
+	assert.NoError(t, h.Err("warming up"))
+	assert.NoError(t, h.Out("tables", "Rumpelstiltskin"))
+	// The run's time limit, and the grace period.
+	h.Clock.AwaitTimers(2)
+	h.Clock.Advance(time.Second)
+	assert.NoError(t, <-result)
+	assert.Contains(t, c.Result(), "tables\n")
+	assert.Contains(t, c.Result(), "warming up\n")
+	r, _ := h.Runner.LastRunReport()
+	assert.Equal(t,
+		[]string{"no err sentinel within 1s of the out sentinel"}, r.Warnings)
+
+	// One that shows up in time makes for no warning.
+	c = NewHoardingCommander("list")
+	result = runAsync(h, c, time.Hour)
+	expectCommands(t, h, "list", "echo Rumpelstiltskin", "oops")
+	// The previous run's late err sentinel goes to the previous Commander,
+	// or to nobody.
+	assert.NoError(t, h.Out("tables", "Rumpelstiltskin"))
+	assert.NoError(t, h.Err("unknown command oops"))
+	assert.NoError(t, <-result)
+	assert.Equal(t, "tables\n", c.Result())
+	r, _ = h.Runner.LastRunReport()
+	assert.Empty(t, r.Warnings)
+	assert.NoError(t, h.Runner.Close())
+}
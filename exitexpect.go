@@ -0,0 +1,56 @@
+package clirunner
+
+import (
+	"errors"
+	"time"
+)
+
+// ExitExpecter is an optional interface for a Commander whose command
+// makes the CLI exit, e.g. "quit" or "shutdown".  If the CLI exits cleanly,
+// i.e. with status zero, during such a run, the run succeeds even though
+// the sentinels weren't seen, and the runner is left uninitialized rather
+// than in its error state; the next run starts a new CLI.  The Commander
+// saw the output that arrived before the exit.  The exit isn't a crash,
+// so a supervised CLI isn't relaunched.  See WithExpectedExit.
+//
+// If the CLI exits with an error, or doesn't exit, the run fails as usual.
+type ExitExpecter interface {
+	// ExpectsExit returns true if the CLI may exit during the Commander's
+	// runs.
+	ExpectsExit() bool
+}
+
+// expectsExit returns true if the CLI may exit during runs of the given
+// Commander.
+func expectsExit(c Commander) bool {
+	for ; c != nil; c = unwrap(c) {
+		if e, ok := c.(ExitExpecter); ok {
+			return e.ExpectsExit()
+		}
+	}
+	return false
+}
+
+// isExitError returns true if the error of a run is one the CLI's exit
+// would cause: a stream closing, or the subprocess exiting with its
+// streams open.
+func isExitError(err error) bool {
+	var sce *streamClosedError
+	var see *SubprocessExitedError
+	return errors.As(err, &sce) || errors.As(err, &see)
+}
+
+// exitedCleanly waits the given duration for the subprocess to exit,
+// returning true if it exited without error.  Then it forgets the
+// subprocess, as Restart does, leaving the runner uninitialized.  The
+// caller must hold mutexState.
+func (pr *ProcRunner) exitedCleanly(d time.Duration) bool {
+	if pr.awaitExit(d) != nil || pr.lastError() != nil {
+		return false
+	}
+	pr.logger.Println("subprocess exited as expected")
+	pr.leaving = pr.proc
+	pr.proc = nil
+	pr.infraErrors = nil
+	return true
+}
@@ -0,0 +1,59 @@
+package clirunner_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunner_ExpectedExit(t *testing.T) {
+	h := makeHarness(t)
+	c := NewHoardingCommander("shutdown")
+	result := runAsync(h, WithExpectedExit(c), time.Hour)
+	expectCommands(t, h, "shutdown", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("bye"))
+	h.Exit(nil)
+	assert.NoError(t, <-result)
+	assert.Equal(t, "bye\n", c.Result())
+	assert.Equal(t, "uninitialized", h.Runner.Report().State)
+
+	// The next run starts a new CLI.
+	result = runAsync(h, NewHoardingCommander("again"), time.Hour)
+	expectCommands(t, h, "again", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	assert.Equal(t, 2, h.Starts())
+	assert.NoError(t, h.Runner.Close())
+}
+
+func TestRunner_ExpectedExitFails(t *testing.T) {
+	h := makeHarness(t)
+	result := runAsync(h,
+		WithExpectedExit(NewHoardingCommander("shutdown")), time.Hour)
+	expectCommands(t, h, "shutdown", "echo Rumpelstiltskin")
+	h.Exit(errors.New("exit status 3"))
+	assert.Error(t, <-result)
+	assert.Equal(t, "error", h.Runner.Report().State)
+	assert.Error(t, h.Runner.Close())
+}
+
+func TestRunner_ExpectedExitSupervised(t *testing.T) {
+	h := makeHarness(t, func(p *Parameters) {
+		p.Supervise = &Supervision{Backoff: time.Second}
+	})
+	result := runAsync(h,
+		WithExpectedExit(NewHoardingCommander("quit")), time.Hour)
+	expectCommands(t, h, "quit", "echo Rumpelstiltskin")
+	h.Exit(nil)
+	assert.NoError(t, <-result)
+	// The exit was no crash, so there's no relaunch.
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 0, h.Clock.Timers())
+	assert.Equal(t, 1, h.Starts())
+	assert.Equal(t, "uninitialized", h.Runner.Report().State)
+	assert.NoError(t, h.Runner.Close())
+}
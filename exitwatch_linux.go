@@ -0,0 +1,33 @@
+package clirunner
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// idTypePid is waitid's P_PID, to wait for one particular process.
+const idTypePid = 1
+
+// watchExit returns a channel that's closed when the process with the given
+// pid exits, whether or not its output streams are closed (e.g. they might
+// be held open by its descendants).  The process isn't reaped, so that
+// exec.Cmd.Wait still works.
+func watchExit(pid int) <-chan struct{} {
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		// Room for a siginfo_t, which we don't look at.
+		var info [128]byte
+		for {
+			_, _, errno := syscall.Syscall6(syscall.SYS_WAITID, idTypePid,
+				uintptr(pid), uintptr(unsafe.Pointer(&info[0])),
+				syscall.WEXITED|syscall.WNOWAIT, 0, 0)
+			// Any error but an interrupt (e.g. ECHILD, because the process
+			// was already reaped) means there's nothing left to wait for.
+			if errno != syscall.EINTR {
+				return
+			}
+		}
+	}()
+	return exited
+}
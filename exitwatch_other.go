@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package clirunner
+
+// watchExit returns nil, a channel that's never closed; the exit of the
+// subprocess is noticed when its output streams close.
+func watchExit(pid int) <-chan struct{} {
+	return nil
+}
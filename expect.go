@@ -0,0 +1,113 @@
+package clirunner
+
+import "regexp"
+
+// Expectation states what a command's output should look like, so that
+// smoke tests get assertions without writing a Commander.  A run whose
+// output falls short returns an ExpectationError, though the command
+// completed, and the ProcRunner remains usable.
+//
+// Every line of output on stdOut and stdErr is considered, including lines
+// a LineSampling doesn't deliver.
+type Expectation struct {
+	// Match holds patterns that some line must match, each.
+	Match []*regexp.Regexp
+
+	// NoMatch holds patterns that no line may match.
+	NoMatch []*regexp.Regexp
+
+	// MinLines is the fewest lines of output on stdOut expected.
+	MinLines int
+
+	// MaxLines, if positive, is the most lines of output on stdOut
+	// expected.
+	MaxLines int
+}
+
+// Expecter is an optional interface for a Commander whose runs have an
+// Expectation.  See WithExpectation.
+type Expecter interface {
+	// Expectation returns the expectation for the Commander's runs, or nil
+	// for none.
+	Expectation() *Expectation
+}
+
+// maxForbiddenLines is the most lines matching NoMatch patterns that an
+// ExpectationError holds.
+const maxForbiddenLines = 10
+
+// expectationFor returns a checker for a run of the given Commander, or
+// nil if it has no Expectation.
+func expectationFor(c Commander) *expectChecker {
+	for ; c != nil; c = unwrap(c) {
+		if e, ok := c.(Expecter); ok {
+			if x := e.Expectation(); x != nil {
+				return &expectChecker{
+					expect: *x, matched: make([]bool, len(x.Match))}
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// expectChecker checks the lines of one run against an Expectation.
+type expectChecker struct {
+	expect    Expectation
+	matched   []bool // per Match pattern
+	forbidden []Line
+	linesOut  int
+}
+
+// observe checks a line of output.
+func (x *expectChecker) observe(stream Stream, line []byte) {
+	if x == nil {
+		return
+	}
+	if stream != StreamErr {
+		x.linesOut++
+	}
+	for i, re := range x.expect.Match {
+		if !x.matched[i] && re.Match(line) {
+			x.matched[i] = true
+		}
+	}
+	if len(x.forbidden) == maxForbiddenLines {
+		return
+	}
+	for _, re := range x.expect.NoMatch {
+		if re.Match(line) {
+			x.forbidden = append(x.forbidden, Line{
+				Data: append([]byte(nil), line...), Stream: stream})
+			return
+		}
+	}
+}
+
+// check returns an ExpectationError for the given command if the lines
+// observed fall short of the Expectation.
+func (x *expectChecker) check(command string) error {
+	if x == nil {
+		return nil
+	}
+	var missing []string
+	for i, re := range x.expect.Match {
+		if !x.matched[i] {
+			missing = append(missing, re.String())
+		}
+	}
+	lines := x.linesOut
+	if len(missing) == 0 && len(x.forbidden) == 0 &&
+		lines >= x.expect.MinLines &&
+		(x.expect.MaxLines <= 0 || lines <= x.expect.MaxLines) {
+		return nil
+	}
+	return &ExpectationError{
+		Command:   command,
+		Missing:   missing,
+		Forbidden: x.forbidden,
+		Lines:     lines,
+		MinLines:  x.expect.MinLines,
+		MaxLines:  x.expect.MaxLines,
+	}
+}
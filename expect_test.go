@@ -0,0 +1,95 @@
+package clirunner_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunner_Expectation(t *testing.T) {
+	expect := Expectation{
+		Match: []*regexp.Regexp{
+			regexp.MustCompile(`^ok$`), regexp.MustCompile(`rows`)},
+		NoMatch:  []*regexp.Regexp{regexp.MustCompile(`(?i)error`)},
+		MinLines: 2,
+		MaxLines: 3,
+	}
+	testCases := map[string]struct {
+		out      []string
+		err      []string
+		missing  []string
+		unwanted []string
+		message  string
+	}{
+		"met": {
+			out: []string{"ok", "3 rows"},
+		},
+		"metWithStdErr": {
+			out: []string{"ok", "3 rows"},
+			err: []string{"warning: slow"},
+		},
+		"missing": {
+			out:     []string{"ok", "done"},
+			missing: []string{"rows"},
+			message: `in command "list", no line matched "rows"`,
+		},
+		"unwanted": {
+			out:      []string{"ok", "3 rows"},
+			err:      []string{"ERROR: oops"},
+			unwanted: []string{"ERROR: oops"},
+			message:  `in command "list", unwanted line on stdErr "ERROR: oops"`,
+		},
+		"tooMany": {
+			out:     []string{"ok", "1", "2", "3 rows"},
+			message: `in command "list", 4 lines of output, expected 2 to 3`,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			h := makeHarness(t)
+			c := NewHoardingCommander("list")
+			result := runAsync(h, WithExpectation(c, expect), time.Hour)
+			expectCommands(t, h, "list", "echo Rumpelstiltskin")
+			assert.NoError(t, h.Err(tc.err...))
+			assert.NoError(t, h.Out(append(tc.out, "Rumpelstiltskin")...))
+			err := <-result
+			if tc.message == "" {
+				assert.NoError(t, err)
+			} else {
+				var ee *ExpectationError
+				assert.True(t, errors.As(err, &ee), "got %v", err)
+				assert.Equal(t, tc.missing, ee.Missing)
+				var unwanted []string
+				for _, l := range ee.Forbidden {
+					unwanted = append(unwanted, string(l.Data))
+				}
+				assert.Equal(t, tc.unwanted, unwanted)
+				assert.Equal(t, tc.message, err.Error())
+			}
+			// The Commander has the output either way, and the runner
+			// remains usable.
+			assert.Contains(t, c.Result(), "ok\n")
+			assert.Equal(t, "idle", h.Runner.Report().State)
+			assert.NoError(t, h.Runner.Close())
+		})
+	}
+}
+
+func TestRunner_ExpectationDiscarder(t *testing.T) {
+	h := makeHarness(t)
+	// The Commander discards its output, but the Expectation still sees it.
+	c := WithExpectation(&KondoCommander{Command: "load"}, Expectation{
+		Match:    []*regexp.Regexp{regexp.MustCompile(`^loaded$`)},
+		MinLines: 2,
+	})
+	result := runAsync(h, c, time.Hour)
+	expectCommands(t, h, "load", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("a", "b", "loaded", "Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	assert.NoError(t, h.Runner.Close())
+}
@@ -0,0 +1,192 @@
+package clirunner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+)
+
+// ExpectSession talks to a CLI a line at a time, sending text and waiting
+// for output matching patterns, for interactions that don't fit running
+// one command to its sentinels, e.g. multi-step wizards.  See
+// ProcRunner.StartExpect.
+//
+// Patterns match whole lines of output, from stdOut or stdErr, so a prompt
+// the CLI shows without a linefeed isn't seen until the line is finished.
+// For logging in, see Auth.
+type ExpectSession struct {
+	pr         *ProcRunner
+	stdIn      io.Writer
+	terminator byte
+	clock      Clock
+	chOut      <-chan []byte
+	chErr      <-chan []byte
+	// pending holds lines received, but not yet consumed by an Expect.
+	pending []Line
+	closed  bool
+}
+
+// ExpectMatch is the outcome of an Expect.
+type ExpectMatch struct {
+	// Index is the index of the pattern that matched, for ExpectAny.
+	Index int
+	// Line is the line that matched.
+	Line Line
+	// Submatches holds the pattern's submatches in the line, the first
+	// being the whole match.
+	Submatches []string
+	// Before holds the lines that went by, unmatched, since the previous
+	// Expect.
+	Before []Line
+}
+
+// StartExpect starts an ExpectSession, starting the CLI first if need be.
+// The session has the CLI to itself, as a run would: other runs wait their
+// turn until it's closed.  Lines of output that arrive from then on are
+// the session's.
+func (pr *ProcRunner) StartExpect() (*ExpectSession, error) {
+	if err := pr.queue.enter(context.Background()); err != nil {
+		return nil, err
+	}
+	pr.disarmIdleTimers()
+	pr.mutexState.Lock()
+	defer pr.mutexState.Unlock()
+	fail := func(err error) (*ExpectSession, error) {
+		pr.armIdleTimers()
+		pr.queue.leave()
+		return nil, err
+	}
+	switch pr.getState() {
+	case stateRunning:
+		return fail(fmt.Errorf("cannot start expect session while running"))
+	case stateError:
+		return fail(fmt.Errorf("cannot start expect session in error state"))
+	case stateUninitialized:
+		if err := pr.launch(); err != nil {
+			pr.enterStateError(err)
+			return fail(err)
+		}
+		pr.prepareStandby()
+	}
+	pr.filter.stopPassThru()
+	pr.sentinelMu.Lock()
+	terminator := pr.filter.terminator
+	pr.sentinelMu.Unlock()
+	return &ExpectSession{
+		pr: pr, stdIn: pr.stdIn, terminator: terminator,
+		clock: pr.filter.clock, chOut: pr.chOut, chErr: pr.chErr,
+	}, nil
+}
+
+// Send writes the text to the CLI's stdIn, terminated as a command is.
+func (s *ExpectSession) Send(text string) error {
+	if s.closed {
+		return fmt.Errorf("expect session is closed")
+	}
+	s.pr.logger.Printf("expect session sending %q\n", text)
+	_, err := io.WriteString(
+		s.stdIn, assureCmdLineTermination([]byte(text), s.terminator))
+	return err
+}
+
+// Expect waits up to the given duration for a line matching the pattern,
+// consuming it and the lines before it.
+func (s *ExpectSession) Expect(
+	pattern *regexp.Regexp, timeOut time.Duration) (*ExpectMatch, error) {
+	return s.ExpectAny([]*regexp.Regexp{pattern}, timeOut)
+}
+
+// ExpectAny waits up to the given duration for a line matching any of the
+// patterns, consuming it and the lines before it.  The earliest such line
+// wins, and of the patterns it matches, the first.  If none shows up in
+// time, ExpectAny returns an ExpectTimeoutError, and the lines stay
+// unconsumed, for the next Expect.
+func (s *ExpectSession) ExpectAny(
+	patterns []*regexp.Regexp, timeOut time.Duration) (*ExpectMatch, error) {
+	if s.closed {
+		return nil, fmt.Errorf("expect session is closed")
+	}
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("provide a pattern")
+	}
+	t := s.clock.NewTimer(timeOut)
+	defer t.Stop()
+	for scanned := 0; ; {
+		for ; scanned < len(s.pending); scanned++ {
+			if m := s.match(patterns, scanned); m != nil {
+				return m, nil
+			}
+		}
+		if s.chOut == nil && s.chErr == nil {
+			return nil, fmt.Errorf("CLI exited; no line matched %s",
+				patternList(patterns))
+		}
+		select {
+		case line, ok := <-s.chOut:
+			s.receive(StreamOut, line, ok, &s.chOut)
+		case line, ok := <-s.chErr:
+			s.receive(StreamErr, line, ok, &s.chErr)
+		case <-t.C():
+			return nil, &ExpectTimeoutError{
+				Patterns: patternList(patterns), TimeOut: timeOut,
+				Unmatched: append([]Line(nil), s.pending...)}
+		}
+	}
+}
+
+// receive takes a line from the given stream, or notes that it's closed.
+func (s *ExpectSession) receive(
+	stream Stream, line []byte, ok bool, ch *<-chan []byte) {
+	if !ok {
+		*ch = nil
+		return
+	}
+	s.pr.lineLogger.Printf("expect session got std%s %q\n", stream, string(line))
+	s.pending = append(s.pending, Line{Data: line, Stream: stream})
+}
+
+// match returns the match of the pending line at index i, consuming it and
+// the lines before it, or nil if no pattern matches it.
+func (s *ExpectSession) match(patterns []*regexp.Regexp, i int) *ExpectMatch {
+	line := s.pending[i]
+	for j, re := range patterns {
+		sub := re.FindSubmatch(line.Data)
+		if sub == nil {
+			continue
+		}
+		m := &ExpectMatch{Index: j, Line: line,
+			Before: append([]Line(nil), s.pending[:i]...)}
+		for _, b := range sub {
+			m.Submatches = append(m.Submatches, string(b))
+		}
+		s.pending = s.pending[i+1:]
+		return m
+	}
+	return nil
+}
+
+// Close ends the session, dropping any unconsumed lines, and lets other
+// runs have their turn.  The caller should leave the CLI ready for
+// commands, e.g. at its prompt, with its output consumed, since output
+// still to come goes to the next run.  Idempotent.
+func (s *ExpectSession) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	s.pending = nil
+	s.pr.armIdleTimers()
+	s.pr.queue.leave()
+	return nil
+}
+
+// patternList returns the patterns as strings.
+func patternList(patterns []*regexp.Regexp) []string {
+	result := make([]string, len(patterns))
+	for i, re := range patterns {
+		result[i] = re.String()
+	}
+	return result
+}
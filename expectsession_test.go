@@ -0,0 +1,73 @@
+package clirunner_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpectSession(t *testing.T) {
+	h := makeHarness(t)
+	s, err := h.Runner.StartExpect()
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.Send("wizard"))
+	expectCommands(t, h, "wizard")
+	assert.NoError(t, h.Out("Step 1: pick a color"))
+	m, err := s.Expect(regexp.MustCompile(`^Step 1`), time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "Step 1: pick a color", string(m.Line.Data))
+
+	assert.NoError(t, s.Send("blue"))
+	expectCommands(t, h, "blue")
+	assert.NoError(t, h.Out("thinking", "Done: blue"))
+	m, err = s.ExpectAny([]*regexp.Regexp{
+		regexp.MustCompile(`^Error`),
+		regexp.MustCompile(`^Done: (\w+)`),
+	}, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, m.Index)
+	assert.Equal(t, []string{"Done: blue", "blue"}, m.Submatches)
+	assert.Len(t, m.Before, 1)
+	assert.Equal(t, "thinking", string(m.Before[0].Data))
+
+	// Lines that don't match wait for the next Expect.
+	assert.NoError(t, h.Out("Step 2: pick a size"))
+	result := make(chan error, 1)
+	go func() {
+		_, err := s.Expect(regexp.MustCompile(`^Step 3`), time.Minute)
+		result <- err
+	}()
+	h.Clock.AwaitTimers(1)
+	h.Clock.Advance(time.Minute)
+	err = <-result
+	var te *ExpectTimeoutError
+	assert.True(t, errors.As(err, &te), "got %v", err)
+	assert.Equal(t, []string{"^Step 3"}, te.Patterns)
+	assert.Len(t, te.Unmatched, 1)
+	m, err = s.Expect(regexp.MustCompile(`^Step 2`), time.Hour)
+	assert.NoError(t, err)
+	assert.Empty(t, m.Before)
+
+	// Runs wait for the session to close.
+	c := NewHoardingCommander("list")
+	runResult := runAsync(h, c, time.Hour)
+	select {
+	case err = <-runResult:
+		t.Fatalf("run didn't wait for the session; %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.NoError(t, s.Close())
+	_, err = s.Expect(regexp.MustCompile(`.`), time.Hour)
+	assert.Error(t, err)
+	expectCommands(t, h, "list", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("tables", "Rumpelstiltskin"))
+	assert.NoError(t, <-runResult)
+	assert.Equal(t, "tables\n", c.Result())
+	assert.NoError(t, h.Runner.Close())
+}
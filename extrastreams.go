@@ -0,0 +1,127 @@
+package clirunner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ExtraStreamWriter is an optional interface for a Commander that wants
+// the lines of the Parameters' ExtraStreams told apart from those of stdOut
+// and stdErr.  A Commander that isn't one gets them via Write.
+type ExtraStreamWriter interface {
+	// WriteExtra accepts a line from the named stream.  Like Write, it
+	// should return an error only on some sort of catastrophe.
+	WriteExtra(stream string, line []byte) error
+}
+
+// extraStream is one of the ExtraStreams, as the filter reads it.
+type extraStream struct {
+	name string
+	ch   <-chan []byte
+}
+
+// scanExtraStreams starts scanning the CLI's ExtraStreams, returning
+// their channels, which are closed when the CLI closes the streams.
+// Unlike stdOut and stdErr, the streams aren't closed by waiting for the
+// CLI, so the scanners don't hold up the wait.
+func (pr *ProcRunner) scanExtraStreams(infra *errorTracker) []extraStream {
+	if len(pr.extras) == 0 {
+		return nil
+	}
+	var wg sync.WaitGroup
+	var result []extraStream
+	var chs []chan []byte
+	for i, r := range pr.extras {
+		ch := make(chan []byte, 100)
+		chs = append(chs, ch)
+		name := pr.params.ExtraStreams[i]
+		result = append(result, extraStream{name: name, ch: ch})
+		wg.Add(1)
+		go pr.scanExtra(&wg, name, pr.params.newLineScanner(r).Scanner, ch, infra)
+	}
+	go func(extras []io.ReadCloser) {
+		wg.Wait()
+		closeAll(extras)
+		for _, ch := range chs {
+			close(ch)
+		}
+	}(pr.extras)
+	return result
+}
+
+// scanExtra is like scanStdErr, for an ExtraStream.
+func (pr *ProcRunner) scanExtra(wg *sync.WaitGroup, name string,
+	scanner *bufio.Scanner, ch chan<- []byte, infra *errorTracker) {
+	defer wg.Done()
+	for scanner.Scan() {
+		send := newLine(scanner.Bytes())
+		pr.stamps.stamp(send, pr.filter.clock.Now())
+		ch <- send
+	}
+	if err := scanner.Err(); err != nil {
+		infra.log(fmt.Errorf("scanner of %s saw : %w", name, err))
+	}
+}
+
+// closeAll closes the given streams, ignoring errors.
+func closeAll(streams []io.ReadCloser) {
+	for _, s := range streams {
+		_ = s.Close()
+	}
+}
+
+// passThruExtra delivers the lines of an ExtraStream until the source
+// ends, noting the first error.
+func (cw *sentinelFilter) passThruExtra(name string, src *lineSource) {
+	defer src.ackFlush()
+	for {
+		line, stillOpen := src.next()
+		if !stillOpen {
+			return
+		}
+		if err := cw.deliverExtra(name, line); err != nil {
+			cw.cmdrLock.Lock()
+			if cw.extraErr == nil {
+				cw.extraErr = err
+			}
+			cw.cmdrLock.Unlock()
+			return
+		}
+	}
+}
+
+// deliverExtra passes a line from the named ExtraStream to the current
+// Commander.  Such lines aren't counted, sampled or limited.
+func (cw *sentinelFilter) deliverExtra(name string, line []byte) error {
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	if cw.detached || cw.fatalLine != nil {
+		return nil
+	}
+	l := Line{Data: line, Stream: StreamExtra, Name: name}
+	if cw.tail != nil {
+		cw.tail.add(l)
+	}
+	cw.archive(l)
+	if cw.tap != nil {
+		cw.addToTap(l, lineMark{})
+	}
+	if w, ok := cw.theCmdr.(LineWriter); ok {
+		return cw.writeLine(w, line, l)
+	}
+	if w, ok := cw.theCmdr.(ExtraStreamWriter); ok {
+		return w.WriteExtra(name, line)
+	}
+	_, err := cw.theCmdr.Write(line)
+	return err
+}
+
+// extraError returns the first error delivering the ExtraStreams in the
+// current run.
+func (cw *sentinelFilter) extraError() error {
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	return cw.extraErr
+}
@@ -0,0 +1,75 @@
+package clirunner_test
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+// extraCommander records the lines of ExtraStreams apart from the others.
+type extraCommander struct {
+	*HoardingCommander
+	extras []string
+}
+
+func (c *extraCommander) WriteExtra(stream string, line []byte) error {
+	c.extras = append(c.extras, stream+": "+string(line))
+	return nil
+}
+
+func TestRunner_Run_ExtraStreams(t *testing.T) {
+	h := makeHarness(t, func(p *Parameters) {
+		p.ExtraStreams = []string{"results", "progress"}
+	})
+
+	c := &extraCommander{HoardingCommander: NewHoardingCommander("query")}
+	result := runAsync(h, c, time.Minute)
+	expectCommands(t, h, "query", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Extra("results", "row1", "row2"))
+	assert.NoError(t, h.Extra("progress", "50%"))
+	assert.NoError(t, h.Out("summary", "Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	assert.Equal(t, "summary\n", c.Result())
+	assert.ElementsMatch(t,
+		[]string{"results: row1", "results: row2", "progress: 50%"}, c.extras)
+
+	// A Commander that isn't an ExtraStreamWriter gets them via Write.
+	hc := NewHoardingCommander("again")
+	result = runAsync(h, hc, time.Minute)
+	expectCommands(t, h, "again", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Extra("results", "row3"))
+	assert.NoError(t, h.Out("Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	assert.Equal(t, "row3\n", hc.Result())
+
+	assert.Error(t, h.Extra("nope", "x"))
+	assert.NoError(t, h.Runner.Close())
+}
+
+func TestRunner_Run_ExtraStreams_Exec(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh")
+	}
+	// The streams are separate pipes, so the test gives fd 3 a head start.
+	pr, err := NewProcRunner(&Parameters{
+		Path:         sh,
+		ExitCommand:  "exit",
+		ExtraStreams: []string{"fd3"},
+		OutSentinel: &SimpleSentinelCommander{
+			Command: "echo Rumpelstiltskin",
+			Value:   "Rumpelstiltskin",
+		},
+	})
+	assert.NoError(t, err)
+	c := &extraCommander{HoardingCommander: NewHoardingCommander(
+		"echo there >&3; sleep 0.2; echo hello")}
+	assert.NoError(t, pr.RunIt(c, 5*time.Second))
+	assert.Equal(t, "hello\n", c.Result())
+	assert.Equal(t, []string{"fd3: there"}, c.extras)
+	assert.NoError(t, pr.Close())
+}
@@ -0,0 +1,62 @@
+#!/bin/bash
+# Runs the runner's throughput benchmarks, and compares runs.
+# Run from top of repo, e.g.
+#
+#  ./hack/bench.sh run /tmp/new.txt
+#  ./hack/bench.sh compare hack/bench_baseline.txt /tmp/new.txt
+#
+# compare prints the mean lines/s of each benchmark in both files, and
+# exits non-zero if any is slower than in the first file by more than
+# the given percentage (default 20), so it can gate a change.
+set -e
+
+case "$1" in
+run)
+  out=${2:-/dev/stdout}
+  go test -run XXX -bench 'BenchmarkRunner_'  -count ${COUNT:-5} . >$out
+  ;;
+compare)
+  old=$2
+  new=$3
+  if [ -z "$old" ] || [ -z "$new" ]; then
+    echo "usage: $0 compare {old} {new} [maxRegressionPercent]" >&2
+    exit 2
+  fi
+  awk -v max=${4:-20} '
+    # Sums the value preceding the lines/s unit, per benchmark.
+    function collect(which) {
+      for (i = 2; i < NF; i++) {
+        if ($(i+1) == "lines/s") {
+          sum[which, $1] += $i
+          n[which, $1]++
+          names[$1] = 1
+        }
+      }
+    }
+    FNR == 1 { file++ }
+    /^Benchmark/ { collect(file) }
+    END {
+      printf "%-40s %14s %14s %8s\n", "benchmark", "old lines/s", "new lines/s", "delta"
+      bad = 0
+      for (b in names) {
+        if (!n[1, b] || !n[2, b]) {
+          continue
+        }
+        o = sum[1, b] / n[1, b]
+        m = sum[2, b] / n[2, b]
+        d = (m - o) / o * 100
+        flag = ""
+        if (d < -max) {
+          flag = "  REGRESSION"
+          bad = 1
+        }
+        printf "%-40s %14.0f %14.0f %+7.1f%%%s\n", b, o, m, d, flag
+      }
+      exit bad
+    }' $old $new
+  ;;
+*)
+  echo "usage: $0 run [file] | compare {old} {new} [maxRegressionPercent]" >&2
+  exit 2
+  ;;
+esac
@@ -0,0 +1,339 @@
+package clirunner
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Harness runs a ProcRunner against a simulated CLI, with no subprocess,
+// and a FakeClock, so that the runner's behavior (its states, timeouts and
+// sentinel handling) can be tested in pure unit tests.
+//
+// The test plays the CLI: it reads the commands the runner sends with
+// ReadCommand, and answers with Out and Err, including the output of
+// sentinel commands.  Since no time passes unless the test advances the
+// Clock, a run times out exactly when the test says so, e.g.
+//
+//	h, _ := NewHarness(&Parameters{OutSentinel: sentinel})
+//	go func() { result <- h.Runner.RunIt(cmdr, time.Second) }()
+//	cmd, _ := h.ReadCommand()   // cmdr's command
+//	sent, _ := h.ReadCommand()  // the sentinel command
+//	h.Out("some output")
+//	h.Clock.AwaitTimers(1)
+//	h.Clock.Advance(time.Second) // RunIt returns a timeout error
+//
+// A new simulated CLI replaces the old whenever the runner starts one,
+// e.g. after Restart.  Parameters that need a real subprocess, e.g.
+// UsePty, aren't supported.
+type Harness struct {
+	// Runner is the ProcRunner under test.
+	Runner *ProcRunner
+	// Clock is the runner's Clock.
+	Clock *FakeClock
+
+	m       sync.Mutex
+	changed *sync.Cond
+	cli     *simProcess // the running CLI, if any
+	starts  int
+	// commands holds what the runner sent to every CLI, in order, and
+	// not yet read; eof marks where the runner closed a CLI's stdIn.
+	commands []simCommand
+	signals  chan os.Signal
+}
+
+// simCommand is a line sent to a simulated CLI, or its EOF.
+type simCommand struct {
+	line string
+	eof  bool
+}
+
+// HarnessEpoch is the time a Harness' Clock starts at.
+var HarnessEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// NewHarness returns a Harness running a ProcRunner with the given
+// Parameters, except that the Clock is a FakeClock, and the Path, if
+// empty, is "harness".  It returns an error on bad parameters.
+func NewHarness(params *Parameters) (*Harness, error) {
+	if params.UsePty {
+		return nil, fmt.Errorf("a Harness doesn't support UsePty")
+	}
+	h := &Harness{
+		Clock:   NewFakeClock(HarnessEpoch),
+		signals: make(chan os.Signal, 100),
+	}
+	h.changed = sync.NewCond(&h.m)
+	p := params.copy()
+	if p.Path == "" {
+		p.Path = "harness"
+	}
+	p.Clock = h.Clock
+	pr, err := NewProcRunner(p)
+	if err != nil {
+		return nil, err
+	}
+	pr.spawn = h.spawn
+	h.Runner = pr
+	return h, nil
+}
+
+// spawn makes a new simulated CLI.
+func (h *Harness) spawn(params *Parameters) process {
+	p := &simProcess{h: h, exited: make(chan struct{})}
+	p.stdIn = &simInput{p: p}
+	p.outR, p.outW = io.Pipe()
+	p.errR, p.errW = io.Pipe()
+	p.extras = map[string]*io.PipeWriter{}
+	for _, name := range params.ExtraStreams {
+		r, w := io.Pipe()
+		p.extraR = append(p.extraR, r)
+		p.extras[name] = w
+	}
+	return p
+}
+
+// current returns the running CLI, waiting for one to start.
+func (h *Harness) current() *simProcess {
+	h.m.Lock()
+	defer h.m.Unlock()
+	for h.cli == nil {
+		h.changed.Wait()
+	}
+	return h.cli
+}
+
+// Starts returns how many times the runner started a CLI.
+func (h *Harness) Starts() int {
+	h.m.Lock()
+	defer h.m.Unlock()
+	return h.starts
+}
+
+// ReadCommand returns the next line the runner sent to a CLI, without its
+// linefeed, waiting for it.  Lines sent to every CLI the runner started
+// are returned, in order.  It returns io.EOF where the runner closed a
+// CLI's stdIn, which ends that CLI.
+func (h *Harness) ReadCommand() (string, error) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	for len(h.commands) == 0 {
+		h.changed.Wait()
+	}
+	c := h.commands[0]
+	h.commands = h.commands[1:]
+	if c.eof {
+		return "", io.EOF
+	}
+	return strings.TrimRight(c.line, "\r"), nil
+}
+
+// Out writes lines to the running CLI's stdOut, waiting for a CLI to
+// start if none is running.
+func (h *Harness) Out(lines ...string) error {
+	return writeLines(h.current().outW, lines)
+}
+
+// Prompt writes text to the running CLI's stdOut without a linefeed, as a
+// CLI waiting for input at a prompt does.  It waits for a CLI to start if
+// none is running.
+func (h *Harness) Prompt(text string) error {
+	_, err := io.WriteString(h.current().outW, text)
+	return err
+}
+
+// CloseOut closes the running CLI's stdOut, as a CLI that keeps running
+// without it does.  It waits for a CLI to start if none is running.
+func (h *Harness) CloseOut() error {
+	return h.current().outW.Close()
+}
+
+// Err writes lines to the running CLI's stdErr, waiting for a CLI to
+// start if none is running.
+func (h *Harness) Err(lines ...string) error {
+	return writeLines(h.current().errW, lines)
+}
+
+// Extra writes lines to the running CLI's ExtraStream of the given name,
+// waiting for a CLI to start if none is running.
+func (h *Harness) Extra(name string, lines ...string) error {
+	w, ok := h.current().extras[name]
+	if !ok {
+		return fmt.Errorf("no extra stream %q", name)
+	}
+	return writeLines(w, lines)
+}
+
+// Exit makes the running CLI exit, as if it died, with the given error,
+// which, if not nil, the runner takes as the CLI's exit status.  It waits
+// for a CLI to start if none is running.
+func (h *Harness) Exit(err error) {
+	h.current().exit(err)
+}
+
+// Signals returns a channel getting the signals sent to the CLI, e.g.
+// Parameters.InterruptSignal, other than those that end it, i.e. SIGTERM
+// and SIGKILL.
+func (h *Harness) Signals() <-chan os.Signal {
+	return h.signals
+}
+
+func writeLines(w io.Writer, lines []string) error {
+	var b bytes.Buffer
+	for _, l := range lines {
+		b.WriteString(l)
+		b.WriteByte('\n')
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// simProcess is a simulated CLI, played by the test through a Harness.
+type simProcess struct {
+	h          *Harness
+	stdIn      *simInput
+	outR, errR *io.PipeReader
+	outW, errW *io.PipeWriter
+	extraR     []io.ReadCloser
+	extras     map[string]*io.PipeWriter // by name
+	began      bool                      // start was called; guarded by h.m
+	exitOnce   sync.Once
+	exited     chan struct{}
+	exitErr    error
+}
+
+func (p *simProcess) pipes() (
+	stdIn io.WriteCloser, stdOut, stdErr io.ReadCloser, err error) {
+	return p.stdIn, p.outR, p.errR, nil
+}
+
+func (p *simProcess) extraPipes() ([]io.ReadCloser, error) {
+	return p.extraR, nil
+}
+
+func (p *simProcess) start() error {
+	p.h.m.Lock()
+	defer p.h.m.Unlock()
+	p.began = true
+	p.h.cli = p
+	p.h.starts++
+	p.h.changed.Broadcast()
+	return nil
+}
+
+func (p *simProcess) started() bool {
+	p.h.m.Lock()
+	defer p.h.m.Unlock()
+	return p.began
+}
+
+// exitDone returns true if the CLI exited.
+func (p *simProcess) exitDone() bool {
+	select {
+	case <-p.exited:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *simProcess) wait() error {
+	<-p.exited
+	return p.exitErr
+}
+
+func (p *simProcess) signal(sig os.Signal) error {
+	if sig == syscall.SIGTERM || sig == os.Kill {
+		p.exit(fmt.Errorf("signal: %s", sig))
+		return nil
+	}
+	select {
+	case p.h.signals <- sig:
+	default:
+	}
+	return nil
+}
+
+func (p *simProcess) kill() error {
+	return p.signal(os.Kill)
+}
+
+func (p *simProcess) watchExit() <-chan struct{} {
+	return p.exited
+}
+
+func (p *simProcess) String() string { return "simulated CLI" }
+
+// exit ends the CLI, closing its streams.
+func (p *simProcess) exit(err error) {
+	p.exitOnce.Do(func() {
+		p.h.m.Lock()
+		if p.h.cli == p {
+			p.h.cli = nil
+		}
+		p.h.m.Unlock()
+		p.exitErr = err
+		_ = p.outW.Close()
+		_ = p.errW.Close()
+		for _, w := range p.extras {
+			_ = w.Close()
+		}
+		close(p.exited)
+	})
+}
+
+// simInput is a simulated CLI's stdIn, queuing whatever the runner writes
+// in its Harness, so the runner never waits for the test to read.
+type simInput struct {
+	p       *simProcess
+	partial []byte // the start of a line; guarded by p.h.m
+	closed  bool   // guarded by p.h.m
+}
+
+// Write queues the complete lines, keeping any partial one for later.
+func (in *simInput) Write(b []byte) (int, error) {
+	h := in.p.h
+	if in.p.exitDone() {
+		return 0, fmt.Errorf("simulated CLI exited; %w", os.ErrClosed)
+	}
+	h.m.Lock()
+	defer h.m.Unlock()
+	if in.closed {
+		return 0, os.ErrClosed
+	}
+	in.partial = append(in.partial, b...)
+	for {
+		i := bytes.IndexByte(in.partial, '\n')
+		if i < 0 {
+			break
+		}
+		h.commands = append(h.commands, simCommand{line: string(in.partial[:i])})
+		in.partial = in.partial[i+1:]
+	}
+	h.changed.Broadcast()
+	return len(b), nil
+}
+
+// Close is an EOF; the CLI exits, as a CLI does.
+func (in *simInput) Close() error {
+	h := in.p.h
+	h.m.Lock()
+	if in.closed {
+		h.m.Unlock()
+		return os.ErrClosed
+	}
+	in.closed = true
+	if len(in.partial) > 0 {
+		h.commands = append(h.commands, simCommand{line: string(in.partial)})
+		in.partial = nil
+	}
+	h.commands = append(h.commands, simCommand{eof: true})
+	h.changed.Broadcast()
+	h.m.Unlock()
+	in.p.exit(nil)
+	return nil
+}
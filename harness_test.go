@@ -0,0 +1,139 @@
+package clirunner_test
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	. "github.com/monopole/clirunner/internal/testing"
+	"github.com/stretchr/testify/assert"
+)
+
+// makeHarness returns a Harness whose CLI exits on "quit", and answers
+// "echo Rumpelstiltskin" with the out sentinel.  The modifiers, if any,
+// change the Parameters first.
+func makeHarness(t testing.TB, mods ...func(*Parameters)) *Harness {
+	p := &Parameters{
+		ExitCommand: "quit",
+		OutSentinel: &SimpleSentinelCommander{
+			Command: "echo Rumpelstiltskin",
+			Value:   "Rumpelstiltskin",
+		},
+	}
+	for _, m := range mods {
+		m(p)
+	}
+	h, err := NewHarness(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// runAsync runs the Commander, returning RunIt's eventual result.
+func runAsync(h *Harness, c Commander, d time.Duration) <-chan error {
+	result := make(chan error, 1)
+	go func() { result <- h.Runner.RunIt(c, d) }()
+	return result
+}
+
+// expectCommands reads commands, asserting they're the given ones.
+func expectCommands(t *testing.T, h *Harness, cmds ...string) {
+	for _, want := range cmds {
+		got, err := h.ReadCommand()
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+}
+
+func TestHarness_Run(t *testing.T) {
+	h := makeHarness(t)
+	c := NewHoardingCommander("list")
+	result := runAsync(h, c, time.Minute)
+	expectCommands(t, h, "list", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Err("a warning"))
+	assert.NoError(t, h.Out("one", "two", "Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	AssertEqualAnyOrder(t, "a warning\none\ntwo\n", c.Result())
+	assert.Equal(t, "idle", h.Runner.Report().State)
+
+	// Close sends the ExitCommand and EOF; the CLI exits gracefully.
+	assert.NoError(t, h.Runner.Close())
+	expectCommands(t, h, "quit")
+	_, err := h.ReadCommand()
+	assert.Equal(t, io.EOF, err)
+	r, _ := h.Runner.LastStartReport()
+	assert.Equal(t, ShutdownGraceful, r.Shutdown)
+}
+
+func TestHarness_Timeout(t *testing.T) {
+	h := makeHarness(t)
+	c := NewHoardingCommander("slow")
+	result := runAsync(h, c, time.Hour)
+	expectCommands(t, h, "slow", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("partial"))
+
+	// Nothing happens until the clock says so.
+	h.Clock.AwaitTimers(1)
+	h.Clock.Advance(time.Hour - time.Second)
+	select {
+	case err := <-result:
+		t.Fatalf("run ended early with %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	h.Clock.Advance(time.Second)
+	err := <-result
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `stdOut "partial"`)
+	assert.Equal(t, "partial\n", c.Result())
+	assert.Equal(t, "error", h.Runner.Report().State)
+	r, _ := h.Runner.LastRunReport()
+	assert.Equal(t, time.Hour, r.Duration)
+	assert.True(t, r.Partial)
+
+	// A new CLI replaces the one that's stuck.
+	assert.NoError(t, h.Runner.Restart())
+	c = NewHoardingCommander("fast")
+	result = runAsync(h, c, time.Hour)
+	expectCommands(t, h, "fast", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("done", "Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	assert.Equal(t, 2, h.Starts())
+	assert.Equal(t, 0, h.Clock.Timers())
+	assert.NoError(t, h.Runner.Close())
+}
+
+func TestHarness_TimeoutWhileClosing(t *testing.T) {
+	h := makeHarness(t)
+	result := runAsync(h, NewHoardingCommander("slow"), time.Hour)
+	expectCommands(t, h, "slow", "echo Rumpelstiltskin")
+	h.Clock.AwaitTimers(1)
+
+	// Whichever comes first, the run's timeout mustn't outlive the CLI.
+	closed := make(chan error, 1)
+	go func() { closed <- h.Runner.Close() }()
+	h.Clock.Advance(time.Hour)
+	assert.Error(t, <-result)
+	<-closed
+	assert.Equal(t, "uninitialized", h.Runner.Report().State)
+}
+
+func TestHarness_Exit(t *testing.T) {
+	h := makeHarness(t)
+	result := runAsync(h, NewHoardingCommander("crash"), time.Hour)
+	expectCommands(t, h, "crash", "echo Rumpelstiltskin")
+	h.Exit(errors.New("segmentation fault"))
+	assert.Error(t, <-result)
+	assert.Equal(t, "error", h.Runner.Report().State)
+	assert.Error(t, h.Runner.Close())
+	// The next run starts a new CLI.
+	result = runAsync(h, NewHoardingCommander("again"), time.Hour)
+	expectCommands(t, h, "again", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	assert.Equal(t, 2, h.Starts())
+	assert.NoError(t, h.Runner.Close())
+}
@@ -0,0 +1,99 @@
+package clirunner
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Step is something a Harness' simulated CLI does, in Play.  Steps script
+// the CLI's side of the pipes at a lower level than Out and Err, e.g.
+// lines arriving in pieces, or a stream closing early.
+type Step func(h *Harness) error
+
+// Play performs the steps in order, stopping at the first error.  It waits
+// for a CLI to start if none is running.
+func (h *Harness) Play(steps ...Step) error {
+	for i, s := range steps {
+		if err := s(h); err != nil {
+			return fmt.Errorf("step %d; %w", i, err)
+		}
+	}
+	return nil
+}
+
+// pipe returns the running CLI's end of stdOut or stdErr.
+func (h *Harness) pipe(stream Stream) (*io.PipeWriter, error) {
+	switch stream {
+	case StreamOut:
+		return h.current().outW, nil
+	case StreamErr:
+		return h.current().errW, nil
+	default:
+		return nil, fmt.Errorf("can't script std%s; use Extra", stream)
+	}
+}
+
+// Emit writes data to the stream as is, in one write: part of a line, or
+// several lines.
+func Emit(stream Stream, data string) Step {
+	return func(h *Harness) error {
+		w, err := h.pipe(stream)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, data)
+		return err
+	}
+}
+
+// EmitChunks writes data to the stream in writes of at most size bytes,
+// as a CLI whose output is flushed unevenly does.
+func EmitChunks(stream Stream, data string, size int) Step {
+	return func(h *Harness) error {
+		if size < 1 {
+			return fmt.Errorf("chunk size %d isn't positive", size)
+		}
+		for len(data) > 0 {
+			n := size
+			if n > len(data) {
+				n = len(data)
+			}
+			if err := Emit(stream, data[:n])(h); err != nil {
+				return err
+			}
+			data = data[n:]
+		}
+		return nil
+	}
+}
+
+// Pause advances the Harness' Clock, once the runner has set the given
+// number of timers, e.g. one for a run's time limit.
+func Pause(d time.Duration, timers int) Step {
+	return func(h *Harness) error {
+		h.Clock.AwaitTimers(timers)
+		h.Clock.Advance(d)
+		return nil
+	}
+}
+
+// CloseStream closes the stream, as a CLI that keeps running without it
+// does, e.g. for an EOF before the sentinel.
+func CloseStream(stream Stream) Step {
+	return func(h *Harness) error {
+		w, err := h.pipe(stream)
+		if err != nil {
+			return err
+		}
+		return w.Close()
+	}
+}
+
+// ExitWith makes the CLI exit, as Exit does.
+func ExitWith(err error) Step {
+	return func(h *Harness) error {
+		h.Exit(err)
+		return nil
+	}
+}
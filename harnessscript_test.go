@@ -0,0 +1,48 @@
+package clirunner_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHarness_Play(t *testing.T) {
+	h := makeHarness(t)
+
+	// Lines arrive in pieces, split anywhere.
+	c := NewHoardingCommander("query")
+	result := runAsync(h, c, time.Hour)
+	expectCommands(t, h, "query", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Play(
+		EmitChunks(StreamOut, "row1\nrow2\nRumpelstiltskin\n", 3)))
+	assert.NoError(t, <-result)
+	assert.Equal(t, "row1\nrow2\n", c.Result())
+
+	// An early EOF on stdErr doesn't matter without an err sentinel.
+	c = NewHoardingCommander("query")
+	result = runAsync(h, c, time.Hour)
+	expectCommands(t, h, "query", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Play(
+		CloseStream(StreamErr),
+		Emit(StreamOut, "ok\nRumpel"),
+		Emit(StreamOut, "stiltskin\n")))
+	assert.NoError(t, <-result)
+	assert.Equal(t, "ok\n", c.Result())
+
+	// The sentinel never comes.
+	c = NewHoardingCommander("slow")
+	result = runAsync(h, c, time.Hour)
+	expectCommands(t, h, "slow", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Play(
+		Emit(StreamOut, "partial\nRumpel"),
+		Pause(time.Hour, 1)))
+	assert.Error(t, <-result)
+	assert.Equal(t, "partial\n", c.Result())
+
+	assert.EqualError(t, h.Play(Emit(StreamExtra, "x")),
+		"step 0; can't script stdExtra; use Extra")
+	_ = h.Runner.Close()
+}
@@ -0,0 +1,106 @@
+package clirunner
+
+import (
+	"sync"
+	"time"
+)
+
+// idleCountdown calls a function once the CLI has been idle for a while,
+// unless it's restarted or canceled first.
+type idleCountdown struct {
+	m    sync.Mutex
+	t    Timer
+	stop chan struct{} // closed on restart or cancel
+}
+
+// start (re)starts the countdown, if d is positive.  When it's done, f is
+// called in a goroutine of its own, with a function that returns false if
+// the countdown was restarted or canceled since, and true otherwise,
+// ending the countdown.
+func (c *idleCountdown) start(clock Clock, d time.Duration,
+	f func(current func() bool)) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.cancelLocked()
+	if d <= 0 {
+		return
+	}
+	stop := make(chan struct{})
+	t := clock.NewTimer(d)
+	c.t, c.stop = t, stop
+	go func() {
+		select {
+		case <-stop:
+			return
+		case <-t.C():
+		}
+		f(func() bool {
+			c.m.Lock()
+			defer c.m.Unlock()
+			select {
+			case <-stop:
+				return false
+			default:
+			}
+			c.t, c.stop = nil, nil
+			return true
+		})
+	}()
+}
+
+// cancel stops the countdown, if any.
+func (c *idleCountdown) cancel() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.cancelLocked()
+}
+
+// cancelLocked does the work of cancel.  The caller must hold m.
+func (c *idleCountdown) cancelLocked() {
+	if c.stop != nil {
+		c.t.Stop()
+		close(c.stop)
+		c.t, c.stop = nil, nil
+	}
+}
+
+// armIdleTimers starts (or restarts) the countdowns to an idle CLI's
+// shutdown and keepalive probe, if Parameters ask for them.
+func (pr *ProcRunner) armIdleTimers() {
+	if pr.isStandby {
+		return
+	}
+	clock := clockOrReal(pr.params.Clock)
+	pr.idle.start(clock, pr.params.IdleTimeout, pr.shutDownIdle)
+	if k := pr.params.Keepalive; k != nil {
+		pr.keepalive.start(clock, k.Interval, pr.probeIdle)
+	}
+}
+
+// disarmIdleTimers cancels the countdowns.
+func (pr *ProcRunner) disarmIdleTimers() {
+	pr.idle.cancel()
+	pr.keepalive.cancel()
+}
+
+// shutDownIdle shuts down the CLI, unless something's run since the
+// countdown started, or is running.  The next run starts a new CLI, as
+// usual.
+func (pr *ProcRunner) shutDownIdle(current func() bool) {
+	if !pr.queue.tryEnter() {
+		// A run is underway or waiting; it restarts the countdown.
+		return
+	}
+	defer pr.queue.leave()
+	pr.mutexState.Lock()
+	defer pr.mutexState.Unlock()
+	if !current() || pr.getState() != stateIdle {
+		return
+	}
+	pr.logger.Printf("idle for %s, shutting down\n", pr.params.IdleTimeout)
+	pr.keepalive.cancel()
+	pr.discardStandby()
+	if err := pr.shutdown(); err != nil {
+		pr.logger.Printf("idle shutdown: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,47 @@
+package clirunner_test
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunner_IdleTimeout(t *testing.T) {
+	h := makeHarness(t, func(p *Parameters) {
+		p.IdleTimeout = time.Minute
+	})
+	run := func(cmd string) {
+		result := runAsync(h, NewHoardingCommander(cmd), time.Hour)
+		expectCommands(t, h, cmd, "echo Rumpelstiltskin")
+		assert.NoError(t, h.Out("Rumpelstiltskin"))
+		assert.NoError(t, <-result)
+	}
+
+	// Each run restarts the countdown.
+	run("one")
+	h.Clock.AwaitTimers(1)
+	h.Clock.Advance(40 * time.Second)
+	run("two")
+	h.Clock.AwaitTimers(1)
+	h.Clock.Advance(40 * time.Second)
+	assert.Equal(t, "idle", h.Runner.Report().State)
+
+	h.Clock.Advance(20 * time.Second)
+	expectCommands(t, h, "quit")
+	_, err := h.ReadCommand()
+	assert.Equal(t, io.EOF, err)
+	awaitState(t, h, "uninitialized")
+	r, _ := h.Runner.LastStartReport()
+	assert.Equal(t, ShutdownGraceful, r.Shutdown)
+
+	// The next run starts a new CLI.
+	run("three")
+	assert.Equal(t, 2, h.Starts())
+	assert.NoError(t, h.Runner.Close())
+	expectCommands(t, h, "quit")
+	assert.Equal(t, 0, h.Clock.Timers())
+}
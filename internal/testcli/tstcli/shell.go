@@ -2,9 +2,12 @@ package tstcli
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
 	"time"
@@ -32,6 +35,13 @@ const (
 	cmdSet     = "set"
 	cmdPrint   = "print"
 	CmdQuery   = "query"
+	CmdPwd     = "pwd"
+	CmdCd      = "cd"
+	CmdTally   = "tally"
+	CmdTerm    = "terminal"
+	CmdGzip    = "gzip"
+	CmdFollow  = "follow"
+	CmdStop    = "stop"
 )
 
 // AllCommands can be used in help and validation.
@@ -45,8 +55,25 @@ var AllCommands = []string{
 	cmdSet,
 	cmdPrint,
 	CmdQuery,
+	CmdPwd,
+	CmdCd,
+	CmdTally,
+	CmdTerm,
+	CmdGzip,
+	CmdFollow,
+	CmdStop,
 }
 
+// TallyPrefix starts the output of CmdTally, e.g. "rows: 3".
+const TallyPrefix = "rows: "
+
+// PayloadHeader starts the line announcing the payload of CmdGzip, e.g.
+// "payload: 42".
+const PayloadHeader = "payload: "
+
+// FollowPrefix starts each line of CmdFollow's output, e.g. "tick 3".
+const FollowPrefix = "tick "
+
 // Other constants.
 //goland:noinspection SpellCheckingInspection
 const (
@@ -69,6 +96,14 @@ type Shell struct {
 	scanner       *bufio.Scanner
 	db            *SillyDb
 	help          string
+	interrupts    chan os.Signal
+	// lines holds the lines read from stdin, closed at its end.
+	lines chan string
+	// pending holds lines that arrived while following, to run afterwards,
+	// as a terminal would run lines typed ahead.
+	pending []string
+	// lastLines counts the stdOut lines of the last echo or query.
+	lastLines int
 }
 
 // NewShell returns a new instance.
@@ -82,14 +117,25 @@ func NewShell(db *SillyDb, disablePrompt, exitOnError bool, help string) *Shell
 		scanner:       bufio.NewScanner(os.Stdin),
 		db:            db,
 		help:          help,
+		interrupts:    make(chan os.Signal, 1),
+		lines:         make(chan string),
 	}
 }
 
 // Run starts a loop to drain the shells input stream, executing commands.
+// An interrupt signal aborts a running command (e.g. sleep), as ctrl-C
+// would in a human's terminal, rather than killing the shell.
 func (s *Shell) Run() error {
+	signal.Notify(s.interrupts, os.Interrupt)
+	defer signal.Stop(s.interrupts)
+	go s.readLines()
 	s.maybeShowPrompt()
-	for s.scanner.Scan() {
-		done, err := s.handleCommand(normalizeCommand(s.scanner.Text()))
+	for {
+		line, ok := s.nextLine()
+		if !ok {
+			return nil
+		}
+		done, err := s.handleCommand(normalizeCommand(line))
 		if err != nil {
 			fmt.Fprintln(s.stdErr, err.Error())
 			if s.exitOnError {
@@ -101,7 +147,69 @@ func (s *Shell) Run() error {
 		}
 		s.maybeShowPrompt()
 	}
-	return nil
+}
+
+// readLines reads stdin, so that commands can arrive while following.
+func (s *Shell) readLines() {
+	for s.scanner.Scan() {
+		s.lines <- s.scanner.Text()
+	}
+	close(s.lines)
+}
+
+// nextLine returns the next line to run, pending lines first.
+func (s *Shell) nextLine() (string, bool) {
+	if len(s.pending) > 0 {
+		line := s.pending[0]
+		s.pending = s.pending[1:]
+		return line, true
+	}
+	line, ok := <-s.lines
+	return line, ok
+}
+
+// follow emits a line per interval, forever, like "tail -f", until it reads
+// CmdStop, stdin ends, or it's interrupted.  Other lines read meanwhile are
+// run afterwards.
+func (s *Shell) follow(arg string) error {
+	d, err := time.ParseDuration(arg)
+	if err != nil {
+		return err
+	}
+	if d <= 0 {
+		return fmt.Errorf("%s interval %s must be positive", CmdFollow, d)
+	}
+	s.drainInterrupts()
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.lastLines++
+			fmt.Fprintf(s.stdOut, "%s%d\n", FollowPrefix, s.lastLines)
+		case line, ok := <-s.lines:
+			if !ok {
+				return nil
+			}
+			if normalizeCommand(line) == CmdStop {
+				return nil
+			}
+			s.pending = append(s.pending, line)
+		case <-s.interrupts:
+			return fmt.Errorf("%s interrupted", CmdFollow)
+		}
+	}
+}
+
+// drainInterrupts discards interrupts that arrived while idle.
+func (s *Shell) drainInterrupts() {
+	for {
+		select {
+		case <-s.interrupts:
+		default:
+			return
+		}
+	}
 }
 
 func (s *Shell) maybeShowPrompt() {
@@ -124,6 +232,22 @@ func (s *Shell) handleCommand(cmd string) (done bool, err error) {
 		// All done.
 		return true, nil
 	}
+	if cmd == CmdTally {
+		// Report on the previous command, as some SQL clients can.
+		fmt.Fprintf(s.stdOut, "%s%d\n", TallyPrefix, s.lastLines)
+		return
+	}
+	s.lastLines = 0
+	if cmd == CmdTerm {
+		// Say whether stdIn is a terminal, as CLIs that prompt only for
+		// humans check.
+		var fi os.FileInfo
+		if fi, err = os.Stdin.Stat(); err != nil {
+			return
+		}
+		fmt.Fprintf(s.stdOut, "terminal: %t\n", fi.Mode()&os.ModeCharDevice != 0)
+		return
+	}
 	if cmd == CmdHelp {
 		fmt.Fprintf(s.stdOut, "Commands: %v\n", AllCommands)
 		fmt.Fprintf(s.stdOut, s.help)
@@ -140,7 +264,12 @@ func (s *Shell) handleCommand(cmd string) (done bool, err error) {
 			return
 		}
 		// For use in tests. Simulate a long-running command.
-		<-time.After(d)
+		s.drainInterrupts()
+		select {
+		case <-time.After(d):
+		case <-s.interrupts:
+			err = fmt.Errorf("%s interrupted", CmdSleep)
+		}
 		return
 	}
 	if cmd == cmdStatus {
@@ -149,8 +278,44 @@ func (s *Shell) handleCommand(cmd string) (done bool, err error) {
 			s.db.NumRowsInDb(), s.db.RowToErrorOn())
 		return
 	}
+	if cmd == CmdPwd {
+		var dir string
+		dir, err = os.Getwd()
+		if err != nil {
+			return
+		}
+		fmt.Fprintln(s.stdOut, dir)
+		return
+	}
+	if strings.HasPrefix(cmd, CmdCd+" ") {
+		return false, os.Chdir(cmd[len(CmdCd)+1:])
+	}
+	if strings.HasPrefix(cmd, CmdGzip+" ") {
+		// Emit the words, one per line, as a gzip payload.
+		var b bytes.Buffer
+		w := gzip.NewWriter(&b)
+		for _, word := range strings.Fields(cmd[len(CmdGzip)+1:]) {
+			fmt.Fprintln(w, word)
+			s.lastLines++
+		}
+		if err = w.Close(); err != nil {
+			return
+		}
+		fmt.Fprintf(s.stdOut, "%s%d\n", PayloadHeader, b.Len())
+		_, err = s.stdOut.Write(b.Bytes())
+		return
+	}
+	if strings.HasPrefix(cmd, CmdFollow+" ") {
+		// For use in tests.  Simulate a command streaming output forever.
+		return false, s.follow(cmd[len(CmdFollow)+1:])
+	}
+	if cmd == CmdStop {
+		// Nothing is being followed; ignore it.
+		return
+	}
 	if strings.HasPrefix(cmd, CmdEcho+" ") {
 		fmt.Fprintln(s.stdOut, cmd[len(CmdEcho)+1:])
+		s.lastLines = 1
 		return
 	}
 	if strings.HasPrefix(cmd, cmdSet+" ") {
@@ -173,7 +338,10 @@ func (s *Shell) handleCommand(cmd string) (done bool, err error) {
 		if err != nil {
 			return
 		}
-		return false, s.db.DoScanQuery(offset, limit)
+		before := s.db.NumRowsInDb()
+		err = s.db.DoScanQuery(offset, limit)
+		s.lastLines = before - s.db.NumRowsInDb()
+		return
 	}
 	return false, fmt.Errorf("unrecognized command: %q", cmd)
 }
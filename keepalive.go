@@ -0,0 +1,90 @@
+package clirunner
+
+import (
+	"fmt"
+	"time"
+)
+
+// Keepalive has a ProcRunner send a lightweight probe command to its CLI
+// whenever the CLI has sat idle for a while, so that a dead or wedged CLI
+// is found out then, rather than by the next real command after its full
+// timeout.  A failed probe kills the CLI, and puts the runner in its
+// error state with a KeepaliveError.
+//
+// Probes aren't reported as runs, and don't count as activity per
+// IdleTimeout.  A run asked for during a probe waits for it.
+type Keepalive struct {
+	// Commander is the probe.  It's Reset before each probe, and the probe
+	// fails if it doesn't report Success, e.g. on unexpected output.
+	//
+	// Example: &cmdrs.KondoCommander{Command: "select 1;"}
+	Commander Commander
+
+	// Interval is how long the CLI sits idle before each probe.
+	//
+	// Example: 30 * time.Second
+	Interval time.Duration
+
+	// TimeOut limits each probe.  If zero, a default of a few seconds is
+	// used.
+	TimeOut time.Duration
+}
+
+func (k *Keepalive) validate() error {
+	if k.Commander == nil {
+		return fmt.Errorf("Keepalive needs a Commander")
+	}
+	if k.Interval <= 0 {
+		return fmt.Errorf("Keepalive Interval %s must be positive", k.Interval)
+	}
+	if k.TimeOut < 0 {
+		return fmt.Errorf("Keepalive TimeOut %s can't be negative", k.TimeOut)
+	}
+	return nil
+}
+
+// probeIdle sends the Keepalive probe, unless something's run since the
+// countdown started, or is running, and starts the countdown to the next.
+func (pr *ProcRunner) probeIdle(current func() bool) {
+	if !pr.queue.tryEnter() {
+		// A run is underway or waiting; it restarts the countdown.
+		return
+	}
+	defer pr.queue.leave()
+	pr.mutexState.Lock()
+	defer pr.mutexState.Unlock()
+	k := pr.params.Keepalive
+	if !current() || k == nil || pr.getState() != stateIdle {
+		return
+	}
+	if err := pr.probe(k); err != nil {
+		pr.logger.Printf("keepalive probe failed: %s\n", err.Error())
+		pr.idle.cancel()
+		pr.abandonSubprocess()
+		// After the kill, so it's the error the runner reports.
+		pr.enterStateError(
+			&KeepaliveError{Command: k.Commander.String(), Cause: err})
+		return
+	}
+	pr.keepalive.start(clockOrReal(pr.params.Clock), k.Interval, pr.probeIdle)
+}
+
+// probe runs the Keepalive probe.  The caller must hold mutexState.
+func (pr *ProcRunner) probe(k *Keepalive) error {
+	c := k.Commander
+	c.Reset()
+	pr.logger.Printf("keepalive probe %q\n", c.String())
+	pr.sentinelMu.Lock()
+	defer pr.sentinelMu.Unlock()
+	if _, err := pr.filter.BeginRun(c, pr.stdIn); err != nil {
+		return err
+	}
+	if err := pr.filter.IssueSentinelsAndFilter(
+		pr.chOut, pr.chErr, k.TimeOut); err != nil {
+		return err
+	}
+	if !c.Success() {
+		return fmt.Errorf("no success")
+	}
+	return nil
+}
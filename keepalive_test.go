@@ -0,0 +1,49 @@
+package clirunner_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunner_Keepalive(t *testing.T) {
+	h := makeHarness(t, func(p *Parameters) {
+		p.Keepalive = &Keepalive{
+			Commander: &KondoCommander{Command: "ping"},
+			Interval:  time.Minute,
+			TimeOut:   time.Second,
+		}
+	})
+	result := runAsync(h, NewHoardingCommander("list"), time.Hour)
+	expectCommands(t, h, "list", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+
+	// A healthy CLI answers, and is probed again later.
+	h.Clock.AwaitTimers(1)
+	h.Clock.Advance(time.Minute)
+	expectCommands(t, h, "ping", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("pong", "Rumpelstiltskin"))
+	h.Clock.AwaitTimers(1)
+	assert.Equal(t, "idle", h.Runner.Report().State)
+	assert.Equal(t, 1, h.Runner.Report().RunCount)
+
+	// A wedged one doesn't.
+	h.Clock.Advance(time.Minute)
+	expectCommands(t, h, "ping", "echo Rumpelstiltskin")
+	h.Clock.AwaitTimers(1)
+	h.Clock.Advance(time.Second)
+	awaitState(t, h, "error")
+	var ke *KeepaliveError
+	assert.True(t, errors.As(h.Runner.Report().LastError, &ke))
+	assert.Equal(t, "ping", ke.Command)
+	assert.Equal(t, 0, h.Clock.Timers())
+
+	// The next run fails at once, rather than after its timeout.
+	assert.Error(t, h.Runner.RunIt(NewHoardingCommander("list"), time.Hour))
+	assert.Error(t, h.Runner.Close())
+}
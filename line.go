@@ -0,0 +1,94 @@
+package clirunner
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Stream identifies the CLI output stream a line came from.
+type Stream int
+
+const (
+	// StreamOut is the CLI's standard output.
+	StreamOut Stream = iota
+	// StreamErr is the CLI's standard error.
+	StreamErr
+	// StreamExtra is one of the Parameters' ExtraStreams.
+	StreamExtra
+)
+
+func (s Stream) String() string {
+	switch s {
+	case StreamErr:
+		return "Err"
+	case StreamExtra:
+		return "Extra"
+	default:
+		return "Out"
+	}
+}
+
+// Line is one line of CLI output, without its trailing linefeed.
+type Line struct {
+	// Data is the content of the line.
+	Data []byte
+	// Stream is the stream the line came from.
+	Stream Stream
+	// Name is the name of the stream, if it's one of the ExtraStreams.
+	Name string
+	// Seq numbers the lines a runner reads, across its streams, in the
+	// order they're read.  It's only set for a LineWriter.
+	Seq uint64
+	// Time is when the line was read.  It's only set for a LineWriter.
+	Time time.Time
+}
+
+// lineRing keeps the most recent lines, up to its size.
+type lineRing struct {
+	lines []Line
+	next  int // where the next line goes, once lines is full
+	size  int
+}
+
+func newLineRing(size int) *lineRing {
+	return &lineRing{size: size}
+}
+
+// add keeps a copy of the line, forgetting the oldest if full.
+func (r *lineRing) add(l Line) {
+	if r.size < 1 {
+		return
+	}
+	l.Data = append([]byte(nil), l.Data...)
+	if len(r.lines) < r.size {
+		r.lines = append(r.lines, l)
+		return
+	}
+	r.lines[r.next] = l
+	r.next = (r.next + 1) % r.size
+}
+
+// contents returns the lines kept, oldest first.
+func (r *lineRing) contents() []Line {
+	result := make([]Line, 0, len(r.lines))
+	result = append(result, r.lines[r.next:]...)
+	return append(result, r.lines[:r.next]...)
+}
+
+// describeTail renders lines of output for an error message.
+func describeTail(tail []Line) string {
+	if len(tail) == 0 {
+		return "no output seen"
+	}
+	parts := make([]string, len(tail))
+	for i, l := range tail {
+		if l.Stream == StreamExtra {
+			parts[i] = fmt.Sprintf("%s %q", l.Name, l.Data)
+		} else {
+			parts[i] = fmt.Sprintf("std%s %q", l.Stream, l.Data)
+		}
+	}
+	return fmt.Sprintf(
+		"last %d lines of output: %s", len(tail), strings.Join(parts, ", "))
+}
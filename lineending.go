@@ -0,0 +1,73 @@
+package clirunner
+
+import (
+	"fmt"
+	"io"
+)
+
+// LineEnding says how lines written to the CLI, i.e. commands, sentinel
+// commands and answers to prompts, end.
+type LineEnding int
+
+const (
+	// LineEndingDefault is LineEndingCRLF on Windows, else LineEndingLF.
+	LineEndingDefault LineEnding = iota
+	// LineEndingLF ends lines with "\n".
+	LineEndingLF
+	// LineEndingCRLF ends lines with "\r\n".
+	LineEndingCRLF
+)
+
+func (e LineEnding) String() string {
+	switch e {
+	case LineEndingDefault:
+		return "Default"
+	case LineEndingLF:
+		return "LF"
+	case LineEndingCRLF:
+		return "CRLF"
+	default:
+		return fmt.Sprintf("LineEnding(%d)", int(e))
+	}
+}
+
+// validate looks for trouble.
+func (e LineEnding) validate() error {
+	if e < LineEndingDefault || e > LineEndingCRLF {
+		return fmt.Errorf("unknown %s", e)
+	}
+	return nil
+}
+
+// wrapStdIn returns the CLI's stdIn, writing lines per the LineEnding.
+func (e LineEnding) wrapStdIn(w io.WriteCloser) io.WriteCloser {
+	if e == LineEndingDefault {
+		e = defaultLineEnding
+	}
+	if e != LineEndingCRLF {
+		return w
+	}
+	return &crlfWriter{WriteCloser: w}
+}
+
+// crlfWriter turns each linefeed written that doesn't already follow a
+// carriage return into "\r\n".
+type crlfWriter struct {
+	io.WriteCloser
+	afterCR bool // the last byte written was a carriage return
+}
+
+func (w *crlfWriter) Write(p []byte) (int, error) {
+	out := make([]byte, 0, len(p)+8)
+	for _, b := range p {
+		if b == lineFeed && !w.afterCR {
+			out = append(out, '\r')
+		}
+		out = append(out, b)
+		w.afterCR = b == '\r'
+	}
+	if _, err := w.WriteCloser.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,27 @@
+package clirunner
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type nopCloser struct{ *bytes.Buffer }
+
+func (nopCloser) Close() error { return nil }
+
+func TestLineEnding_WrapStdIn(t *testing.T) {
+	var b bytes.Buffer
+	w := LineEndingCRLF.wrapStdIn(nopCloser{&b})
+	for _, s := range []string{"select 1;\n", "a\nb\r\n", "c\r", "\n", "\n"} {
+		n, err := w.Write([]byte(s))
+		assert.NoError(t, err)
+		assert.Equal(t, len(s), n)
+	}
+	assert.Equal(t, "select 1;\r\na\r\nb\r\nc\r\n\r\n", b.String())
+
+	plain := nopCloser{&b}
+	assert.Equal(t, plain, LineEndingLF.wrapStdIn(plain))
+	assert.EqualError(t, LineEnding(7).validate(), "unknown LineEnding(7)")
+}
@@ -0,0 +1,48 @@
+package clirunner
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// LineFilter transforms a line of output, e.g. trimming it or redacting
+// part of it, or drops it by returning false.  The line is only valid
+// during the call; a LineFilter may return it, changed in place, or
+// another.  See Parameters.LineFilters.
+type LineFilter func(line []byte) ([]byte, bool)
+
+// TrimSpace is a LineFilter removing leading and trailing white space.
+func TrimSpace(line []byte) ([]byte, bool) {
+	return bytes.TrimSpace(line), true
+}
+
+// DropBlank is a LineFilter dropping lines that are empty, or all white
+// space.
+func DropBlank(line []byte) ([]byte, bool) {
+	return line, len(bytes.TrimSpace(line)) > 0
+}
+
+// Redact returns a LineFilter replacing whatever the pattern matches with
+// repl, which may refer to submatches as in regexp.Expand, e.g. to mask
+// tokens a CLI echoes.
+func Redact(re *regexp.Regexp, repl string) LineFilter {
+	r := []byte(repl)
+	return func(line []byte) ([]byte, bool) {
+		return re.ReplaceAll(line, r), true
+	}
+}
+
+// lineText returns the scanned line as the runner sees it, per the
+// Parameters' StripANSI and LineFilters, or false if it's dropped.
+func (p *Parameters) lineText(line []byte) ([]byte, bool) {
+	if p.StripANSI {
+		line = stripANSI(line)
+	}
+	for _, f := range p.LineFilters {
+		var keep bool
+		if line, keep = f(line); !keep {
+			return nil, false
+		}
+	}
+	return line, true
+}
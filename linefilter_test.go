@@ -0,0 +1,37 @@
+package clirunner_test
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunner_LineFilters(t *testing.T) {
+	h := makeHarness(t, func(p *Parameters) {
+		p.StripANSI = true
+		p.LineFilters = []LineFilter{
+			TrimSpace,
+			DropBlank,
+			Redact(regexp.MustCompile(`token=\S+`), "token=***"),
+		}
+	})
+	c := NewHoardingCommander("login")
+	result := runAsync(h, c, time.Minute)
+	expectCommands(t, h, "login", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out(
+		"  \x1b[32mwelcome\x1b[0m  ", "", "   ", "\ttoken=abc123 ok",
+		"  Rumpelstiltskin\r"))
+	assert.NoError(t, <-result)
+	assert.Equal(t, "welcome\ntoken=*** ok\n", c.Result())
+	assert.NoError(t, h.Runner.Close())
+
+	_, err := NewHarness(&Parameters{
+		LineFilters: []LineFilter{TrimSpace, nil},
+		OutSentinel: &SimpleSentinelCommander{Command: "x", Value: "x"},
+	})
+	assert.EqualError(t, err, "LineFilters entry 1 is nil")
+}
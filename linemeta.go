@@ -0,0 +1,127 @@
+package clirunner
+
+import (
+	"sync"
+	"time"
+)
+
+// LineWriter is an optional interface for a Commander that wants each line
+// with its metadata: the stream it came from, its sequence number and when
+// it was read.  Lines of stdErr and stdOut can reach a Commander out of the
+// order the CLI wrote them, as the streams are read apart; sorting by Seq
+// puts them back in the order they were read.
+//
+// A LineWriter gets every line via WriteLine, in place of Write, WriteOut,
+// WriteErr and WriteExtra.  Lines of stdErr lose the ErrPrefix, as for a
+// Commander2.  Pieces of split lines still go to WriteContinued if it's a
+// ContinuedWriter.
+type LineWriter interface {
+	// WriteLine accepts a line.  Its Data is only valid during the call.
+	// Like Write, it should return an error only on some sort of
+	// catastrophe.
+	WriteLine(l Line) error
+}
+
+// lineStamp is what's known of a line as it's read.
+type lineStamp struct {
+	seq uint64
+	at  time.Time
+}
+
+// lineStamps stamps the lines of all of a runner's streams as they're
+// read, until they're delivered, as pieceMarks does.  Lines are numbered
+// regardless, but only kept while the current Commander wants them.
+type lineStamps struct {
+	m       sync.Mutex
+	seq     uint64
+	on      bool
+	stamped map[*byte]lineStamp
+}
+
+// newLine returns a copy of the line to send, with room to stamp it even
+// if it's empty.
+func newLine(line []byte) []byte {
+	return append(make([]byte, 0, len(line)+1), line...)
+}
+
+// stampKey returns the key of the line, or nil if it has no room for one.
+func stampKey(line []byte) *byte {
+	if cap(line) == 0 {
+		return nil
+	}
+	return &line[:1][0]
+}
+
+// stamp numbers the line, and notes it was read at the given time.
+func (s *lineStamps) stamp(line []byte, at time.Time) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.seq++
+	k := stampKey(line)
+	if k == nil || !s.on {
+		return
+	}
+	if s.stamped == nil {
+		s.stamped = map[*byte]lineStamp{}
+	}
+	s.stamped[k] = lineStamp{seq: s.seq, at: at}
+}
+
+// take returns the stamp of the line, forgetting it.  A line that wasn't
+// stamped, e.g. one read before a reset, is stamped now.  A nil lineStamps
+// only knows the time.
+func (s *lineStamps) take(line []byte, now time.Time) lineStamp {
+	if s == nil {
+		return lineStamp{at: now}
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	if k := stampKey(line); k != nil {
+		if st, ok := s.stamped[k]; ok {
+			delete(s.stamped, k)
+			return st
+		}
+	}
+	s.seq++
+	return lineStamp{seq: s.seq, at: now}
+}
+
+// peek returns the stamp of the line as take does, but keeps it for take.
+func (s *lineStamps) peek(line []byte, now time.Time) lineStamp {
+	if s == nil {
+		return lineStamp{at: now}
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	k := stampKey(line)
+	if k != nil {
+		if st, ok := s.stamped[k]; ok {
+			return st
+		}
+	}
+	s.seq++
+	st := lineStamp{seq: s.seq, at: now}
+	if k != nil && s.on {
+		if s.stamped == nil {
+			s.stamped = map[*byte]lineStamp{}
+		}
+		s.stamped[k] = st
+	}
+	return st
+}
+
+// reset forgets the stamps of lines never delivered, e.g. those that went
+// to the sentinels, keeping stamps from now on if on.
+func (s *lineStamps) reset(on bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.on, s.stamped = on, nil
+}
+
+// writeLine passes a line to the current Commander, which is a LineWriter,
+// with the stamp of the line as read.  The caller must hold cmdrLock.
+func (cw *sentinelFilter) writeLine(w LineWriter, read []byte, l Line) error {
+	st := cw.stamps.take(read, cw.clock.Now())
+	l.Seq, l.Time = st.seq, st.at
+	return w.WriteLine(l)
+}
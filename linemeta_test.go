@@ -0,0 +1,63 @@
+package clirunner_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+// lineRecorder keeps the Lines it's given, telling the test of each.
+type lineRecorder struct {
+	*HoardingCommander
+	m     sync.Mutex
+	lines []Line
+	got   chan struct{}
+}
+
+func (c *lineRecorder) WriteLine(l Line) error {
+	c.m.Lock()
+	l.Data = append([]byte(nil), l.Data...)
+	c.lines = append(c.lines, l)
+	c.m.Unlock()
+	c.got <- struct{}{}
+	return nil
+}
+
+func TestRunner_LineWriter(t *testing.T) {
+	h := makeHarness(t)
+	c := &lineRecorder{HoardingCommander: NewHoardingCommander("query"),
+		got: make(chan struct{}, 3)}
+	result := runAsync(h, c, time.Hour)
+	expectCommands(t, h, "query", "echo Rumpelstiltskin")
+	start := h.Clock.Now()
+	assert.NoError(t, h.Err("warning"))
+	<-c.got
+	h.Clock.Advance(time.Second)
+	assert.NoError(t, h.Out("row1"))
+	<-c.got
+	h.Clock.Advance(time.Second)
+	assert.NoError(t, h.Out("row2", "Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+
+	// Nothing went to Write.
+	assert.Empty(t, c.Result())
+	assert.Len(t, c.lines, 3)
+	var want []string
+	for i, l := range c.lines {
+		want = append(want, string(l.Data))
+		if i > 0 {
+			assert.Greater(t, l.Seq, c.lines[i-1].Seq)
+			assert.False(t, l.Time.Before(c.lines[i-1].Time))
+		}
+	}
+	assert.Equal(t, []string{"warning", "row1", "row2"}, want)
+	assert.Equal(t, StreamErr, c.lines[0].Stream)
+	assert.Equal(t, StreamOut, c.lines[2].Stream)
+	assert.Equal(t, start, c.lines[0].Time)
+	assert.Equal(t, start.Add(2*time.Second), c.lines[2].Time)
+	assert.NoError(t, h.Runner.Close())
+}
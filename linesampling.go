@@ -0,0 +1,93 @@
+package clirunner
+
+// LineSampling has a Commander receive only a sample of a command's output
+// on stdOut, for monitoring commands that need the shape, rather than the
+// entirety, of massive outputs.  Lines from stdErr are always delivered.
+//
+// The Commander receives the First lines, then one of every Every lines,
+// then the Last lines, in their original order.  Every line, sampled or
+// not, is counted in the RunReport.
+type LineSampling struct {
+	// First is the number of lines delivered at the start of the output.
+	First int
+
+	// Every, if positive, delivers the first of every Every lines after
+	// the First lines.  If zero, none of them are delivered.
+	Every int
+
+	// Last is the number of lines delivered at the end of the output.
+	// They're held until the run ends, since only then is the end known.
+	Last int
+}
+
+// LineSampler is an optional interface for a Commander whose runs need a
+// LineSampling other than the one specified in Parameters.
+type LineSampler interface {
+	// LineSampling returns the sampling for the Commander's runs, or nil
+	// to receive every line.
+	LineSampling() *LineSampling
+}
+
+// samplerFor returns a sampler for a run of the given Commander, given the
+// default sampling, either of which might be nil.  A nil sampler takes
+// every line.
+func samplerFor(c Commander, dflt *LineSampling) *lineSampler {
+	s := dflt
+	for ; c != nil; c = unwrap(c) {
+		if l, ok := c.(LineSampler); ok {
+			s = l.LineSampling()
+			break
+		}
+	}
+	if s == nil {
+		return nil
+	}
+	return &lineSampler{sampling: *s}
+}
+
+// heldLine is a line held until it's known whether it's among the Last.
+type heldLine struct {
+	data    []byte
+	sampled bool // true if it's to be delivered regardless
+}
+
+// lineSampler samples the lines of one run.
+type lineSampler struct {
+	sampling LineSampling
+	seen     int        // the number of lines seen so far
+	held     []heldLine // the most recent lines, up to Last of them
+}
+
+// take accepts the next line, returning the lines to deliver now.
+func (s *lineSampler) take(line []byte) (result [][]byte) {
+	n := s.seen
+	s.seen++
+	if n < s.sampling.First {
+		return [][]byte{line}
+	}
+	sampled := s.sampling.Every > 0 && (n-s.sampling.First)%s.sampling.Every == 0
+	if s.sampling.Last <= 0 {
+		if sampled {
+			result = append(result, line)
+		}
+		return
+	}
+	// Hold sampled lines too, so they're delivered in order.
+	s.held = append(s.held, heldLine{data: line, sampled: sampled})
+	if len(s.held) > s.sampling.Last {
+		if s.held[0].sampled {
+			result = append(result, s.held[0].data)
+		}
+		s.held = s.held[1:]
+	}
+	return
+}
+
+// drain returns the lines held until the end of the run.
+func (s *lineSampler) drain() (result [][]byte) {
+	for _, h := range s.held {
+		result = append(result, h.data)
+	}
+	s.held = nil
+	return
+}
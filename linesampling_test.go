@@ -0,0 +1,62 @@
+package clirunner
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineSampler(t *testing.T) {
+	testCases := map[string]struct {
+		sampling LineSampling
+		lines    int
+		expected string
+	}{
+		"nothing": {
+			lines:    5,
+			expected: "",
+		},
+		"first": {
+			sampling: LineSampling{First: 2},
+			lines:    5,
+			expected: "0 1",
+		},
+		"every": {
+			sampling: LineSampling{Every: 3},
+			lines:    8,
+			expected: "0 3 6",
+		},
+		"last": {
+			sampling: LineSampling{Last: 2},
+			lines:    5,
+			expected: "3 4",
+		},
+		"all": {
+			sampling: LineSampling{First: 2, Every: 3, Last: 2},
+			lines:    12,
+			expected: "0 1 2 5 8 10 11",
+		},
+		"overlap": {
+			sampling: LineSampling{First: 3, Every: 2, Last: 3},
+			lines:    4,
+			expected: "0 1 2 3",
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			s := &lineSampler{sampling: tc.sampling}
+			var got []string
+			for i := 0; i < tc.lines; i++ {
+				for _, l := range s.take([]byte(fmt.Sprint(i))) {
+					got = append(got, string(l))
+				}
+			}
+			for _, l := range s.drain() {
+				got = append(got, string(l))
+			}
+			assert.Equal(t, tc.expected, strings.Join(got, " "))
+		})
+	}
+}
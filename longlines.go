@@ -0,0 +1,207 @@
+package clirunner
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sync"
+)
+
+// LongLinePolicy says what a runner does with a line of output longer than
+// Parameters.MaxLineBytes.
+type LongLinePolicy int
+
+const (
+	// LongLinesAbort stops reading the stream the line is on, so that no
+	// run can finish until the runner is restarted.
+	LongLinesAbort LongLinePolicy = iota
+
+	// LongLinesSplit delivers the line in pieces of at most MaxLineBytes,
+	// each counted as a line.  All but the last piece are continued by the
+	// next, and go to a ContinuedWriter via WriteContinued.
+	LongLinesSplit
+
+	// LongLinesTruncate delivers the first MaxLineBytes of the line,
+	// dropping the rest.
+	LongLinesTruncate
+)
+
+// defaultMaxLineBytes is the longest line read by default, as by a
+// bufio.Scanner.
+const defaultMaxLineBytes = bufio.MaxScanTokenSize
+
+// ContinuedWriter is an optional interface for a Commander that wants the
+// pieces of lines split per LongLinesSplit told apart from whole lines.  A
+// Commander that isn't one gets every piece via Write.
+type ContinuedWriter interface {
+	// WriteContinued accepts a piece of a line, which the next piece
+	// written, via WriteContinued or Write, continues.  Like Write, it
+	// should return an error only on some sort of catastrophe.
+	WriteContinued(piece []byte) error
+}
+
+// lineSplitter splits a stream into records, i.e. lines, as
+// bufio.ScanLines does, or records ended by any of its other delimiters,
+// and handles records longer than max per its policy.
+type lineSplitter struct {
+	max    int
+	policy LongLinePolicy
+	// delims end records besides linefeed; longest is the length of the
+	// longest delimiter, linefeed included.
+	delims  [][]byte
+	longest int
+	// skipping is true while dropping the rest of a truncated record.
+	skipping bool
+	// continued is true if the last token is continued by the next.
+	continued bool
+	// afterCR is true if the last record ended with a carriage return, so
+	// that a linefeed right after it ends no record of its own.
+	afterCR bool
+}
+
+// end returns where the first record in data ends, and the length of the
+// delimiter ending it, or -1 if data holds no delimiter.  The longest of
+// delimiters found at the same spot wins.
+func (s *lineSplitter) end(data []byte) (int, int) {
+	i, n := bytes.IndexByte(data, '\n'), 1
+	for _, d := range s.delims {
+		j := bytes.Index(data, d)
+		if j >= 0 && (i < 0 || j < i || (j == i && len(d) > n)) {
+			i, n = j, len(d)
+		}
+	}
+	return i, n
+}
+
+// split is a bufio.SplitFunc.
+func (s *lineSplitter) split(data []byte, atEOF bool) (int, []byte, error) {
+	s.continued = false
+	if s.afterCR && len(data) > 0 {
+		s.afterCR = false
+		if data[0] == '\n' {
+			return 1, nil, nil
+		}
+	}
+	i, n := s.end(data)
+	if s.skipping {
+		if i >= 0 {
+			s.skipping = false
+			s.afterCR = isCR(data[i : i+n])
+			return i + n, nil, nil
+		}
+		return len(data), nil, nil
+	}
+	if i >= 0 && i <= s.max {
+		s.afterCR = isCR(data[i : i+n])
+		if data[i] == '\n' {
+			return i + n, dropCR(data[:i]), nil
+		}
+		return i + n, data[:i], nil
+	}
+	if i > s.max || len(data) >= s.max+s.longest {
+		switch s.policy {
+		case LongLinesSplit:
+			s.continued = true
+			return s.max, data[:s.max], nil
+		case LongLinesTruncate:
+			s.skipping = true
+			return s.max, data[:s.max], nil
+		}
+		return 0, nil, bufio.ErrTooLong
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), dropCR(data), nil
+	}
+	return 0, nil, nil
+}
+
+func isCR(delim []byte) bool { return len(delim) == 1 && delim[0] == '\r' }
+
+// dropCR drops a terminal carriage return, as bufio.ScanLines does.
+func dropCR(data []byte) []byte {
+	if len(data) > 0 && data[len(data)-1] == '\r' {
+		return data[:len(data)-1]
+	}
+	return data
+}
+
+// lineScanner is a bufio.Scanner of records, per the Parameters'
+// RecordDelimiters, MaxLineBytes and LongLines.
+type lineScanner struct {
+	*bufio.Scanner
+	splitter *lineSplitter
+}
+
+// newLineScanner returns a lineScanner of r per the Parameters.
+func (p *Parameters) newLineScanner(r io.Reader) *lineScanner {
+	max := p.MaxLineBytes
+	if max == 0 {
+		max = defaultMaxLineBytes
+	}
+	s := &lineSplitter{max: max, policy: p.LongLines, longest: 1}
+	for _, d := range p.RecordDelimiters {
+		if d == "\n" {
+			continue
+		}
+		s.delims = append(s.delims, []byte(d))
+		if len(d) > s.longest {
+			s.longest = len(d)
+		}
+	}
+	scanner := bufio.NewScanner(r)
+	// Room for a record of max bytes and its delimiter, no more.
+	size := 4096
+	if size > max+s.longest {
+		size = max + s.longest
+	}
+	scanner.Buffer(make([]byte, size), max+s.longest)
+	scanner.Split(s.split)
+	return &lineScanner{Scanner: scanner, splitter: s}
+}
+
+// continued returns true if the line last scanned is a piece of a split
+// line, continued by the next.
+func (s *lineScanner) continued() bool { return s.splitter.continued }
+
+// pieceMarks remembers the pieces of split lines that are continued, on
+// their way from the stream scanners to the filter.  Pieces are known by
+// the address of their first byte, since each is a fresh copy.
+type pieceMarks struct {
+	m      sync.Mutex
+	marked map[*byte]bool
+}
+
+// mark remembers the piece as continued.
+func (p *pieceMarks) mark(piece []byte) {
+	if len(piece) == 0 {
+		return
+	}
+	p.m.Lock()
+	defer p.m.Unlock()
+	if p.marked == nil {
+		p.marked = map[*byte]bool{}
+	}
+	p.marked[&piece[0]] = true
+}
+
+// take returns true if the piece is marked continued, forgetting it.
+func (p *pieceMarks) take(piece []byte) bool {
+	if len(piece) == 0 {
+		return false
+	}
+	p.m.Lock()
+	defer p.m.Unlock()
+	if !p.marked[&piece[0]] {
+		return false
+	}
+	delete(p.marked, &piece[0])
+	return true
+}
+
+// reset forgets the marks of pieces never delivered, e.g. those that went
+// to the sentinels.
+func (p *pieceMarks) reset() {
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.marked = nil
+}
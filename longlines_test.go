@@ -0,0 +1,84 @@
+package clirunner_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+// pieceCommander records the pieces of split lines apart from the others.
+type pieceCommander struct {
+	*HoardingCommander
+	pieces []string
+}
+
+func (c *pieceCommander) WriteContinued(piece []byte) error {
+	c.pieces = append(c.pieces, string(piece))
+	return nil
+}
+
+func longLineHarness(t *testing.T, policy LongLinePolicy) *Harness {
+	return makeHarness(t, func(p *Parameters) {
+		p.ErrPrefix = "E:"
+		p.MaxLineBytes = 16
+		p.LongLines = policy
+	})
+}
+
+func TestRunner_LongLinesSplit(t *testing.T) {
+	h := longLineHarness(t, LongLinesSplit)
+	long := strings.Repeat("0123456789", 4)
+
+	c := &pieceCommander{HoardingCommander: NewHoardingCommander("query")}
+	result := runAsync(h, c, time.Minute)
+	expectCommands(t, h, "query", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out(long, "short", "Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	assert.Equal(t,
+		[]string{"0123456789012345", "6789012345678901"}, c.pieces)
+	assert.Equal(t, "23456789\nshort\n", c.Result())
+
+	// A Commander that isn't a ContinuedWriter gets the pieces via Write,
+	// and the ErrPrefix goes only on the first piece, beyond the cap.
+	hc := NewHoardingCommander("again")
+	result = runAsync(h, hc, time.Minute)
+	expectCommands(t, h, "again", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Err("abcdefghijklmnopq"))
+	assert.NoError(t, h.Out("Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	assert.Equal(t, "E:abcdefghijklmnop\nq\n", hc.Result())
+	assert.NoError(t, h.Runner.Close())
+}
+
+func TestRunner_LongLinesTruncate(t *testing.T) {
+	h := longLineHarness(t, LongLinesTruncate)
+	c := &pieceCommander{HoardingCommander: NewHoardingCommander("query")}
+	result := runAsync(h, c, time.Minute)
+	expectCommands(t, h, "query", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out(strings.Repeat("0123456789", 4), "short",
+		"exactly sixteen!", "Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	assert.Empty(t, c.pieces)
+	assert.Equal(t, "0123456789012345\nshort\nexactly sixteen!\n", c.Result())
+	assert.NoError(t, h.Runner.Close())
+}
+
+func TestRunner_RecordDelimiters(t *testing.T) {
+	h := makeHarness(t, func(p *Parameters) {
+		p.RecordDelimiters = []string{"\x00", "\r", "<EOR>"}
+	})
+	c := NewHoardingCommander("query")
+	result := runAsync(h, c, time.Minute)
+	expectCommands(t, h, "query", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Prompt("a\x00b\x00 10%\r 50%\r100%\r\n"))
+	assert.NoError(t, h.Prompt("one<EOR>two<EO"))
+	assert.NoError(t, h.Prompt("R>line\r\nRumpelstiltskin\n"))
+	assert.NoError(t, <-result)
+	assert.Equal(t,
+		"a\nb\n 10%\n 50%\n100%\none\ntwo\nline\n", c.Result())
+	assert.NoError(t, h.Runner.Close())
+}
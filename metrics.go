@@ -0,0 +1,126 @@
+package clirunner
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// DurationBuckets are the upper bounds of the buckets of a ProcRunner's
+// run duration histogram.
+var DurationBuckets = []time.Duration{
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+}
+
+// Metrics holds counters describing a ProcRunner's life, for export to a
+// monitoring system, e.g. as Prometheus counters and a histogram.  The
+// counts only grow, except for the queue lengths.
+type Metrics struct {
+	// Runs counts all runs; Failures counts those that returned an error.
+	Runs, Failures int
+	// SentinelTimeouts counts runs whose sentinels didn't show up in time,
+	// whether or not an interrupt recovered the CLI.
+	SentinelTimeouts int
+	// Starts counts the times the CLI subprocess was started; Restarts
+	// counts those after the first.
+	Starts, Restarts int
+	// Durations is the histogram of run durations.
+	Durations DurationHistogram
+	// Out and Err describe the queues of lines read from stdOut and
+	// stdErr, waiting to be handled.
+	Out, Err QueueMetrics
+}
+
+// DurationHistogram is a cumulative histogram, as Prometheus has them.
+type DurationHistogram struct {
+	// Bounds are the upper bounds of the buckets, i.e. DurationBuckets.
+	Bounds []time.Duration
+	// Counts[i] counts the durations no greater than Bounds[i].
+	Counts []int
+	// Count counts all durations, i.e. it's the count of the +Inf bucket.
+	Count int
+	// Sum is the sum of all durations.
+	Sum time.Duration
+}
+
+// QueueMetrics describes a queue of lines read from an output stream.  A
+// full queue stalls the reading of the stream, and eventually the CLI.
+type QueueMetrics struct {
+	// Len is how many lines are queued now; Cap is how many fit.
+	Len, Cap int
+	// Peak is the most lines ever queued at once.
+	Peak int
+	// FullSends counts lines that found the queue full.
+	FullSends int
+}
+
+// queueGauge accumulates the QueueMetrics of one stream.  Use atomically;
+// it's updated for every line.
+type queueGauge struct {
+	peak, fullSends int64
+}
+
+// send puts the line on the queue, noting its fill.
+func (g *queueGauge) send(ch chan<- []byte, line []byte) {
+	n := int64(len(ch))
+	if n == int64(cap(ch)) {
+		atomic.AddInt64(&g.fullSends, 1)
+	}
+	ch <- line
+	n++
+	for {
+		peak := atomic.LoadInt64(&g.peak)
+		if n <= peak || atomic.CompareAndSwapInt64(&g.peak, peak, n) {
+			return
+		}
+	}
+}
+
+// fill copies the gauge into the given QueueMetrics.
+func (g *queueGauge) fill(m *QueueMetrics) {
+	m.Peak = int(atomic.LoadInt64(&g.peak))
+	m.FullSends = int(atomic.LoadInt64(&g.fullSends))
+}
+
+// observe adds a duration to the histogram.
+func (h *DurationHistogram) observe(d time.Duration) {
+	if h.Bounds == nil {
+		h.Bounds = DurationBuckets
+		h.Counts = make([]int, len(h.Bounds))
+	}
+	for i, b := range h.Bounds {
+		if d <= b {
+			h.Counts[i]++
+		}
+	}
+	h.Count++
+	h.Sum += d
+}
+
+// copy returns a copy that doesn't share the counts.
+func (h DurationHistogram) copy() DurationHistogram {
+	h.Counts = append([]int(nil), h.Counts...)
+	return h
+}
+
+// Metrics returns the runner's counters.
+func (pr *ProcRunner) Metrics() Metrics {
+	var m Metrics
+	pr.history.fillMetrics(&m)
+	pr.mutexState.Lock()
+	if pr.chOut != nil {
+		m.Out.Len, m.Out.Cap = len(pr.chOut), cap(pr.chOut)
+	}
+	if pr.chErr != nil {
+		m.Err.Len, m.Err.Cap = len(pr.chErr), cap(pr.chErr)
+	}
+	pr.mutexState.Unlock()
+	return m
+}
@@ -0,0 +1,49 @@
+package clirunner_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/monopole/clirunner/internal/testcli/tstcli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunner_Metrics(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+	})
+	assert.NoError(t, err)
+	m := runner.Metrics()
+	assert.Equal(t, 0, m.Runs)
+	assert.Equal(t, DurationBuckets, m.Durations.Bounds)
+	assert.Len(t, m.Durations.Counts, len(DurationBuckets))
+
+	assert.NoError(t, runner.RunIt(
+		NewHoardingCommander(tstcli.CmdQuery+" limit 20"), testingTimeout))
+	assert.Error(t, runner.RunIt(
+		tstcli.MakeSleepCommander(300*time.Millisecond), 10*time.Millisecond))
+	assert.NoError(t, runner.Restart())
+	assert.NoError(t, runner.RunIt(
+		NewHoardingCommander(tstcli.CmdQuery+" limit 1"), testingTimeout))
+
+	m = runner.Metrics()
+	assert.Equal(t, 3, m.Runs)
+	assert.Equal(t, 1, m.Failures)
+	assert.Equal(t, 1, m.SentinelTimeouts)
+	assert.Equal(t, 2, m.Starts)
+	assert.Equal(t, 1, m.Restarts)
+	assert.Equal(t, 3, m.Durations.Count)
+	assert.Greater(t, int64(m.Durations.Sum), int64(0))
+	// Cumulative, and the last bound is long enough for every run.
+	assert.Equal(t, 3, m.Durations.Counts[len(m.Durations.Counts)-1])
+	assert.Greater(t, m.Out.Cap, 0)
+	assert.Equal(t, 0, m.Out.Len)
+	assert.GreaterOrEqual(t, m.Out.Peak, 1)
+	assert.Equal(t, 0, m.Out.FullSends)
+	assert.NoError(t, runner.Close())
+}
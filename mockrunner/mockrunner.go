@@ -0,0 +1,206 @@
+// Package mockrunner has clirunner.Runners for unit tests of code that
+// runs Commanders, without launching a CLI: a Runner with programmed
+// responses, recording the commands it's given, and a ScriptedRunner
+// expecting commands in a scripted order.
+//
+//	r := mockrunner.New()
+//	r.Add(mockrunner.Response{Command: "version", Out: []string{"v1.2.3"}})
+//	codeUnderTest(r)
+//	assert.Equal(t, []string{"version"}, r.Commands())
+package mockrunner
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/monopole/clirunner"
+)
+
+// Response is the programmed response to a command.
+type Response struct {
+	// Command, if not empty, is the command answered.
+	Command string
+	// Match, if not nil, matches the commands answered, in place of Command.
+	Match *regexp.Regexp
+	// Out holds the lines written to the Commander, as if from stdOut.
+	Out []string
+	// Err is returned by the run, after the lines are written.
+	Err error
+	// Times is how many runs are answered, after which the Response is
+	// used up.  If zero, it never is.
+	Times int
+	// Delay is how long a run takes.  A run is canceled if its context is
+	// done first.
+	Delay time.Duration
+	used  int
+}
+
+// answers returns true if the response answers the command.
+func (r *Response) answers(cmd string) bool {
+	if r.Times > 0 && r.used >= r.Times {
+		return false
+	}
+	if r.Match != nil {
+		return r.Match.MatchString(cmd)
+	}
+	return r.Command == cmd
+}
+
+// Call records a run.
+type Call struct {
+	// Command is the command run.
+	Command string
+	// TimeOut is the time limit given to RunIt; zero for RunContext.
+	TimeOut time.Duration
+	// Err is what the run returned.
+	Err error
+}
+
+// Runner is a clirunner.Runner that answers each command with the first
+// of its Responses to match it, and records the calls made.  A command
+// that no Response answers fails with an UnexpectedCommandError, unless
+// there's a Fallback.  It's safe for concurrent use.
+type Runner struct {
+	// Fallback, if not nil, answers the commands no Response answers.
+	Fallback *Response
+
+	m         sync.Mutex
+	responses []*Response
+	calls     []Call
+	closed    bool
+}
+
+var _ clirunner.Runner = &Runner{}
+
+// New returns a Runner with the given Responses.
+func New(responses ...Response) *Runner {
+	r := &Runner{}
+	r.Add(responses...)
+	return r
+}
+
+// Add adds Responses, after those already added.
+func (r *Runner) Add(responses ...Response) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	for i := range responses {
+		resp := responses[i]
+		r.responses = append(r.responses, &resp)
+	}
+}
+
+// RunIt answers the Commander's command per the Responses.
+func (r *Runner) RunIt(c clirunner.Commander, timeOut time.Duration) error {
+	return r.run(context.Background(), c, timeOut)
+}
+
+// RunContext answers the Commander's command per the Responses, unless
+// the context is done first.
+func (r *Runner) RunContext(ctx context.Context, c clirunner.Commander) error {
+	return r.run(ctx, c, 0)
+}
+
+func (r *Runner) run(
+	ctx context.Context, c clirunner.Commander, timeOut time.Duration) error {
+	if c == nil {
+		return fmt.Errorf("provide a Commander")
+	}
+	cmd := c.String()
+	resp, err := r.find(cmd)
+	if err == nil {
+		err = respond(ctx, c, resp)
+	}
+	r.m.Lock()
+	r.calls = append(r.calls, Call{Command: cmd, TimeOut: timeOut, Err: err})
+	r.m.Unlock()
+	return err
+}
+
+// find returns the response for the command, using it up.
+func (r *Runner) find(cmd string) (Response, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.closed {
+		return Response{}, clirunner.ErrRunnerClosed
+	}
+	for _, resp := range r.responses {
+		if resp.answers(cmd) {
+			resp.used++
+			return *resp, nil
+		}
+	}
+	if r.Fallback != nil {
+		return *r.Fallback, nil
+	}
+	return Response{}, &UnexpectedCommandError{Command: cmd}
+}
+
+// respond writes the response to the Commander.
+func respond(ctx context.Context, c clirunner.Commander, resp Response) error {
+	if err := ctx.Err(); err != nil {
+		return &clirunner.RunCanceledError{Command: c.String(), Cause: err}
+	}
+	if resp.Delay > 0 {
+		t := time.NewTimer(resp.Delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return &clirunner.RunCanceledError{
+				Command: c.String(), Cause: ctx.Err()}
+		}
+	}
+	for _, line := range resp.Out {
+		if _, err := c.Write([]byte(line)); err != nil {
+			return err
+		}
+	}
+	return resp.Err
+}
+
+// Calls returns the runs made so far, in order.
+func (r *Runner) Calls() []Call {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// Commands returns the commands run so far, in order.
+func (r *Runner) Commands() []string {
+	r.m.Lock()
+	defer r.m.Unlock()
+	result := make([]string, len(r.calls))
+	for i, c := range r.calls {
+		result[i] = c.Command
+	}
+	return result
+}
+
+// Close makes later runs fail with clirunner.ErrRunnerClosed.
+func (r *Runner) Close() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.closed = true
+	return nil
+}
+
+// Closed returns true if Close was called.
+func (r *Runner) Closed() bool {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.closed
+}
+
+// UnexpectedCommandError is returned by a run of a command that no
+// Response answers.
+type UnexpectedCommandError struct {
+	// Command is the command run.
+	Command string
+}
+
+func (e *UnexpectedCommandError) Error() string {
+	return fmt.Sprintf("no response programmed for command %q", e.Command)
+}
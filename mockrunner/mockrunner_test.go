@@ -0,0 +1,80 @@
+package mockrunner_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/monopole/clirunner"
+	"github.com/monopole/clirunner/cmdrs"
+	"github.com/monopole/clirunner/mockrunner"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunner(t *testing.T) {
+	oops := errors.New("oops")
+	r := mockrunner.New(
+		mockrunner.Response{
+			Command: "version", Out: []string{"v1.2.3"}, Times: 1},
+		mockrunner.Response{
+			Match: regexp.MustCompile(`^query `), Out: []string{"a", "b"}},
+		mockrunner.Response{Command: "bad", Err: oops},
+	)
+
+	c := cmdrs.NewHoardingCommander("version")
+	assert.NoError(t, r.RunIt(c, time.Minute))
+	assert.Equal(t, "v1.2.3\n", c.Result())
+
+	c = cmdrs.NewHoardingCommander("query limit 2")
+	assert.NoError(t, r.RunContext(context.Background(), c))
+	assert.Equal(t, "a\nb\n", c.Result())
+
+	assert.Equal(t, oops, r.RunIt(cmdrs.NewHoardingCommander("bad"), 0))
+
+	// The version Response is used up.
+	var uce *mockrunner.UnexpectedCommandError
+	err := r.RunIt(cmdrs.NewHoardingCommander("version"), 0)
+	assert.True(t, errors.As(err, &uce))
+	assert.Equal(t, "version", uce.Command)
+
+	r.Fallback = &mockrunner.Response{Out: []string{"whatever"}}
+	c = cmdrs.NewHoardingCommander("version")
+	assert.NoError(t, r.RunIt(c, 0))
+	assert.Equal(t, "whatever\n", c.Result())
+
+	assert.Equal(t,
+		[]string{"version", "query limit 2", "bad", "version", "version"},
+		r.Commands())
+	calls := r.Calls()
+	assert.Equal(t, time.Minute, calls[0].TimeOut)
+	assert.Equal(t, oops, calls[2].Err)
+
+	assert.NoError(t, r.Close())
+	assert.True(t, r.Closed())
+	assert.True(t, errors.Is(
+		r.RunIt(cmdrs.NewHoardingCommander("version"), 0),
+		clirunner.ErrRunnerClosed))
+}
+
+func TestRunner_Delay(t *testing.T) {
+	r := mockrunner.New(
+		mockrunner.Response{Command: "sleep", Delay: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	var ce *clirunner.RunCanceledError
+	err := r.RunContext(ctx, cmdrs.NewHoardingCommander("sleep"))
+	assert.True(t, errors.As(err, &ce))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestRunner_WorkSet(t *testing.T) {
+	r := mockrunner.New(mockrunner.Response{Command: "ping"})
+	ws := &clirunner.WorkSet{Workers: 2}
+	for i := 0; i < 3; i++ {
+		ws.Add(r, cmdrs.NewHoardingCommander("ping"))
+	}
+	assert.NoError(t, ws.Run(context.Background()).Err())
+	assert.Len(t, r.Calls(), 3)
+}
@@ -0,0 +1,186 @@
+package mockrunner
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/monopole/clirunner"
+)
+
+// TestingT is the part of a *testing.T a ScriptedRunner uses.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// ScriptedRunner is a clirunner.Runner that expects commands in the order
+// they're scripted, as sqlmock does for database/sql, answering each with
+// its scripted output, as if the CLI printed it and then its sentinels:
+//
+//	r := mockrunner.NewScriptedRunner(t)
+//	r.Expect("use inventory")
+//	r.Expect("select count(*) from parts").WillOutput("42")
+//	r.Expect("drop table parts").WillErr("permission denied")
+//	codeUnderTest(r)
+//
+// A command that isn't the next one expected fails the test, as does,
+// once the test ends, an expected command that never ran.  It's safe for
+// concurrent use, though concurrent commands make for an unpredictable
+// order.
+type ScriptedRunner struct {
+	t      TestingT
+	m      sync.Mutex
+	steps  []*Step
+	next   int // index of the next step expected
+	closed bool
+}
+
+var _ clirunner.Runner = &ScriptedRunner{}
+
+// NewScriptedRunner returns a ScriptedRunner failing the given test.  If
+// the test has a Cleanup method, as a *testing.T does, the runner checks
+// that every expected command ran once the test ends.
+func NewScriptedRunner(t TestingT) *ScriptedRunner {
+	r := &ScriptedRunner{t: t}
+	if c, ok := t.(interface{ Cleanup(func()) }); ok {
+		c.Cleanup(func() {
+			if err := r.ExpectationsWereMet(); err != nil {
+				t.Errorf("%v", err)
+			}
+		})
+	}
+	return r
+}
+
+// Step is an expected command and the response to it.  Its methods
+// script the response, returning the Step so they can be chained.
+type Step struct {
+	command string
+	match   *regexp.Regexp
+	lines   []string // stdOut and stdErr lines, in order
+	err     error
+	delay   time.Duration
+}
+
+// Expect expects the command next, after those already expected.
+func (r *ScriptedRunner) Expect(command string) *Step {
+	return r.add(&Step{command: command})
+}
+
+// ExpectMatch expects a command matching the pattern next, after those
+// already expected.
+func (r *ScriptedRunner) ExpectMatch(pattern *regexp.Regexp) *Step {
+	return r.add(&Step{match: pattern})
+}
+
+func (r *ScriptedRunner) add(s *Step) *Step {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.steps = append(r.steps, s)
+	return s
+}
+
+// WillOutput adds lines the command prints on stdOut.
+func (s *Step) WillOutput(lines ...string) *Step {
+	s.lines = append(s.lines, lines...)
+	return s
+}
+
+// WillErr adds lines the command prints on stdErr.  Like the lines on
+// stdOut, they're written to the Commander, in the order scripted.
+func (s *Step) WillErr(lines ...string) *Step {
+	s.lines = append(s.lines, lines...)
+	return s
+}
+
+// WillFail makes the run return the error, after its output, e.g. a
+// clirunner.TimeoutButRecoveredError for a command that never finished.
+func (s *Step) WillFail(err error) *Step {
+	s.err = err
+	return s
+}
+
+// WillDelay makes the run take the given time, unless its context is
+// done first.
+func (s *Step) WillDelay(d time.Duration) *Step {
+	s.delay = d
+	return s
+}
+
+func (s *Step) String() string {
+	if s.match != nil {
+		return fmt.Sprintf("a command matching %q", s.match)
+	}
+	return fmt.Sprintf("%q", s.command)
+}
+
+// accepts returns true if the step expects the command.
+func (s *Step) accepts(cmd string) bool {
+	if s.match != nil {
+		return s.match.MatchString(cmd)
+	}
+	return s.command == cmd
+}
+
+// RunIt runs the Commander per the next step of the script.
+func (r *ScriptedRunner) RunIt(c clirunner.Commander, _ time.Duration) error {
+	return r.RunContext(context.Background(), c)
+}
+
+// RunContext runs the Commander per the next step of the script, unless
+// the context is done first.
+func (r *ScriptedRunner) RunContext(
+	ctx context.Context, c clirunner.Commander) error {
+	r.t.Helper()
+	if c == nil {
+		return fmt.Errorf("provide a Commander")
+	}
+	s, err := r.take(c.String())
+	if err != nil {
+		r.t.Errorf("%v", err)
+		return err
+	}
+	return respond(ctx, c, Response{Out: s.lines, Err: s.err, Delay: s.delay})
+}
+
+// take returns the next step, if it expects the command.
+func (r *ScriptedRunner) take(cmd string) (*Step, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.closed {
+		return nil, clirunner.ErrRunnerClosed
+	}
+	if r.next >= len(r.steps) {
+		return nil, &UnexpectedCommandError{Command: cmd}
+	}
+	s := r.steps[r.next]
+	if !s.accepts(cmd) {
+		return nil, fmt.Errorf(
+			"command %q run, but step %d expects %s", cmd, r.next, s)
+	}
+	r.next++
+	return s, nil
+}
+
+// ExpectationsWereMet returns an error if some expected command hasn't
+// run.
+func (r *ScriptedRunner) ExpectationsWereMet() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.next < len(r.steps) {
+		return fmt.Errorf("%d expected commands didn't run, starting with %s",
+			len(r.steps)-r.next, r.steps[r.next])
+	}
+	return nil
+}
+
+// Close makes later runs fail with clirunner.ErrRunnerClosed.
+func (r *ScriptedRunner) Close() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.closed = true
+	return nil
+}
@@ -0,0 +1,84 @@
+package mockrunner_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/monopole/clirunner"
+	"github.com/monopole/clirunner/cmdrs"
+	"github.com/monopole/clirunner/mockrunner"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeT records the failures of a ScriptedRunner.
+type fakeT struct {
+	failures []string
+	cleanups []func()
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.failures = append(f.failures, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeT) Cleanup(fn func()) { f.cleanups = append(f.cleanups, fn) }
+
+func TestScriptedRunner(t *testing.T) {
+	r := mockrunner.NewScriptedRunner(t)
+	denied := errors.New("denied")
+	r.Expect("use inventory")
+	r.Expect("select count(*) from parts").WillOutput("42")
+	r.ExpectMatch(regexp.MustCompile(`^drop `)).
+		WillOutput("dropping").WillErr("permission denied").WillFail(denied)
+
+	assert.NoError(t, r.RunIt(cmdrs.NewHoardingCommander("use inventory"), 0))
+	c := cmdrs.NewHoardingCommander("select count(*) from parts")
+	assert.NoError(t, r.RunContext(context.Background(), c))
+	assert.Equal(t, "42\n", c.Result())
+	c = cmdrs.NewHoardingCommander("drop table parts")
+	assert.Equal(t, denied, r.RunIt(c, time.Minute))
+	assert.Equal(t, "dropping\npermission denied\n", c.Result())
+	assert.NoError(t, r.ExpectationsWereMet())
+	assert.NoError(t, r.Close())
+}
+
+func TestScriptedRunner_Failures(t *testing.T) {
+	ft := &fakeT{}
+	r := mockrunner.NewScriptedRunner(ft)
+	r.Expect("one")
+	r.Expect("two").WillDelay(time.Hour)
+
+	// Out of order.
+	assert.Error(t, r.RunIt(cmdrs.NewHoardingCommander("two"), 0))
+	assert.Equal(t,
+		[]string{`command "two" run, but step 0 expects "one"`}, ft.failures)
+	assert.NoError(t, r.RunIt(cmdrs.NewHoardingCommander("one"), 0))
+
+	// Canceled, though as expected.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var ce *clirunner.RunCanceledError
+	assert.True(t, errors.As(
+		r.RunContext(ctx, cmdrs.NewHoardingCommander("two")), &ce))
+	assert.Len(t, ft.failures, 1)
+
+	// Not expected at all.
+	var uce *mockrunner.UnexpectedCommandError
+	assert.True(t, errors.As(
+		r.RunIt(cmdrs.NewHoardingCommander("three"), 0), &uce))
+	assert.Len(t, ft.failures, 2)
+
+	// Never run.
+	r.Expect("four")
+	r.Expect("five")
+	for _, fn := range ft.cleanups {
+		fn()
+	}
+	assert.Equal(t,
+		`2 expected commands didn't run, starting with "four"`, ft.failures[2])
+}
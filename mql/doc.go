@@ -0,0 +1,13 @@
+// Package mql has Commanders, query builders and parsers for the MQL
+// (Matrix Query Language) CLI, the CLI this module was first written
+// to drive.
+//
+// Query output is dumped one object per line, with fields separated by
+// DumpDelimiter, e.g.
+//
+//	Part_|_P-100_|_A_|_12345.67890.1234.5678
+//
+// and errors look like
+//
+//	Error: #1900068: print business object failed
+package mql
@@ -0,0 +1,66 @@
+package mql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DumpDelimiter separates the fields of a dumped object.  It's chosen to be
+// unlikely to appear in the fields themselves.
+const DumpDelimiter = "_|_"
+
+// wildcard matches any type, name or revision.
+const wildcard = "*"
+
+// Query builds a "temp query bus" command, which dumps the type, name and
+// revision of each matching business object, followed by any Selects.
+type Query struct {
+	// Type, Name and Revision are patterns for the objects to find.
+	// Empty means "*".
+	Type, Name, Revision string
+	// Where, if not empty, is an expression further restricting the
+	// objects, e.g. "current == Release".
+	Where string
+	// Limit, if positive, limits the number of objects found.
+	Limit int
+	// Selects are the selectables to dump after the revision, e.g. "id".
+	Selects []string
+}
+
+// String returns the MQL command.
+func (q *Query) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "temp query bus %s %s %s",
+		quote(orWildcard(q.Type)), quote(orWildcard(q.Name)),
+		quote(orWildcard(q.Revision)))
+	if q.Limit > 0 {
+		fmt.Fprintf(&b, " limit %d", q.Limit)
+	}
+	if q.Where != "" {
+		fmt.Fprintf(&b, " where '%s'", strings.ReplaceAll(q.Where, "'", "''"))
+	}
+	if len(q.Selects) > 0 {
+		b.WriteString(" select")
+		for _, s := range q.Selects {
+			b.WriteString(" ")
+			b.WriteString(quote(s))
+		}
+	}
+	fmt.Fprintf(&b, " dump %s", DumpDelimiter)
+	return b.String()
+}
+
+func orWildcard(s string) string {
+	if s == "" {
+		return wildcard
+	}
+	return s
+}
+
+// quote double quotes an MQL token if it holds spaces or quotes.
+func quote(s string) string {
+	if !strings.ContainsAny(s, " \t\"'") {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
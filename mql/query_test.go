@@ -0,0 +1,45 @@
+package mql_test
+
+import (
+	"testing"
+
+	. "github.com/monopole/clirunner/mql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuery_String(t *testing.T) {
+	var testCases = map[string]struct {
+		query    Query
+		expected string
+	}{
+		"empty": {
+			expected: "temp query bus * * * dump _|_",
+		},
+		"full": {
+			query: Query{
+				Type:     "Part",
+				Name:     "P-*",
+				Revision: "A",
+				Where:    "current == 'Release'",
+				Limit:    5,
+				Selects:  []string{"id", "attribute[Weight]"},
+			},
+			expected: "temp query bus Part P-* A limit 5 " +
+				"where 'current == ''Release''' " +
+				"select id attribute[Weight] dump _|_",
+		},
+		"quoted": {
+			query: Query{
+				Type:    "Buddha's hand",
+				Selects: []string{`attribute[Part "Name"]`},
+			},
+			expected: `temp query bus "Buddha's hand" * * ` +
+				`select "attribute[Part \"Name\"]" dump _|_`,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.query.String())
+		})
+	}
+}
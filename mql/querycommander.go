@@ -0,0 +1,94 @@
+package mql
+
+import (
+	"strings"
+
+	"github.com/monopole/clirunner/cmdrs"
+)
+
+// QueryCommander runs a command dumping business objects, and parses its
+// output into Records, and any errors the CLI reports.
+//
+// Lines that are neither records nor errors are noted as Problems, rather
+// than returned as errors from Write, since the CLI itself is fine.
+type QueryCommander struct {
+	// Command is the command, e.g. the String of a Query.
+	Command string
+	// Selects is the number of selected values following the revision.
+	Selects  int
+	lines    int
+	records  []Record
+	errors   []*Error
+	problems []cmdrs.ParseProblem
+}
+
+// NewQueryCommander returns a QueryCommander running the given Query.
+func NewQueryCommander(q *Query) *QueryCommander {
+	return &QueryCommander{Command: q.String(), Selects: len(q.Selects)}
+}
+
+func (c *QueryCommander) String() string { return c.Command }
+
+// Write parses a line as an error or a Record.  Blank lines are ignored.
+func (c *QueryCommander) Write(b []byte) (int, error) {
+	c.lines++
+	line := string(b)
+	if strings.TrimSpace(line) == "" {
+		return 0, nil
+	}
+	if e, ok := ParseError(line); ok {
+		c.errors = append(c.errors, e)
+		return 0, nil
+	}
+	r, err := ParseRecord(line, c.Selects)
+	if err != nil {
+		c.problems = append(c.problems, cmdrs.ParseProblem{
+			Line: c.lines, Content: line, Reason: err.Error()})
+		return 0, nil
+	}
+	c.records = append(c.records, r)
+	return 0, nil
+}
+
+// Success returns true if the CLI reported no errors, and every line of
+// output was understood.
+func (c *QueryCommander) Success() bool {
+	return len(c.errors) == 0 && len(c.problems) == 0
+}
+
+// Reset forgets everything parsed.
+func (c *QueryCommander) Reset() {
+	c.lines = 0
+	c.records = nil
+	c.errors = nil
+	c.problems = nil
+}
+
+// Records returns the parsed Records, in order.
+func (c *QueryCommander) Records() []Record { return c.records }
+
+// Errors returns the errors reported by the CLI, in order.
+func (c *QueryCommander) Errors() []*Error { return c.errors }
+
+// Problems returns the lines that couldn't be parsed, in order.
+func (c *QueryCommander) Problems() []cmdrs.ParseProblem { return c.problems }
+
+// QueryData is the data of a QueryCommander's cmdrs.Result.
+type QueryData struct {
+	// Records are the parsed Records, in order.
+	Records []Record `json:"records"`
+	// Errors are the errors reported by the CLI, in order.
+	Errors []*Error `json:"errors,omitempty"`
+}
+
+// ResultKind returns "mql.query".
+func (c *QueryCommander) ResultKind() string { return "mql.query" }
+
+// ResultData returns a QueryData.
+func (c *QueryCommander) ResultData() interface{} {
+	records := c.records
+	if records == nil {
+		records = []Record{}
+	}
+	return QueryData{Records: records, Errors: c.errors}
+}
@@ -0,0 +1,77 @@
+package mql_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/monopole/clirunner"
+	"github.com/monopole/clirunner/cmdrs"
+	"github.com/monopole/clirunner/internal/testcli/tstcli"
+	. "github.com/monopole/clirunner/mql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryCommander(t *testing.T) {
+	c := NewQueryCommander(&Query{Type: "Part", Selects: []string{"id"}})
+	assert.Equal(t, "temp query bus Part * * select id dump _|_", c.String())
+	for _, l := range []string{
+		"Part_|_P-100_|_A_|_1.2.3.4",
+		"",
+		"Part_|_P-200_|_B_|_5.6.7.8",
+		"who knows",
+		"Error: #666: lookup failed",
+		"Error: Expected name",
+	} {
+		_, err := c.Write([]byte(l))
+		assert.NoError(t, err)
+	}
+	assert.False(t, c.Success())
+	assert.Len(t, c.Records(), 2)
+	assert.Equal(t, "P-200", c.Records()[1].Name)
+	if assert.Len(t, c.Problems(), 1) {
+		assert.Equal(t, 4, c.Problems()[0].Line)
+		assert.Equal(t, "who knows", c.Problems()[0].Content)
+	}
+	if assert.Len(t, c.Errors(), 2) {
+		assert.Equal(t, 666, c.Errors()[0].Code)
+		assert.Equal(t, 0, c.Errors()[1].Code)
+	}
+	b, err := cmdrs.EncodeResult(c)
+	assert.NoError(t, err)
+	e, err := cmdrs.DecodeResult(b)
+	assert.NoError(t, err)
+	assert.Equal(t, "mql.query", e.Kind)
+	assert.Len(t, e.Problems, 1)
+	var d QueryData
+	assert.NoError(t, json.Unmarshal(e.Data, &d))
+	assert.Equal(t, c.Records(), d.Records)
+	assert.Equal(t, c.Errors(), d.Errors)
+
+	c.Reset()
+	assert.True(t, c.Success())
+	assert.Empty(t, c.Records())
+	assert.Empty(t, c.Problems())
+}
+
+func TestQueryCommander_Run(t *testing.T) {
+	runner, err := clirunner.NewProcRunner(&clirunner.Parameters{
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+	})
+	assert.NoError(t, err)
+	// The test CLI dumps objects as MQL would, with one selected id.
+	c := &QueryCommander{Command: tstcli.CmdQuery + " limit 3", Selects: 1}
+	assert.NoError(t, runner.RunIt(c, 0))
+	assert.True(t, c.Success())
+	if assert.Len(t, c.Records(), 3) {
+		assert.Equal(t, Record{
+			Type:     "Cempedak",
+			Name:     "Bamberga",
+			Revision: "4",
+			Selects:  []string{"00000000000000000000000000000001"},
+		}, c.Records()[0])
+	}
+	assert.NoError(t, runner.Close())
+}
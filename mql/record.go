@@ -0,0 +1,69 @@
+package mql
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Record is one business object dumped by a Query.
+type Record struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Revision string `json:"revision"`
+	// Selects holds the values of the Query's Selects, in order.
+	Selects []string `json:"selects"`
+}
+
+// ParseRecord parses a dumped line holding a type, name, revision and the
+// given number of selected values.
+func ParseRecord(line string, numSelects int) (Record, error) {
+	fields := strings.Split(line, DumpDelimiter)
+	if len(fields) != 3+numSelects {
+		return Record{}, fmt.Errorf(
+			"expected %d fields, got %d in %q", 3+numSelects, len(fields), line)
+	}
+	return Record{
+		Type:     fields[0],
+		Name:     fields[1],
+		Revision: fields[2],
+		Selects:  fields[3:],
+	}, nil
+}
+
+// Error is an error reported by the MQL CLI.
+type Error struct {
+	// Code is the error's number, or zero if the line had none.
+	// MQL reports a numbered error followed by unnumbered details.
+	Code int `json:"code"`
+	// Message is the rest of the line.
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == 0 {
+		return "Error: " + e.Message
+	}
+	return fmt.Sprintf("Error: #%d: %s", e.Code, e.Message)
+}
+
+var errorPattern = regexp.MustCompile(`^Error:\s*(?:#(\d+):?)?\s*(.*)$`)
+
+// ParseError parses a line of the form "Error: #NNNNNNN: message" or
+// "Error: message", returning false if the line is neither.
+func ParseError(line string) (*Error, bool) {
+	m := errorPattern.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return nil, false
+	}
+	e := &Error{Message: m[2]}
+	if m[1] != "" {
+		code, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, false
+		}
+		e.Code = code
+	}
+	return e, true
+}
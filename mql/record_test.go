@@ -0,0 +1,93 @@
+package mql_test
+
+import (
+	"testing"
+
+	. "github.com/monopole/clirunner/mql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRecord(t *testing.T) {
+	var testCases = map[string]struct {
+		line       string
+		numSelects int
+		expected   Record
+		expectErr  bool
+	}{
+		"noSelects": {
+			line:     "Part_|_P-100_|_A",
+			expected: Record{Type: "Part", Name: "P-100", Revision: "A", Selects: []string{}},
+		},
+		"selects": {
+			line:       "Buddha's hand_|_Hermione_|_6_|_00000000000000000000000000000002",
+			numSelects: 1,
+			expected: Record{
+				Type:     "Buddha's hand",
+				Name:     "Hermione",
+				Revision: "6",
+				Selects:  []string{"00000000000000000000000000000002"},
+			},
+		},
+		"emptyFields": {
+			line:       "Part_|__|_A_|_",
+			numSelects: 1,
+			expected: Record{
+				Type: "Part", Revision: "A", Selects: []string{""}},
+		},
+		"tooFew": {
+			line:       "Part_|_P-100_|_A",
+			numSelects: 1,
+			expectErr:  true,
+		},
+		"tooMany": {
+			line:      "Part_|_P-100_|_A_|_x",
+			expectErr: true,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			r, err := ParseRecord(tc.line, tc.numSelects)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, r)
+		})
+	}
+}
+
+func TestParseError(t *testing.T) {
+	var testCases = map[string]struct {
+		line     string
+		expected *Error
+	}{
+		"coded": {
+			line:     "Error: #1900068: print business object failed",
+			expected: &Error{Code: 1900068, Message: "print business object failed"},
+		},
+		"shortCode": {
+			line:     "Error: #666: lookup failed",
+			expected: &Error{Code: 666, Message: "lookup failed"},
+		},
+		"detail": {
+			line:     "Error: Expected name",
+			expected: &Error{Message: "Expected name"},
+		},
+		"notAnError": {
+			line: "Part_|_Error: #1_|_A",
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			e, ok := ParseError(tc.line)
+			if tc.expected == nil {
+				assert.False(t, ok)
+				return
+			}
+			assert.True(t, ok)
+			assert.Equal(t, tc.expected, e)
+			assert.Equal(t, tc.line, e.Error())
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package clirunner
+
+import (
+	"errors"
+	"time"
+)
+
+// watchOutClosed ends the search of stdOut, by closing ended, if the
+// subprocess closes its stdOut but keeps running, as the out sentinel
+// can't come.  Normally stdOut closes as the subprocess exits, which is
+// handled as such.  It returns once the run is over.
+func (cw *sentinelFilter) watchOutClosed(ended chan<- struct{}, over <-chan struct{}) {
+	cw.cmdrLock.Lock()
+	outClosed, reaped, gone := cw.outClosed, cw.reaped, cw.outGone
+	cw.cmdrLock.Unlock()
+	if outClosed == nil {
+		return
+	}
+	if !gone {
+		select {
+		case <-outClosed:
+		case <-over:
+			return
+		}
+		select {
+		case <-reaped:
+			return
+		case <-over:
+			return
+		case <-time.After(exitGracePeriod):
+		}
+		cw.logger.Println("stdOut closed, but the subprocess is running")
+		cw.cmdrLock.Lock()
+		if cw.outClosed == outClosed {
+			cw.outGone = true
+		}
+		cw.cmdrLock.Unlock()
+	}
+	close(ended)
+}
+
+// setStdOut sets the channels closed when a new subprocess closes its
+// stdOut, and once it's reaped.
+func (cw *sentinelFilter) setStdOut(outClosed, reaped <-chan struct{}) {
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	cw.outClosed, cw.reaped, cw.outGone = outClosed, reaped, false
+}
+
+func (cw *sentinelFilter) isOutGone() bool {
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	return cw.outGone
+}
+
+// outGoneError returns the error of the search of stdOut, errOut, given
+// that it might have ended as stdOut is gone.  Then the run completes
+// on the err sentinel, if one is required, or fails with a
+// StdOutClosedError.
+func (cw *sentinelFilter) outGoneError(errOut error, optional bool) error {
+	var sce *streamClosedError
+	if !errors.As(errOut, &sce) || !cw.isOutGone() {
+		return errOut
+	}
+	if cw.errSentinel != nil && !optional {
+		cw.warn("stdOut is closed; the run ended on the err sentinel alone")
+		return nil
+	}
+	return &StdOutClosedError{Command: cw.theCmdr.String()}
+}
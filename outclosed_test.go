@@ -0,0 +1,68 @@
+package clirunner_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunner_StdOutClosed(t *testing.T) {
+	h := makeHarness(t)
+	c := NewHoardingCommander("detach")
+	result := runAsync(h, c, time.Hour)
+	expectCommands(t, h, "detach", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("detaching"))
+	assert.NoError(t, h.CloseOut())
+	err := <-result
+	var sce *StdOutClosedError
+	assert.True(t, errors.As(err, &sce), "got %v", err)
+	assert.Equal(t, "detach", sce.Command)
+	assert.Equal(t, "detaching\n", c.Result())
+	assert.Equal(t, "error", h.Runner.Report().State)
+
+	// Exiting afterwards is no news.
+	h.Exit(nil)
+	assert.NoError(t, h.Runner.Restart())
+	c = NewHoardingCommander("again")
+	result = runAsync(h, c, time.Hour)
+	expectCommands(t, h, "again", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	assert.NoError(t, h.Runner.Close())
+}
+
+func TestRunner_StdOutClosedErrSentinel(t *testing.T) {
+	h := makeHarness(t, func(p *Parameters) {
+		p.ErrSentinel = &SimpleSentinelCommander{
+			Command: "nonsense",
+			Value:   "unknown command",
+		}
+	})
+	c := NewHoardingCommander("detach")
+	result := runAsync(h, c, time.Hour)
+	expectCommands(t, h, "detach", "echo Rumpelstiltskin", "nonsense")
+	assert.NoError(t, h.Out("detaching"))
+	assert.NoError(t, h.CloseOut())
+	// The run goes on without stdOut, ending on the err sentinel.
+	assert.NoError(t, h.Err("unknown command"))
+	assert.NoError(t, <-result)
+	assert.Equal(t, "detaching\n", c.Result())
+	r, _ := h.Runner.LastRunReport()
+	assert.Equal(t, []string{
+		"stdOut is closed; the run ended on the err sentinel alone"}, r.Warnings)
+
+	// So do later runs, without the wait.
+	c = NewHoardingCommander("more")
+	result = runAsync(h, c, time.Hour)
+	expectCommands(t, h, "more", "echo Rumpelstiltskin", "nonsense")
+	assert.NoError(t, h.Err("oops", "unknown command"))
+	assert.NoError(t, <-result)
+	assert.Equal(t, "oops\n", c.Result())
+	assert.Equal(t, "idle", h.Runner.Report().State)
+	h.Exit(nil)
+	_ = h.Runner.Close()
+}
@@ -0,0 +1,34 @@
+package clirunner
+
+// OutputCheck has the CLI report on the size of each command's output on
+// stdOut, so that dropped or truncated output can be detected.  How to get
+// such a report depends on the CLI; e.g. a SQL client might be asked for
+// the number of rows the last statement returned.
+//
+// Example (mysql): Command "select concat('rows: ', found_rows())",
+// with Parse looking for a line starting with "rows: ".
+type OutputCheck struct {
+	// Command makes the CLI report on the output of the command issued
+	// before it.  It's issued after every command, ahead of the sentinels.
+	Command string
+
+	// Parse recognizes the report in a line from stdOut, returning false
+	// for any other line.  The line with the report isn't passed to the
+	// Commander.
+	Parse func(line []byte) (OutputTally, bool)
+}
+
+// OutputTally is the size of a command's output on stdOut.
+// A negative field means unknown, and isn't checked.
+type OutputTally struct {
+	// Lines counts lines.
+	Lines int
+	// Bytes counts bytes, including linefeeds.
+	Bytes int
+}
+
+// matches returns true if the tallies agree on the fields known to both.
+func (t OutputTally) matches(o OutputTally) bool {
+	return (t.Lines < 0 || o.Lines < 0 || t.Lines == o.Lines) &&
+		(t.Bytes < 0 || o.Bytes < 0 || t.Bytes == o.Bytes)
+}
@@ -0,0 +1,63 @@
+package clirunner
+
+// OutputLimit caps the output delivered to a Commander in one run,
+// protecting it from accidentally unbounded queries.
+type OutputLimit struct {
+	// MaxLines, if positive, is the most lines (from stdOut and stdErr
+	// combined) to deliver.
+	MaxLines int
+
+	// MaxBytes, if positive, is the most bytes (not counting linefeeds) to
+	// deliver.
+	MaxBytes int
+
+	// Policy says what to do with a run that exceeds the limit.
+	Policy OutputLimitPolicy
+}
+
+// OutputLimitPolicy specifies what to do with a run whose output exceeds
+// its OutputLimit.  Either way, the line that would exceed the limit, and
+// all lines after it, aren't delivered to the Commander, and RunIt returns
+// an OutputLimitError.
+type OutputLimitPolicy int
+
+const (
+	// OutputLimitDiscard quietly discards the excess output, but otherwise
+	// performs a normal run, i.e. the sentinels are awaited.  The ProcRunner
+	// remains usable.
+	OutputLimitDiscard OutputLimitPolicy = iota
+
+	// OutputLimitAbort ends the run as soon as the limit is exceeded, as if
+	// the command had timed out.  The command is interrupted if Parameters
+	// ask for that, else the ProcRunner enters its error state.
+	OutputLimitAbort
+)
+
+// OutputLimiter is an optional interface for a Commander whose runs need an
+// OutputLimit other than the one specified in Parameters.
+type OutputLimiter interface {
+	// OutputLimit returns the limit for the Commander's runs, or nil for
+	// no limit.
+	OutputLimit() *OutputLimit
+}
+
+// limitFor returns the limit for a run of the given Commander, given the
+// default limit, either of which might be nil.
+func limitFor(c Commander, dflt *OutputLimit) *OutputLimit {
+	for ; c != nil; c = unwrap(c) {
+		if l, ok := c.(OutputLimiter); ok {
+			return l.OutputLimit()
+		}
+	}
+	return dflt
+}
+
+// exceededBy returns true if the given counts, plus a line of the given
+// length, exceed the limit.
+func (l *OutputLimit) exceededBy(c lineCounts, n int) bool {
+	if l == nil {
+		return false
+	}
+	return (l.MaxLines > 0 && c.linesOut+c.linesErr+1 > l.MaxLines) ||
+		(l.MaxBytes > 0 && c.bytesOut+c.bytesErr+n > l.MaxBytes)
+}
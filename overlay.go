@@ -0,0 +1,55 @@
+package clirunner
+
+// CommandOverlay holds commands issued around a run's command, in the same
+// sentinel window, e.g. to turn on a CLI setting for just that command:
+//
+//	CommandOverlay{Pre: []string{"set timing on"}, Post: []string{"set timing off"}}
+//
+// The Pre commands are issued just before the command, and the Post
+// commands just after it (and after any OutputCheck command), before the
+// sentinels, so the setting is reverted even if the command fails.  Their
+// output, if any, goes to the Commander along with the command's.  Runs
+// of an empty command issue neither.  Don't use Post commands with
+// sentinels that report on the command before them, e.g. those made by
+// NewExitCodeSentinel.
+type CommandOverlay struct {
+	// Pre holds the commands issued before the command.
+	Pre []string
+	// Post holds the commands issued after the command.
+	Post []string
+}
+
+// Overlayer is an optional interface for a Commander whose runs have a
+// CommandOverlay.  See WithOverlay.
+type Overlayer interface {
+	// CommandOverlay returns the overlay for the Commander's runs, or nil
+	// for none.
+	CommandOverlay() *CommandOverlay
+}
+
+// overlayFor returns the overlay for a run of the given Commander, or nil
+// if it has none.
+func overlayFor(c Commander) *CommandOverlay {
+	for ; c != nil; c = unwrap(c) {
+		if o, ok := c.(Overlayer); ok {
+			return o.CommandOverlay()
+		}
+	}
+	return nil
+}
+
+// pre returns the commands issued before the command.
+func (o *CommandOverlay) pre() []string {
+	if o == nil {
+		return nil
+	}
+	return o.Pre
+}
+
+// post returns the commands issued after the command.
+func (o *CommandOverlay) post() []string {
+	if o == nil {
+		return nil
+	}
+	return o.Post
+}
@@ -0,0 +1,30 @@
+package clirunner_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunner_Overlay(t *testing.T) {
+	h := makeHarness(t)
+	c := NewHoardingCommander("select 1")
+	result := runAsync(h, WithOverlay(c,
+		[]string{"set timing on"}, []string{"set timing off"}), time.Hour)
+	expectCommands(t, h,
+		"set timing on", "select 1", "set timing off", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("1", "Time: 0.2ms", "Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	// The overlay's output goes to the Commander too.
+	assert.Equal(t, "1\nTime: 0.2ms\n", c.Result())
+
+	// Other runs have no overlay.
+	result = runAsync(h, NewHoardingCommander("select 2"), time.Hour)
+	expectCommands(t, h, "select 2", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("2", "Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	assert.NoError(t, h.Runner.Close())
+}
@@ -0,0 +1,169 @@
+package clirunner
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// PagerSuppression keeps a CLI from waiting on a pager (e.g. less or more)
+// to show long output, which would hang the runner, since nobody is there
+// to page through it.
+//
+// The Env and SetupCommands should keep the CLI from starting a pager at
+// all.  The Prompts are a safety net for pagers started anyway.
+type PagerSuppression struct {
+	// Env is added to the CLI's environment, ahead of Parameters.Env.
+	// Example: []string{"PAGER=cat"}
+	Env []string
+
+	// SetupCommands are run every time the CLI starts, ahead of
+	// Parameters.SetupCommands.
+	// Example: []string{`\pset pager off`}
+	SetupCommands []string
+
+	// Prompts are answered whenever they show up on stdOut.
+	Prompts []PagerPrompt
+}
+
+// PagerPrompt is what a pager shows while it waits, and what to answer.
+type PagerPrompt struct {
+	// Prompt is the text the pager shows, e.g. "--More--".  It's found
+	// anywhere in the output, whether or not a linefeed follows it, and
+	// is removed from the output.
+	Prompt string
+
+	// Response is written to the CLI's stdIn when the Prompt is seen, e.g.
+	// " " for the next page, or "q" to quit.
+	Response string
+}
+
+// DefaultPagerSuppression returns a PagerSuppression for CLIs that honor
+// the usual pager environment variables, answering the prompts of more
+// and less.
+func DefaultPagerSuppression() *PagerSuppression {
+	return &PagerSuppression{
+		Env: []string{
+			"PAGER=cat", "MANPAGER=cat", "GIT_PAGER=cat", "SYSTEMD_PAGER=cat"},
+		Prompts: []PagerPrompt{
+			{Prompt: "--More--", Response: " "},
+			{Prompt: "(END)", Response: "q"},
+		},
+	}
+}
+
+// PsqlPagerSuppression returns a PagerSuppression for psql.
+func PsqlPagerSuppression() *PagerSuppression {
+	p := DefaultPagerSuppression()
+	p.Env = append(p.Env, "PSQL_PAGER=cat")
+	p.SetupCommands = []string{`\pset pager off`}
+	return p
+}
+
+// MysqlPagerSuppression returns a PagerSuppression for mysql.
+func MysqlPagerSuppression() *PagerSuppression {
+	p := DefaultPagerSuppression()
+	p.SetupCommands = []string{"nopager"}
+	return p
+}
+
+// validate looks for trouble.
+func (p *PagerSuppression) validate() error {
+	for i, pp := range p.Prompts {
+		if pp.Prompt == "" {
+			return fmt.Errorf("pager prompt %d is empty", i)
+		}
+	}
+	return nil
+}
+
+// pagerWatch reads a CLI's output, removing pager prompts and answering
+// them on the CLI's stdIn.
+type pagerWatch struct {
+	r       io.Reader
+	stdIn   io.Writer
+	prompts []PagerPrompt
+	buf     []byte // read, but not yet returned
+	out     []byte // ready to return
+	eof     error  // the error that ended reading, if any
+}
+
+// newPagerWatch returns r, wrapped to answer the given prompts, if any.
+func newPagerWatch(
+	r io.Reader, stdIn io.Writer, prompts []PagerPrompt) io.Reader {
+	if len(prompts) == 0 {
+		return r
+	}
+	return &pagerWatch{r: r, stdIn: stdIn, prompts: prompts}
+}
+
+func (p *pagerWatch) Read(b []byte) (int, error) {
+	for len(p.out) == 0 {
+		if p.eof != nil {
+			// Whatever is held back can't be a prompt now.
+			p.out, p.buf = p.buf, nil
+			if len(p.out) == 0 {
+				return 0, p.eof
+			}
+			break
+		}
+		chunk := make([]byte, len(b))
+		n, err := p.r.Read(chunk)
+		p.buf = append(p.buf, chunk[:n]...)
+		p.eof = err
+		if err := p.scan(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, p.out)
+	p.out = p.out[n:]
+	return n, nil
+}
+
+// scan moves buf to out, answering and removing prompts, but holding back
+// a tail that might be the start of a prompt.
+func (p *pagerWatch) scan() error {
+	for {
+		i, pp := p.firstPrompt()
+		if pp == nil {
+			break
+		}
+		p.out = append(p.out, p.buf[:i]...)
+		p.buf = p.buf[i+len(pp.Prompt):]
+		if _, err := io.WriteString(p.stdIn, pp.Response); err != nil {
+			return fmt.Errorf("answering pager prompt %q; %w", pp.Prompt, err)
+		}
+	}
+	keep := p.partialPrompt()
+	p.out = append(p.out, p.buf[:len(p.buf)-keep]...)
+	p.buf = append([]byte(nil), p.buf[len(p.buf)-keep:]...)
+	return nil
+}
+
+// firstPrompt returns the index of the earliest prompt in buf, and the
+// prompt, or nil if there's none.
+func (p *pagerWatch) firstPrompt() (int, *PagerPrompt) {
+	first, result := -1, (*PagerPrompt)(nil)
+	for i := range p.prompts {
+		j := bytes.Index(p.buf, []byte(p.prompts[i].Prompt))
+		if j >= 0 && (first < 0 || j < first) {
+			first, result = j, &p.prompts[i]
+		}
+	}
+	return first, result
+}
+
+// partialPrompt returns the length of the longest tail of buf that's the
+// start of some prompt.
+func (p *pagerWatch) partialPrompt() int {
+	longest := 0
+	for _, pp := range p.prompts {
+		for n := len(pp.Prompt) - 1; n > longest; n-- {
+			if bytes.HasSuffix(p.buf, []byte(pp.Prompt[:n])) {
+				longest = n
+				break
+			}
+		}
+	}
+	return longest
+}
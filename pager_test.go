@@ -0,0 +1,78 @@
+package clirunner
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPagerWatch(t *testing.T) {
+	prompts := []PagerPrompt{
+		{Prompt: "--More--", Response: " "},
+		{Prompt: "(END)", Response: "q"},
+	}
+	testCases := map[string]struct {
+		input     string
+		expected  string
+		responses string
+	}{
+		"noPrompts": {
+			input:    "hello\nthere\n",
+			expected: "hello\nthere\n",
+		},
+		"prompts": {
+			input:     "a\n--More--b\n(END)",
+			expected:  "a\nb\n",
+			responses: " q",
+		},
+		"earliestFirst": {
+			input:     "(END)--More--\n",
+			expected:  "\n",
+			responses: "q ",
+		},
+		"partialAtEnd": {
+			input:    "a\n--Mo",
+			expected: "a\n--Mo",
+		},
+		"lookalike": {
+			input:    "--Moose--\n(EN\n",
+			expected: "--Moose--\n(EN\n",
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			// One byte at a time, so prompts are split across reads.
+			var stdIn bytes.Buffer
+			got, err := io.ReadAll(newPagerWatch(
+				iotest.OneByteReader(bytes.NewBufferString(tc.input)),
+				&stdIn, prompts))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(got))
+			assert.Equal(t, tc.responses, stdIn.String())
+
+			// All at once.
+			stdIn.Reset()
+			got, err = io.ReadAll(newPagerWatch(
+				bytes.NewBufferString(tc.input), &stdIn, prompts))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(got))
+			assert.Equal(t, tc.responses, stdIn.String())
+		})
+	}
+}
+
+func TestPagerWatch_NoPrompts(t *testing.T) {
+	r := bytes.NewBufferString("x")
+	assert.Equal(t, io.Reader(r), newPagerWatch(r, nil, nil))
+}
+
+func TestPagerSuppression_Validate(t *testing.T) {
+	assert.NoError(t, DefaultPagerSuppression().validate())
+	assert.NoError(t, PsqlPagerSuppression().validate())
+	assert.NoError(t, MysqlPagerSuppression().validate())
+	p := &PagerSuppression{Prompts: []PagerPrompt{{Response: "q"}}}
+	assert.Error(t, p.validate())
+}
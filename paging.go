@@ -0,0 +1,61 @@
+package clirunner
+
+import (
+	"context"
+	"time"
+)
+
+// Continuer is an optional interface for a Commander of a CLI that pages
+// its results, needing a command like "next" or "more" to show each page
+// after the first.  After each page, i.e. once its sentinels are seen, the
+// ProcRunner asks for the command showing the next page, and runs it with
+// the same Commander, until the Commander has all it wants, or the time
+// limit, which covers all the pages, expires.
+//
+// Each page is a run of its own in the RunReports.
+type Continuer interface {
+	// Continuation returns the command showing the next page, or an empty
+	// string if no more pages are wanted.
+	Continuation() string
+}
+
+// continuerOf returns the Continuer of the given Commander, if any.
+func continuerOf(c Commander) Continuer {
+	for ; c != nil; c = unwrap(c) {
+		if p, ok := c.(Continuer); ok {
+			return p
+		}
+	}
+	return nil
+}
+
+// continued runs a continuation command, handing the output to the
+// Commander being paged.
+type continued struct {
+	wrapper
+	cmd string
+}
+
+// String returns the continuation command.
+func (c *continued) String() string { return c.cmd }
+
+// runPages does the work of run for a Continuer, running pages until it's
+// satisfied, or the time limit, which covers every page, expires.
+func (pr *ProcRunner) runPages(ctx context.Context, cmdr Commander,
+	p Continuer, timeOut time.Duration, tap *lineQueue) error {
+	if timeOut == 0 {
+		timeOut = defaultSentinelDuration
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeOut)
+	defer cancel()
+	for page := cmdr; ; {
+		if err := pr.runPage(ctx, page, timeOut, tap); err != nil {
+			return err
+		}
+		next := p.Continuation()
+		if next == "" {
+			return nil
+		}
+		page = &continued{wrapper: wrapper{cmdr}, cmd: next}
+	}
+}
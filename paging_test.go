@@ -0,0 +1,63 @@
+package clirunner_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/monopole/clirunner/internal/testcli/tstcli"
+	"github.com/stretchr/testify/assert"
+)
+
+// pagingCommander wants the given number of pages, fetching each with the
+// command made by next.
+type pagingCommander struct {
+	*HoardingCommander
+	pages, done int
+	next        func(page int) string
+}
+
+func (c *pagingCommander) Continuation() string {
+	c.done++
+	if c.done >= c.pages {
+		return ""
+	}
+	return c.next(c.done)
+}
+
+func TestRunner_Run_Continuer(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+	})
+	assert.NoError(t, err)
+
+	c := &pagingCommander{
+		HoardingCommander: NewHoardingCommander(tstcli.CmdEcho + " page 0"),
+		pages:             3,
+		next: func(page int) string {
+			return fmt.Sprintf("%s page %d", tstcli.CmdEcho, page)
+		},
+	}
+	assert.NoError(t, runner.RunIt(c, testingTimeout))
+	assert.Equal(t, "page 0\npage 1\npage 2\n", c.Result())
+	assert.Equal(t, 3, runner.Report().RunCount)
+	r, _ := runner.LastRunReport()
+	assert.Equal(t, tstcli.CmdEcho+" page 2", r.Command)
+
+	// The time limit covers every page.
+	c = &pagingCommander{
+		HoardingCommander: NewHoardingCommander(tstcli.CmdSleep + " 40ms"),
+		pages:             1000,
+		next:              func(int) string { return tstcli.CmdSleep + " 40ms" },
+	}
+	start := time.Now()
+	assert.Error(t, runner.RunIt(c, 200*time.Millisecond))
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	assert.NoError(t, runner.Restart())
+	assert.NoError(t, runner.Close())
+}
@@ -2,10 +2,45 @@ package clirunner
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
 )
 
 // Parameters is a bag of parameters for ProcRunner.
 type Parameters struct {
+	// Name identifies the runner in debug output, e.g. when many runners
+	// share a DebugSink.  Defaults to Path.
+	Name string
+
+	// DebugWriter, if not nil, receives the runner's debug output.
+	// To give many runners one destination, use a DebugSink.
+	// Example: os.Stderr
+	DebugWriter io.Writer
+
+	// Verbosity says how much debug output goes to the DebugWriter.  It
+	// can be changed at any time; see ProcRunner.SetVerbosity.
+	Verbosity Verbosity
+
+	// Secrets, e.g. passwords or tokens that commands carry, are replaced
+	// with "****" in the runner's debug output, RunReports and errors.
+	// See ProcRunner.AddSecret.
+	Secrets []string
+
+	// RunLogger, if not nil, is told about every run, e.g. to feed a
+	// central log.  See NewSlogRunLogger.
+	RunLogger RunLogger
+
+	// RunTracer, if not nil, traces every run, e.g. as OpenTelemetry spans.
+	RunTracer RunTracer
+
+	// Clock, if not nil, tells the runner the time, e.g. a FakeClock in
+	// tests.  It times runs and their time limits, except those set by a
+	// context's deadline.
+	Clock Clock
+
 	// WorkingDir is the working directory of the CLI process.
 	WorkingDir string
 
@@ -15,13 +50,44 @@ type Parameters struct {
 	// Args has the arguments, flags and flag arguments for the CLI invocation.
 	Args []string
 
+	// Env has environment variables for the CLI, each of the form
+	// "key=value", e.g. for credentials or locale.  If empty, the CLI
+	// inherits this process' environment, regardless of InheritEnv.
+	//
+	// Example: []string{"LC_ALL=C", "MYSQL_PWD=hunter2"}
+	Env []string
+
+	// InheritEnv, if true, gives the CLI this process' environment as well
+	// as Env, with Env taking precedence.  If false, the CLI gets only Env.
+	InheritEnv bool
+
 	// ErrPrefix is added to the lines coming out of stdErr before combining
 	// them with lines from stdOut.  Can be empty.  This is just a way
 	// to help a Commander implementation more easily distinguish stdErr
-	// from stdOut.
+	// from stdOut.  A Commander2 gets the lines of stdErr apart from those
+	// of stdOut, without it.
 	// Example: "Err: "
+	//
+	// Deprecated: A Commander should tell the streams apart as a Commander2
+	// or LineWriter, rather than parse a prefix back out of its lines.  For
+	// a Commander that does parse one, WithErrPrefix renders it.
 	ErrPrefix string
 
+	// StripANSI, if true, removes ANSI escape sequences, e.g. colors and
+	// cursor movement, from lines of stdOut and stdErr before they're
+	// checked for sentinels or given to the Commander, for CLIs whose
+	// output is colored.  Pieces of lines split per LongLinesSplit are
+	// stripped one by one, so a sequence split between pieces remains.
+	StripANSI bool
+
+	// LineFilters transform lines of stdOut and stdErr, in order, after
+	// StripANSI, before they're checked for sentinels or given to the
+	// Commander, e.g. to trim them or drop blank ones, so that Commanders
+	// needn't clean their output up each.  Lines of stdErr are filtered
+	// before they get the ErrPrefix.  A filter mustn't drop or mangle the
+	// sentinels' lines.  See TrimSpace, DropBlank and Redact.
+	LineFilters []LineFilter
+
 	// ExitCommand is the command to send to gracefully exit the CLI.
 	// If empty it won't be sent.  Regardless, the final thing sent to the
 	// CLI subprocess will be an EOF on its stdIn.
@@ -47,7 +113,8 @@ type Parameters struct {
 	//   Look for: "v1.2.3"
 	//
 	// The sentinel can be custom, but it's simplest to use an instance
-	// of SimpleSentinelCommander, which can accommodate prompt detection.
+	// of SimpleSentinelCommander, or, to detect a prompt, one made by
+	// cmdrs.NewPromptSentinel.
 	OutSentinel Commander
 
 	// ErrSentinel is a command that intentionally triggers output on stderr,
@@ -59,11 +126,329 @@ type Parameters struct {
 	// from command N+1.
 	ErrSentinel Commander
 
+	// OutStrategy, if not nil, is used instead of OutSentinel to decide when
+	// a command's output on stdOut is complete.  Specify one or the other.
+	// Use this for completion schemes that can't be expressed as a sentinel
+	// Commander.
+	OutStrategy SentinelStrategy
+
+	// ErrStrategy, if not nil, is used instead of ErrSentinel to decide when
+	// a command's output on stdErr is complete.  Specify one or the other.
+	ErrStrategy SentinelStrategy
+
 	// CommandTerminator, if not 0, is appended to the end of every command.
 	// This is merely a convenience for CLI's like mysql that want such things.
 	//
 	// Example: ';'
 	CommandTerminator byte
+
+	// LineEnding says how lines written to the CLI end.  By default, lines
+	// end with "\r\n" on Windows, and "\n" elsewhere.  Either way, a
+	// carriage return ending a line of output is dropped.
+	LineEnding LineEnding
+
+	// SetupCommands are run, in order, every time the CLI subprocess starts,
+	// before any other command.  Their output is discarded.  Use them to log
+	// in, set session options, etc.
+	//
+	// Example: []string{"set pager off", "set timing on"}
+	SetupCommands []string
+
+	// ChangeDirCommand, if not empty, is a fmt format string with one %s verb
+	// that builds a command to change the CLI's working directory.  It's used
+	// by SetWorkingDir.  If empty, SetWorkingDir restarts the CLI instead.
+	//
+	// Example: "cd %s"
+	ChangeDirCommand string
+
+	// InterruptSignal, if not nil, is sent to the CLI subprocess when a command
+	// fails to finish in time, in an attempt to abort the command but keep the
+	// CLI alive.  If the sentinels then show up within RecoveryTimeout, RunIt
+	// returns a TimeoutButRecoveredError and the ProcRunner remains usable.
+	// Otherwise the ProcRunner enters its error state, as it would without an
+	// interrupt.
+	//
+	// Windows can't send signals other than os.Kill; use an
+	// InterruptSequence there.
+	//
+	// Example: os.Interrupt
+	InterruptSignal os.Signal
+
+	// InterruptSequence, if not empty, is written verbatim to the CLI's stdIn
+	// when a command fails to finish in time (after sending any
+	// InterruptSignal), for CLIs that accept an in-band interrupt.  It's
+	// otherwise handled like InterruptSignal.
+	//
+	// Example: "\x03"
+	InterruptSequence string
+
+	// RecoveryTimeout is how long to wait for sentinels after an interrupt.
+	// If zero, a default of a few seconds is used.
+	RecoveryTimeout time.Duration
+
+	// ShutdownGracePeriod is how long Close waits for the CLI to exit after
+	// the ExitCommand and EOF, and again after each of SIGTERM and SIGKILL.
+	// On Windows, which has no SIGTERM, the CLI is killed after the first
+	// wait.
+	// If zero, a default of a few seconds is used.
+	ShutdownGracePeriod time.Duration
+
+	// IdleTimeout, if positive, is how long the CLI may go without a run
+	// before the runner shuts it down, as Close does, e.g. to free the
+	// connection a CLI holds.  The next run starts a new CLI, running
+	// SetupCommands and re-establishing any tracked context, as usual.
+	//
+	// Example: 10 * time.Minute
+	IdleTimeout time.Duration
+
+	// Auth, if not nil, has the runner log in to its CLI as the CLI starts,
+	// answering its prompts for passwords, tokens and the like.
+	// Example: PsqlPasswordAuth(password)
+	Auth *Auth
+
+	// Keepalive, if not nil, has the runner probe its CLI whenever the CLI
+	// sits idle, to find out a dead or wedged CLI before the next run does.
+	Keepalive *Keepalive
+
+	// EmptyCommandPolicy specifies what to do when asked to run a Commander
+	// whose command string is empty.  The default is EmptyCommandNoOp.
+	EmptyCommandPolicy EmptyCommandPolicy
+
+	// ContextTracker, if not nil, observes every successfully run command
+	// to track the CLI's session context (current database, etc.).  When the
+	// CLI subprocess is (re)started, the tracked context is re-established by
+	// replaying commands before running anything else.
+	ContextTracker *ContextTracker
+
+	// SentinelPhaseCommander, if not nil, receives the lines that show up
+	// after the first sentinel value is seen, but before all of them are.
+	// By then the command itself is known to be done, so such lines (e.g.
+	// late stdErr output) are stragglers that would otherwise be credited
+	// to the command.  Its String method isn't used.  It accumulates lines
+	// across runs until it's Reset by its owner.
+	SentinelPhaseCommander Commander
+
+	// WarmStandby, if true, keeps a second CLI subprocess started and past
+	// its SetupCommands.  If the active subprocess enters the error state,
+	// the next RunIt fails over to the standby instead of failing, and a
+	// new standby is prepared in the background.  Standby starts count as
+	// starts in the SessionReport.
+	WarmStandby bool
+
+	// OutputCheck, if not nil, has the CLI report on every command's output,
+	// so that RunIt can return an OutputMismatchError if output was dropped
+	// or truncated.
+	OutputCheck *OutputCheck
+
+	// OutputLimit, if not nil, caps the output delivered to a Commander in
+	// one run, unless the Commander implements OutputLimiter.
+	OutputLimit *OutputLimit
+
+	// LineSampling, if not nil, has a Commander receive only a sample of
+	// each run's output on stdOut, unless the Commander implements
+	// LineSampler.
+	LineSampling *LineSampling
+
+	// SpoolMemory is the most bytes of a Spooler's output held in memory
+	// in one run; the rest is spooled to a temporary file.  If not
+	// positive, it's 1MiB.
+	SpoolMemory int
+
+	// SpoolDir is where Spoolers' temporary files go.  If empty, it's the
+	// default directory for temporary files, per os.TempDir.
+	SpoolDir string
+
+	// TimeoutTailLines is how many of the most recent lines of output a
+	// timeout error shows, to tell a silent CLI from one stuck mid-output
+	// or at an unexpected prompt.  Zero means DefaultTimeoutTailLines;
+	// negative means none.
+	TimeoutTailLines int
+
+	// FatalLinePatterns match lines of output meaning the session is dead,
+	// e.g. "server has gone away" or "connection lost".  A run seeing such
+	// a line ends at once with a FatalLineError, and the CLI is killed.
+	FatalLinePatterns []*regexp.Regexp
+
+	// RestartOnFatal, if true, has the runner start a new CLI on the run
+	// after a FatalLineError, rather than entering its error state.
+	RestartOnFatal bool
+
+	// TruncationPatterns match lines of output by which the CLI says it
+	// cut the output short, e.g. "size 128000 limit" or "output
+	// truncated".  A run seeing such a line is reported as
+	// OutputTruncated, with a warning.
+	TruncationPatterns []*regexp.Regexp
+
+	// FailOnTruncation, if true, fails a run seeing a line matching one of
+	// the TruncationPatterns with an OutputTruncatedError.
+	FailOnTruncation bool
+
+	// ErrSentinelPolicy, if not nil, says when the ErrSentinel is issued,
+	// and whether a run needs it, for runs whose Commander doesn't say
+	// otherwise.  See ErrSentinelPolicer.
+	ErrSentinelPolicy *ErrSentinelPolicy
+
+	// Supervise, if not nil, has the runner relaunch its CLI whenever the
+	// CLI exits unexpectedly, with backoff, up to a limit.
+	// Example: &Supervision{MaxRestarts: 5, Backoff: time.Second}
+	Supervise *Supervision
+
+	// UsePty, if true, connects the CLI's stdIn and stdOut to a
+	// pseudo-terminal rather than pipes, for CLIs that don't prompt, or
+	// that buffer their output, when they aren't talking to a terminal
+	// (e.g. mysql, psql, ssh).  Terminal echo is turned off.  StdErr remains
+	// a pipe.  Supported on Linux and macOS, and on Windows, where the CLI
+	// gets a pseudo console (ConPTY) of its own, for CLIs that only behave
+	// interactively in a console (e.g. sqlcmd, diskpart).  There, the
+	// console's escape sequences and its echo of input are dropped from its
+	// output, and stdErr goes to the console, with stdOut.  ConPTY needs
+	// Windows 10 1809 or later.
+	UsePty bool
+
+	// ExtraStreams names output streams the CLI writes to besides stdOut
+	// and stdErr, e.g. results it's asked to write to a side channel.  The
+	// first is the CLI's file descriptor 3, the next 4, and so on.  Their
+	// lines go to the Commander of the run underway as they arrive, tagged
+	// with the stream's name if the Commander is an ExtraStreamWriter.
+	// They have no sentinels, so a CLI should finish writing them before
+	// it writes the sentinels' output.  Not supported on Windows.
+	//
+	// Example: []string{"results"}
+	ExtraStreams []string
+
+	// PagerSuppression, if not nil, keeps the CLI from waiting on a pager.
+	// Example: DefaultPagerSuppression()
+	PagerSuppression *PagerSuppression
+
+	// RecordDelimiters end records of output, i.e. the "lines" delivered,
+	// besides linefeed, which always does, as sentinels and prompts are
+	// lines.  A carriage return followed by a linefeed ends one record.
+	// They apply to every output stream.
+	// Examples: []string{"\x00"} for NUL-separated output,
+	// []string{"\r"} to see each step of a CLI's progress display.
+	RecordDelimiters []string
+
+	// MaxLineBytes is the length, without its linefeed, beyond which a
+	// line of output is too long, per LongLines.  Defaults to 64KiB.
+	MaxLineBytes int
+
+	// LongLines says what to do with a line of output longer than
+	// MaxLineBytes.  By default, LongLinesAbort, a single giant line ends
+	// the session.  Pieces of lines on ExtraStreams aren't told apart from
+	// whole lines.
+	// Example: LongLinesSplit
+	LongLines LongLinePolicy
+
+	// OutputSink, if not nil, archives the raw output of every run, e.g.
+	// off-host for auditing.  Archiving trouble doesn't fail runs.
+	// Example: &FileSink{Dir: "/var/log/mysql-runs"}
+	OutputSink Sink
+
+	// CoalesceReadOnly, if true, collapses runs of the same read-only
+	// command that wait for their turn at once: the CLI runs the command
+	// once, and each Commander gets its output.  See ReadOnlyMarker.
+	CoalesceReadOnly bool
+}
+
+// EmptyCommandPolicy specifies how to handle an empty command string.
+type EmptyCommandPolicy int
+
+const (
+	// EmptyCommandNoOp sends nothing to the CLI for the command itself, but
+	// otherwise performs a normal run, i.e. the sentinels are issued and
+	// awaited.  Any stray output seen before the sentinels goes to the
+	// Commander.
+	EmptyCommandNoOp EmptyCommandPolicy = iota
+
+	// EmptyCommandError rejects the run with an error, without sending
+	// anything to the CLI.
+	EmptyCommandError
+
+	// EmptyCommandNewline sends a bare linefeed (no CommandTerminator) to
+	// the CLI, as a human would by hitting enter at the prompt.
+	EmptyCommandNewline
+)
+
+// copy returns a copy of the parameters that can be modified without
+// affecting the original.
+func (p *Parameters) copy() *Parameters {
+	result := *p
+	result.Args = append([]string(nil), p.Args...)
+	result.Env = append([]string(nil), p.Env...)
+	result.SetupCommands = append([]string(nil), p.SetupCommands...)
+	result.ExtraStreams = append([]string(nil), p.ExtraStreams...)
+	result.RecordDelimiters = append([]string(nil), p.RecordDelimiters...)
+	result.Secrets = append([]string(nil), p.Secrets...)
+	result.FatalLinePatterns = append(
+		[]*regexp.Regexp(nil), p.FatalLinePatterns...)
+	result.TruncationPatterns = append(
+		[]*regexp.Regexp(nil), p.TruncationPatterns...)
+	result.LineFilters = append([]LineFilter(nil), p.LineFilters...)
+	return &result
+}
+
+// environ returns the environment for the CLI's exec.Cmd, where nil means
+// this process' environment.
+func (p *Parameters) environ() []string {
+	var pagerEnv []string
+	if p.PagerSuppression != nil {
+		pagerEnv = p.PagerSuppression.Env
+	}
+	if len(p.Env) == 0 && len(pagerEnv) == 0 {
+		return nil
+	}
+	var env []string
+	if len(p.Env) == 0 || p.InheritEnv {
+		env = os.Environ()
+	}
+	// For duplicate keys, exec.Cmd uses the last value.
+	env = append(env, pagerEnv...)
+	return append(env, p.Env...)
+}
+
+// DefaultTimeoutTailLines is the default for Parameters.TimeoutTailLines.
+const DefaultTimeoutTailLines = 10
+
+// tailLines returns the number of lines a timeout error shows.
+func (p *Parameters) tailLines() int {
+	switch {
+	case p.TimeoutTailLines < 0:
+		return 0
+	case p.TimeoutTailLines == 0:
+		return DefaultTimeoutTailLines
+	default:
+		return p.TimeoutTailLines
+	}
+}
+
+// setupCommands returns the commands to run whenever the CLI starts.
+func (p *Parameters) setupCommands() []string {
+	if p.PagerSuppression == nil {
+		return p.SetupCommands
+	}
+	return append(append([]string(nil),
+		p.PagerSuppression.SetupCommands...), p.SetupCommands...)
+}
+
+// pagerPrompts returns the pager prompts to answer, if any.
+func (p *Parameters) pagerPrompts() []PagerPrompt {
+	if p.PagerSuppression == nil {
+		return nil
+	}
+	return p.PagerSuppression.Prompts
+}
+
+// strategies returns the sentinel strategies to use for stdOut and stdErr.
+// The latter might be nil.
+func (p *Parameters) strategies() (out SentinelStrategy, es SentinelStrategy) {
+	out, es = p.OutStrategy, p.ErrStrategy
+	if out == nil {
+		out = StrategyFromCommander(p.OutSentinel)
+	}
+	if es == nil {
+		es = StrategyFromCommander(p.ErrSentinel)
+	}
+	return
 }
 
 // Validate looks for trouble and sets defaults.
@@ -71,8 +456,101 @@ func (p *Parameters) Validate() error {
 	if p.Path == "" {
 		return fmt.Errorf("must specify a Path")
 	}
-	if p.OutSentinel == nil {
-		return fmt.Errorf("must specify OutSentinel")
+	if p.OutSentinel == nil && p.OutStrategy == nil {
+		return fmt.Errorf("must specify OutSentinel or OutStrategy")
+	}
+	if p.OutSentinel != nil && p.OutStrategy != nil {
+		return fmt.Errorf("specify only one of OutSentinel and OutStrategy")
+	}
+	if p.ErrSentinel != nil && p.ErrStrategy != nil {
+		return fmt.Errorf("specify only one of ErrSentinel and ErrStrategy")
+	}
+	if p.Name == "" {
+		p.Name = p.Path
+	}
+	if p.PagerSuppression != nil {
+		if err := p.PagerSuppression.validate(); err != nil {
+			return err
+		}
+	}
+	if p.IdleTimeout < 0 {
+		return fmt.Errorf("IdleTimeout %s can't be negative", p.IdleTimeout)
+	}
+	if err := p.Verbosity.validate(); err != nil {
+		return err
+	}
+	if p.Auth != nil {
+		if err := p.Auth.validate(); err != nil {
+			return err
+		}
+	}
+	if p.Keepalive != nil {
+		if err := p.Keepalive.validate(); err != nil {
+			return err
+		}
+	}
+	if p.ErrSentinelPolicy != nil {
+		if err := p.ErrSentinelPolicy.validate(); err != nil {
+			return err
+		}
+	}
+	if p.Supervise != nil {
+		if err := p.Supervise.validate(); err != nil {
+			return err
+		}
+	}
+	for i, f := range p.LineFilters {
+		if f == nil {
+			return fmt.Errorf("LineFilters entry %d is nil", i)
+		}
+	}
+	for i, re := range p.FatalLinePatterns {
+		if re == nil {
+			return fmt.Errorf("FatalLinePatterns entry %d is nil", i)
+		}
+	}
+	for i, re := range p.TruncationPatterns {
+		if re == nil {
+			return fmt.Errorf("TruncationPatterns entry %d is nil", i)
+		}
+	}
+	seen := map[string]bool{}
+	for _, name := range p.ExtraStreams {
+		if name == "" {
+			return fmt.Errorf("ExtraStreams has an empty name")
+		}
+		if seen[name] {
+			return fmt.Errorf("ExtraStreams has %q twice", name)
+		}
+		seen[name] = true
+	}
+	for _, kv := range p.Env {
+		if i := strings.Index(kv, "="); i < 1 {
+			return fmt.Errorf("Env entry %q isn't of the form key=value", kv)
+		}
+	}
+	if p.ChangeDirCommand != "" &&
+		strings.Count(p.ChangeDirCommand, "%s") != 1 {
+		return fmt.Errorf(
+			"ChangeDirCommand %q must have one %%s verb", p.ChangeDirCommand)
+	}
+	for _, d := range p.RecordDelimiters {
+		if d == "" {
+			return fmt.Errorf("RecordDelimiters has an empty delimiter")
+		}
+	}
+	if err := p.LineEnding.validate(); err != nil {
+		return err
+	}
+	if p.MaxLineBytes < 0 {
+		return fmt.Errorf("MaxLineBytes %d is negative", p.MaxLineBytes)
+	}
+	if p.LongLines < LongLinesAbort || p.LongLines > LongLinesTruncate {
+		return fmt.Errorf("unknown LongLinePolicy %d", p.LongLines)
+	}
+	if p.EmptyCommandPolicy < EmptyCommandNoOp ||
+		p.EmptyCommandPolicy > EmptyCommandNewline {
+		return fmt.Errorf("unknown EmptyCommandPolicy %d", p.EmptyCommandPolicy)
 	}
 	// TODO: assure Path actually exists and
 	// TODO: assure working dir actually exists.
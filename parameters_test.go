@@ -1,7 +1,9 @@
 package clirunner_test
 
 import (
+	"regexp"
 	"testing"
+	"time"
 
 	. "github.com/monopole/clirunner/cmdrs"
 
@@ -23,4 +25,165 @@ func TestParameters_Validate(t *testing.T) {
 	p.OutSentinel = &SimpleSentinelCommander{}
 	err = p.Validate()
 	assert.NoError(t, err)
+	assert.Equal(t, "/whatever", p.Name)
+
+	p.OutStrategy = StrategyFromCommander(&SimpleSentinelCommander{})
+	err = p.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "only one of OutSentinel and OutStrategy")
+	p.OutStrategy = nil
+
+	p.Env = []string{"LC_ALL=C", "=oops"}
+	err = p.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `Env entry "=oops"`)
+	p.Env = nil
+
+	p.ChangeDirCommand = "cd"
+	err = p.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `ChangeDirCommand "cd" must have one %s verb`)
+	p.ChangeDirCommand = "cd %s"
+	assert.NoError(t, p.Validate())
+	p.ChangeDirCommand = ""
+
+	p.ExtraStreams = []string{"results", ""}
+	err = p.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "ExtraStreams has an empty name")
+	p.ExtraStreams = []string{"results", "results"}
+	err = p.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `ExtraStreams has "results" twice`)
+	p.ExtraStreams = nil
+
+	p.IdleTimeout = -time.Second
+	err = p.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "IdleTimeout -1s can't be negative")
+	p.IdleTimeout = 0
+
+	p.Verbosity = VerbosityLines + 1
+	err = p.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown Verbosity(4)")
+	p.Verbosity = VerbosityDefault
+
+	p.RecordDelimiters = []string{"\x00", ""}
+	err = p.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "RecordDelimiters has an empty delimiter")
+	p.RecordDelimiters = nil
+
+	p.MaxLineBytes = -1
+	err = p.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "MaxLineBytes -1 is negative")
+	p.MaxLineBytes = 0
+
+	p.LongLines = LongLinesTruncate + 1
+	err = p.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown LongLinePolicy 3")
+	p.LongLines = LongLinesAbort
+
+	p.Auth = &Auth{Steps: []AuthStep{{Prompt: regexp.MustCompile("Token:")}}}
+	err = p.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Auth step 0 has no Answer")
+	p.Auth = nil
+
+	p.Keepalive = &Keepalive{Commander: &KondoCommander{Command: "ping"}}
+	err = p.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Keepalive Interval 0s must be positive")
+	p.Keepalive = nil
+
+	p.ErrSentinelPolicy = &ErrSentinelPolicy{Grace: -time.Second}
+	err = p.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Grace -1s can't be negative")
+	p.ErrSentinelPolicy = nil
+
+	p.Supervise = &Supervision{Backoff: -time.Second}
+	err = p.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Supervision backoff can't be negative")
+	p.Supervise = nil
+
+	p.Supervise = &Supervision{RestartBudget: 3}
+	err = p.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(),
+		"Supervision RestartWindow must be positive with a RestartBudget")
+	p.Supervise = nil
+
+	p.EmptyCommandPolicy = EmptyCommandNewline + 1
+	err = p.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown EmptyCommandPolicy")
+}
+
+func TestRunner_Run_Env(t *testing.T) {
+	t.Setenv("CLIRUNNER_PARENT", "yes")
+	testCases := map[string]struct {
+		env        []string
+		inheritEnv bool
+		expected   string
+	}{
+		"noEnv": {
+			expected: "/yes\n",
+		},
+		"onlyEnv": {
+			env:      []string{"FOO=bar"},
+			expected: "bar/\n",
+		},
+		"inheritEnv": {
+			env:        []string{"FOO=bar", "CLIRUNNER_PARENT=overridden"},
+			inheritEnv: true,
+			expected:   "bar/overridden\n",
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			runner, err := NewProcRunner(&Parameters{
+				Path:        "sh",
+				Env:         tc.env,
+				InheritEnv:  tc.inheritEnv,
+				ExitCommand: "exit",
+				OutSentinel: &SimpleSentinelCommander{
+					Command: "echo Rumpelstiltskin",
+					Value:   "Rumpelstiltskin",
+				},
+			})
+			assert.NoError(t, err)
+			c := NewHoardingCommander(`echo "$FOO/$CLIRUNNER_PARENT"`)
+			assert.NoError(t, runner.RunIt(c, testingTimeout))
+			assert.Equal(t, tc.expected, c.Result())
+			assert.NoError(t, runner.Close())
+		})
+	}
+}
+
+func TestRunner_Run_PagerSuppression(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path: "sh",
+		Env:  []string{"GIT_PAGER=less"},
+		PagerSuppression: &PagerSuppression{
+			Env:           []string{"PAGER=cat", "GIT_PAGER=cat"},
+			SetupCommands: []string{"PAGER_OFF=1"},
+		},
+		SetupCommands: []string{`PAGER_OFF="$PAGER_OFF+"`},
+		ExitCommand:   "exit",
+		OutSentinel: &SimpleSentinelCommander{
+			Command: "echo Rumpelstiltskin",
+			Value:   "Rumpelstiltskin",
+		},
+	})
+	assert.NoError(t, err)
+	// Parameters.Env overrides, and Parameters.SetupCommands follow.
+	c := NewHoardingCommander(`echo "$PAGER/$GIT_PAGER/$PAGER_OFF"`)
+	assert.NoError(t, runner.RunIt(c, testingTimeout))
+	assert.Equal(t, "cat/less/1+\n", c.Result())
+	assert.NoError(t, runner.Close())
 }
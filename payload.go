@@ -0,0 +1,178 @@
+package clirunner
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// PayloadFraming describes a compressed payload that a command embeds in
+// its output on stdOut.  The payload is announced by a header line giving
+// its length, and is followed by exactly that many bytes of compressed
+// data.  The payload is decompressed before the output is split into
+// lines, so the Commander sees the decompressed lines in place of the
+// header and the compressed data.
+type PayloadFraming struct {
+	// Header is the start of the line that announces a payload.  The rest
+	// of the line is the payload's length in bytes, in decimal.
+	//
+	// Example: "PAYLOAD " would match the line "PAYLOAD 1234", which is
+	// followed by 1234 bytes of payload.
+	Header string
+
+	// Decompress returns a reader of the decompressed payload, given a
+	// reader of the compressed payload.  If nil, GzipDecompress is used.
+	// For zstd, wrap a zstd decoder (e.g. github.com/klauspost/compress).
+	Decompress func(io.Reader) (io.Reader, error)
+}
+
+// GzipDecompress decompresses a gzip payload.
+func GzipDecompress(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+// PayloadFramer is an optional interface for a Commander whose command
+// emits compressed payloads.
+type PayloadFramer interface {
+	// PayloadFraming returns the framing of the command's payloads.
+	PayloadFraming() *PayloadFraming
+}
+
+// framingFor returns the PayloadFraming of the given Commander, if any.
+func framingFor(c Commander) *PayloadFraming {
+	for ; c != nil; c = unwrap(c) {
+		if f, ok := c.(PayloadFramer); ok {
+			return f.PayloadFraming()
+		}
+	}
+	return nil
+}
+
+// payloadSize returns the size announced by the line, if it's a header.
+func (f *PayloadFraming) payloadSize(line []byte) (int64, bool) {
+	line = bytes.TrimRight(line, "\r\n")
+	if f == nil || !bytes.HasPrefix(line, []byte(f.Header)) {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(string(line[len(f.Header):]), 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// framingSlot holds the PayloadFraming of the current run, if any.  It's
+// shared with any warm standby, since a failover hands over the standby's
+// output stream.
+type framingSlot struct {
+	mu      sync.Mutex
+	framing *PayloadFraming
+}
+
+func (s *framingSlot) get() *PayloadFraming {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.framing
+}
+
+func (s *framingSlot) set(f *PayloadFraming) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.framing = f
+}
+
+// deframer reads a CLI's output, replacing framed payloads with their
+// decompressed content.
+type deframer struct {
+	r       *bufio.Reader
+	slot    *framingSlot
+	raw     *io.LimitedReader // the payload being read, if any
+	payload io.Reader         // decompresses raw
+	last    byte              // the last byte of decompressed payload
+	pending []byte            // what's left of the current line
+	midLine bool              // the last piece read didn't end its line
+}
+
+func newDeframer(r io.Reader, slot *framingSlot) *deframer {
+	return &deframer{r: bufio.NewReader(r), slot: slot}
+}
+
+func (d *deframer) Read(b []byte) (int, error) {
+	for len(d.pending) == 0 {
+		if d.payload != nil {
+			n, err := d.readPayload(b)
+			if n > 0 || err != nil {
+				return n, err
+			}
+			continue
+		}
+		// The slice is good until the next read of r, by which time pending
+		// is consumed, so there's no need to copy each line.
+		line, err := d.r.ReadSlice(lineFeed)
+		if err == bufio.ErrBufferFull {
+			// A long line comes in pieces.
+			err = nil
+		}
+		if len(line) == 0 {
+			return 0, err
+		}
+		if !d.midLine {
+			if size, ok := d.slot.get().payloadSize(line); ok {
+				if err = d.startPayload(size); err != nil {
+					return 0, err
+				}
+				continue
+			}
+		}
+		d.midLine = line[len(line)-1] != lineFeed
+		d.pending = line
+	}
+	n := copy(b, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+// startPayload starts decompressing a payload of the given size.
+func (d *deframer) startPayload(size int64) error {
+	d.raw = &io.LimitedReader{R: d.r, N: size}
+	decompress := d.slot.get().Decompress
+	if decompress == nil {
+		decompress = GzipDecompress
+	}
+	p, err := decompress(d.raw)
+	if err != nil {
+		return fmt.Errorf("decompressing payload; %w", err)
+	}
+	d.payload = p
+	d.last = lineFeed
+	return nil
+}
+
+// readPayload reads decompressed payload.  At the end of the payload, it
+// skips any compressed bytes the decompressor didn't read, and assures the
+// payload's last line is terminated, so the output that follows it starts
+// on a new line.
+func (d *deframer) readPayload(b []byte) (int, error) {
+	n, err := d.payload.Read(b)
+	if n > 0 {
+		d.last = b[n-1]
+	}
+	if err == io.EOF {
+		if _, err = io.Copy(io.Discard, d.raw); err != nil {
+			return n, err
+		}
+		d.payload, d.raw = nil, nil
+		if d.last != lineFeed {
+			d.pending = []byte{lineFeed}
+		}
+		return n, nil
+	}
+	if err != nil {
+		return n, fmt.Errorf("decompressing payload; %w", err)
+	}
+	return n, nil
+}
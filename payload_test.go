@@ -0,0 +1,104 @@
+package clirunner
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// frame returns a framed gzip payload of the given text.
+func frame(t *testing.T, header, text string) string {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	_, err := w.Write([]byte(text))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	return fmt.Sprintf("%s%d\n%s", header, b.Len(), b.String())
+}
+
+func TestDeframer(t *testing.T) {
+	gz := &PayloadFraming{Header: "PAYLOAD "}
+	testCases := map[string]struct {
+		framing  *PayloadFraming
+		input    string
+		expected []string
+	}{
+		"plain": {
+			framing:  gz,
+			input:    "hello\nthere\n",
+			expected: []string{"hello", "there"},
+		},
+		"payload": {
+			framing: gz,
+			input: "before\n" + frame(t, "PAYLOAD ", "alpha\nbeta\n") +
+				"after\n",
+			expected: []string{"before", "alpha", "beta", "after"},
+		},
+		"unterminatedPayload": {
+			framing:  gz,
+			input:    frame(t, "PAYLOAD ", "alpha\nbeta") + "after\n",
+			expected: []string{"alpha", "beta", "after"},
+		},
+		"emptyPayload": {
+			framing:  gz,
+			input:    frame(t, "PAYLOAD ", "") + "after\n",
+			expected: []string{"after"},
+		},
+		"notAHeader": {
+			framing:  gz,
+			input:    "PAYLOAD lots\n",
+			expected: []string{"PAYLOAD lots"},
+		},
+		"longLine": {
+			// The header is past the reader's buffer, in mid line.
+			framing:  gz,
+			input:    strings.Repeat("x", 4096) + "PAYLOAD 3\nabc\n",
+			expected: []string{strings.Repeat("x", 4096) + "PAYLOAD 3", "abc"},
+		},
+		"noFraming": {
+			input:    "PAYLOAD 3\nabc\n",
+			expected: []string{"PAYLOAD 3", "abc"},
+		},
+		"customDecompress": {
+			framing: &PayloadFraming{
+				Header: "UPPER ",
+				Decompress: func(r io.Reader) (io.Reader, error) {
+					b, err := io.ReadAll(r)
+					return strings.NewReader(strings.ToLower(string(b))), err
+				},
+			},
+			input:    "UPPER 6\nA\nB\nC\nafter\n",
+			expected: []string{"a", "b", "c", "after"},
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			slot := &framingSlot{}
+			slot.set(tc.framing)
+			s := bufio.NewScanner(
+				newDeframer(strings.NewReader(tc.input), slot))
+			var lines []string
+			for s.Scan() {
+				lines = append(lines, s.Text())
+			}
+			assert.NoError(t, s.Err())
+			assert.Equal(t, tc.expected, lines)
+		})
+	}
+}
+
+func TestDeframer_corrupt(t *testing.T) {
+	slot := &framingSlot{}
+	slot.set(&PayloadFraming{Header: "PAYLOAD "})
+	s := bufio.NewScanner(newDeframer(
+		strings.NewReader("PAYLOAD 5\nnope!\n"), slot))
+	for s.Scan() {
+	}
+	assert.Error(t, s.Err())
+}
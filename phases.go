@@ -0,0 +1,111 @@
+package clirunner
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RunPhases breaks a run down, to tell whether its time went to the CLI,
+// its backend or the Commander's parsing.  Each phase is the time from the
+// run's Start until the run reached it, or zero if it didn't, e.g.
+// FirstLine for a command printing nothing.
+//
+// Roughly, Written is spent getting a CLI and the runner's turn,
+// FirstLine - Written waiting on the CLI and its backend, LastLine -
+// FirstLine streaming the output, and Sentinels - LastLine finishing the
+// command and echoing the sentinels.  Parsing is spent within those.
+type RunPhases struct {
+	// Written is when the command was written to the CLI's stdIn.
+	Written time.Duration
+	// FirstLine and LastLine are when the first and last lines of output
+	// for the Commander arrived.
+	FirstLine, LastLine time.Duration
+	// SentinelsIssued is when the sentinel commands were written.
+	SentinelsIssued time.Duration
+	// Sentinels is when the sentinels were seen, ending the run.
+	Sentinels time.Duration
+	// Parsing is the time spent delivering lines to the Commander, i.e. in
+	// its Write, in total.
+	Parsing time.Duration
+}
+
+func (p RunPhases) String() string {
+	var parts []string
+	add := func(name string, d time.Duration) {
+		if d > 0 {
+			parts = append(parts, fmt.Sprintf("%s %s", name, d))
+		}
+	}
+	add("written", p.Written)
+	add("first line", p.FirstLine)
+	add("last line", p.LastLine)
+	add("sentinels issued", p.SentinelsIssued)
+	add("sentinels", p.Sentinels)
+	add("parsing", p.Parsing)
+	if len(parts) == 0 {
+		return "no phases"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// runPhasesJSON is the JSON form of RunPhases.
+type runPhasesJSON struct {
+	WrittenMs         float64 `json:"writtenMs"`
+	FirstLineMs       float64 `json:"firstLineMs"`
+	LastLineMs        float64 `json:"lastLineMs"`
+	SentinelsIssuedMs float64 `json:"sentinelsIssuedMs"`
+	SentinelsMs       float64 `json:"sentinelsMs"`
+	ParsingMs         float64 `json:"parsingMs"`
+}
+
+func (p RunPhases) toJSON() runPhasesJSON {
+	return runPhasesJSON{
+		WrittenMs:         durationMs(p.Written),
+		FirstLineMs:       durationMs(p.FirstLine),
+		LastLineMs:        durationMs(p.LastLine),
+		SentinelsIssuedMs: durationMs(p.SentinelsIssued),
+		SentinelsMs:       durationMs(p.Sentinels),
+		ParsingMs:         durationMs(p.Parsing),
+	}
+}
+
+// runTimes are when the current run reached its phases, or zero times
+// where it didn't.
+type runTimes struct {
+	written, firstLine, lastLine, issued, sentinels time.Time
+	parsing                                         time.Duration
+}
+
+// phases returns the times as RunPhases of a run started at start.
+func (t runTimes) phases(start time.Time) RunPhases {
+	since := func(at time.Time) time.Duration {
+		if at.IsZero() {
+			return 0
+		}
+		return at.Sub(start)
+	}
+	return RunPhases{
+		Written:         since(t.written),
+		FirstLine:       since(t.firstLine),
+		LastLine:        since(t.lastLine),
+		SentinelsIssued: since(t.issued),
+		Sentinels:       since(t.sentinels),
+		Parsing:         t.parsing,
+	}
+}
+
+// stamp sets the given time of the current run to now.
+func (cw *sentinelFilter) stamp(at *time.Time) {
+	now := cw.clock.Now()
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	*at = now
+}
+
+// runPhases returns the phases of the current run, started at start.
+func (cw *sentinelFilter) runPhases(start time.Time) RunPhases {
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	return cw.times.phases(start)
+}
@@ -0,0 +1,78 @@
+package clirunner_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+// slowParser spends parse on the clock parsing each line, telling the test
+// when it's done.
+type slowParser struct {
+	*HoardingCommander
+	clock  *FakeClock
+	parse  time.Duration
+	parsed chan struct{}
+}
+
+func (c *slowParser) Write(p []byte) (int, error) {
+	c.clock.Advance(c.parse)
+	defer func() { c.parsed <- struct{}{} }()
+	return c.HoardingCommander.Write(p)
+}
+
+func TestRunner_Phases(t *testing.T) {
+	h := makeHarness(t)
+	c := &slowParser{HoardingCommander: NewHoardingCommander("query"),
+		clock: h.Clock, parse: 10 * time.Millisecond,
+		parsed: make(chan struct{}, 2)}
+	result := runAsync(h, c, time.Hour)
+	expectCommands(t, h, "query", "echo Rumpelstiltskin")
+	h.Clock.Advance(time.Second)
+	assert.NoError(t, h.Out("row1"))
+	<-c.parsed
+	h.Clock.Advance(time.Second)
+	assert.NoError(t, h.Out("row2"))
+	<-c.parsed
+	h.Clock.Advance(time.Second)
+	assert.NoError(t, h.Out("Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+
+	r, _ := h.Runner.LastRunReport()
+	assert.Equal(t, RunPhases{
+		FirstLine: time.Second,
+		LastLine:  2*time.Second + 10*time.Millisecond,
+		Sentinels: 3*time.Second + 20*time.Millisecond,
+		Parsing:   20 * time.Millisecond,
+	}, r.Phases)
+	assert.Equal(t, r.Duration, r.Phases.Sentinels)
+	assert.Equal(t, "first line 1s, last line 2.01s, sentinels 3.02s, "+
+		"parsing 20ms", r.Phases.String())
+
+	data, err := json.Marshal(r)
+	assert.NoError(t, err)
+	var decoded struct {
+		Phases map[string]float64 `json:"phases"`
+	}
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, map[string]float64{
+		"writtenMs":         0,
+		"firstLineMs":       1000,
+		"lastLineMs":        2010,
+		"sentinelsIssuedMs": 0,
+		"sentinelsMs":       3020,
+		"parsingMs":         20,
+	}, decoded.Phases)
+	assert.NoError(t, h.Runner.Close())
+}
+
+func TestRunPhases_String(t *testing.T) {
+	assert.Equal(t, "no phases", RunPhases{}.String())
+	assert.Equal(t, "written 5ms, sentinels issued 6ms",
+		RunPhases{Written: 5 * time.Millisecond,
+			SentinelsIssued: 6 * time.Millisecond}.String())
+}
@@ -0,0 +1,574 @@
+package clirunner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrPoolClosed is returned by a ProcRunnerPool's runs once it's closed,
+// or draining.
+var ErrPoolClosed = errors.New("pool closed")
+
+// PoolParameters configure a ProcRunnerPool.
+type PoolParameters struct {
+	// NewParameters returns the Parameters of a new runner in the pool.
+	// Each call should return the same settings, but sentinel Commanders
+	// (or strategies) of their own, since they have state, and the
+	// runners use them at the same time.
+	NewParameters func() *Parameters
+
+	// MaxSize is the most runners, i.e. CLI subprocesses, the pool runs
+	// at once.  Runs beyond that many wait for a runner to come free.
+	//
+	// Example: 4
+	MaxSize int
+
+	// IdleTimeout, if positive, is how long a runner may sit idle before
+	// the pool closes it, ending its CLI.  Zero keeps idle runners until
+	// the pool is closed.
+	//
+	// Example: 5 * time.Minute
+	IdleTimeout time.Duration
+
+	// MaxAffinityKeys is the most affinity keys a runner keeps, forgetting
+	// the least recently used beyond that, so that a workload using a new
+	// key for each request doesn't make the pool grow without limit.  The
+	// next run with a forgotten key may get any runner, as if the key's
+	// runner was closed.  Zero means 256.
+	//
+	// Example: 1000
+	MaxAffinityKeys int
+}
+
+// defaultMaxAffinityKeys is the MaxAffinityKeys used by default.
+const defaultMaxAffinityKeys = 256
+
+// Validate returns an error if the parameters are unusable.
+func (p *PoolParameters) Validate() error {
+	if p.NewParameters == nil {
+		return fmt.Errorf("must specify NewParameters")
+	}
+	if err := p.NewParameters().Validate(); err != nil {
+		return err
+	}
+	if p.MaxSize < 1 {
+		return fmt.Errorf("MaxSize %d must be positive", p.MaxSize)
+	}
+	if p.IdleTimeout < 0 {
+		return fmt.Errorf("IdleTimeout %s can't be negative", p.IdleTimeout)
+	}
+	if p.MaxAffinityKeys < 0 {
+		return fmt.Errorf(
+			"MaxAffinityKeys %d can't be negative", p.MaxAffinityKeys)
+	}
+	return nil
+}
+
+// ProcRunnerPool runs Commanders in parallel on up to MaxSize identical
+// ProcRunners, each with a CLI of its own, e.g. to spread a bulk query
+// workload over several mql processes rather than serializing it
+// through one.
+//
+// Runners are made as runs need them, and reused once they're idle, the
+// most recently used first, so that the rest can be reaped per
+// IdleTimeout.  A runner in the error state is reused too; as usual, its
+// next run starts a new CLI.
+//
+// Since each run may land on a different CLI, Commanders that depend on
+// state left by earlier commands (e.g. a working directory or a
+// SubSession) don't belong in a pool, unless they share an affinity key;
+// see AffinityKeyer.
+type ProcRunnerPool struct {
+	params PoolParameters
+	clock  Clock
+
+	mu      sync.Mutex
+	idle    []*pooledRunner // most recently used last
+	runners []*ProcRunner   // all the runners not yet closed, oldest first
+	size    int             // runners made and not yet closed
+	busy    int
+	waiters []chan *ProcRunner // runs waiting for a runner, oldest first
+	closed  bool
+	// drained, if not nil, is closed once a draining pool's runs are done.
+	drained chan struct{}
+
+	// affinity holds the runner of each affinity key, nil while the first
+	// run with the key waits for one; keys holds each runner's keys.
+	affinity map[string]*ProcRunner
+	keys     map[*ProcRunner][]string
+	// affine holds the runs waiting for their key's runner, by key, oldest
+	// first.
+	affine map[string][]chan *ProcRunner
+
+	stopReaper chan struct{}
+	reaperDone chan struct{}
+}
+
+// pooledRunner is an idle runner in a pool.
+type pooledRunner struct {
+	pr    *ProcRunner
+	since time.Time // when it became idle
+}
+
+// PoolReport describes a ProcRunnerPool at a moment.
+type PoolReport struct {
+	// Size counts the runners in the pool; Idle and Busy split it.
+	Size, Idle, Busy int
+	// Waiting counts the runs waiting for a runner.
+	Waiting int
+	// Draining is true once Drain is called.
+	Draining bool
+}
+
+// NewProcRunnerPool returns a new, empty ProcRunnerPool, or an error on
+// bad parameters.
+func NewProcRunnerPool(params *PoolParameters) (*ProcRunnerPool, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	p := &ProcRunnerPool{
+		params:   *params,
+		clock:    clockOrReal(params.NewParameters().Clock),
+		affinity: make(map[string]*ProcRunner),
+		keys:     make(map[*ProcRunner][]string),
+		affine:   make(map[string][]chan *ProcRunner),
+	}
+	if p.params.IdleTimeout > 0 {
+		p.stopReaper = make(chan struct{})
+		p.reaperDone = make(chan struct{})
+		go p.reap()
+	}
+	return p, nil
+}
+
+// RunIt runs the Commander on an idle runner, waiting for one if all are
+// busy, as ProcRunner.RunIt does.  A Commander with an affinity key runs
+// on, or waits for, its key's runner.  The duration limits the command's
+// run, not its wait.
+func (p *ProcRunnerPool) RunIt(cmdr Commander, timeOut time.Duration) error {
+	pr, err := p.acquire(context.Background(), affinityKey(cmdr))
+	if err != nil {
+		return err
+	}
+	defer p.release(pr)
+	return pr.RunIt(cmdr, timeOut)
+}
+
+// RunContext is like RunIt, but as ProcRunner.RunContext.  The context's
+// deadline covers any wait for a runner too.
+func (p *ProcRunnerPool) RunContext(ctx context.Context, cmdr Commander) error {
+	if cmdr == nil {
+		return fmt.Errorf("provide a Commander")
+	}
+	pr, err := p.acquire(ctx, affinityKey(cmdr))
+	if err != nil {
+		return &RunCanceledError{Command: cmdr.String(), Cause: err}
+	}
+	defer p.release(pr)
+	return pr.RunContext(ctx, cmdr)
+}
+
+// Map runs the Commanders on the pool's runners, as many at once as
+// MaxSize allows, returning once all are done.  It returns the errors of
+// their runs in the order of the Commanders, nil for each that succeeded.
+// The duration limits each command's run, as for RunIt.
+func (p *ProcRunnerPool) Map(cmds []Commander, timeOut time.Duration) []error {
+	return p.mapRuns(cmds, func(c Commander) error { return p.RunIt(c, timeOut) })
+}
+
+// MapContext is like Map, but runs each Commander as RunContext does.
+func (p *ProcRunnerPool) MapContext(
+	ctx context.Context, cmds []Commander) []error {
+	return p.mapRuns(cmds, func(c Commander) error {
+		return p.RunContext(ctx, c)
+	})
+}
+
+// mapRuns does the work of Map and MapContext, running each Commander
+// with the given function.
+func (p *ProcRunnerPool) mapRuns(
+	cmds []Commander, run func(Commander) error) []error {
+	errs := make([]error, len(cmds))
+	p.mu.Lock()
+	workers := p.params.MaxSize
+	p.mu.Unlock()
+	if workers > len(cmds) {
+		workers = len(cmds)
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				errs[i] = run(cmds[i])
+			}
+		}()
+	}
+	for i := range cmds {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return errs
+}
+
+// Report returns a PoolReport on the pool.
+func (p *ProcRunnerPool) Report() PoolReport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.reportLocked()
+}
+
+// reportLocked returns a PoolReport.  The caller must hold mu.
+func (p *ProcRunnerPool) reportLocked() PoolReport {
+	return PoolReport{
+		Size:     p.size,
+		Idle:     len(p.idle),
+		Busy:     p.busy,
+		Waiting:  len(p.waiters) + p.affineWaiting(),
+		Draining: p.drained != nil,
+	}
+}
+
+// Close closes the idle runners, and the busy ones as their runs finish;
+// runs waiting for a runner return ErrPoolClosed.  It returns the first
+// error from closing a runner.  The pool can't be used afterwards.
+func (p *ProcRunnerPool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.size -= len(idle)
+	for _, r := range idle {
+		p.forget(r.pr)
+	}
+	for _, w := range p.waiters {
+		close(w)
+	}
+	p.waiters = nil
+	for k, ws := range p.affine {
+		for _, w := range ws {
+			close(w)
+		}
+		delete(p.affine, k)
+	}
+	p.mu.Unlock()
+	if p.stopReaper != nil {
+		close(p.stopReaper)
+		<-p.reaperDone
+	}
+	var first error
+	for _, r := range idle {
+		if err := r.pr.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// acquire returns a runner for a run with the given affinity key, if
+// any, waiting for one if need be.  A draining pool turns the run away,
+// unless it was already waiting, and is told to try again.
+func (p *ProcRunnerPool) acquire(
+	ctx context.Context, key string) (*ProcRunner, error) {
+	for queued := false; ; queued = true {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		p.mu.Lock()
+		if p.closed || p.drained != nil && !queued {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+		if pr, ok := p.affinity[key]; key != "" && ok {
+			if pr != nil && p.takeIdle(pr) {
+				p.busy++
+				p.touch(key, pr)
+				p.mu.Unlock()
+				return pr, nil
+			}
+			// Wait for the key's runner to come free, or be made.
+			turn := make(chan *ProcRunner, 1)
+			p.affine[key] = append(p.affine[key], turn)
+			p.mu.Unlock()
+			pr, err := p.await(ctx, turn, func() bool {
+				return removeTurn(p.affine, key, turn)
+			})
+			if pr == nil && err == nil {
+				continue // the key's runner wasn't made after all
+			}
+			return pr, err
+		}
+		if key != "" {
+			p.affinity[key] = nil
+		}
+		if n := len(p.idle); n > 0 {
+			pr := p.idle[n-1].pr
+			p.idle = p.idle[:n-1]
+			p.busy++
+			p.bind(key, pr)
+			p.mu.Unlock()
+			return pr, nil
+		}
+		if p.size < p.params.MaxSize {
+			p.size++
+			p.busy++
+			p.mu.Unlock()
+			pr, err := NewProcRunner(p.params.NewParameters())
+			p.mu.Lock()
+			if err != nil {
+				p.size--
+				p.busy--
+				p.unbind(key)
+				p.mu.Unlock()
+				return nil, err
+			}
+			p.runners = append(p.runners, pr)
+			p.bind(key, pr)
+			p.mu.Unlock()
+			return pr, nil
+		}
+		turn := make(chan *ProcRunner, 1)
+		p.waiters = append(p.waiters, turn)
+		p.mu.Unlock()
+		pr, err := p.await(ctx, turn, func() bool {
+			for i, w := range p.waiters {
+				if w == turn {
+					p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+					return true
+				}
+			}
+			return false
+		})
+		p.mu.Lock()
+		if pr != nil {
+			p.bind(key, pr)
+		} else {
+			p.unbind(key)
+		}
+		p.mu.Unlock()
+		if pr == nil && err == nil {
+			continue // there's room for another runner
+		}
+		return pr, err
+	}
+}
+
+// await waits for the turn of a run waiting for a runner.  It returns the
+// runner handed over; nil, if the run should try again; or an error if
+// the pool is closed or the context is done first.  The given function
+// removes the turn from its queue, returning false if it was already
+// taken; it's called with mu held.
+func (p *ProcRunnerPool) await(ctx context.Context,
+	turn chan *ProcRunner, remove func() bool) (*ProcRunner, error) {
+	select {
+	case pr, ok := <-turn:
+		if !ok {
+			return nil, ErrPoolClosed
+		}
+		return pr, nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		removed := remove()
+		p.mu.Unlock()
+		if removed {
+			return nil, ctx.Err()
+		}
+		// Handed a runner (or closed) meanwhile; pass it on.
+		if pr, ok := <-turn; ok && pr != nil {
+			p.release(pr)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// release returns a runner to the pool after a run, handing it to the
+// oldest run waiting for it by affinity key, if any, else to the oldest
+// waiting run, if any.
+func (p *ProcRunnerPool) release(pr *ProcRunner) {
+	p.mu.Lock()
+	if p.closed || p.size > p.params.MaxSize {
+		p.size--
+		p.busy--
+		p.forget(pr)
+		p.noteDrained()
+		p.mu.Unlock()
+		_ = pr.Close()
+		return
+	}
+	for _, k := range p.keys[pr] {
+		if ws := p.affine[k]; len(ws) > 0 {
+			if len(ws) == 1 {
+				delete(p.affine, k)
+			} else {
+				p.affine[k] = ws[1:]
+			}
+			p.touch(k, pr)
+			p.mu.Unlock()
+			ws[0] <- pr
+			return
+		}
+	}
+	if len(p.waiters) > 0 {
+		turn := p.waiters[0]
+		p.waiters = p.waiters[1:]
+		p.mu.Unlock()
+		turn <- pr
+		return
+	}
+	p.busy--
+	p.idle = append(p.idle, &pooledRunner{pr: pr, since: p.clock.Now()})
+	p.noteDrained()
+	p.mu.Unlock()
+}
+
+// Resize changes the pool's MaxSize.  If it shrinks, the idle runners
+// beyond the new size are closed, the least recently used first, and busy
+// ones as their runs finish, until the pool fits; runs waiting for a
+// runner go on waiting.  If it grows, runs waiting for a runner get new
+// ones.  It returns the first error from closing a runner.
+func (p *ProcRunnerPool) Resize(n int) error {
+	if n < 1 {
+		return fmt.Errorf("MaxSize %d must be positive", n)
+	}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrPoolClosed
+	}
+	p.params.MaxSize = n
+	var surplus []*ProcRunner
+	for p.size > n && len(p.idle) > 0 {
+		pr := p.idle[0].pr
+		p.idle = p.idle[1:]
+		p.size--
+		p.forget(pr)
+		surplus = append(surplus, pr)
+	}
+	// Have as many waiting runs as now fit try again.
+	for room := n - p.size; room > 0 && len(p.waiters) > 0; room-- {
+		p.waiters[0] <- nil
+		p.waiters = p.waiters[1:]
+	}
+	p.mu.Unlock()
+	var first error
+	for _, pr := range surplus {
+		if err := pr.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Drain stops the pool taking new runs, which return ErrPoolClosed, and
+// waits for the runs under way, and those waiting for a runner, to
+// finish; then it closes the pool.  If the context is done first, Drain
+// closes the pool at once, as Close does, and returns the context's
+// error.
+func (p *ProcRunnerPool) Drain(ctx context.Context) error {
+	p.mu.Lock()
+	if p.drained == nil {
+		p.drained = make(chan struct{})
+		p.noteDrained()
+	}
+	drained := p.drained
+	p.mu.Unlock()
+	select {
+	case <-drained:
+		return p.Close()
+	case <-ctx.Done():
+		_ = p.Close()
+		return ctx.Err()
+	}
+}
+
+// noteDrained closes drained if the pool is draining, and its runs are
+// done.  The caller must hold mu.
+func (p *ProcRunnerPool) noteDrained() {
+	if p.drained == nil || p.busy > 0 || len(p.waiters) > 0 {
+		return
+	}
+	select {
+	case <-p.drained:
+	default:
+		close(p.drained)
+	}
+}
+
+// reap closes runners that have been idle for IdleTimeout, until the pool
+// is closed.
+func (p *ProcRunnerPool) reap() {
+	defer close(p.reaperDone)
+	for {
+		t := p.clock.NewTimer(p.nextReap())
+		select {
+		case <-p.stopReaper:
+			t.Stop()
+			return
+		case <-t.C():
+		}
+		for _, pr := range p.takeExpired() {
+			_ = pr.Close()
+		}
+	}
+}
+
+// nextReap returns how long until the least recently used idle runner
+// expires, or IdleTimeout if none are idle.
+func (p *ProcRunnerPool) nextReap() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.idle) == 0 {
+		return p.params.IdleTimeout
+	}
+	d := p.idle[0].since.Add(p.params.IdleTimeout).Sub(p.clock.Now())
+	if d <= 0 {
+		d = time.Millisecond
+	}
+	return d
+}
+
+// takeExpired removes from the pool the runners that have been idle for
+// IdleTimeout, returning them.
+func (p *ProcRunnerPool) takeExpired() []*ProcRunner {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.clock.Now()
+	var expired []*ProcRunner
+	i := 0
+	for ; i < len(p.idle); i++ {
+		if now.Sub(p.idle[i].since) < p.params.IdleTimeout {
+			break
+		}
+		expired = append(expired, p.idle[i].pr)
+		p.forget(p.idle[i].pr)
+	}
+	p.idle = p.idle[i:]
+	p.size -= len(expired)
+	return expired
+}
+
+// forget removes a runner that's being closed from the pool's runners,
+// along with its affinity keys.  The caller must hold mu.
+func (p *ProcRunnerPool) forget(pr *ProcRunner) {
+	for _, k := range p.keys[pr] {
+		p.affinity[k] = nil
+		p.unbind(k)
+	}
+	delete(p.keys, pr)
+	for i, r := range p.runners {
+		if r == pr {
+			p.runners = append(p.runners[:i], p.runners[i+1:]...)
+			return
+		}
+	}
+}
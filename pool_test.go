@@ -0,0 +1,400 @@
+package clirunner_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/monopole/clirunner/internal/testcli/tstcli"
+	"github.com/stretchr/testify/assert"
+)
+
+func poolParams(maxSize int, idle time.Duration, clock Clock) *PoolParameters {
+	return &PoolParameters{
+		NewParameters: func() *Parameters {
+			return &Parameters{
+				Path:        tstcli.TestCliPath,
+				Args:        []string{"--" + tstcli.FlagDisablePrompt},
+				ExitCommand: tstcli.CmdQuit,
+				OutSentinel: tstcli.MakeOutSentinelCommander(),
+				Clock:       clock,
+			}
+		},
+		MaxSize:     maxSize,
+		IdleTimeout: idle,
+	}
+}
+
+func TestPoolParameters_Validate(t *testing.T) {
+	p := PoolParameters{}
+	err := p.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "must specify NewParameters")
+
+	p = *poolParams(0, 0, nil)
+	err = p.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "MaxSize 0 must be positive")
+
+	p = *poolParams(2, -time.Second, nil)
+	err = p.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "IdleTimeout -1s can't be negative")
+
+	p = *poolParams(2, 0, nil)
+	p.MaxAffinityKeys = -1
+	err = p.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "MaxAffinityKeys -1 can't be negative")
+
+	p = *poolParams(2, time.Second, nil)
+	assert.NoError(t, p.Validate())
+}
+
+func TestProcRunnerPool_RunIt(t *testing.T) {
+	pool, err := NewProcRunnerPool(poolParams(3, 0, nil))
+	assert.NoError(t, err)
+	var wg sync.WaitGroup
+	cmdrs := make([]*HoardingCommander, 12)
+	for i := range cmdrs {
+		cmdrs[i] = NewHoardingCommander(tstcli.CmdQuery + " limit 2")
+		wg.Add(1)
+		go func(c Commander) {
+			defer wg.Done()
+			assert.NoError(t, pool.RunIt(c, testingTimeout))
+		}(cmdrs[i])
+	}
+	wg.Wait()
+	for _, c := range cmdrs {
+		assert.Equal(t, 2, strings.Count(c.Result(), "\n"))
+	}
+	r := pool.Report()
+	assert.LessOrEqual(t, r.Size, 3)
+	assert.Equal(t, r.Size, r.Idle)
+	assert.Equal(t, 0, r.Busy)
+	assert.Equal(t, 0, r.Waiting)
+
+	assert.NoError(t, pool.Close())
+	assert.Equal(t, PoolReport{}, pool.Report())
+	assert.ErrorIs(t, pool.RunIt(cmdrs[0], testingTimeout), ErrPoolClosed)
+}
+
+func TestProcRunnerPool_RunContext_Waiting(t *testing.T) {
+	pool, err := NewProcRunnerPool(poolParams(1, 0, nil))
+	assert.NoError(t, err)
+	defer pool.Close()
+	// Hold the only runner with a slow command.
+	done := make(chan error, 1)
+	go func() {
+		done <- pool.RunIt(NewHoardingCommander(
+			tstcli.CmdSleep+" 300ms"), testingTimeout)
+	}()
+	for pool.Report().Busy == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = pool.RunContext(ctx, NewHoardingCommander(tstcli.CmdQuery+" limit 1"))
+	var rc *RunCanceledError
+	assert.True(t, errors.As(err, &rc))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 0, pool.Report().Waiting)
+
+	// Without a deadline, the run waits its turn.
+	c := NewHoardingCommander(tstcli.CmdQuery + " limit 1")
+	assert.NoError(t, pool.RunContext(context.Background(), c))
+	assert.NoError(t, <-done)
+	assert.Equal(t, 1, strings.Count(c.Result(), "\n"))
+	assert.Equal(t, 1, pool.Report().Size)
+}
+
+func TestProcRunnerPool_IdleTimeout(t *testing.T) {
+	clock := NewFakeClock(HarnessEpoch)
+	pool, err := NewProcRunnerPool(poolParams(2, time.Minute, clock))
+	assert.NoError(t, err)
+	defer pool.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, pool.RunIt(NewHoardingCommander(
+				tstcli.CmdSleep+" 50ms"), testingTimeout))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 2, pool.Report().Idle)
+
+	// One runner is used again later; the other is reaped.
+	clock.Advance(40 * time.Second)
+	assert.NoError(t, pool.RunIt(
+		NewHoardingCommander(tstcli.CmdQuery+" limit 1"), testingTimeout))
+	clock.Advance(30 * time.Second)
+	for pool.Report().Size > 1 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 1, pool.Report().Idle)
+	clock.Advance(40 * time.Second)
+	for pool.Report().Size > 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestProcRunnerPool_Map(t *testing.T) {
+	pool, err := NewProcRunnerPool(poolParams(3, 0, nil))
+	assert.NoError(t, err)
+	defer pool.Close()
+	var hoarders []*HoardingCommander
+	var cmds []Commander
+	for i := 1; i <= 7; i++ {
+		c := NewHoardingCommander(fmt.Sprintf("%s limit %d", tstcli.CmdQuery, i))
+		hoarders = append(hoarders, c)
+		cmds = append(cmds, c)
+	}
+	// A Commander that can't be run fails on its own.
+	cmds = append(cmds[:3], append([]Commander{nil}, cmds[3:]...)...)
+
+	errs := pool.Map(cmds, testingTimeout)
+	assert.Len(t, errs, 8)
+	for i, err := range errs {
+		if i == 3 {
+			assert.EqualError(t, err, "provide a Commander")
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+	// The results are in order.
+	for i, c := range hoarders {
+		assert.Equal(t, i+1, strings.Count(c.Result(), "\n"))
+	}
+	assert.LessOrEqual(t, pool.Report().Size, 3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	errs = pool.MapContext(ctx, cmds[:2])
+	for _, err := range errs {
+		assert.ErrorIs(t, err, context.Canceled)
+	}
+	assert.Empty(t, pool.Map(nil, testingTimeout))
+}
+
+func TestProcRunnerPool_Affinity(t *testing.T) {
+	pool, err := NewProcRunnerPool(poolParams(3, 0, nil))
+	assert.NoError(t, err)
+	defer pool.Close()
+	run := func(key, cmd string) chan error {
+		done := make(chan error, 1)
+		go func() {
+			done <- pool.RunIt(
+				WithAffinity(NewHoardingCommander(cmd), key), testingTimeout)
+		}()
+		return done
+	}
+	// Keep the first key's runner busy, so the second gets another.
+	a := run("a", tstcli.CmdSleep+" 300ms")
+	for pool.Report().Busy == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.NoError(t, <-run("b", tstcli.CmdQuery+" limit 1"))
+	// A run with the first key waits for its runner, though another is
+	// idle.
+	pwd := NewHoardingCommander(tstcli.CmdPwd)
+	waiting := make(chan error, 1)
+	go func() {
+		waiting <- pool.RunIt(WithAffinity(pwd, "a"), testingTimeout)
+	}()
+	for pool.Report().Waiting == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, PoolReport{Size: 2, Idle: 1, Busy: 1, Waiting: 1},
+		pool.Report())
+	assert.NoError(t, <-a)
+	assert.NoError(t, <-waiting)
+
+	// Each key's commands share a CLI, and its working directory.
+	dirs := map[string]string{}
+	for _, key := range []string{"a", "b"} {
+		dir, err := filepath.EvalSymlinks(t.TempDir())
+		assert.NoError(t, err)
+		dirs[key] = dir
+		assert.NoError(t, <-run(key, tstcli.CmdCd+" "+dir))
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 12; i++ {
+		key := []string{"a", "b", ""}[i%3]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := NewHoardingCommander(tstcli.CmdPwd)
+			assert.NoError(t, pool.RunIt(WithAffinity(c, key), testingTimeout))
+			if key != "" {
+				assert.Equal(t, dirs[key]+"\n", c.Result())
+			}
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, pool.Report().Size, 3)
+}
+
+func TestProcRunnerPool_AffinityForgotten(t *testing.T) {
+	params := poolParams(2, 0, nil)
+	params.MaxAffinityKeys = 1
+	pool, err := NewProcRunnerPool(params)
+	assert.NoError(t, err)
+	defer pool.Close()
+	query := func(key string) Commander {
+		return WithAffinity(
+			NewHoardingCommander(tstcli.CmdQuery+" limit 1"), key)
+	}
+	assert.NoError(t, pool.RunIt(query("a"), testingTimeout))
+	// The idle runner takes on the second key, forgetting the first.
+	assert.NoError(t, pool.RunIt(query("b"), testingTimeout))
+	b := make(chan error, 1)
+	go func() {
+		b <- pool.RunIt(WithAffinity(
+			NewHoardingCommander(tstcli.CmdSleep+" 1s"), "b"), testingTimeout)
+	}()
+	for pool.Report().Busy == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// So a run with the first key needn't wait for that runner.
+	assert.NoError(t, pool.RunIt(query("a"), testingTimeout))
+	select {
+	case err := <-b:
+		t.Fatalf("run with the forgotten key waited; %v", err)
+	default:
+	}
+	assert.Equal(t, 2, pool.Report().Size)
+	assert.NoError(t, <-b)
+}
+
+func TestProcRunnerPool_Drain(t *testing.T) {
+	pool, err := NewProcRunnerPool(poolParams(1, 0, nil))
+	assert.NoError(t, err)
+	slow := make(chan error, 1)
+	go func() {
+		slow <- pool.RunIt(NewHoardingCommander(
+			tstcli.CmdSleep+" 200ms"), testingTimeout)
+	}()
+	for pool.Report().Busy == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	c := NewHoardingCommander(tstcli.CmdQuery + " limit 1")
+	waiting := make(chan error, 1)
+	go func() { waiting <- pool.RunIt(c, testingTimeout) }()
+	for pool.Report().Waiting == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The runs under way, and those waiting, finish; new ones are turned
+	// away.
+	drained := make(chan error, 1)
+	go func() { drained <- pool.Drain(context.Background()) }()
+	for !pool.Report().Draining {
+		time.Sleep(time.Millisecond)
+	}
+	assert.ErrorIs(t, pool.RunIt(
+		NewHoardingCommander(tstcli.CmdQuery), testingTimeout), ErrPoolClosed)
+	assert.NoError(t, <-slow)
+	assert.NoError(t, <-waiting)
+	assert.Equal(t, 1, strings.Count(c.Result(), "\n"))
+	assert.NoError(t, <-drained)
+	assert.Equal(t, PoolReport{Draining: true}, pool.Report())
+}
+
+func TestProcRunnerPool_DrainResize(t *testing.T) {
+	pool, err := NewProcRunnerPool(poolParams(1, 0, nil))
+	assert.NoError(t, err)
+	slow := make(chan error, 1)
+	go func() {
+		slow <- pool.RunIt(NewHoardingCommander(
+			tstcli.CmdSleep+" 500ms"), testingTimeout)
+	}()
+	for pool.Report().Busy == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	c := NewHoardingCommander(tstcli.CmdQuery + " limit 1")
+	waiting := make(chan error, 1)
+	go func() { waiting <- pool.RunIt(c, testingTimeout) }()
+	for pool.Report().Waiting == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	drained := make(chan error, 1)
+	go func() { drained <- pool.Drain(context.Background()) }()
+	for !pool.Report().Draining {
+		time.Sleep(time.Millisecond)
+	}
+
+	// A run already waiting gets a runner made for it, though the pool is
+	// draining.
+	assert.NoError(t, pool.Resize(2))
+	assert.NoError(t, <-waiting)
+	assert.Equal(t, 1, strings.Count(c.Result(), "\n"))
+	assert.NoError(t, <-slow)
+	assert.NoError(t, <-drained)
+}
+
+func TestProcRunnerPool_DrainCanceled(t *testing.T) {
+	pool, err := NewProcRunnerPool(poolParams(1, 0, nil))
+	assert.NoError(t, err)
+	slow := make(chan error, 1)
+	go func() {
+		slow <- pool.RunIt(NewHoardingCommander(
+			tstcli.CmdSleep+" 200ms"), testingTimeout)
+	}()
+	for pool.Report().Busy == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, pool.Drain(ctx), context.DeadlineExceeded)
+	// The run under way still finishes; then its runner is closed.
+	assert.NoError(t, <-slow)
+	assert.Equal(t, 0, pool.Report().Size)
+}
+
+func TestProcRunnerPool_Resize(t *testing.T) {
+	pool, err := NewProcRunnerPool(poolParams(1, 0, nil))
+	assert.NoError(t, err)
+	defer pool.Close()
+	assert.EqualError(t, pool.Resize(0), "MaxSize 0 must be positive")
+
+	// Runs waiting for a runner get new ones when the pool grows.
+	slow := make(chan error, 1)
+	go func() {
+		slow <- pool.RunIt(NewHoardingCommander(
+			tstcli.CmdSleep+" 300ms"), testingTimeout)
+	}()
+	for pool.Report().Busy == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	waiting := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			waiting <- pool.RunIt(NewHoardingCommander(
+				tstcli.CmdQuery+" limit 1"), testingTimeout)
+		}()
+	}
+	for pool.Report().Waiting < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.NoError(t, pool.Resize(3))
+	assert.NoError(t, <-waiting)
+	assert.NoError(t, <-waiting)
+	assert.Equal(t, 3, pool.Report().Size)
+
+	// When it shrinks, idle runners are closed at once, and busy ones as
+	// their runs finish.
+	assert.NoError(t, pool.Resize(1))
+	assert.Equal(t, PoolReport{Size: 1, Busy: 1}, pool.Report())
+	assert.NoError(t, <-slow)
+	assert.Equal(t, PoolReport{Size: 1, Idle: 1}, pool.Report())
+}
@@ -0,0 +1,362 @@
+package clirunner
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/monopole/clirunner/cmdrs"
+)
+
+// probeValue is what candidate sentinel commands try to print.
+const probeValue = "clirunnerProbeOk"
+
+// probeBogusCommand is a command no CLI should know, used to find an
+// error sentinel.
+const probeBogusCommand = "clirunnerNoSuchCommand"
+
+// SentinelCandidate is a candidate sentinel command for Probe.
+type SentinelCandidate struct {
+	// Command should make the CLI print Value on stdOut.
+	Command string
+	// Value is what to look for.
+	Value string
+}
+
+// DefaultSentinelCandidates are the sentinel commands Probe tries by
+// default, covering common shells, SQL clients and interpreters.
+var DefaultSentinelCandidates = []SentinelCandidate{
+	{Command: "echo " + probeValue, Value: probeValue},
+	{Command: "print " + probeValue, Value: probeValue},
+	{Command: "puts " + probeValue, Value: probeValue},
+	{Command: "select '" + probeValue + "'", Value: probeValue},
+	{Command: "print('" + probeValue + "')", Value: probeValue},
+	{Command: `\! echo ` + probeValue, Value: probeValue},
+}
+
+// DefaultProbeTerminators are the command terminators Probe tries by
+// default, where 0 means none.
+var DefaultProbeTerminators = []byte{0, ';'}
+
+// ProbeOptions controls Probe.  Zero values get defaults.
+type ProbeOptions struct {
+	// Candidates are the sentinel commands to try.
+	Candidates []SentinelCandidate
+	// Terminators are the command terminators to try with each candidate.
+	Terminators []byte
+	// Trials is how many times to run each candidate, to measure latency.
+	Trials int
+	// TimeOut limits the wait for each trial, and for the CLI to go quiet
+	// after starting.
+	TimeOut time.Duration
+}
+
+// ProbeResult reports on one candidate sentinel and terminator.
+type ProbeResult struct {
+	Candidate  SentinelCandidate
+	Terminator byte
+	// RoundTrip is the mean time from issuing the command to seeing the
+	// value, if the candidate worked.
+	RoundTrip time.Duration
+	// Err says why the candidate didn't work, if it didn't.
+	Err error
+}
+
+// ProbeReport is what Probe learned about a CLI.
+type ProbeReport struct {
+	// Prompt is any unterminated output the CLI left after starting up,
+	// presumably a prompt.  If not empty, consider disabling the prompt, as
+	// it will prefix the output of every command.
+	Prompt string
+	// Results holds a result for every candidate and terminator tried.
+	Results []ProbeResult
+	// Recommended is a copy of the Parameters given to Probe, with the
+	// fastest working sentinel and its terminator, and an ErrSentinel if
+	// the CLI reliably complains on stdErr about unknown commands.
+	Recommended *Parameters
+}
+
+// Probe starts the CLI described by the Path, Args, WorkingDir and
+// ErrPrefix of the given Parameters, tries candidate sentinel commands
+// and terminators, measures their round trip latency, and recommends
+// Parameters.  Each candidate is tried in its own CLI subprocess, all
+// at once.  The opts may be nil.
+//
+// An error is returned if the CLI can't be started, or if no candidate
+// works; the report is returned regardless.
+func Probe(params *Parameters, opts *ProbeOptions) (*ProbeReport, error) {
+	if params == nil || params.Path == "" {
+		return nil, fmt.Errorf("must specify a Path")
+	}
+	o := ProbeOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if len(o.Candidates) == 0 {
+		o.Candidates = DefaultSentinelCandidates
+	}
+	if len(o.Terminators) == 0 {
+		o.Terminators = DefaultProbeTerminators
+	}
+	if o.Trials < 1 {
+		o.Trials = 3
+	}
+	if o.TimeOut == 0 {
+		o.TimeOut = defaultSentinelDuration
+	}
+	report := &ProbeReport{}
+
+	// Start one to see if it starts, and look for a prompt.
+	ps, err := startProbeSession(params)
+	if err != nil {
+		return report, err
+	}
+	report.Prompt = strings.TrimSpace(ps.awaitQuiet(o.TimeOut))
+	ps.close()
+
+	for _, t := range o.Terminators {
+		for _, c := range o.Candidates {
+			report.Results = append(
+				report.Results, ProbeResult{Candidate: c, Terminator: t})
+		}
+	}
+	var wg sync.WaitGroup
+	for i := range report.Results {
+		wg.Add(1)
+		go func(r *ProbeResult) {
+			defer wg.Done()
+			r.RoundTrip, r.Err = probeCandidate(
+				params, &o, r.Candidate, r.Terminator)
+		}(&report.Results[i])
+	}
+	wg.Wait()
+
+	var best *ProbeResult
+	for i := range report.Results {
+		r := &report.Results[i]
+		if r.Err == nil && (best == nil || r.RoundTrip < best.RoundTrip) {
+			best = r
+		}
+	}
+	if best == nil {
+		return report, fmt.Errorf("no candidate sentinel worked")
+	}
+	rec := params.copy()
+	rec.OutStrategy = nil
+	rec.OutSentinel = &cmdrs.SimpleSentinelCommander{
+		Command: best.Candidate.Command, Value: best.Candidate.Value}
+	rec.CommandTerminator = best.Terminator
+	rec.ErrStrategy = nil
+	rec.ErrSentinel = nil
+	if v, ok := probeErrSentinel(params, &o, best.Terminator); ok {
+		rec.ErrSentinel = &cmdrs.SimpleSentinelCommander{
+			Command: probeBogusCommand, Value: v}
+	}
+	report.Recommended = rec
+	return report, nil
+}
+
+// probeCandidate runs the candidate repeatedly in a fresh subprocess,
+// returning the mean round trip time.
+func probeCandidate(
+	params *Parameters, o *ProbeOptions,
+	c SentinelCandidate, t byte) (time.Duration, error) {
+	ps, err := startProbeSession(params)
+	if err != nil {
+		return 0, err
+	}
+	defer ps.close()
+	ps.awaitQuiet(o.TimeOut)
+	cmd := assureCmdLineTermination([]byte(c.Command), t)
+	var total time.Duration
+	for i := 0; i < o.Trials; i++ {
+		start := time.Now()
+		if _, err = io.WriteString(ps.stdIn, cmd); err != nil {
+			return 0, fmt.Errorf("writing %q; %w", cmd, err)
+		}
+		_, err = ps.awaitOutLine(c.Value, c.Command, o.TimeOut)
+		if err != nil {
+			return 0, err
+		}
+		total += time.Since(start)
+	}
+	return total / time.Duration(o.Trials), nil
+}
+
+// probeErrSentinel sends a bogus command twice, and if the CLI complains
+// the same way on stdErr both times, returns the complaint.
+func probeErrSentinel(
+	params *Parameters, o *ProbeOptions, t byte) (string, bool) {
+	ps, err := startProbeSession(params)
+	if err != nil {
+		return "", false
+	}
+	defer ps.close()
+	ps.awaitQuiet(o.TimeOut)
+	cmd := assureCmdLineTermination([]byte(probeBogusCommand), t)
+	var lines [2]string
+	for i := range lines {
+		if _, err = io.WriteString(ps.stdIn, cmd); err != nil {
+			return "", false
+		}
+		if lines[i], err = ps.awaitErrLine(o.TimeOut); err != nil {
+			return "", false
+		}
+	}
+	if lines[0] == "" || lines[0] != lines[1] {
+		return "", false
+	}
+	return params.ErrPrefix + lines[0], true
+}
+
+// probeSession is a bare CLI subprocess, without sentinels.
+type probeSession struct {
+	cmd     *exec.Cmd
+	stdIn   io.WriteCloser
+	chOut   chan []byte // raw chunks of stdOut
+	chErr   chan string // lines of stdErr
+	pending []byte      // stdOut not yet consumed
+}
+
+func startProbeSession(params *Parameters) (*probeSession, error) {
+	ps := &probeSession{
+		cmd:   exec.Command(params.Path, params.Args...),
+		chOut: make(chan []byte, 100),
+		chErr: make(chan string, 100),
+	}
+	ps.cmd.Dir = params.WorkingDir
+	var err error
+	if ps.stdIn, err = ps.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	out, err := ps.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	errPipe, err := ps.cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = ps.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("trying to start %s - %w", params.Path, err)
+	}
+	go func() {
+		defer close(ps.chOut)
+		for {
+			buf := make([]byte, 4096)
+			n, err := out.Read(buf)
+			if n > 0 {
+				ps.chOut <- buf[:n]
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		defer close(ps.chErr)
+		s := bufio.NewScanner(errPipe)
+		for s.Scan() {
+			ps.chErr <- s.Text()
+		}
+	}()
+	return ps, nil
+}
+
+// awaitQuiet consumes stdOut until none arrives for a moment, or the
+// given duration passes, returning any unterminated final line.
+func (ps *probeSession) awaitQuiet(d time.Duration) string {
+	const quiet = 250 * time.Millisecond
+	deadline := time.After(d)
+	for {
+		select {
+		case chunk, ok := <-ps.chOut:
+			if !ok {
+				return ""
+			}
+			ps.pending = append(ps.pending, chunk...)
+		case <-time.After(quiet):
+			return ps.dropLines()
+		case <-deadline:
+			return ps.dropLines()
+		}
+	}
+}
+
+// dropLines discards complete lines of pending stdOut, returning the rest.
+func (ps *probeSession) dropLines() string {
+	if i := bytes.LastIndexByte(ps.pending, lineFeed); i >= 0 {
+		ps.pending = ps.pending[i+1:]
+	}
+	return string(ps.pending)
+}
+
+// awaitOutLine consumes stdOut until a line containing the value shows up.
+// Lines containing the command are skipped, in case the CLI echoes its
+// input.
+func (ps *probeSession) awaitOutLine(
+	value, command string, d time.Duration) (string, error) {
+	deadline := time.After(d)
+	for {
+		for {
+			i := bytes.IndexByte(ps.pending, lineFeed)
+			if i < 0 {
+				break
+			}
+			line := string(ps.pending[:i])
+			ps.pending = ps.pending[i+1:]
+			if strings.Contains(line, value) &&
+				!strings.Contains(line, command) {
+				return line, nil
+			}
+		}
+		select {
+		case chunk, ok := <-ps.chOut:
+			if !ok {
+				return "", fmt.Errorf("stdOut closed before %q seen", value)
+			}
+			ps.pending = append(ps.pending, chunk...)
+		case <-deadline:
+			return "", fmt.Errorf("%q not seen within %s", value, d)
+		}
+	}
+}
+
+// awaitErrLine returns the next line from stdErr.
+func (ps *probeSession) awaitErrLine(d time.Duration) (string, error) {
+	select {
+	case line, ok := <-ps.chErr:
+		if !ok {
+			return "", fmt.Errorf("stdErr closed")
+		}
+		return line, nil
+	case <-time.After(d):
+		return "", fmt.Errorf("nothing on stdErr within %s", d)
+	}
+}
+
+// close ends the subprocess, killing it if it doesn't exit on EOF.
+func (ps *probeSession) close() {
+	_ = ps.stdIn.Close()
+	done := make(chan struct{})
+	go func() {
+		// Drain, so the readers finish and Wait can return.
+		for range ps.chOut {
+		}
+		for range ps.chErr {
+		}
+		_ = ps.cmd.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		_ = ps.cmd.Process.Kill()
+		<-done
+	}
+}
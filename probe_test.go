@@ -0,0 +1,81 @@
+package clirunner_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/monopole/clirunner/internal/testcli/tstcli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbe(t *testing.T) {
+	params := &Parameters{
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+	}
+	report, err := Probe(params, &ProbeOptions{TimeOut: time.Second})
+	assert.NoError(t, err)
+	assert.Equal(t, "", report.Prompt)
+	assert.Len(t, report.Results,
+		len(DefaultSentinelCandidates)*len(DefaultProbeTerminators))
+	for _, r := range report.Results {
+		if r.Candidate.Command == DefaultSentinelCandidates[0].Command {
+			// The testcli knows echo, with or without ';'.
+			assert.NoError(t, r.Err)
+			assert.Greater(t, int64(r.RoundTrip), int64(0))
+		}
+	}
+	rec := report.Recommended
+	if !assert.NotNil(t, rec) {
+		t.FailNow()
+	}
+	assert.Equal(t, tstcli.CmdQuit, rec.ExitCommand)
+	assert.NotNil(t, rec.OutSentinel)
+	assert.NotNil(t, rec.ErrSentinel)
+
+	// The recommendation works.
+	runner, err := NewProcRunner(rec)
+	assert.NoError(t, err)
+	commander := NewHoardingCommander(tstcli.CmdEcho + " hello")
+	assert.NoError(t, runner.RunIt(commander, testingTimeout))
+	assert.Equal(t, "hello\n", commander.Result())
+	assert.NoError(t, runner.Close())
+}
+
+func TestProbe_prompt(t *testing.T) {
+	report, err := Probe(&Parameters{
+		Path: tstcli.TestCliPath,
+	}, &ProbeOptions{
+		Candidates: DefaultSentinelCandidates[:1],
+		Trials:     1,
+		TimeOut:    time.Second,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "hey<1>", report.Prompt)
+}
+
+func TestProbe_nothingWorks(t *testing.T) {
+	report, err := Probe(&Parameters{
+		Path: tstcli.TestCliPath,
+		Args: []string{"--" + tstcli.FlagDisablePrompt},
+	}, &ProbeOptions{
+		Candidates:  []SentinelCandidate{{Command: "bogus", Value: "nope"}},
+		Terminators: []byte{0},
+		Trials:      1,
+		TimeOut:     200 * time.Millisecond,
+	})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "no candidate sentinel worked")
+	}
+	assert.Nil(t, report.Recommended)
+	assert.Len(t, report.Results, 1)
+	assert.Error(t, report.Results[0].Err)
+}
+
+func TestProbe_badPath(t *testing.T) {
+	_, err := Probe(&Parameters{Path: nonexistentCommandPath}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,122 @@
+package clirunner
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// process is the CLI as a ProcRunner sees it: normally a subprocess, but
+// a simulation in a Harness.
+type process interface {
+	// pipes returns the CLI's streams.  Call it before start.
+	pipes() (stdIn io.WriteCloser, stdOut, stdErr io.ReadCloser, err error)
+	// extraPipes returns the CLI's ExtraStreams, in order.  Call it before
+	// start.
+	extraPipes() ([]io.ReadCloser, error)
+	// start starts the CLI.
+	start() error
+	// started returns true if start succeeded.
+	started() bool
+	// wait waits for the CLI to exit, once its streams are drained.
+	wait() error
+	// signal sends the CLI a signal.
+	signal(sig os.Signal) error
+	// kill ends the CLI at once.
+	kill() error
+	// watchExit returns a channel closed when the CLI exits, or nil.
+	watchExit() <-chan struct{}
+	// String describes the CLI, for debugging.
+	String() string
+}
+
+// consoleProcess is a subprocess attached to a console of its own, e.g. a
+// Windows pseudo console, whose pipes are the console's.
+type consoleProcess interface {
+	process
+	console()
+}
+
+// spawnFunc makes a process per the Parameters, not yet started.
+type spawnFunc func(p *Parameters) process
+
+// execProcess is a CLI subprocess.
+type execProcess struct {
+	cmd *exec.Cmd
+	// extras is the number of ExtraStreams.
+	extras int
+}
+
+// newExecProcess returns a subprocess per the Parameters, not yet started.
+func newExecProcess(p *Parameters) process {
+	if proc, ok := newConsoleProcess(p); ok {
+		return proc
+	}
+	cmd := exec.Command(p.Path, p.Args...)
+	cmd.Dir = p.WorkingDir
+	cmd.Env = p.environ()
+	return &execProcess{cmd: cmd, extras: len(p.ExtraStreams)}
+}
+
+func (p *execProcess) pipes() (
+	stdIn io.WriteCloser, stdOut, stdErr io.ReadCloser, err error) {
+	if stdIn, err = p.cmd.StdinPipe(); err != nil {
+		return nil, nil, nil, fmt.Errorf("getting stdIn; %w", err)
+	}
+	if stdOut, err = p.cmd.StdoutPipe(); err != nil {
+		return nil, nil, nil, fmt.Errorf("getting stdOut; %w", err)
+	}
+	if stdErr, err = p.cmd.StderrPipe(); err != nil {
+		return nil, nil, nil, fmt.Errorf("getting stdErr; %w", err)
+	}
+	return stdIn, stdOut, stdErr, nil
+}
+
+// extraPipes makes a pipe per ExtraStream, handing the CLI the writing
+// ends, which start closes here once the CLI has its own copies.
+func (p *execProcess) extraPipes() ([]io.ReadCloser, error) {
+	var result []io.ReadCloser
+	for i := 0; i < p.extras; i++ {
+		r, w, err := os.Pipe()
+		if err != nil {
+			for _, rc := range result {
+				_ = rc.Close()
+			}
+			p.closeExtraFiles()
+			return nil, fmt.Errorf("getting extra stream %d; %w", i, err)
+		}
+		result = append(result, r)
+		p.cmd.ExtraFiles = append(p.cmd.ExtraFiles, w)
+	}
+	return result, nil
+}
+
+// closeExtraFiles closes the writing ends of the ExtraStreams.
+func (p *execProcess) closeExtraFiles() {
+	for _, f := range p.cmd.ExtraFiles {
+		_ = f.Close()
+	}
+	p.cmd.ExtraFiles = nil
+}
+
+func (p *execProcess) start() error {
+	defer p.closeExtraFiles()
+	return p.cmd.Start()
+}
+
+func (p *execProcess) started() bool { return p.cmd.Process != nil }
+
+func (p *execProcess) wait() error { return p.cmd.Wait() }
+
+func (p *execProcess) signal(sig os.Signal) error {
+	return p.cmd.Process.Signal(sig)
+}
+
+func (p *execProcess) kill() error { return p.cmd.Process.Kill() }
+
+func (p *execProcess) watchExit() <-chan struct{} {
+	return watchExit(p.cmd.Process.Pid)
+}
+
+func (p *execProcess) String() string { return p.cmd.String() }
@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package clirunner
+
+import "syscall"
+
+// defaultLineEnding is the LineEnding CLIs expect.
+const defaultLineEnding = LineEndingLF
+
+// terminate asks a process to exit.
+func terminate(p process) error { return p.signal(syscall.SIGTERM) }
+
+// newConsoleProcess returns false, as a pty is set up by the runner.
+func newConsoleProcess(*Parameters) (process, bool) { return nil, false }
@@ -0,0 +1,16 @@
+//go:build windows
+// +build windows
+
+package clirunner
+
+import "errors"
+
+// defaultLineEnding is the LineEnding Windows CLIs expect.
+const defaultLineEnding = LineEndingCRLF
+
+// errNoTerminate says a process can't be asked to exit on Windows, which
+// has no SIGTERM, only killed.
+var errNoTerminate = errors.New("processes can't be asked to terminate on windows")
+
+// terminate asks a process to exit, which Windows can't do.
+func terminate(process) error { return errNoTerminate }
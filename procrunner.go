@@ -1,14 +1,15 @@
 package clirunner
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/monopole/clirunner/cmdrs"
@@ -42,7 +43,9 @@ import (
 // output are the only option for generating a sentinel.  Also, some prompts
 // might not be unambiguously distinguishable in several thousand lines of data,
 // so it's best to use a sentinel command rather than rely on a prompt to
-// signal command completion.
+// signal command completion.  If a prompt must do, make its sentinel with
+// cmdrs.NewPromptSentinel, which checks that the prompt is plausibly
+// unambiguous.
 //
 // If the ProcRunner is prepared with a sentinel command, it will automatically
 // issue the command inside the call to RunIt, immediately after issuing the
@@ -54,31 +57,48 @@ import (
 //
 type ProcRunner struct {
 	params      *Parameters     // specifics about a particular CLI
-	cmd         *exec.Cmd       // the CLI subprocess
+	proc        process         // the CLI subprocess
+	spawn       spawnFunc       // makes the CLI subprocess
 	stdIn       io.WriteCloser  // the CLI's input stream
-	outScanner  *bufio.Scanner  // scans the CLI's standard output
-	errScanner  *bufio.Scanner  // scans the CLI's error output
+	outScanner  *lineScanner    // scans the CLI's standard output
+	errScanner  *lineScanner    // scans the CLI's error output
+	extras      []io.ReadCloser // the CLI's ExtraStreams
 	chOut       chan []byte     // lines from stdOut
 	chErr       chan []byte     // lines from stdErr
 	infraErrors *errorTracker   // multiple threads can generate errors
 	mutexState  sync.Mutex      // protect the ProcRunner state
 	filter      *sentinelFilter // runs commands and watches for sentinels
-}
-
-type runnerState int
-
-type logSink struct{}
-
-var DebugMode = false
+	logger      *log.Logger     // debug output for this runner
+	lineLogger  *log.Logger     // debug output about lines of output
+	verbosity   *verbosityLevel // how much debug output; shared with any standby
+	history     *runHistory     // run reports and statistics
+	exited      chan struct{}   // closed when the subprocess exits
+	standby     *ProcRunner     // warm standby, if Parameters ask for one
+	sentinelMu  *sync.Mutex     // guards sentinels, shared with any standby
+	startup     *StartReport    // report on the current subprocess' start
+	pty         *os.File        // controlling end of the CLI's terminal, if any
+	tty         *os.File        // the CLI's terminal, until the CLI starts
+	framing     *framingSlot    // the current run's payload framing
+	responses   *responseSlot   // the current run's Responses
+	secrets     *redactor       // kept out of logs, reports and errors
+	discard     *discardSlot    // the current run's discarding, if any
+	pieces      *pieceMarks     // continued pieces of split lines
+	stamps      *lineStamps     // lines read, as numbered and timed
+	queue       runQueue        // runs waiting their turn
+	flights     flights         // shared runs waiting their turn
+	isStandby   bool            // a warm standby, not supervised itself
+	leaving     process         // the subprocess the runner is ending
+	restarts    int32           // supervised relaunches in a row; atomic
+	relaunches  []time.Time     // recent supervised relaunches, per RestartBudget
+	idle        idleCountdown   // to shutting down per IdleTimeout
+	keepalive   idleCountdown   // to the next Keepalive probe
+	auth        *authWatch      // the current subprocess' login, if any
 
-func (l logSink) Write(p []byte) (n int, err error) {
-	if DebugMode {
-		return fmt.Fprint(os.Stderr, string(p))
-	}
-	return 0, nil
+	// subSessions holds the entered SubSessions, innermost last.
+	subSessions []*enclosingSession
 }
 
-var logger = log.New(&logSink{}, "DEBUG: ", log.Ldate|log.Ltime|log.Lshortfile)
+type runnerState int
 
 const (
 	// Construction parameters are okay, but no subprocess running.
@@ -96,10 +116,26 @@ const (
 
 	// Unrecoverable error, e.g. subprocess timed out on last command and
 	// might be hung.
-	// Cannot change to another state; the ProcRunner no longer usable.
+	// Can change to stateUninitialized only via Restart; the subprocess is
+	// no longer usable.
 	stateError
 )
 
+func (s runnerState) String() string {
+	switch s {
+	case stateUninitialized:
+		return "uninitialized"
+	case stateIdle:
+		return "idle"
+	case stateRunning:
+		return "running"
+	case stateError:
+		return "error"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
 // lastError reports the most recent error.
 func (pr *ProcRunner) lastError() error {
 	return pr.infraErrors.lastError()
@@ -109,7 +145,7 @@ func (pr *ProcRunner) getState() runnerState {
 	if pr.lastError() != nil {
 		return stateError
 	}
-	if pr.cmd == nil {
+	if pr.proc == nil || pr.subprocessExited() {
 		return stateUninitialized
 	}
 	if pr.filter.isRunning() {
@@ -125,21 +161,82 @@ func (pr *ProcRunner) enterStateError(err error) {
 	pr.infraErrors.log(err)
 }
 
-func (pr *ProcRunner) enterStateUninitialized() {
-	pr.cmd = nil
+// subprocessExited returns true if the subprocess exited, which puts the
+// runner in stateUninitialized.  It's told by the exited channel, rather
+// than by the goroutine awaiting the exit clearing proc, so that proc is
+// only touched with mutexState held.  The channel follows the subprocess
+// if it's taken over by another runner (see failover).
+func (pr *ProcRunner) subprocessExited() bool {
+	select {
+	case <-pr.exited:
+		return true
+	default:
+		return false
+	}
 }
 
 // NewProcRunner returns a new ProcRunner, or an error on bad parameters.
 func NewProcRunner(params *Parameters) (*ProcRunner, error) {
-	logger.Println("creating new ProcRunner")
 	if err := params.Validate(); err != nil {
 		return nil, err
 	}
-	return &ProcRunner{
-		params: params,
-		filter: makeSentinelFilter(
-			params.OutSentinel, params.ErrSentinel, params.CommandTerminator),
-	}, nil
+	pr := &ProcRunner{
+		history:    newRunHistory(),
+		sentinelMu: &sync.Mutex{},
+		framing:    &framingSlot{},
+		responses:  &responseSlot{},
+		secrets:    &redactor{},
+		discard:    &discardSlot{},
+		pieces:     &pieceMarks{},
+		stamps:     &lineStamps{},
+		spawn:      newExecProcess,
+		verbosity:  &verbosityLevel{},
+	}
+	pr.setParams(params)
+	pr.verbosity.set(params.Verbosity)
+	pr.logger.Printf("created new ProcRunner %q\n", pr.params.Name)
+	return pr, nil
+}
+
+// Name returns the runner's name, from Parameters.
+func (pr *ProcRunner) Name() string {
+	return pr.params.Name
+}
+
+// setParams installs a copy of the given (validated) parameters, since some
+// can change over the runner's life, and configures the filter to match.
+func (pr *ProcRunner) setParams(params *Parameters) {
+	pr.params = params.copy()
+	pr.secrets.add(params.Secrets...)
+	var w, lw io.Writer
+	if params.DebugWriter != nil {
+		rw := &redactingWriter{w: params.DebugWriter, r: pr.secrets}
+		w = &gatedWriter{w: rw, level: pr.verbosity, min: VerbosityCommands}
+		lw = &gatedWriter{w: rw, level: pr.verbosity, min: VerbosityLines}
+	}
+	pr.logger = newDebugLogger(w)
+	pr.lineLogger = newDebugLogger(lw)
+	out, es := params.strategies()
+	pr.filter = makeSentinelFilter(out, es, params.CommandTerminator)
+	pr.filter.emptyPolicy = params.EmptyCommandPolicy
+	pr.filter.errPrefix = []byte(params.ErrPrefix)
+	pr.filter.phaseCmdr = params.SentinelPhaseCommander
+	pr.filter.check = params.OutputCheck
+	pr.filter.limit = params.OutputLimit
+	pr.filter.sampling = params.LineSampling
+	pr.filter.spoolMemory = params.SpoolMemory
+	pr.filter.spoolDir = params.SpoolDir
+	pr.filter.errPolicy = params.ErrSentinelPolicy
+	pr.filter.tailSize = params.tailLines()
+	pr.filter.fatal = params.FatalLinePatterns
+	pr.filter.truncation = params.TruncationPatterns
+	pr.filter.failOnTruncation = params.FailOnTruncation
+	pr.filter.logger = pr.logger
+	pr.filter.lineLogger = pr.lineLogger
+	pr.filter.clock = clockOrReal(params.Clock)
+	pr.filter.discard = pr.discard
+	pr.filter.pieces = pr.pieces
+	pr.filter.stamps = pr.stamps
 }
 
 // RunIgnoringOutput runs the given command ignoring its output.
@@ -150,6 +247,12 @@ func (pr *ProcRunner) RunIgnoringOutput(c string) error {
 
 // RunIt runs the given Commander in the given duration.
 //
+// If something is already running, e.g. RunIt called from another goroutine,
+// the command waits its turn, behind any others already waiting; the
+// duration limits the command's run, not its wait.  With
+// Parameters.CoalesceReadOnly, a read-only command waiting alongside a run
+// of the same command shares that run instead; see ReadOnlyMarker.
+//
 // RunIt blocks until the command completes, or the duration passes. After a
 // call to RunIt returns, with or without an error, the Commander may be
 // consulted for data it accumulated. If RunIt returned an error, the Commander
@@ -163,82 +266,423 @@ func (pr *ProcRunner) RunIgnoringOutput(c string) error {
 // the rare case that it (the Commander) determines that the subprocess should
 // no longer be used by itself or any other Commander.
 //
-// If RunIt returns an error, then the ProcRunner should be abandoned.
-// There's no general way to interrupt and "fix" a subprocess.
+// If RunIt returns an error, then the subprocess should be abandoned.
+// There's no general way to interrupt and "fix" a subprocess, unless
+// Parameters ask for an interrupt or a warm standby.  Call Restart to
+// start over with a new subprocess.
 func (pr *ProcRunner) RunIt(cmdr Commander, timeOut time.Duration) error {
+	return pr.run(context.Background(), cmdr, timeOut, nil)
+}
+
+// RunContext is like RunIt, but the command's time limit comes from the
+// context's deadline, if it has one, rather than the default timeout.
+// The deadline covers any wait for the command's turn too.
+//
+// If the context is canceled before the command completes, RunContext
+// returns a RunCanceledError whose Cause is the context's error, and the
+// Commander holds every line of output that arrived before cancellation.
+// If Parameters ask for an interrupt, the command is interrupted and, if the
+// CLI recovers, the ProcRunner remains usable.  Otherwise the command can't
+// be stopped without stopping the CLI, so the subprocess is killed and the
+// ProcRunner enters the error state (and fails over to a warm standby, if
+// there is one, on the next run).
+func (pr *ProcRunner) RunContext(ctx context.Context, cmdr Commander) error {
+	return pr.run(ctx, cmdr, 0, nil)
+}
+
+// run does the work of RunIt, RunContext and Stream.  If tap isn't nil,
+// it gets the lines of output as they arrive.
+func (pr *ProcRunner) run(ctx context.Context,
+	cmdr Commander, timeOut time.Duration, tap *lineQueue) (err error) {
+	defer func() { err = pr.secrets.redactErr(err) }()
+	if cmdr == nil {
+		return fmt.Errorf("provide a Commander")
+	}
+	if err := ctx.Err(); err != nil {
+		return &RunCanceledError{Command: cmdr.String(), Cause: err}
+	}
+	if tap == nil && pr.params.CoalesceReadOnly && readOnly(cmdr) {
+		return pr.runShared(ctx, cmdr, timeOut)
+	}
+	return pr.runTurn(ctx, cmdr, timeOut, tap, nil)
+}
+
+// runTurn does the work of run once the Commander is known to need a run
+// of its own: it waits for the run's turn, calling onTurn, if not nil,
+// when the turn comes, and runs the Commander.
+func (pr *ProcRunner) runTurn(ctx context.Context, cmdr Commander,
+	timeOut time.Duration, tap *lineQueue, onTurn func()) error {
+	if err := pr.queue.enter(ctx); err != nil {
+		return &RunCanceledError{Command: cmdr.String(), Cause: err}
+	}
+	defer pr.queue.leave()
+	if onTurn != nil {
+		onTurn()
+	}
+	defer pr.armIdleTimers()
+	timeOut = timeoutFor(cmdr, timeOut)
+	if p := continuerOf(cmdr); p != nil {
+		return pr.runPages(ctx, cmdr, p, timeOut, tap)
+	}
+	return pr.runPage(ctx, cmdr, timeOut, tap)
+}
+
+// runPage does the work of run for one command.
+func (pr *ProcRunner) runPage(ctx context.Context,
+	cmdr Commander, timeOut time.Duration, tap *lineQueue) error {
+	endTrace := pr.startTrace(ctx, cmdr, timeOut)
+	start := pr.filter.clock.Now()
+	sink := pr.openSink(cmdr, start)
+	ran, err := pr.runIt(ctx, cmdr, timeOut, tap, sink)
+	if err == nil {
+		atomic.StoreInt32(&pr.restarts, 0)
+	}
+	var r RunReport
+	if ran {
+		r = pr.recordRun(cmdr, start, err)
+	} else {
+		r = RunReport{Command: pr.secrets.redact(cmdr.String()),
+			Start: start, Duration: pr.filter.clock.Now().Sub(start),
+			Err: pr.secrets.redactErr(err)}
+	}
+	pr.closeSink(sink, r)
+	endTrace(r)
+	return err
+}
+
+// runIt does the work of run, returning true if the command was actually
+// sent to the CLI, as opposed to being rejected up front.
+func (pr *ProcRunner) runIt(ctx context.Context, cmdr Commander,
+	timeOut time.Duration, tap *lineQueue, sink SinkWriter) (ran bool, err error) {
 	// Don't defer the 'Unlock' call corresponding to this Lock.
 	// We must unlock well before exiting this function because we intend to run
 	// a potentially long-running command.
-	logger.Printf("beginning RunIt for command %q\n", cmdr.String())
+	pr.logger.Printf("beginning RunIt for command %q\n", cmdr.String())
 	pr.mutexState.Lock()
+	if pr.getState() == stateError && pr.standby != nil {
+		if err = pr.failover(); err != nil {
+			pr.logger.Printf("failover failed: %s\n", err.Error())
+		}
+	}
 	switch pr.getState() {
 	case stateError:
-		logger.Println("entering state error")
+		pr.logger.Println("entering state error")
+		var be *RestartBudgetExhaustedError
+		exhausted := errors.As(pr.lastError(), &be)
 		pr.mutexState.Unlock()
-		return fmt.Errorf("subprocess in error state, cannot recover")
+		if exhausted {
+			return false, be
+		}
+		return false, fmt.Errorf("subprocess in error state, cannot recover")
 	case stateRunning:
-		logger.Println("already running")
+		pr.logger.Println("already running")
 		pr.mutexState.Unlock()
-		return fmt.Errorf("already running something")
+		return false, fmt.Errorf("already running something")
 	case stateUninitialized:
-		logger.Println("in state uninitialized")
-		if err := pr.startSubprocess(); err != nil {
+		pr.logger.Println("in state uninitialized")
+		if err = pr.launch(); err != nil {
 			pr.enterStateError(err)
 			pr.mutexState.Unlock()
-			return err
+			return false, err
 		}
+		pr.prepareStandby()
 		// immediately enter stateIdle and do the run
 		fallthrough
 	case stateIdle:
-		logger.Println("in state idle, starting run")
-		if cmdr == nil {
-			pr.mutexState.Unlock()
-			return fmt.Errorf("provide a Commander")
-		}
+		pr.logger.Println("in state idle, starting run")
 		// enter stateRunning
-		logger.Println("entering state running")
-		_, err := pr.filter.BeginRun(cmdr, pr.stdIn)
+		pr.logger.Println("entering state running")
+		pr.sentinelMu.Lock()
+		// settle, if set, changes the runner's state once the run is over.
+		// It's run with mutexState held, after the sentinels are free, as
+		// mutexState is taken before sentinelMu.  It's skipped if the
+		// subprocess is no longer the runner's, e.g. after a Close.
+		var settle func()
+		proc, stdIn := pr.proc, pr.stdIn
+		defer func() {
+			pr.sentinelMu.Unlock()
+			if settle == nil {
+				return
+			}
+			pr.mutexState.Lock()
+			defer pr.mutexState.Unlock()
+			if pr.proc == proc {
+				settle()
+			}
+		}()
+		pr.framing.set(framingFor(cmdr))
+		defer pr.framing.set(nil)
+		pr.responses.set(responsesFor(cmdr))
+		defer pr.responses.set(nil)
+		_, err = pr.filter.BeginRun(cmdr, pr.stdIn)
 		pr.mutexState.Unlock()
 		if err != nil {
-			return err
+			return false, err
+		}
+		if tap != nil {
+			filter := pr.filter
+			filter.setTap(tap)
+			defer filter.setTap(nil)
+			tap.start()
+		}
+		if sink != nil {
+			filter := pr.filter
+			filter.setSink(sink)
+			defer filter.setSink(nil)
 		}
 		// The following call should consume no more than "timeOut" wall clock time.
-		if err = pr.filter.IssueSentinelsAndFilter(
-			pr.chOut, pr.chErr, timeOut); err != nil {
-			pr.enterStateError(err)
-			return err
+		if err = pr.filter.issueSentinelsAndFilterContext(
+			ctx, pr.chOut, pr.chErr, timeOut); err != nil {
+			var te *sentinelTimeoutError
+			var le *OutputLimitError
+			// An aborted run is handled like one that timed out.
+			timedOut := errors.As(err, &te) ||
+				(errors.As(err, &le) && le.Limit.Policy == OutputLimitAbort)
+			// Only the context cancels a run without expiring or closing.
+			ctxCanceled := errors.Is(err, context.Canceled)
+			if (timedOut || ctxCanceled) && pr.interruptible() {
+				rErr := pr.interruptAndRecover(proc, stdIn)
+				if rErr == nil {
+					if ctxCanceled || le != nil {
+						return true, err
+					}
+					return true, &TimeoutButRecoveredError{
+						Command: cmdr.String(), TimeOut: te.timeOut, Tail: te.tail}
+				}
+				pr.logger.Printf("recovery failed: %s\n", rErr.Error())
+				if timedOut {
+					err = rErr
+				}
+			}
+			if timedOut || ctxCanceled {
+				// Keep the Commander's output as of the deadline.
+				pr.filter.detach()
+			}
+			if ctxCanceled {
+				// Killing the CLI is the only way left to stop the command,
+				// and it ends the filter's goroutines.
+				settle = func() {
+					pr.abandonSubprocess()
+					pr.enterStateError(err)
+				}
+				return true, err
+			}
+			var fe *FatalLineError
+			if errors.As(err, &fe) {
+				settle = func() {
+					pr.abandonSubprocess()
+					if pr.params.RestartOnFatal {
+						pr.logger.Println("fatal line seen, restarting on next run")
+						// As Restart does; the kill is no news.
+						pr.proc = nil
+						pr.infraErrors = nil
+						return
+					}
+					pr.enterStateError(err)
+				}
+				return true, err
+			}
+			var ce *RunCanceledError
+			if errors.As(err, &ce) {
+				// Whoever canceled the run is responsible for the runner's state.
+				return true, err
+			}
+			if isExitError(err) && expectsExit(cmdr) {
+				settle = func() {
+					if pr.exitedCleanly(exitGracePeriod) {
+						err = nil
+						return
+					}
+					pr.enterStateError(err)
+				}
+				return true, err
+			}
+			var me *OutputMismatchError
+			var ee *ExpectationError
+			var se *SpoolError
+			var tre *OutputTruncatedError
+			if errors.As(err, &me) || errors.As(err, &ee) ||
+				errors.As(err, &se) || errors.As(err, &tre) ||
+				le != nil && !timedOut {
+				// The CLI is fine, it's just the output that's suspect.
+				return true, err
+			}
+			settle = func() { pr.enterStateError(err) }
+			return true, err
+		}
+		pr.history.recordReady(pr.startup, pr.filter.clock.Now())
+		if pr.params.ContextTracker != nil && cmdr.Success() {
+			pr.params.ContextTracker.Observe(cmdr.String())
 		}
 		// exit stateRunning, back to stateIdle.
 		// This relies on sentinelFilter working as expected.
-		return nil
+		return true, nil
 	default:
 		pr.mutexState.Unlock()
-		return fmt.Errorf("unknown state %d", pr.getState())
+		return false, fmt.Errorf("unknown state %d", pr.getState())
 	}
 }
 
+// recordRun adds a report on a run to the runner's history, returning it.
+func (pr *ProcRunner) recordRun(
+	cmdr Commander, start time.Time, err error) RunReport {
+	counts := pr.filter.lineCounts()
+	r := RunReport{
+		Command:  pr.secrets.redact(cmdr.String()),
+		Start:    start,
+		Duration: pr.filter.clock.Now().Sub(start),
+		LinesOut: counts.linesOut,
+		LinesErr: counts.linesErr,
+		BytesOut: counts.bytesOut,
+		BytesErr: counts.bytesErr,
+		Success:  cmdr.Success(),
+		Err:      pr.secrets.redactErr(err),
+		// Any error after the command was sent means the sentinels weren't
+		// seen in the normal course of things.
+		Truncated: err != nil,
+		Partial:   isPartial(err),
+		ExitCode:  pr.filter.exitCode,
+		Warnings:  pr.filter.runWarnings(),
+		Phases:    pr.filter.runPhases(start),
+		// The CLI may have said so, however the run ended.
+		OutputTruncated: pr.filter.outputTruncated(),
+	}
+	pr.logger.Printf("run of %q took %s: %s\n", r.Command, r.Duration, r.Phases)
+	pr.history.recordRun(r)
+	if pr.params.RunLogger != nil {
+		pr.params.RunLogger.LogRun(pr.params.Name, r)
+	}
+	return r
+}
+
+// isSentinelTimeout returns true if the error says a run's sentinels didn't
+// show up in time.
+func isSentinelTimeout(err error) bool {
+	var te *sentinelTimeoutError
+	var re *TimeoutButRecoveredError
+	return errors.As(err, &te) || errors.As(err, &re)
+}
+
+// isPartial returns true if the error says a run was cut short by its
+// deadline, by cancellation or by its OutputLimit, rather than by some
+// failure of the CLI.
+func isPartial(err error) bool {
+	var ce *RunCanceledError
+	var le *OutputLimitError
+	return isSentinelTimeout(err) || errors.As(err, &ce) ||
+		(errors.As(err, &le) && le.Limit.Policy == OutputLimitAbort)
+}
+
+// LastRunReport returns a report on the most recent run, and false if
+// nothing has run yet.
+func (pr *ProcRunner) LastRunReport() (RunReport, bool) {
+	return pr.history.lastRun()
+}
+
+// LastStartReport returns a report on the most recent start of the CLI
+// subprocess, and false if it hasn't started yet.  With a warm standby,
+// that's possibly the standby's start.
+func (pr *ProcRunner) LastStartReport() (StartReport, bool) {
+	return pr.history.lastStart()
+}
+
+// Report returns a report on the runner's life so far.
+func (pr *ProcRunner) Report() SessionReport {
+	pr.mutexState.Lock()
+	r := SessionReport{
+		Name:      pr.params.Name,
+		Path:      pr.params.Path,
+		State:     pr.getState().String(),
+		Queued:    pr.queue.length() + pr.flights.length(),
+		LastError: pr.lastError(),
+	}
+	pr.mutexState.Unlock()
+	pr.history.fill(&r)
+	return r
+}
+
+// interruptible returns true if the ProcRunner knows how to interrupt a
+// command.
+func (pr *ProcRunner) interruptible() bool {
+	return pr.params.InterruptSignal != nil || pr.params.InterruptSequence != ""
+}
+
+// interruptAndRecover interrupts a command that failed to finish in time,
+// and waits for its sentinels, returning an error if they don't show up.
+// It's given the run's subprocess and its input, as taken with mutexState
+// held, since a Close may take them from the runner meanwhile.
+func (pr *ProcRunner) interruptAndRecover(
+	proc process, stdIn io.Writer) error {
+	pr.logger.Println("attempting to interrupt command")
+	if pr.params.InterruptSignal != nil {
+		if proc == nil || !proc.started() {
+			return fmt.Errorf("no subprocess to interrupt")
+		}
+		if err := proc.signal(pr.params.InterruptSignal); err != nil {
+			return fmt.Errorf("sending interrupt signal; %w", err)
+		}
+	}
+	if pr.params.InterruptSequence != "" {
+		if _, err := io.WriteString(
+			stdIn, pr.params.InterruptSequence); err != nil {
+			return fmt.Errorf("writing interrupt sequence; %w", err)
+		}
+	}
+	d := pr.params.RecoveryTimeout
+	if d == 0 {
+		d = defaultSentinelDuration
+	}
+	return pr.filter.awaitRecovery(d)
+}
+
 // startSubprocess starts the CLI subprocess, returning an error on any trouble.
 func (pr *ProcRunner) startSubprocess() (err error) {
 	pr.infraErrors = &errorTracker{}
 
-	pr.cmd = exec.Command(pr.params.Path, pr.params.Args...)
-	pr.cmd.Dir = pr.params.WorkingDir
+	// A fresh CLI has a fresh prompt; forget any swapped sentinels, and
+	// any SubSessions.
+	pr.sentinelMu.Lock()
+	err = pr.filter.setSentinels(pr.params.strategies())
+	pr.filter.terminator = pr.params.CommandTerminator
+	pr.subSessions = nil
+	pr.sentinelMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	pr.proc = pr.spawn(pr.params)
 
 	// Set up pipes and buffered scanners.
 	if err = pr.setUpPipesAndScanners(); err != nil {
 		return err
 	}
 
-	logger.Printf("starting subprocess: %q\n", pr.cmd.String())
+	pr.logger.Printf("starting subprocess: %q\n", pr.proc.String())
 
 	// Assure that the subprocess is started without error before
 	// doing anything else.
 	// The I/O pipes for the subprocess are buffered; it can wait.
-	if err = pr.cmd.Start(); err != nil {
+	clock := pr.filter.clock
+	start := clock.Now()
+	err = pr.proc.start()
+	if pr.tty != nil {
+		// The subprocess has its own copy, if it started.
+		_ = pr.tty.Close()
+		pr.tty = nil
+	}
+	if err != nil {
+		if pr.pty != nil {
+			_ = pr.pty.Close()
+		}
+		closeAll(pr.extras)
 		return fmt.Errorf("trying to start %s - %w", pr.params.Path, err)
 	}
+	pr.startup = pr.history.recordStart(start, clock.Now().Sub(start))
+	// Runs end promptly if the subprocess dies, even if its output streams
+	// don't close.
+	pr.filter.exited = pr.proc.watchExit()
 
-	logger.Printf("seems to have started ok\n")
+	pr.logger.Printf("seems to have started ok\n")
 	// Scan the subprocess' output.
 	// Send its stdErr and stdOut to a combined output channel.
 	// There might be lots of output, so buffer the channel.
@@ -247,75 +691,499 @@ func (pr *ProcRunner) startSubprocess() (err error) {
 	pr.chErr = make(chan []byte, 10)
 	var scanWg sync.WaitGroup
 	scanWg.Add(2)
-	go pr.scanStdErr(&scanWg)
-	go pr.scanStdOut(&scanWg)
+	infra := pr.infraErrors
+	go pr.scanStdErr(&scanWg, pr.errScanner, pr.chErr, infra)
+	outClosed := make(chan struct{})
+	go func(scanner *lineScanner, ch chan<- []byte) {
+		defer close(outClosed)
+		pr.scanStdOut(&scanWg, scanner, ch, infra)
+	}(pr.outScanner, pr.chOut)
+	pr.filter.extras = pr.scanExtraStreams(infra)
 
 	// Wait for completion of both scanners.  They should complete on subprocess
 	// exit, regardless of exit code. If the subprocess fails to close its stdErr
 	// and stdOut, this will hang, and chOut won't close.  The client is
 	// protected from this hang by the timeout sent into RunIt.
+	proc, chOut, chErr, ptmx := pr.proc, pr.chOut, pr.chErr, pr.pty
+	pr.exited = make(chan struct{})
+	exited := pr.exited
+	pr.filter.setStdOut(outClosed, exited)
 	go func() {
-		logger.Println("waiting for subprocess exit")
+		// Per os/exec, Wait closes the pipes, so all reads from them must
+		// complete before calling it.  The scanners finish when the subprocess
+		// closes its end of stdErr and stdOut.
+		scanWg.Wait()
+		pr.logger.Println("waiting for subprocess exit")
 
-		waitErr := pr.cmd.Wait()
+		waitErr := proc.wait()
 		// find out at runtime if this is true by checking second value
 
-		logger.Println("subprocess finished")
+		pr.logger.Println("subprocess finished")
 		if exitErr, isExitError := waitErr.(*exec.ExitError); isExitError {
-			logger.Println("detected exit error: " + exitErr.Error())
-			pr.enterStateError(
-				errors.Wrap(exitErr, "subprocess exited with err"))
+			pr.logger.Println("detected exit error: " + exitErr.Error())
+			infra.log(errors.Wrap(exitErr, "subprocess exited with err"))
 		} else if waitErr != nil {
-			logger.Println("encounter some error other than exit failure")
-			pr.enterStateError(
-				errors.Wrap(exitErr, "subprocess erred out"))
+			pr.logger.Println("encounter some error other than exit failure")
+			infra.log(errors.Wrap(waitErr, "subprocess erred out"))
+		}
+		if ptmx != nil {
+			_ = ptmx.Close()
 		}
-		// The following should end quickly if cmd.Wait worked.
-		scanWg.Wait()
 		// We're all done with this subprocess.
-		// Close the channel to shut down parsing.
-		close(pr.chOut)
-		pr.enterStateUninitialized()
+		// Close the channels to shut down parsing.
+		close(chOut)
+		close(chErr)
+		close(exited)
 	}()
 	return nil
 }
 
-// Close gracefully terminates the CLI, and shuts down all streams, reporting
-// any errors that happen.
+// launch starts the subprocess and prepares it for client commands by
+// running the SetupCommands and re-establishing any tracked context.
+// The caller must hold mutexState.
+func (pr *ProcRunner) launch() error {
+	if err := pr.startSubprocess(); err != nil {
+		return err
+	}
+	if err := pr.awaitAuth(); err != nil {
+		return err
+	}
+	start := pr.filter.clock.Now()
+	err := pr.setUp()
+	pr.history.recordSetup(pr.startup,
+		pr.filter.clock.Now().Sub(start), pr.secrets.redactErr(err))
+	if err == nil {
+		pr.supervise()
+		pr.armIdleTimers()
+	}
+	return err
+}
+
+// setUp runs the SetupCommands and re-establishes any tracked context.
+func (pr *ProcRunner) setUp() error {
+	for _, c := range pr.params.setupCommands() {
+		pr.logger.Printf("running setup command %q\n", c)
+		if err := pr.runInternal(c); err != nil {
+			return fmt.Errorf("running setup command %q; %w", c, err)
+		}
+	}
+	return pr.replayContext()
+}
+
+// prepareStandby starts launching a warm standby subprocess in the
+// background, if Parameters ask for one and there isn't one already.
+// The standby shares the runner's sentinels, so runs wait while it runs
+// its SetupCommands.  The caller must hold mutexState.
+func (pr *ProcRunner) prepareStandby() {
+	if !pr.params.WarmStandby || pr.standby != nil {
+		return
+	}
+	sb := &ProcRunner{history: pr.history,
+		sentinelMu: pr.sentinelMu, framing: pr.framing, discard: pr.discard,
+		pieces: pr.pieces, stamps: pr.stamps, responses: pr.responses,
+		secrets: pr.secrets, spawn: pr.spawn, verbosity: pr.verbosity,
+		isStandby: true}
+	sb.setParams(pr.params)
+	// Held until the standby is ready, so failover waits for it.
+	sb.mutexState.Lock()
+	pr.standby = sb
+	go func() {
+		defer sb.mutexState.Unlock()
+		sb.logger.Println("preparing warm standby")
+		if err := sb.launch(); err != nil {
+			sb.logger.Printf("warm standby failed: %s\n", err.Error())
+			sb.enterStateError(err)
+		}
+	}()
+}
+
+// failover replaces a subprocess in stateError with the warm standby, and
+// starts preparing a new standby.  The caller must hold mutexState.
+func (pr *ProcRunner) failover() error {
+	sb := pr.standby
+	pr.standby = nil
+	pr.logger.Println("failing over to warm standby")
+	pr.abandonSubprocess()
+	sb.mutexState.Lock()
+	defer sb.mutexState.Unlock()
+	if state := sb.getState(); state != stateIdle {
+		sb.abandonSubprocess()
+		return fmt.Errorf("warm standby not ready, in state %s", state)
+	}
+	pr.proc, pr.stdIn = sb.proc, sb.stdIn
+	pr.outScanner, pr.errScanner = sb.outScanner, sb.errScanner
+	pr.chOut, pr.chErr, pr.exited = sb.chOut, sb.chErr, sb.exited
+	pr.infraErrors, pr.filter = sb.infraErrors, sb.filter
+	pr.startup = sb.startup
+	pr.subSessions = nil
+	// The context might have changed since the standby started.
+	if err := pr.replayContext(); err != nil {
+		pr.enterStateError(err)
+		return err
+	}
+	pr.supervise()
+	pr.prepareStandby()
+	return nil
+}
+
+// discardStandby shuts down the warm standby, if any.
+// The caller must hold mutexState.
+func (pr *ProcRunner) discardStandby() {
+	sb := pr.standby
+	if sb == nil {
+		return
+	}
+	pr.standby = nil
+	sb.mutexState.Lock()
+	defer sb.mutexState.Unlock()
+	if sb.getState() == stateIdle && sb.attemptShutdown() == nil {
+		return
+	}
+	sb.abandonSubprocess()
+}
+
+// abandonSubprocess kills the subprocess, if any, and waits briefly for it
+// to exit and for any sentinel search still underway to end, so that the
+// sentinels are free for other use.  The caller must hold mutexState.
+func (pr *ProcRunner) abandonSubprocess() {
+	pr.leaving = pr.proc
+	if proc := pr.proc; proc != nil && proc.started() {
+		_ = proc.kill()
+		if err := pr.awaitExit(defaultSentinelDuration); err != nil {
+			pr.logger.Printf("abandoning subprocess: %s\n", err.Error())
+		}
+	}
+	if pending := pr.filter.pending; pending != nil {
+		select {
+		case <-pending:
+		case <-time.After(defaultSentinelDuration):
+		}
+	}
+}
+
+// awaitExit waits the given duration for the subprocess to exit.
+func (pr *ProcRunner) awaitExit(d time.Duration) error {
+	select {
+	case <-pr.exited:
+		return nil
+	case <-time.After(d):
+		return fmt.Errorf("subprocess didn't exit within %s", d)
+	}
+}
+
+// replayContext re-establishes the session context (if any) in a freshly
+// started subprocess.
+func (pr *ProcRunner) replayContext() error {
+	if pr.params.ContextTracker == nil {
+		return nil
+	}
+	for _, c := range pr.params.ContextTracker.ReplayCommands() {
+		pr.logger.Printf("replaying context command %q\n", c)
+		if err := pr.runInternal(c); err != nil {
+			return fmt.Errorf("re-establishing context with %q; %w", c, err)
+		}
+	}
+	return nil
+}
+
+// runInternal runs a command on behalf of the ProcRunner itself, rather
+// than a client, discarding its output.  The caller must hold mutexState.
+func (pr *ProcRunner) runInternal(c string) error {
+	pr.sentinelMu.Lock()
+	defer pr.sentinelMu.Unlock()
+	if _, err := pr.filter.BeginRun(
+		&cmdrs.KondoCommander{Command: c}, pr.stdIn); err != nil {
+		return err
+	}
+	if err := pr.filter.IssueSentinelsAndFilter(
+		pr.chOut, pr.chErr, 0); err != nil {
+		return err
+	}
+	pr.history.recordReady(pr.startup, pr.filter.clock.Now())
+	return nil
+}
+
+// WorkingDir returns the CLI's current working directory as known to the
+// ProcRunner.
+func (pr *ProcRunner) WorkingDir() string {
+	pr.mutexState.Lock()
+	defer pr.mutexState.Unlock()
+	return pr.params.WorkingDir
+}
+
+// SetWorkingDir changes the CLI's working directory.
+//
+// If Parameters.ChangeDirCommand is set, it's used to tell the running CLI to
+// change directory.  Otherwise, a running CLI is gracefully shut down and
+// restarted in the new directory, running SetupCommands and re-establishing
+// any tracked context.  If the CLI isn't running yet, the directory is simply
+// used when it starts.
+func (pr *ProcRunner) SetWorkingDir(dir string) error {
+	pr.mutexState.Lock()
+	defer pr.mutexState.Unlock()
+	switch pr.getState() {
+	case stateUninitialized:
+		pr.discardStandby()
+		pr.params.WorkingDir = dir
+		return nil
+	case stateRunning:
+		return fmt.Errorf("cannot change working dir while running")
+	case stateError:
+		return fmt.Errorf("cannot change working dir in error state")
+	case stateIdle:
+		// The standby is in the old directory.
+		pr.discardStandby()
+		if pr.params.ChangeDirCommand != "" {
+			if err := pr.runInternal(
+				fmt.Sprintf(pr.params.ChangeDirCommand, dir)); err != nil {
+				pr.enterStateError(err)
+				return err
+			}
+			pr.params.WorkingDir = dir
+			pr.prepareStandby()
+			return nil
+		}
+		if err := pr.stopSubprocess(); err != nil {
+			return err
+		}
+		pr.params.WorkingDir = dir
+		if err := pr.launch(); err != nil {
+			pr.enterStateError(err)
+			return err
+		}
+		pr.prepareStandby()
+		return nil
+	default:
+		return fmt.Errorf("unknown state %d", pr.getState())
+	}
+}
+
+// Reconfigure replaces the runner's parameters, e.g. to rotate credentials
+// passed as Args, or to change flags.
+//
+// The new parameters are validated first; on error nothing changes.  If the
+// CLI is running, it's gracefully shut down, and a new CLI is started with the
+// new parameters (running SetupCommands, etc.).  The ProcRunner itself, and
+// thus anything holding it, remains valid.  If the new parameters lack a
+// ContextTracker, the current one (if any) is kept, so the session context
+// carries over to the new CLI.
+func (pr *ProcRunner) Reconfigure(params *Parameters) error {
+	if params == nil {
+		return fmt.Errorf("provide Parameters")
+	}
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	pr.mutexState.Lock()
+	defer pr.mutexState.Unlock()
+	if params.ContextTracker == nil {
+		params = params.copy()
+		params.ContextTracker = pr.params.ContextTracker
+	}
+	switch pr.getState() {
+	case stateUninitialized:
+		pr.discardStandby()
+		pr.setParams(params)
+		pr.verbosity.set(params.Verbosity)
+		return nil
+	case stateRunning:
+		return fmt.Errorf("cannot reconfigure while running")
+	case stateError:
+		return fmt.Errorf("cannot reconfigure in error state")
+	case stateIdle:
+		pr.discardStandby()
+		if err := pr.stopSubprocess(); err != nil {
+			return err
+		}
+		pr.setParams(params)
+		pr.verbosity.set(params.Verbosity)
+		if err := pr.launch(); err != nil {
+			pr.enterStateError(err)
+			return err
+		}
+		pr.prepareStandby()
+		return nil
+	default:
+		return fmt.Errorf("unknown state %d", pr.getState())
+	}
+}
+
+// Restart discards the CLI subprocess, killing it if need be, and forgets
+// any errors, returning the runner to the state it was in when new.  The
+// next run starts a new CLI (running SetupCommands, etc.).
+//
+// Use Restart to recover from an error, e.g. a timeout, rather than
+// abandoning the ProcRunner.  An idle CLI is gracefully shut down first.
+// Any warm standby is discarded too; a new one is prepared on the next run.
+// The Supervision's RestartBudget is refilled.
+func (pr *ProcRunner) Restart() error {
+	pr.mutexState.Lock()
+	defer pr.mutexState.Unlock()
+	pr.relaunches = nil
+	switch pr.getState() {
+	case stateUninitialized:
+		pr.discardStandby()
+		return nil
+	case stateRunning:
+		return fmt.Errorf("cannot restart while running")
+	case stateIdle:
+		if pr.stopSubprocess() == nil {
+			pr.discardStandby()
+			return nil
+		}
+		pr.logger.Println("graceful shutdown failed, killing subprocess")
+		fallthrough
+	case stateError:
+		pr.discardStandby()
+		pr.abandonSubprocess()
+		// Forget the subprocess even if it wouldn't die.
+		pr.proc = nil
+		pr.infraErrors = nil
+		pr.filter.resetFilter()
+		return nil
+	default:
+		return fmt.Errorf("unknown state %d", pr.getState())
+	}
+}
+
+// stopSubprocess gracefully shuts down an idle subprocess and waits for it
+// to exit, leaving the runner in stateUninitialized on success.
+// The caller must hold mutexState.
+func (pr *ProcRunner) stopSubprocess() error {
+	if err := pr.attemptShutdown(); err != nil {
+		return err
+	}
+	if err := pr.awaitExit(defaultSentinelDuration); err != nil {
+		pr.enterStateError(err)
+		return err
+	}
+	return nil
+}
+
+// Close terminates the CLI, and shuts down all streams, reporting any
+// errors that happen.
+//
+// Close sends the CLI's ExitCommand (if not empty) and EOF, and waits up to
+// Parameters.ShutdownGracePeriod for the CLI to exit.  A CLI that doesn't
+// exit is sent SIGTERM, and then SIGKILL, with the same wait after each.
+// The stage that worked is recorded in the StartReport of the subprocess.
+// If the CLI exited gracefully, Close returns the process' exit code in
+// error form.  If the exit code was 0, nil is returned.
+//
+// If a command is running, Close cancels it; the pending RunIt returns a
+// RunCanceledError whose Cause is ErrRunnerClosed.  The CLI receives the
+// ExitCommand and EOF after the command, and exits once the command finishes
+// (or is forced to exit, per the above).
 //
-// Close sends the CLI's ExitCommand (if not empty) and EOF, and returns the
-// process' exit code in string form.  If the exit code was 0, nil is returned.
+// In the error state, Close shuts down whatever is left of the CLI, and
+// returns the error that put the runner in that state.
 //
-// TODO: kill a hung process, make it possible to transition from
-// stateError to stateUninitialized.
+// Whatever the state, the runner is left as it was when new, so the next
+// run starts a new CLI.  Close also shuts down any warm standby.
 func (pr *ProcRunner) Close() (err error) {
 	pr.mutexState.Lock()
 	defer pr.mutexState.Unlock()
+	// After any run is canceled, since a standby might be waiting for it.
+	defer pr.discardStandby()
+	pr.disarmIdleTimers()
 	switch pr.getState() {
 	case stateUninitialized:
 		return nil
 	case stateRunning:
-		return fmt.Errorf("cannot interrupt run")
+		pr.logger.Println("canceling run to close")
+		pr.filter.cancelRun(ErrRunnerClosed)
+		return pr.shutdown()
 	case stateError:
-		return fmt.Errorf("cannot close error state")
+		lastErr := pr.lastError()
+		if err = pr.shutdown(); err != nil {
+			pr.logger.Printf("shutdown in error state: %s\n", err.Error())
+		}
+		return lastErr
 	case stateIdle:
-		return pr.attemptShutdown()
+		return pr.shutdown()
 	default:
 		return fmt.Errorf("unknown close state %d", pr.getState())
 	}
 }
 
+// shutdown shuts down the subprocess, escalating from the ExitCommand and
+// EOF to SIGTERM to SIGKILL as needed, and records the stage that worked.
+// Once the subprocess is gone, its errors are forgotten, leaving the runner
+// in stateUninitialized.  The caller must hold mutexState.
+func (pr *ProcRunner) shutdown() error {
+	if pr.proc == nil || !pr.proc.started() || pr.subprocessExited() {
+		// Gone already, or never started.
+		pr.proc = nil
+		pr.infraErrors = &errorTracker{}
+		return nil
+	}
+	grace := pr.params.ShutdownGracePeriod
+	if grace == 0 {
+		grace = defaultSentinelDuration
+	}
+	stage := ShutdownGraceful
+	if err := pr.attemptShutdown(); err != nil {
+		// The CLI might be dead or hung; carry on.
+		pr.logger.Printf("graceful shutdown: %s\n", err.Error())
+	}
+	if pr.awaitExit(grace) != nil {
+		stage = ShutdownTerminated
+		pr.logger.Println("terminating subprocess")
+		err := terminate(pr.proc)
+		if err != nil {
+			// No use waiting for it.
+			pr.logger.Printf("sending SIGTERM: %s\n", err.Error())
+		}
+		if err != nil || pr.awaitExit(grace) != nil {
+			stage = ShutdownKilled
+			pr.logger.Println("killing subprocess")
+			_ = pr.proc.kill()
+			if err := pr.awaitExit(grace); err != nil {
+				return err
+			}
+		}
+	}
+	pr.history.recordShutdown(pr.startup, stage)
+	exitErr := pr.lastError()
+	// The subprocess is gone; it doesn't matter how it left.  A fresh
+	// tracker, rather than none, as a run giving up on it may yet log to it.
+	pr.proc = nil
+	pr.infraErrors = &errorTracker{}
+	if stage != ShutdownGraceful {
+		// The exit code just reflects the signal.
+		return nil
+	}
+	return exitErr
+}
+
 func (pr *ProcRunner) attemptShutdown() error {
-	// This is a no-op if the exit command is empty.
-	if _, err := pr.filter.BeginRun(
-		&cmdrs.KondoCommander{Command: pr.params.ExitCommand},
-		pr.stdIn); err != nil {
-		pr.enterStateError(err)
-		return err
+	pr.leaving = pr.proc
+	// Leave any SubSessions first, innermost first, without waiting.
+	for i := len(pr.subSessions) - 1; i >= 0; i-- {
+		sub := pr.subSessions[i].sub
+		if _, err := io.WriteString(pr.stdIn, assureCmdLineTermination(
+			[]byte(sub.ExitCommand), sub.CommandTerminator)); err != nil {
+			pr.enterStateError(err)
+			return err
+		}
+	}
+	pr.subSessions = nil
+	// An empty exit command is skipped regardless of EmptyCommandPolicy.
+	// It's written directly rather than via the filter, since a canceled
+	// run might still be winding down in the filter.
+	if pr.params.ExitCommand != "" {
+		if _, err := io.WriteString(pr.stdIn, assureCmdLineTermination(
+			[]byte(pr.params.ExitCommand),
+			pr.params.CommandTerminator)); err != nil {
+			pr.enterStateError(err)
+			return err
+		}
 	}
 	// The following is like sending an EOF on the input, and should trigger
 	// shutdown of the scanners on stdErr and stdOut.
-	if err := pr.stdIn.Close(); err != nil {
+	// If the ExitCommand already ended the subprocess, cmd.Wait may have
+	// closed stdIn first, which is fine.
+	if err := pr.stdIn.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
 		pr.enterStateError(err)
 		return err
 	}
@@ -323,64 +1191,176 @@ func (pr *ProcRunner) attemptShutdown() error {
 }
 
 // setUpPipesAndScanners establishes the necessary pipes.
-func (pr *ProcRunner) setUpPipesAndScanners() (err error) {
-	pr.stdIn, err = pr.cmd.StdinPipe()
+func (pr *ProcRunner) setUpPipesAndScanners() error {
+	pr.pty, pr.tty = nil, nil
+	// A console process brings its own terminal.
+	_, console := pr.proc.(consoleProcess)
+	if pr.params.UsePty && !console {
+		ep, ok := pr.proc.(*execProcess)
+		if !ok {
+			return fmt.Errorf("UsePty requires a subprocess")
+		}
+		if err := pr.setUpPty(ep.cmd); err != nil {
+			return err
+		}
+	} else {
+		stdIn, stdOut, stdErr, err := pr.proc.pipes()
+		if err != nil {
+			return fmt.Errorf("for %q, %w", pr.params.Path, err)
+		}
+		pr.stdIn = pr.params.LineEnding.wrapStdIn(stdIn)
+		pr.outScanner = pr.params.newLineScanner(pr.watchStdOut(stdOut))
+		pr.errScanner = pr.params.newLineScanner(
+			pr.auth.watch(stdErr, StreamErr))
+	}
+	extras, err := pr.proc.extraPipes()
 	if err != nil {
-		return fmt.Errorf("getting stdIn for %q; %w", pr.params.Path, err)
+		return fmt.Errorf("for %q, %w", pr.params.Path, err)
 	}
-	var pipe io.ReadCloser
-	pipe, err = pr.cmd.StdoutPipe()
+	pr.extras = extras
+	return nil
+}
+
+// watchStdOut wraps the CLI's stdOut to answer login, run and pager prompts
+// on stdIn, which must be set up first, and to remove any payload framing.
+// Login and run prompts are looked for beneath the deframer, which waits
+// for whole lines, since they're usually unfinished ones.  It starts the
+// login, whose prompts on stdErr are watched for too, once stdErr is
+// wrapped by pr.auth.watch.
+func (pr *ProcRunner) watchStdOut(stdOut io.Reader) io.Reader {
+	pr.auth = newAuthWatch(pr.stdIn, pr.params.Auth)
+	var r io.Reader = &promptWatch{r: pr.auth.watch(stdOut, StreamOut),
+		answer: pr.responses.respondTo(pr.stdIn), active: pr.responses.active}
+	return newPagerWatch(
+		newDeframer(r, pr.framing), pr.stdIn, pr.params.pagerPrompts())
+}
+
+// setUpPty connects the CLI's stdIn and stdOut to a pseudo-terminal.
+// StdErr remains a pipe, so that it can still be told apart from stdOut.
+func (pr *ProcRunner) setUpPty(cmd *exec.Cmd) error {
+	ptmx, tty, err := openPty()
 	if err != nil {
-		return fmt.Errorf("getting stdOut for %q; %w", pr.params.Path, err)
+		return fmt.Errorf("opening pty for %q; %w", pr.params.Path, err)
 	}
-	pr.outScanner = bufio.NewScanner(pipe)
-	pipe, err = pr.cmd.StderrPipe()
+	pr.pty, pr.tty = ptmx, tty
+	pipe, err := cmd.StderrPipe()
 	if err != nil {
 		return fmt.Errorf("getting stdErr for %q; %w", pr.params.Path, err)
 	}
-	pr.errScanner = bufio.NewScanner(pipe)
+	cmd.Stdin, cmd.Stdout = tty, tty
+	cmd.SysProcAttr = ptyProcAttr()
+	pr.stdIn = pr.params.LineEnding.wrapStdIn(ptyInput{ptmx})
+	pr.outScanner = pr.params.newLineScanner(pr.watchStdOut(ptyOutput{ptmx}))
+	pr.errScanner = pr.params.newLineScanner(pr.auth.watch(pipe, StreamErr))
 	return nil
 }
 
-func (pr *ProcRunner) scanStdErr(wg *sync.WaitGroup) {
+// ctrlD is the character that, typed at the start of a line, ends a
+// terminal's input.
+const ctrlD = 0x04
+
+// ptyInput writes to the CLI's terminal.  Closing it sends an EOF, as a
+// human would with ctrl-D, rather than closing the terminal, which is
+// closed once the CLI exits.
+type ptyInput struct {
+	*os.File
+}
+
+func (p ptyInput) Close() error {
+	if _, err := p.Write([]byte{ctrlD}); err != nil && !isPtyClosed(err) {
+		return err
+	}
+	return nil
+}
+
+// ptyOutput reads from the CLI's terminal, reporting an EOF once the CLI
+// closes it.
+type ptyOutput struct {
+	io.Reader
+}
+
+func (p ptyOutput) Read(b []byte) (int, error) {
+	n, err := p.Reader.Read(b)
+	if err != nil && isPtyClosed(err) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// scanStdErr sends lines from the scanner to the channel.  The scanner and
+// channel are passed in, since a failover can replace the runner's own.
+// The ErrPrefix goes on whole lines, and the first pieces of split ones.
+func (pr *ProcRunner) scanStdErr(
+	wg *sync.WaitGroup, scanner *lineScanner, ch chan<- []byte,
+	infra *errorTracker) {
 	defer wg.Done()
 	if len(pr.params.ErrPrefix) > 0 {
-		for pr.errScanner.Scan() {
+		continuing := false
+		for scanner.Scan() {
+			line, keep := pr.params.lineText(scanner.Bytes())
+			if !keep {
+				continuing = scanner.continued()
+				continue
+			}
 			var buff bytes.Buffer
-			buff.WriteString(pr.params.ErrPrefix)
-			buff.Write(pr.errScanner.Bytes())
-			pr.chErr <- buff.Bytes()
+			if !continuing {
+				buff.WriteString(pr.params.ErrPrefix)
+			}
+			buff.Write(line)
+			continuing = scanner.continued()
+			if pr.discard.admit(StreamErr, buff.Bytes()) {
+				if continuing {
+					pr.pieces.mark(buff.Bytes())
+				}
+				pr.stamps.stamp(buff.Bytes(), pr.filter.clock.Now())
+				pr.history.err.send(ch, buff.Bytes())
+			}
 		}
 	} else {
-		for pr.errScanner.Scan() {
-			line := pr.errScanner.Bytes()
-			send := make([]byte, len(line))
-			copy(send, line)
-			pr.chErr <- send
+		for scanner.Scan() {
+			line, keep := pr.params.lineText(scanner.Bytes())
+			if !keep || !pr.discard.admit(StreamErr, line) {
+				continue
+			}
+			send := newLine(line)
+			if scanner.continued() {
+				pr.pieces.mark(send)
+			}
+			pr.stamps.stamp(send, pr.filter.clock.Now())
+			pr.history.err.send(ch, send)
 		}
 	}
-	if err := pr.errScanner.Err(); err != nil {
+	if err := scanner.Err(); err != nil {
 		// This should be rare.
-		pr.enterStateError(fmt.Errorf("errScanner saw : %w", err))
+		infra.log(fmt.Errorf("errScanner saw : %w", err))
 	}
 }
 
-func (pr *ProcRunner) scanStdOut(wg *sync.WaitGroup) {
+// scanStdOut is like scanStdErr, for stdOut.
+func (pr *ProcRunner) scanStdOut(
+	wg *sync.WaitGroup, scanner *lineScanner, ch chan<- []byte,
+	infra *errorTracker) {
 	defer wg.Done()
-	logger.Println("Entered scanStdOut")
+	pr.logger.Println("Entered scanStdOut")
 	count := 0
-	for pr.outScanner.Scan() {
-		line := pr.outScanner.Bytes()
+	for scanner.Scan() {
+		line, keep := pr.params.lineText(scanner.Bytes())
 		count++
-		logger.Printf("Managed to read line: %s\n", string(line))
-		send := make([]byte, len(line))
-		copy(send, line)
-		pr.chOut <- send
+		if !keep || !pr.discard.admit(StreamOut, line) {
+			continue
+		}
+		pr.lineLogger.Printf("Managed to read line: %s\n", string(line))
+		send := newLine(line)
+		if scanner.continued() {
+			pr.pieces.mark(send)
+		}
+		pr.stamps.stamp(send, pr.filter.clock.Now())
+		pr.history.out.send(ch, send)
 	}
-	logger.Printf("scanStdOut ended, read %d lines!\n", count)
-	if err := pr.outScanner.Err(); err != nil {
+	pr.logger.Printf("scanStdOut ended, read %d lines!\n", count)
+	if err := scanner.Err(); err != nil {
 		// This should be rare.
-		logger.Printf("scanStdOut 'rare' error was %s!\n", err.Error())
-		pr.enterStateError(fmt.Errorf("outScanner saw : %w", err))
+		pr.logger.Printf("scanStdOut 'rare' error was %s!\n", err.Error())
+		infra.log(fmt.Errorf("outScanner saw : %w", err))
 	}
 }
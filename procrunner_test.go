@@ -1,6 +1,13 @@
 package clirunner_test
 
 import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -86,14 +93,6 @@ hey<1>Cempedak_|_Bamberga_|_4_|_00000000000000000000000000000001
 	assert.NoError(t, runner.Close())
 }
 
-/*
-
-Need a v2 here.  there's too much synchrony in the current impl.
-RunIt needs a select loop, looking for completion of either
-the command or the process itself.  currently there is no
-loop at all, it's just stupid.
-
-*/
 func TestRunner_Run_FailOnStartup(t *testing.T) {
 	runner, err := NewProcRunner(&Parameters{
 		Path:        tstcli.TestCliPath,
@@ -107,6 +106,29 @@ func TestRunner_Run_FailOnStartup(t *testing.T) {
 	assert.Error(t, runner.Close())
 }
 
+func TestRunner_Run_ExitWithStreamsOpen(t *testing.T) {
+	// The shell becomes the CLI, leaving a sleep holding its streams open.
+	runner, err := NewProcRunner(&Parameters{
+		Path: "sh",
+		Args: []string{"-c", "sleep 2 & exec " + tstcli.TestCliPath +
+			" --" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, runner.RunIt(
+		NewHoardingCommander(tstcli.CmdEcho+" hello"), testingTimeout))
+
+	start := time.Now()
+	err = runner.RunIt(NewHoardingCommander(tstcli.CmdQuit), 10*time.Second)
+	var ee *SubprocessExitedError
+	assert.True(t, errors.As(err, &ee), "got %v", err)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	assert.Error(t, runner.RunIt(
+		NewHoardingCommander(tstcli.CmdEcho+" hello"), testingTimeout))
+	assert.NoError(t, runner.Restart())
+}
+
 func TestRunner_Run_HappyQuery(t *testing.T) {
 	runner, err := NewProcRunner(&Parameters{
 		Path:        tstcli.TestCliPath,
@@ -127,6 +149,150 @@ Banana_|_Egeria_|_5_|_00000000000000000000000000000005
 	assert.NoError(t, runner.Close())
 }
 
+func TestRunner_Run_EmptyCommand(t *testing.T) {
+	testCases := map[string]struct {
+		policy    EmptyCommandPolicy
+		expectErr string
+	}{
+		"noOp": {
+			policy: EmptyCommandNoOp,
+		},
+		"error": {
+			policy:    EmptyCommandError,
+			expectErr: "empty command not allowed",
+		},
+		"newline": {
+			policy: EmptyCommandNewline,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			runner, err := NewProcRunner(&Parameters{
+				Path:               tstcli.TestCliPath,
+				Args:               []string{"--" + tstcli.FlagDisablePrompt},
+				ExitCommand:        tstcli.CmdQuit,
+				OutSentinel:        tstcli.MakeOutSentinelCommander(),
+				EmptyCommandPolicy: tc.policy,
+			})
+			assert.NoError(t, err)
+			commander := NewHoardingCommander("")
+			err = runner.RunIt(commander, testingTimeout)
+			if tc.expectErr != "" {
+				if !assert.Error(t, err) {
+					t.Fatal("expecting an error")
+				}
+				assert.Contains(t, err.Error(), tc.expectErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "", commander.Result())
+			}
+			// Either way, the runner remains usable.
+			assert.NoError(t, runner.Close())
+		})
+	}
+}
+
+func TestRunner_Run_ContextTracker(t *testing.T) {
+	ct := makeTestContextTracker(t)
+	// Pretend an earlier subprocess established a namespace;
+	// it's replayed when the subprocess starts.
+	ct.Observe("set ns kube-system")
+	runner, err := NewProcRunner(&Parameters{
+		Path:           tstcli.TestCliPath,
+		Args:           []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand:    tstcli.CmdQuit,
+		OutSentinel:    tstcli.MakeOutSentinelCommander(),
+		ContextTracker: ct,
+	})
+	assert.NoError(t, err)
+	// The testcli quietly accepts any "set" command.
+	assert.NoError(t, runner.RunIgnoringOutput("set ns default"))
+	assert.NoError(t, runner.RunIgnoringOutput(tstcli.CmdQuery+" limit 1"))
+	assert.Equal(t, map[string]string{"namespace": "default"}, ct.Current())
+	assert.NoError(t, runner.Close())
+}
+
+func TestRunner_SetWorkingDir(t *testing.T) {
+	testCases := map[string]struct {
+		changeDirCommand string
+	}{
+		"restart": {},
+		"cd": {
+			changeDirCommand: tstcli.CmdCd + " %s",
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			dir1, err := filepath.EvalSymlinks(t.TempDir())
+			assert.NoError(t, err)
+			dir2, err := filepath.EvalSymlinks(t.TempDir())
+			assert.NoError(t, err)
+			runner, err := NewProcRunner(&Parameters{
+				Path:             tstcli.TestCliPath,
+				Args:             []string{"--" + tstcli.FlagDisablePrompt},
+				ExitCommand:      tstcli.CmdQuit,
+				OutSentinel:      tstcli.MakeOutSentinelCommander(),
+				SetupCommands:    []string{"set whatever"},
+				ChangeDirCommand: tc.changeDirCommand,
+			})
+			assert.NoError(t, err)
+
+			// Before the CLI starts.
+			assert.NoError(t, runner.SetWorkingDir(dir1))
+			commander := NewHoardingCommander(tstcli.CmdPwd)
+			assert.NoError(t, runner.RunIt(commander, testingTimeout))
+			assert.Equal(t, dir1+"\n", commander.Result())
+
+			// While the CLI is running.
+			assert.NoError(t, runner.SetWorkingDir(dir2))
+			assert.Equal(t, dir2, runner.WorkingDir())
+			commander.Reset()
+			assert.NoError(t, runner.RunIt(commander, testingTimeout))
+			assert.Equal(t, dir2+"\n", commander.Result())
+			assert.NoError(t, runner.Close())
+		})
+	}
+}
+
+func TestRunner_Reconfigure(t *testing.T) {
+	ct := makeTestContextTracker(t)
+	runner, err := NewProcRunner(&Parameters{
+		Path:           tstcli.TestCliPath,
+		Args:           []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand:    tstcli.CmdQuit,
+		OutSentinel:    tstcli.MakeOutSentinelCommander(),
+		ContextTracker: ct,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, runner.RunIgnoringOutput("set ns default"))
+
+	err = runner.Reconfigure(&Parameters{Path: tstcli.TestCliPath})
+	if !assert.Error(t, err) {
+		t.Fatal("expecting an error")
+	}
+	assert.Contains(t, err.Error(), "must specify OutSentinel")
+
+	assert.NoError(t, runner.Reconfigure(&Parameters{
+		Path: tstcli.TestCliPath,
+		Args: []string{
+			"--" + tstcli.FlagDisablePrompt,
+			"--" + tstcli.FlagNumRowsInDb, "2",
+		},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+	}))
+	// The new CLI sees the new flags.
+	commander := NewHoardingCommander(tstcli.CmdQuery + " limit 5")
+	assert.NoError(t, runner.RunIt(commander, testingTimeout))
+	assert.Equal(t, `
+Cempedak_|_Bamberga_|_4_|_00000000000000000000000000000001
+Buddha's hand_|_Hermione_|_6_|_00000000000000000000000000000002
+`[1:], commander.Result())
+	// The context carried over.
+	assert.Equal(t, map[string]string{"namespace": "default"}, ct.Current())
+	assert.NoError(t, runner.Close())
+}
+
 func TestRunner_Run_SentinelTimeoutOnLongRunningCommand(t *testing.T) {
 	runner, err := NewProcRunner(&Parameters{
 		Path:        tstcli.TestCliPath,
@@ -144,6 +310,517 @@ func TestRunner_Run_SentinelTimeoutOnLongRunningCommand(t *testing.T) {
 		t, err.Error(), "time 1s expired before detection of output from sentinel")
 }
 
+func TestRunner_Restart(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, runner.Restart())
+	err = runner.RunIt(tstcli.MakeSleepCommander(4*time.Second), 1*time.Second)
+	assert.Error(t, err)
+	assert.Equal(t, "error", runner.Report().State)
+	assert.Error(t, runner.RunIgnoringOutput(tstcli.CmdEcho+" hello"))
+
+	assert.NoError(t, runner.Restart())
+	assert.Equal(t, "uninitialized", runner.Report().State)
+	commander := NewHoardingCommander(tstcli.CmdEcho + " hello")
+	assert.NoError(t, runner.RunIt(commander, testingTimeout))
+	assert.Equal(t, "hello\n", commander.Result())
+
+	// An idle CLI is restarted too.
+	assert.NoError(t, runner.Restart())
+	assert.Equal(t, "uninitialized", runner.Report().State)
+	assert.NoError(t, runner.RunIgnoringOutput(tstcli.CmdEcho+" again"))
+	assert.Equal(t, 3, runner.Report().Starts)
+	assert.NoError(t, runner.Close())
+}
+
+func TestRunner_Run_FailoverToWarmStandby(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path:          tstcli.TestCliPath,
+		Args:          []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand:   tstcli.CmdQuit,
+		OutSentinel:   tstcli.MakeOutSentinelCommander(),
+		SetupCommands: []string{tstcli.CmdEcho + " hello"},
+		WarmStandby:   true,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, runner.RunIt(
+		NewHoardingCommander(tstcli.CmdQuery+" limit 1"), testingTimeout))
+	// Put the active subprocess into the error state.
+	err = runner.RunIt(tstcli.MakeSleepCommander(4*time.Second), 1*time.Second)
+	if !assert.Error(t, err) {
+		t.Fatal("expecting an error")
+	}
+	assert.Equal(t, "error", runner.Report().State)
+	start := time.Now()
+	commander := NewHoardingCommander(tstcli.CmdQuery + " limit 2")
+	assert.NoError(t, runner.RunIt(commander, testingTimeout))
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	assert.Equal(t, 2, strings.Count(commander.Result(), "\n"))
+	assert.Equal(t, "idle", runner.Report().State)
+	assert.NoError(t, runner.Close())
+	// The first two, plus the standby's replacement.
+	assert.Equal(t, 3, runner.Report().Starts)
+}
+
+// makeTestOutputCheck makes an OutputCheck using the testcli's tally.
+func makeTestOutputCheck() *OutputCheck {
+	return &OutputCheck{
+		Command: tstcli.CmdTally,
+		Parse: func(line []byte) (OutputTally, bool) {
+			s := string(line)
+			if !strings.HasPrefix(s, tstcli.TallyPrefix) {
+				return OutputTally{}, false
+			}
+			n, err := strconv.Atoi(s[len(tstcli.TallyPrefix):])
+			if err != nil {
+				return OutputTally{}, false
+			}
+			return OutputTally{Lines: n, Bytes: -1}, true
+		},
+	}
+}
+
+func TestRunner_Run_OutputCheck(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+		OutputCheck: makeTestOutputCheck(),
+	})
+	assert.NoError(t, err)
+	commander := NewHoardingCommander(tstcli.CmdQuery + " limit 3")
+	assert.NoError(t, runner.RunIt(commander, testingTimeout))
+	// The tally isn't passed to the Commander.
+	assert.Equal(t, 3, strings.Count(commander.Result(), "\n"))
+	assert.NotContains(t, commander.Result(), tstcli.TallyPrefix)
+	assert.NoError(t, runner.Close())
+}
+
+func TestRunner_Run_OutputLimit(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+		OutputLimit: &OutputLimit{MaxLines: 2},
+	})
+	assert.NoError(t, err)
+	commander := NewHoardingCommander(tstcli.CmdQuery + " limit 4")
+	err = runner.RunIt(commander, testingTimeout)
+	var le *OutputLimitError
+	if !assert.True(t, errors.As(err, &le)) {
+		t.Fatalf("expected OutputLimitError, got %v", err)
+	}
+	assert.Equal(t, 2, strings.Count(commander.Result(), "\n"))
+
+	// The excess output was swept up; the runner is still usable.
+	commander = NewHoardingCommander(tstcli.CmdQuery + " limit 1")
+	assert.NoError(t, runner.RunIt(commander, testingTimeout))
+	assert.Equal(t, 1, strings.Count(commander.Result(), "\n"))
+	assert.NoError(t, runner.Close())
+}
+
+func TestRunner_Run_Discarded(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path: tstcli.TestCliPath,
+		Args: []string{
+			"--" + tstcli.FlagDisablePrompt,
+			"--" + tstcli.FlagNumRowsInDb, "2000",
+		},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+	})
+	assert.NoError(t, err)
+	kondo := &KondoCommander{Command: tstcli.CmdQuery + " limit 1000"}
+	assert.NoError(t, runner.RunIt(kondo, testingTimeout))
+	report, _ := runner.LastRunReport()
+	assert.Equal(t, 1000, report.LinesOut)
+	// Lines that arrived before the sentinel was issued might have been
+	// handed over, but most weren't.
+	assert.Less(t, kondo.LineTally().Lines, 1000)
+
+	// The next run sees all of its output.
+	commander := NewHoardingCommander(tstcli.CmdQuery + " limit 3")
+	assert.NoError(t, runner.RunIt(commander, testingTimeout))
+	assert.Equal(t, 3, strings.Count(commander.Result(), "\n"))
+	assert.NoError(t, runner.Close())
+}
+
+func TestRunner_Run_FatalLine(t *testing.T) {
+	for _, restart := range []bool{false, true} {
+		runner, err := NewProcRunner(&Parameters{
+			Path:              tstcli.TestCliPath,
+			Args:              []string{"--" + tstcli.FlagDisablePrompt},
+			ExitCommand:       tstcli.CmdQuit,
+			OutSentinel:       tstcli.MakeOutSentinelCommander(),
+			FatalLinePatterns: []*regexp.Regexp{regexp.MustCompile(`Hermione`)},
+			RestartOnFatal:    restart,
+		})
+		assert.NoError(t, err)
+		commander := NewHoardingCommander(tstcli.CmdQuery + " limit 3")
+		err = runner.RunIt(commander, testingTimeout)
+		var fe *FatalLineError
+		if !assert.True(t, errors.As(err, &fe)) {
+			t.Fatalf("expected FatalLineError, got %v", err)
+		}
+		assert.Equal(t, StreamOut, fe.Line.Stream)
+		assert.Contains(t, string(fe.Line.Data), "Hermione")
+		// The Commander saw the output up to and including the fatal line.
+		assert.Equal(t, 2, strings.Count(commander.Result(), "\n"))
+		assert.Contains(t, commander.Result(), "Hermione")
+
+		commander = NewHoardingCommander(tstcli.CmdQuery + " limit 1")
+		err = runner.RunIt(commander, testingTimeout)
+		if restart {
+			assert.NoError(t, err)
+			assert.Equal(t, 1, strings.Count(commander.Result(), "\n"))
+		} else {
+			assert.Error(t, err)
+			assert.NoError(t, runner.Restart())
+		}
+		assert.NoError(t, runner.Close())
+	}
+}
+
+// pollStatus polls the runner's Status until the returned func is called,
+// for the race detector to check state changes against.
+func pollStatus(runner *ProcRunner) func() {
+	done := make(chan struct{})
+	polled := make(chan struct{})
+	go func() {
+		defer close(polled)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				_ = runner.Status()
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-polled
+	}
+}
+
+func TestRunner_Run_FatalLineStatus(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path:              tstcli.TestCliPath,
+		Args:              []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand:       tstcli.CmdQuit,
+		OutSentinel:       tstcli.MakeOutSentinelCommander(),
+		FatalLinePatterns: []*regexp.Regexp{regexp.MustCompile(`Hermione`)},
+		RestartOnFatal:    true,
+	})
+	assert.NoError(t, err)
+	// Poll the runner's state while fatal runs reset it.
+	stop := pollStatus(runner)
+	for i := 0; i < 3; i++ {
+		var fe *FatalLineError
+		err = runner.RunIt(
+			NewHoardingCommander(tstcli.CmdQuery+" limit 3"), testingTimeout)
+		assert.True(t, errors.As(err, &fe))
+	}
+	stop()
+	assert.Equal(t, "uninitialized", runner.Status().State)
+	assert.NoError(t, runner.Close())
+}
+
+func TestRunner_Run_UsePty(t *testing.T) {
+	for _, usePty := range []bool{false, true} {
+		runner, err := NewProcRunner(&Parameters{
+			Path:        tstcli.TestCliPath,
+			Args:        []string{"--" + tstcli.FlagDisablePrompt},
+			ExitCommand: tstcli.CmdQuit,
+			OutSentinel: tstcli.MakeOutSentinelCommander(),
+			ErrSentinel: tstcli.MakeErrSentinelCommander(),
+			UsePty:      usePty,
+		})
+		assert.NoError(t, err)
+		commander := NewHoardingCommander(tstcli.CmdTerm)
+		assert.NoError(t, runner.RunIt(commander, testingTimeout))
+		assert.Equal(t,
+			"terminal: "+strconv.FormatBool(usePty)+"\n", commander.Result())
+		// No echo, no carriage returns.
+		commander = NewHoardingCommander(tstcli.CmdEcho + " hello")
+		assert.NoError(t, runner.RunIt(commander, testingTimeout))
+		assert.Equal(t, "hello\n", commander.Result())
+		assert.NoError(t, runner.Close())
+	}
+}
+
+// gzipCommander hoards lines, after decompressing payloads.
+type gzipCommander struct {
+	*HoardingCommander
+}
+
+func (c *gzipCommander) PayloadFraming() *PayloadFraming {
+	return &PayloadFraming{Header: tstcli.PayloadHeader}
+}
+
+func TestRunner_Run_PayloadFraming(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+	})
+	assert.NoError(t, err)
+	commander := &gzipCommander{
+		NewHoardingCommander(tstcli.CmdGzip + " alpha beta")}
+	assert.NoError(t, runner.RunIt(commander, testingTimeout))
+	assert.Equal(t, "alpha\nbeta\n", commander.Result())
+
+	// Without framing, the payload isn't decompressed.
+	hoarder := NewHoardingCommander(tstcli.CmdGzip + " alpha beta")
+	assert.NoError(t, runner.RunIt(hoarder, testingTimeout))
+	assert.True(t, strings.HasPrefix(hoarder.Result(), tstcli.PayloadHeader))
+	assert.NoError(t, runner.Close())
+}
+
+func TestRunner_Run_SentinelTimeoutRecoveredByInterrupt(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+		// Assure the complaint about the interrupt is swept up.
+		ErrSentinel:     tstcli.MakeErrSentinelCommander(),
+		InterruptSignal: os.Interrupt,
+	})
+	assert.NoError(t, err)
+	sleeper := tstcli.MakeSleepCommander(10 * time.Second)
+	err = runner.RunIt(sleeper, 1*time.Second)
+	var recovered *TimeoutButRecoveredError
+	if !assert.True(t, errors.As(err, &recovered)) {
+		t.Fatalf("expected TimeoutButRecoveredError, got %v", err)
+	}
+	assert.Equal(t, 1*time.Second, recovered.TimeOut)
+	assert.Equal(t, "sleep interrupted\n", sleeper.Result())
+
+	// The runner is still usable.
+	commander := NewHoardingCommander(tstcli.CmdQuery + " limit 1")
+	assert.NoError(t, runner.RunIt(commander, testingTimeout))
+	assert.Equal(t, `
+Cempedak_|_Bamberga_|_4_|_00000000000000000000000000000001
+`[1:], commander.Result())
+	assert.NoError(t, runner.Close())
+}
+
+func TestRunner_RunContext_Deadline(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+	})
+	assert.NoError(t, err)
+	// The deadline, well under the default timeout, supersedes it.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	err = runner.RunContext(ctx, tstcli.MakeSleepCommander(4*time.Second))
+	assert.Less(t, int64(time.Since(start)), int64(2*time.Second))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "expired before detection")
+	}
+	r, ok := runner.LastRunReport()
+	assert.True(t, ok)
+	assert.True(t, r.Partial)
+}
+
+func TestRunner_RunContext_CanceledAndRecovered(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path:            tstcli.TestCliPath,
+		Args:            []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand:     tstcli.CmdQuit,
+		OutSentinel:     tstcli.MakeOutSentinelCommander(),
+		ErrSentinel:     tstcli.MakeErrSentinelCommander(),
+		InterruptSignal: os.Interrupt,
+	})
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(500*time.Millisecond, cancel)
+	err = runner.RunContext(ctx, tstcli.MakeSleepCommander(10*time.Second))
+	var ce *RunCanceledError
+	if !assert.True(t, errors.As(err, &ce)) {
+		t.Fatalf("expected RunCanceledError, got %v", err)
+	}
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	// The runner is still usable.
+	commander := NewHoardingCommander(tstcli.CmdQuery + " limit 1")
+	assert.NoError(t, runner.RunContext(context.Background(), commander))
+	assert.Equal(t, `
+Cempedak_|_Bamberga_|_4_|_00000000000000000000000000000001
+`[1:], commander.Result())
+	assert.NoError(t, runner.Close())
+}
+
+func TestRunner_RunContext_CanceledUninterruptible(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+	})
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(500*time.Millisecond, cancel)
+	start := time.Now()
+	stop := pollStatus(runner)
+	err = runner.RunContext(ctx, tstcli.MakeSleepCommander(10*time.Second))
+	stop()
+	assert.Less(t, int64(time.Since(start)), int64(2*time.Second))
+	assert.True(t, errors.Is(err, context.Canceled))
+	// The CLI had to be killed.
+	assert.Equal(t, "error", runner.Report().State)
+
+	// A context that's already done doesn't start anything.
+	err = runner.RunContext(ctx, NewHoardingCommander(tstcli.CmdQuery))
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+// awaitQueued waits for the runner to have n runs waiting their turn.
+func awaitQueued(h *Harness, n int) {
+	for h.Runner.Report().Queued != n {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRunner_RunIt_Queued(t *testing.T) {
+	h := makeHarness(t)
+	first := NewHoardingCommander("first")
+	result1 := runAsync(h, first, time.Hour)
+	expectCommands(t, h, "first", "echo Rumpelstiltskin")
+
+	// Runs asked for meanwhile wait their turn.
+	second := NewHoardingCommander("second")
+	result2 := runAsync(h, second, time.Minute)
+	awaitQueued(h, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	result3 := make(chan error, 1)
+	go func() {
+		result3 <- h.Runner.RunContext(ctx, NewHoardingCommander("third"))
+	}()
+	awaitQueued(h, 2)
+	assert.Equal(t, "running", h.Runner.Report().State)
+
+	// A run whose context is done while it waits gives up its place.
+	cancel()
+	assert.True(t, errors.Is(<-result3, context.Canceled))
+	awaitQueued(h, 1)
+
+	// The waiting run's time limit doesn't start until its turn.
+	h.Clock.AwaitTimers(1)
+	h.Clock.Advance(time.Minute)
+	assert.NoError(t, h.Out("one", "Rumpelstiltskin"))
+	assert.NoError(t, <-result1)
+	expectCommands(t, h, "second", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("two", "Rumpelstiltskin"))
+	assert.NoError(t, <-result2)
+	assert.Equal(t, "one\n", first.Result())
+	assert.Equal(t, "two\n", second.Result())
+	assert.Equal(t, 0, h.Runner.Report().Queued)
+	assert.NoError(t, h.Runner.Close())
+}
+
+func TestRunner_CloseWhileRunning(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+	})
+	assert.NoError(t, err)
+	runErr := make(chan error)
+	go func() {
+		runErr <- runner.RunIt(
+			tstcli.MakeSleepCommander(2*time.Second), testingTimeout)
+	}()
+	// Give the run time to start.
+	time.Sleep(500 * time.Millisecond)
+	start := time.Now()
+	// Close waits for the CLI to exit, but the run ends immediately.
+	closeErr := make(chan error)
+	go func() {
+		closeErr <- runner.Close()
+	}()
+	err = <-runErr
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	assert.NoError(t, <-closeErr)
+	var ce *RunCanceledError
+	if !assert.True(t, errors.As(err, &ce)) {
+		t.Fatalf("expected RunCanceledError, got %v", err)
+	}
+	assert.True(t, errors.Is(err, ErrRunnerClosed))
+	assert.Equal(t, tstcli.CmdSleep+" 2s", ce.Command)
+}
+
+func TestRunner_Close_Escalation(t *testing.T) {
+	testCases := map[string]struct {
+		params      *Parameters
+		expectStage ShutdownStage
+	}{
+		"graceful": {
+			params: &Parameters{
+				Path:        tstcli.TestCliPath,
+				Args:        []string{"--" + tstcli.FlagDisablePrompt},
+				ExitCommand: tstcli.CmdQuit,
+				OutSentinel: tstcli.MakeOutSentinelCommander(),
+			},
+			expectStage: ShutdownGraceful,
+		},
+		"terminated": {
+			// Stuck in a command, so deaf to the ExitCommand and EOF.
+			params: &Parameters{
+				Path:        tstcli.TestCliPath,
+				Args:        []string{"--" + tstcli.FlagDisablePrompt},
+				ExitCommand: tstcli.CmdQuit,
+				OutSentinel: tstcli.MakeOutSentinelCommander(),
+			},
+			expectStage: ShutdownTerminated,
+		},
+		"killed": {
+			// Deaf to everything but SIGKILL.
+			params: &Parameters{
+				Path:        "sh",
+				Args:        []string{"-c", "trap '' TERM; exec sleep 60"},
+				OutSentinel: tstcli.MakeOutSentinelCommander(),
+			},
+			expectStage: ShutdownKilled,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			tc.params.ShutdownGracePeriod = 200 * time.Millisecond
+			runner, err := NewProcRunner(tc.params)
+			assert.NoError(t, err)
+			if tc.expectStage == ShutdownGraceful {
+				assert.NoError(t, runner.RunIgnoringOutput(tstcli.CmdEcho+" hi"))
+				assert.NoError(t, runner.Close())
+			} else {
+				err = runner.RunIt(
+					tstcli.MakeSleepCommander(60*time.Second), 200*time.Millisecond)
+				assert.Error(t, err)
+				// Close returns the timeout.
+				assert.Equal(t, err, runner.Close())
+			}
+			assert.Equal(t, "uninitialized", runner.Report().State)
+			r, ok := runner.LastStartReport()
+			assert.True(t, ok)
+			assert.Equal(t, tc.expectStage, r.Shutdown)
+		})
+	}
+}
+
 func TestRunner_NoSentinelTimeoutOnShortRunningCommand(t *testing.T) {
 	runner, err := NewProcRunner(&Parameters{
 		Path:        tstcli.TestCliPath,
@@ -236,11 +913,16 @@ Bilberry_|_Interamnia_|_2_|_00000000000000000000000000000003
 error! touching row 4 triggers this error
 `[1:], commander.Result())
 
+	// Closing returns the error that put the runner in its error state, and
+	// leaves it ready to start over.
 	err = runner.Close()
 	if !assert.Error(t, err) {
 		t.Fatal("expecting an error")
 	}
-	assert.Contains(t, err.Error(), "cannot close error state")
+	assert.Contains(t, err.Error(), "no sentinel detected")
+	assert.Equal(t, "uninitialized", runner.Report().State)
+	assert.NoError(t, runner.RunIgnoringOutput(tstcli.CmdEcho+" hello"))
+	assert.NoError(t, runner.Close())
 }
 
 func TestRunner_ErrorPrefix(t *testing.T) {
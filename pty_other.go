@@ -0,0 +1,24 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package clirunner
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// openPty reports that pseudo-terminals aren't supported.
+func openPty() (*os.File, *os.File, error) {
+	return nil, nil, fmt.Errorf("UsePty isn't supported on %s", runtime.GOOS)
+}
+
+func ptyProcAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+func isPtyClosed(error) bool {
+	return false
+}
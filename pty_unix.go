@@ -0,0 +1,49 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package clirunner
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
+)
+
+// openPty opens a pseudo-terminal, returning its controlling end and the
+// terminal itself.  The terminal doesn't echo input, or turn linefeeds into
+// carriage return/linefeed pairs, so CLI output arrives as it would through
+// a pipe.  The terminal is still line buffered, as it is for a human.
+func openPty() (ptmx *os.File, tty *os.File, err error) {
+	ptmx, tty, err = pty.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	fd := int(tty.Fd())
+	t, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err == nil {
+		t.Lflag &^= unix.ECHO | unix.ECHONL
+		t.Oflag &^= unix.OPOST
+		err = unix.IoctlSetTermios(fd, ioctlSetTermios, t)
+	}
+	if err != nil {
+		_ = ptmx.Close()
+		_ = tty.Close()
+		return nil, nil, err
+	}
+	return ptmx, tty, nil
+}
+
+// ptyProcAttr makes the terminal on the subprocess' stdIn its controlling
+// terminal, in a new session.
+func ptyProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true, Setctty: true}
+}
+
+// isPtyClosed returns true if a read error from the controlling end of a
+// pseudo-terminal just means the subprocess closed the terminal.
+func isPtyClosed(err error) bool {
+	return errors.Is(err, syscall.EIO)
+}
@@ -0,0 +1,245 @@
+package clirunner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Transcript is a recorded session with a CLI: the commands run, in order,
+// and what the CLI said in response to each.  Record one with a
+// TranscriptRecorder, save it with WriteTo, and replay it with a
+// ReplayRunner, to test Commanders against real output without the CLI.
+type Transcript struct {
+	Exchanges []Exchange
+}
+
+// Exchange is one command of a Transcript.
+type Exchange struct {
+	// Command is the command that was run.
+	Command string
+	// Lines are the lines the Commander got, in the order they arrived,
+	// sans sentinels.
+	Lines []Line
+	// Err is the message of the error the run returned, if any.
+	Err string
+}
+
+// transcriptJSON is the JSON form of a Transcript.
+type transcriptJSON struct {
+	Exchanges []exchangeJSON `json:"exchanges"`
+}
+
+// exchangeJSON is the JSON form of an Exchange, with lines as text.
+type exchangeJSON struct {
+	Command string     `json:"command"`
+	Lines   []lineJSON `json:"lines,omitempty"`
+	Err     string     `json:"error,omitempty"`
+}
+
+// lineJSON is the JSON form of a Line.
+type lineJSON struct {
+	Stream string `json:"stream"`
+	Name   string `json:"name,omitempty"`
+	Text   string `json:"text"`
+}
+
+// MarshalJSON renders the transcript with its lines as text, named by
+// stream, e.g. {"stream":"Out","text":"3 rows"}.
+func (t Transcript) MarshalJSON() ([]byte, error) {
+	j := transcriptJSON{Exchanges: []exchangeJSON{}}
+	for _, x := range t.Exchanges {
+		jx := exchangeJSON{Command: x.Command, Err: x.Err}
+		for _, l := range x.Lines {
+			jx.Lines = append(jx.Lines, lineJSON{
+				Stream: l.Stream.String(), Name: l.Name, Text: string(l.Data)})
+		}
+		j.Exchanges = append(j.Exchanges, jx)
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON reads the form written by MarshalJSON.
+func (t *Transcript) UnmarshalJSON(b []byte) error {
+	var j transcriptJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	t.Exchanges = nil
+	for i, jx := range j.Exchanges {
+		x := Exchange{Command: jx.Command, Err: jx.Err}
+		for _, jl := range jx.Lines {
+			s, err := parseStream(jl.Stream)
+			if err != nil {
+				return fmt.Errorf("exchange %d; %w", i, err)
+			}
+			x.Lines = append(x.Lines,
+				Line{Data: []byte(jl.Text), Stream: s, Name: jl.Name})
+		}
+		t.Exchanges = append(t.Exchanges, x)
+	}
+	return nil
+}
+
+// parseStream returns the Stream with the given name.
+func parseStream(name string) (Stream, error) {
+	for _, s := range []Stream{StreamOut, StreamErr, StreamExtra} {
+		if s.String() == name {
+			return s, nil
+		}
+	}
+	return StreamOut, fmt.Errorf("unknown stream %q", name)
+}
+
+// WriteTo writes the transcript as indented JSON.
+func (t *Transcript) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, lineFeed))
+	return int64(n), err
+}
+
+// ReadTranscript reads a transcript written by WriteTo.
+func ReadTranscript(r io.Reader) (*Transcript, error) {
+	var t Transcript
+	if err := json.NewDecoder(r).Decode(&t); err != nil {
+		return nil, fmt.Errorf("reading transcript; %w", err)
+	}
+	return &t, nil
+}
+
+// TranscriptRecorder runs Commanders on a ProcRunner, as RunIt does, while
+// recording a Transcript of the session.  It should be the runner's only
+// user while recording, since it learns how each run went from the
+// runner's LastRunReport.
+type TranscriptRecorder struct {
+	runner *ProcRunner
+	m      sync.Mutex
+	t      Transcript
+}
+
+// NewTranscriptRecorder returns a recorder running Commanders on the
+// given runner.
+func NewTranscriptRecorder(r *ProcRunner) *TranscriptRecorder {
+	return &TranscriptRecorder{runner: r}
+}
+
+// RunIt runs the Commander, recording its command and output.  A command
+// that couldn't be run at all isn't recorded.
+func (r *TranscriptRecorder) RunIt(cmdr Commander, timeOut time.Duration) error {
+	lines, err := r.runner.Stream(cmdr, timeOut)
+	if err != nil {
+		return err
+	}
+	x := Exchange{Command: cmdr.String()}
+	for l := range lines {
+		x.Lines = append(x.Lines, l)
+	}
+	report, _ := r.runner.LastRunReport()
+	if report.Err != nil {
+		x.Err = report.Err.Error()
+	}
+	r.m.Lock()
+	r.t.Exchanges = append(r.t.Exchanges, x)
+	r.m.Unlock()
+	return report.Err
+}
+
+// Transcript returns a copy of the transcript recorded so far.
+func (r *TranscriptRecorder) Transcript() *Transcript {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return &Transcript{
+		Exchanges: append([]Exchange(nil), r.t.Exchanges...)}
+}
+
+// ReplayRunner replays a Transcript in place of a CLI, so that Commanders
+// can be tested against a real session without the CLI installed.  Like a
+// ProcRunner, it's a Runner, with RunContext and Close methods.
+//
+// Each run must be of the command next in the transcript.  The recorded
+// lines are written to the Commander, those of extra streams via
+// WriteExtra if it's an ExtraStreamWriter, and the recorded error, if
+// any, is returned.  Nothing else a ProcRunner does during a run, e.g.
+// enforcing an OutputLimit or checking an Expectation, is replayed.
+type ReplayRunner struct {
+	m    sync.Mutex
+	t    *Transcript
+	next int // index of the next exchange to replay
+}
+
+// NewReplayRunner returns a runner replaying the transcript.
+func NewReplayRunner(t *Transcript) *ReplayRunner {
+	return &ReplayRunner{t: t}
+}
+
+// RunIt replays the next exchange of the transcript to the Commander.
+// The time limit is ignored, since replaying takes no time.
+func (r *ReplayRunner) RunIt(cmdr Commander, _ time.Duration) error {
+	return r.RunContext(context.Background(), cmdr)
+}
+
+// RunContext replays the next exchange of the transcript to the Commander,
+// unless the context is already done.  It returns a ReplayMismatchError
+// if the Commander's command isn't the next one in the transcript.
+func (r *ReplayRunner) RunContext(ctx context.Context, cmdr Commander) error {
+	if cmdr == nil {
+		return fmt.Errorf("provide a Commander")
+	}
+	if err := ctx.Err(); err != nil {
+		return &RunCanceledError{Command: cmdr.String(), Cause: err}
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.next >= len(r.t.Exchanges) {
+		return &ReplayMismatchError{Index: r.next, Got: cmdr.String()}
+	}
+	x := r.t.Exchanges[r.next]
+	if x.Command != cmdr.String() {
+		return &ReplayMismatchError{
+			Index: r.next, Want: x.Command, Got: cmdr.String()}
+	}
+	r.next++
+	for _, l := range x.Lines {
+		if err := replayLine(cmdr, l); err != nil {
+			return fmt.Errorf("in command %q, Commander failed; %w", x.Command, err)
+		}
+	}
+	if x.Err != "" {
+		return errors.New(x.Err)
+	}
+	return nil
+}
+
+// replayLine writes a recorded line to the Commander.
+func replayLine(cmdr Commander, l Line) error {
+	if l.Stream == StreamExtra {
+		if w, ok := cmdr.(ExtraStreamWriter); ok {
+			return w.WriteExtra(l.Name, append([]byte(nil), l.Data...))
+		}
+	}
+	_, err := cmdr.Write(append([]byte(nil), l.Data...))
+	return err
+}
+
+// Remaining returns the number of exchanges not yet replayed.
+func (r *ReplayRunner) Remaining() int {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return len(r.t.Exchanges) - r.next
+}
+
+// Close ends the replay, returning an error if some of the transcript
+// wasn't replayed, so a test notices commands its code no longer runs.
+func (r *ReplayRunner) Close() error {
+	if n := r.Remaining(); n > 0 {
+		return fmt.Errorf("%d exchanges of the transcript not replayed", n)
+	}
+	return nil
+}
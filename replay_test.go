@@ -0,0 +1,82 @@
+package clirunner_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/monopole/clirunner/internal/testcli/tstcli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayRunner(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+		ErrSentinel: tstcli.MakeErrSentinelCommander(),
+	})
+	assert.NoError(t, err)
+
+	// Record a session.
+	rec := NewTranscriptRecorder(runner)
+	query := NewHoardingCommander(tstcli.CmdQuery + " limit 3")
+	assert.NoError(t, rec.RunIt(query, testingTimeout))
+	bogus := NewHoardingCommander("bogus")
+	assert.NoError(t, rec.RunIt(bogus, testingTimeout))
+	assert.NoError(t, runner.Close())
+	var b bytes.Buffer
+	_, err = rec.Transcript().WriteTo(&b)
+	assert.NoError(t, err)
+	assert.Contains(t, b.String(), `"stream": "Err"`)
+
+	// Replay it, without the CLI.
+	tr, err := ReadTranscript(&b)
+	assert.NoError(t, err)
+	assert.Len(t, tr.Exchanges, 2)
+	replay := NewReplayRunner(tr)
+	c := NewHoardingCommander(tstcli.CmdQuery + " limit 3")
+	assert.NoError(t, replay.RunIt(c, testingTimeout))
+	assert.Equal(t, query.Result(), c.Result())
+
+	// Commands must come in order.
+	err = replay.RunIt(NewHoardingCommander("status"), testingTimeout)
+	var mismatch *ReplayMismatchError
+	if assert.True(t, errors.As(err, &mismatch)) {
+		assert.Equal(t, 1, mismatch.Index)
+		assert.Equal(t, "bogus", mismatch.Want)
+	}
+	assert.Error(t, replay.Close())
+
+	c = NewHoardingCommander("bogus")
+	assert.NoError(t, replay.RunContext(context.Background(), c))
+	assert.Equal(t, bogus.Result(), c.Result())
+	assert.Equal(t, 0, replay.Remaining())
+	assert.Error(t, replay.RunIt(NewHoardingCommander("bogus"), 0))
+	assert.NoError(t, replay.Close())
+}
+
+func TestReplayRunner_Errors(t *testing.T) {
+	replay := NewReplayRunner(&Transcript{Exchanges: []Exchange{{
+		Command: "list",
+		Lines: []Line{
+			{Data: []byte("partial"), Stream: StreamOut},
+		},
+		Err: "command \"list\" timed out",
+	}}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var ce *RunCanceledError
+	assert.True(t, errors.As(
+		replay.RunContext(ctx, NewHoardingCommander("list")), &ce))
+
+	// The recorded error is returned.
+	c := NewHoardingCommander("list")
+	err := replay.RunIt(c, 0)
+	assert.EqualError(t, err, "command \"list\" timed out")
+	assert.Equal(t, "partial\n", c.Result())
+}
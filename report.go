@@ -0,0 +1,407 @@
+package clirunner
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// maxRunReports bounds the number of RunReports a ProcRunner retains.
+const maxRunReports = 1000
+
+// maxStartReports bounds the number of StartReports a ProcRunner retains.
+const maxStartReports = 100
+
+// RunReport describes one run of a Commander.
+type RunReport struct {
+	// Command is the command string that was run.
+	Command string
+	// Start is when the run began.
+	Start time.Time
+	// Duration is how long the run took, including sentinel detection.
+	Duration time.Duration
+	// LinesOut and LinesErr count the lines from stdOut and stdErr that were
+	// delivered to the Commander, or kept from it by a LineSampling.
+	// Sentinel values aren't counted.
+	LinesOut, LinesErr int
+	// BytesOut and BytesErr count the bytes in those lines, sans linefeeds.
+	BytesOut, BytesErr int
+	// Success is the Commander's Success value at the end of the run.
+	Success bool
+	// Err is the error returned by RunIt, if any.
+	Err error
+	// Truncated is true if the run ended before its sentinels were seen
+	// (e.g. a timeout, or the CLI died), so the Commander might have
+	// received incomplete output.
+	Truncated bool
+	// Partial is true if the run was cut short by its deadline, by
+	// cancellation or by its OutputLimit.  The Commander then holds every line that arrived
+	// before the cut, and nothing after it.
+	Partial bool
+	// OutputTruncated is true if the CLI said it cut the output short, per
+	// Parameters.TruncationPatterns, though the run ended as usual.
+	OutputTruncated bool
+	// ExitCode is the command's exit status, if the sentinels learned it
+	// (see ExitCodeSentinel), else nil.
+	ExitCode *int
+	// Warnings say what was amiss with a run that succeeded anyway, e.g.
+	// an optional err sentinel that didn't show up.
+	Warnings []string
+	// Phases break the run's Duration down.
+	Phases RunPhases
+}
+
+// RunLogger is told about every run of a ProcRunner, as the run ends.
+type RunLogger interface {
+	// LogRun reports a run by the runner with the given Parameters.Name.
+	LogRun(runner string, r RunReport)
+}
+
+// runReportJSON is the JSON form of RunReport.
+type runReportJSON struct {
+	Command         string         `json:"command"`
+	Start           time.Time      `json:"start"`
+	DurationMs      float64        `json:"durationMs"`
+	LinesOut        int            `json:"linesOut"`
+	LinesErr        int            `json:"linesErr"`
+	BytesOut        int            `json:"bytesOut"`
+	BytesErr        int            `json:"bytesErr"`
+	Success         bool           `json:"success"`
+	Err             string         `json:"error,omitempty"`
+	Truncated       bool           `json:"truncated"`
+	Partial         bool           `json:"partial"`
+	OutputTruncated bool           `json:"outputTruncated,omitempty"`
+	ExitCode        *int           `json:"exitCode,omitempty"`
+	Warnings        []string       `json:"warnings,omitempty"`
+	Phases          *runPhasesJSON `json:"phases,omitempty"`
+}
+
+// MarshalJSON renders the report with the duration in milliseconds and
+// the error as a string.
+func (r RunReport) MarshalJSON() ([]byte, error) {
+	j := runReportJSON{
+		Command:         r.Command,
+		Start:           r.Start,
+		DurationMs:      durationMs(r.Duration),
+		LinesOut:        r.LinesOut,
+		LinesErr:        r.LinesErr,
+		BytesOut:        r.BytesOut,
+		BytesErr:        r.BytesErr,
+		Success:         r.Success,
+		Truncated:       r.Truncated,
+		Partial:         r.Partial,
+		OutputTruncated: r.OutputTruncated,
+		ExitCode:        r.ExitCode,
+		Warnings:        r.Warnings,
+	}
+	if r.Phases != (RunPhases{}) {
+		p := r.Phases.toJSON()
+		j.Phases = &p
+	}
+	if r.Err != nil {
+		j.Err = r.Err.Error()
+	}
+	return json.Marshal(j)
+}
+
+// StartReport describes one start of the CLI subprocess, to show how long
+// it takes a CLI to become usable (e.g. to log in to a backend).
+type StartReport struct {
+	// Start is when the subprocess was started.
+	Start time.Time
+	// Spawn is how long it took to start the subprocess.
+	Spawn time.Duration
+	// Ready is how long after Start the CLI first completed a command, i.e.
+	// first produced its sentinels.  The command might be a setup command or
+	// a client's command.  Zero if the CLI hasn't completed one.
+	Ready time.Duration
+	// Setup is how long the SetupCommands and context replay took.
+	Setup time.Duration
+	// Err is the error, if any, from setting up the subprocess.
+	Err error
+	// Shutdown is how Close shut down the subprocess, or ShutdownNone if
+	// it hasn't.
+	Shutdown ShutdownStage
+}
+
+// ShutdownStage says how far Close had to go to shut down a CLI
+// subprocess.
+type ShutdownStage int
+
+const (
+	// ShutdownNone means Close hasn't shut down the subprocess.
+	ShutdownNone ShutdownStage = iota
+	// ShutdownGraceful means the subprocess exited after the ExitCommand
+	// and EOF.
+	ShutdownGraceful
+	// ShutdownTerminated means the subprocess exited after SIGTERM.
+	ShutdownTerminated
+	// ShutdownKilled means the subprocess exited after SIGKILL.
+	ShutdownKilled
+)
+
+func (s ShutdownStage) String() string {
+	switch s {
+	case ShutdownNone:
+		return "none"
+	case ShutdownGraceful:
+		return "graceful"
+	case ShutdownTerminated:
+		return "terminated"
+	case ShutdownKilled:
+		return "killed"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+// startReportJSON is the JSON form of StartReport.
+type startReportJSON struct {
+	Start    time.Time `json:"start"`
+	SpawnMs  float64   `json:"spawnMs"`
+	ReadyMs  *float64  `json:"readyMs,omitempty"`
+	SetupMs  float64   `json:"setupMs"`
+	Err      string    `json:"error,omitempty"`
+	Shutdown string    `json:"shutdown,omitempty"`
+}
+
+// MarshalJSON renders the report with durations in milliseconds and the
+// error as a string.  Ready is omitted if the CLI never became ready, and
+// Shutdown if the CLI hasn't been shut down.
+func (r StartReport) MarshalJSON() ([]byte, error) {
+	j := startReportJSON{
+		Start:   r.Start,
+		SpawnMs: durationMs(r.Spawn),
+		SetupMs: durationMs(r.Setup),
+	}
+	if r.Ready > 0 {
+		ms := durationMs(r.Ready)
+		j.ReadyMs = &ms
+	}
+	if r.Err != nil {
+		j.Err = r.Err.Error()
+	}
+	if r.Shutdown != ShutdownNone {
+		j.Shutdown = r.Shutdown.String()
+	}
+	return json.Marshal(j)
+}
+
+// SessionReport describes the life of a ProcRunner.
+type SessionReport struct {
+	// Name is the runner's name.
+	Name string
+	// Path is the CLI's path.
+	Path string
+	// Created is when the runner was made.
+	Created time.Time
+	// State is the runner's current state, e.g. "idle".
+	State string
+	// Queued counts the runs waiting for the current run to finish.
+	Queued int
+	// Starts counts the times the CLI subprocess was started.
+	Starts int
+	// RunCount counts all runs; FailCount counts those that returned an error.
+	RunCount, FailCount int
+	// RunTime is the total duration of all runs.
+	RunTime time.Duration
+	// LastError is the runner's most recent infrastructure error, if any.
+	LastError error
+	// Runs holds reports on the most recent runs, oldest first.
+	Runs []RunReport
+	// Startups holds reports on the most recent subprocess starts,
+	// oldest first.
+	Startups []StartReport
+}
+
+// sessionReportJSON is the JSON form of SessionReport.
+type sessionReportJSON struct {
+	Name      string        `json:"name"`
+	Path      string        `json:"path"`
+	Created   time.Time     `json:"created"`
+	State     string        `json:"state"`
+	Queued    int           `json:"queued,omitempty"`
+	Starts    int           `json:"starts"`
+	RunCount  int           `json:"runCount"`
+	FailCount int           `json:"failCount"`
+	RunTimeMs float64       `json:"runTimeMs"`
+	LastError string        `json:"lastError,omitempty"`
+	Runs      []RunReport   `json:"runs"`
+	Startups  []StartReport `json:"startups"`
+}
+
+// MarshalJSON renders the report with durations in milliseconds and
+// errors as strings.
+func (r SessionReport) MarshalJSON() ([]byte, error) {
+	j := sessionReportJSON{
+		Name:      r.Name,
+		Path:      r.Path,
+		Created:   r.Created,
+		State:     r.State,
+		Queued:    r.Queued,
+		Starts:    r.Starts,
+		RunCount:  r.RunCount,
+		FailCount: r.FailCount,
+		RunTimeMs: durationMs(r.RunTime),
+		Runs:      r.Runs,
+		Startups:  r.Startups,
+	}
+	if r.LastError != nil {
+		j.LastError = r.LastError.Error()
+	}
+	if j.Runs == nil {
+		j.Runs = []RunReport{}
+	}
+	if j.Startups == nil {
+		j.Startups = []StartReport{}
+	}
+	return json.Marshal(j)
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// runHistory accumulates run reports and statistics for a ProcRunner.
+// It survives subprocess restarts and Reconfigure.
+type runHistory struct {
+	// out and err gauge the queues of lines read from the streams.  They
+	// come first, to align them for atomic access on 32-bit platforms.
+	out, err  queueGauge
+	m         sync.Mutex
+	created   time.Time
+	starts    int
+	runCount  int
+	failCount int
+	runTime   time.Duration
+	runs      []RunReport
+	startups  []*StartReport // pointers, so a start can be updated later
+	timeouts  int
+	durations DurationHistogram
+}
+
+func newRunHistory() *runHistory {
+	return &runHistory{created: time.Now()}
+}
+
+// recordStart records a subprocess start, returning its report for
+// later updates.
+func (h *runHistory) recordStart(
+	start time.Time, spawn time.Duration) *StartReport {
+	h.m.Lock()
+	defer h.m.Unlock()
+	h.starts++
+	if len(h.startups) >= maxStartReports {
+		h.startups = h.startups[1:]
+	}
+	r := &StartReport{Start: start, Spawn: spawn}
+	h.startups = append(h.startups, r)
+	return r
+}
+
+// recordSetup records how setting up a started subprocess went.
+func (h *runHistory) recordSetup(r *StartReport, d time.Duration, err error) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	r.Setup = d
+	r.Err = err
+}
+
+// recordShutdown records how a started subprocess was shut down.
+func (h *runHistory) recordShutdown(r *StartReport, stage ShutdownStage) {
+	if r == nil {
+		return
+	}
+	h.m.Lock()
+	defer h.m.Unlock()
+	r.Shutdown = stage
+}
+
+// recordReady records that a started subprocess completed a command at
+// the given time, if it hadn't already.
+func (h *runHistory) recordReady(r *StartReport, at time.Time) {
+	if r == nil {
+		return
+	}
+	h.m.Lock()
+	defer h.m.Unlock()
+	if r.Ready == 0 {
+		r.Ready = at.Sub(r.Start)
+	}
+}
+
+func (h *runHistory) recordRun(r RunReport) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	h.runCount++
+	if r.Err != nil {
+		h.failCount++
+	}
+	h.runTime += r.Duration
+	h.durations.observe(r.Duration)
+	if isSentinelTimeout(r.Err) {
+		h.timeouts++
+	}
+	if len(h.runs) >= maxRunReports {
+		h.runs = h.runs[1:]
+	}
+	h.runs = append(h.runs, r)
+}
+
+// fill copies the history into the given report.
+func (h *runHistory) fill(r *SessionReport) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	r.Created = h.created
+	r.Starts = h.starts
+	r.RunCount = h.runCount
+	r.FailCount = h.failCount
+	r.RunTime = h.runTime
+	r.Runs = append([]RunReport(nil), h.runs...)
+	r.Startups = make([]StartReport, len(h.startups))
+	for i, s := range h.startups {
+		r.Startups[i] = *s
+	}
+}
+
+// fillMetrics copies the history's counters into the given Metrics.
+func (h *runHistory) fillMetrics(m *Metrics) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	m.Runs = h.runCount
+	m.Failures = h.failCount
+	m.SentinelTimeouts = h.timeouts
+	m.Starts = h.starts
+	if h.starts > 1 {
+		m.Restarts = h.starts - 1
+	}
+	m.Durations = h.durations.copy()
+	if m.Durations.Bounds == nil {
+		m.Durations.Bounds = DurationBuckets
+		m.Durations.Counts = make([]int, len(DurationBuckets))
+	}
+	h.out.fill(&m.Out)
+	h.err.fill(&m.Err)
+}
+
+// lastStart returns the most recent start report, and false if there
+// is none.
+func (h *runHistory) lastStart() (StartReport, bool) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	if len(h.startups) == 0 {
+		return StartReport{}, false
+	}
+	return *h.startups[len(h.startups)-1], true
+}
+
+// lastRun returns the most recent run report, and false if there is none.
+func (h *runHistory) lastRun() (RunReport, bool) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	if len(h.runs) == 0 {
+		return RunReport{}, false
+	}
+	return h.runs[len(h.runs)-1], true
+}
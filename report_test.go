@@ -0,0 +1,179 @@
+package clirunner_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/monopole/clirunner/internal/testcli/tstcli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunReport_MarshalJSON(t *testing.T) {
+	exitCode := 2
+	r := RunReport{
+		Command:   "query limit 3",
+		Start:     time.Date(2021, 11, 3, 14, 30, 0, 0, time.UTC),
+		Duration:  1500 * time.Microsecond,
+		LinesOut:  3,
+		LinesErr:  1,
+		BytesOut:  180,
+		BytesErr:  42,
+		Err:       fmt.Errorf("oops"),
+		Truncated: true,
+		Partial:   true,
+		ExitCode:  &exitCode,
+	}
+	data, err := json.Marshal(r)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+  "command": "query limit 3",
+  "start": "2021-11-03T14:30:00Z",
+  "durationMs": 1.5,
+  "linesOut": 3,
+  "linesErr": 1,
+  "bytesOut": 180,
+  "bytesErr": 42,
+  "success": false,
+  "error": "oops",
+  "truncated": true,
+  "partial": true,
+  "exitCode": 2
+}`, string(data))
+}
+
+func TestSessionReport_MarshalJSON(t *testing.T) {
+	r := SessionReport{
+		Name:      "silly",
+		Path:      "testcli",
+		Created:   time.Date(2021, 11, 3, 14, 30, 0, 0, time.UTC),
+		State:     "idle",
+		Starts:    1,
+		RunCount:  2,
+		FailCount: 0,
+		RunTime:   2 * time.Second,
+	}
+	data, err := json.Marshal(r)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+  "name": "silly",
+  "path": "testcli",
+  "created": "2021-11-03T14:30:00Z",
+  "state": "idle",
+  "starts": 1,
+  "runCount": 2,
+  "failCount": 0,
+  "runTimeMs": 2000,
+  "runs": [],
+  "startups": []
+}`, string(data))
+}
+
+func TestStartReport_MarshalJSON(t *testing.T) {
+	testCases := map[string]struct {
+		report   StartReport
+		expected string
+	}{
+		"ready": {
+			report: StartReport{
+				Start: time.Date(2021, 11, 3, 14, 30, 0, 0, time.UTC),
+				Spawn: 2 * time.Millisecond,
+				Ready: 250 * time.Millisecond,
+				Setup: 240 * time.Millisecond,
+			},
+			expected: `{
+  "start": "2021-11-03T14:30:00Z",
+  "spawnMs": 2,
+  "readyMs": 250,
+  "setupMs": 240
+}`,
+		},
+		"failedSetup": {
+			report: StartReport{
+				Start: time.Date(2021, 11, 3, 14, 30, 0, 0, time.UTC),
+				Spawn: 2 * time.Millisecond,
+				Setup: 3 * time.Second,
+				Err:   fmt.Errorf("login timed out"),
+			},
+			expected: `{
+  "start": "2021-11-03T14:30:00Z",
+  "spawnMs": 2,
+  "setupMs": 3000,
+  "error": "login timed out"
+}`,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			data, err := json.Marshal(tc.report)
+			assert.NoError(t, err)
+			assert.JSONEq(t, tc.expected, string(data))
+		})
+	}
+}
+
+func TestRunner_Report(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path: tstcli.TestCliPath,
+		Args: []string{
+			"--" + tstcli.FlagDisablePrompt,
+			"--" + tstcli.FlagRowToErrorOn, "3",
+		},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+		ErrSentinel: tstcli.MakeErrSentinelCommander(),
+	})
+	assert.NoError(t, err)
+	_, ok := runner.LastRunReport()
+	assert.False(t, ok)
+
+	assert.NoError(t, runner.RunIt(
+		NewHoardingCommander(tstcli.CmdQuery+" limit 5"), testingTimeout))
+	r, ok := runner.LastRunReport()
+	assert.True(t, ok)
+	assert.Equal(t, tstcli.CmdQuery+" limit 5", r.Command)
+	assert.Equal(t, 2, r.LinesOut)
+	assert.Equal(t, 1, r.LinesErr)
+	assert.True(t, r.Success)
+	assert.False(t, r.Truncated)
+	assert.NoError(t, r.Err)
+
+	assert.NoError(t, runner.RunIgnoringOutput(tstcli.CmdQuery+" limit 1"))
+	sr := runner.Report()
+	assert.Equal(t, tstcli.TestCliPath, sr.Name)
+	assert.Equal(t, "idle", sr.State)
+	assert.Equal(t, 1, sr.Starts)
+	assert.Equal(t, 2, sr.RunCount)
+	assert.Equal(t, 0, sr.FailCount)
+	assert.Len(t, sr.Runs, 2)
+	assert.Len(t, sr.Startups, 1)
+	assert.NoError(t, runner.Close())
+}
+
+func TestRunner_LastStartReport(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+		SetupCommands: []string{
+			tstcli.CmdSleep + " 100ms",
+			tstcli.CmdEcho + " hello",
+		},
+	})
+	assert.NoError(t, err)
+	_, ok := runner.LastStartReport()
+	assert.False(t, ok)
+	assert.NoError(t, runner.RunIgnoringOutput(tstcli.CmdQuery+" limit 1"))
+	r, ok := runner.LastStartReport()
+	assert.True(t, ok)
+	assert.NoError(t, r.Err)
+	assert.Greater(t, int64(r.Spawn), int64(0))
+	// Ready after the first setup command.
+	assert.GreaterOrEqual(t, int64(r.Ready), int64(100*time.Millisecond))
+	assert.GreaterOrEqual(t, int64(r.Setup), int64(100*time.Millisecond))
+	assert.NoError(t, runner.Close())
+}
@@ -0,0 +1,161 @@
+package clirunner
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+)
+
+// Response answers a prompt a CLI shows during a run, e.g. a "[y/N]"
+// confirmation.
+type Response struct {
+	// Prompt matches the prompt: the CLI's unfinished line of output on
+	// stdOut, i.e. what it shows while it waits for input, or a complete
+	// line.  The line is removed from the output.
+	// Example: regexp.MustCompile(`\[y/N\] ?$`)
+	Prompt *regexp.Regexp
+
+	// Answer is what to type at the prompt, without a linefeed.
+	Answer string
+}
+
+// Responder is an optional interface for a Commander whose command asks
+// for input as it runs.  Whenever a line of the command's output matches
+// one of the prompts, the ProcRunner writes the answer to the CLI's stdIn,
+// and carries on waiting for the sentinels.
+//
+// While a Responder's command runs, an unfinished line of output is held
+// back until it's finished or answered, so Responders and PayloadFramers
+// don't mix.
+type Responder interface {
+	// Responses returns the prompts to answer, the first match winning.
+	Responses() []Response
+}
+
+// responsesFor returns the Responses of the given Commander, if any.
+func responsesFor(c Commander) []Response {
+	for ; c != nil; c = unwrap(c) {
+		if r, ok := c.(Responder); ok {
+			return r.Responses()
+		}
+	}
+	return nil
+}
+
+// responseSlot holds the Responses of the current run, if any.  It's
+// shared with any warm standby, as the framingSlot is.
+type responseSlot struct {
+	mu        sync.Mutex
+	responses []Response
+}
+
+func (s *responseSlot) get() []Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.responses
+}
+
+func (s *responseSlot) set(r []Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses = r
+}
+
+// respondTo returns a function answering, on stdIn, the prompts of the
+// current run, per the slot.
+func (s *responseSlot) respondTo(stdIn io.Writer) promptAnswerer {
+	return func(line []byte) (bool, error) {
+		for _, r := range s.get() {
+			if !r.Prompt.Match(line) {
+				continue
+			}
+			if _, err := io.WriteString(
+				stdIn, r.Answer+string(lineFeed)); err != nil {
+				return false, fmt.Errorf(
+					"answering prompt %q; %w", r.Prompt, err)
+			}
+			return true, nil
+		}
+		return false, nil
+	}
+}
+
+// active returns true while the current run has Responses.
+func (s *responseSlot) active() bool { return len(s.get()) > 0 }
+
+// promptAnswerer answers the line, if it's a prompt, returning true if it
+// did.
+type promptAnswerer func(line []byte) (bool, error)
+
+// promptWatch reads a CLI's output, answering prompts and removing them.
+// It reads beneath the deframer, which waits for whole lines, since a
+// prompt is usually an unfinished one.  While prompts are expected, per
+// active, it holds back an unfinished line until it's finished or
+// answered; otherwise, it just passes the output along.
+type promptWatch struct {
+	r      io.Reader
+	answer promptAnswerer
+	active func() bool
+	buf    []byte // read, but not yet returned
+	out    []byte // ready to return
+	eof    error  // the error that ended reading, if any
+}
+
+func (w *promptWatch) Read(b []byte) (int, error) {
+	for len(w.out) == 0 {
+		if w.eof != nil {
+			w.out, w.buf = w.buf, nil
+			if len(w.out) == 0 {
+				return 0, w.eof
+			}
+			break
+		}
+		chunk := make([]byte, len(b))
+		n, err := w.r.Read(chunk)
+		w.buf = append(w.buf, chunk[:n]...)
+		w.eof = err
+		if err := w.scan(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, w.out)
+	w.out = w.out[n:]
+	return n, nil
+}
+
+// scan moves complete lines from buf to out, answering and removing
+// prompts, and then looks for a prompt in the unfinished line, holding it
+// back while prompts are expected.
+func (w *promptWatch) scan() error {
+	for w.active() {
+		i := bytes.IndexByte(w.buf, lineFeed)
+		if i < 0 {
+			break
+		}
+		line := w.buf[:i+1]
+		w.buf = w.buf[i+1:]
+		answered, err := w.answer(bytes.TrimRight(line, "\r\n"))
+		if err != nil {
+			return err
+		}
+		if !answered {
+			w.out = append(w.out, line...)
+		}
+	}
+	if len(w.buf) > 0 && w.active() {
+		answered, err := w.answer(w.buf)
+		if err != nil {
+			return err
+		}
+		if answered {
+			w.buf = nil
+		}
+	}
+	if !w.active() {
+		w.out = append(w.out, w.buf...)
+		w.buf = nil
+	}
+	return nil
+}
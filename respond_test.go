@@ -0,0 +1,54 @@
+package clirunner_test
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunner_Responder(t *testing.T) {
+	h := makeHarness(t)
+	c := NewHoardingCommander("drop table")
+	result := runAsync(h, WithResponses(c,
+		Response{Prompt: regexp.MustCompile(`^Password:$`), Answer: "s3cret"},
+		Response{Prompt: regexp.MustCompile(`\[y/N\]$`), Answer: "y"},
+	), time.Hour)
+	expectCommands(t, h, "drop table", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("Really drop? [y/N]"))
+	expectCommands(t, h, "y")
+	assert.NoError(t, h.Out("Password:"))
+	expectCommands(t, h, "s3cret")
+	assert.NoError(t, h.Out("dropped", "Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	// The prompts don't show up in the output.
+	assert.Equal(t, "dropped\n", c.Result())
+
+	// Other runs don't answer.
+	c = NewHoardingCommander("list")
+	result = runAsync(h, c, time.Hour)
+	expectCommands(t, h, "list", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("Really drop? [y/N]", "Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	assert.Equal(t, "Really drop? [y/N]\n", c.Result())
+	assert.NoError(t, h.Runner.Close())
+}
+
+func TestRunner_ResponderUnfinishedLine(t *testing.T) {
+	h := makeHarness(t)
+	c := NewHoardingCommander("drop table")
+	result := runAsync(h, WithResponses(c, Response{
+		Prompt: regexp.MustCompile(`\[y/N\] $`), Answer: "y",
+	}), time.Hour)
+	expectCommands(t, h, "drop table", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Prompt("Really drop? "))
+	assert.NoError(t, h.Prompt("[y/N] "))
+	expectCommands(t, h, "y")
+	assert.NoError(t, h.Out("dropped", "Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	assert.Equal(t, "dropped\n", c.Result())
+	assert.NoError(t, h.Runner.Close())
+}
@@ -0,0 +1,29 @@
+package clirunner
+
+import (
+	"context"
+	"time"
+)
+
+// Runner runs Commanders on a CLI, e.g. a ProcRunner, a ProcRunnerPool or
+// a ReplayRunner.  Code written against a Runner, rather than a ProcRunner,
+// can be tested without launching a CLI; see the mockrunner package.
+type Runner interface {
+	// RunIt runs the Commander, returning once its output is in, or the
+	// time limit passes.  A zero time limit means the default.
+	RunIt(c Commander, timeOut time.Duration) error
+
+	// RunContext is RunIt, limited by the context rather than a duration.
+	RunContext(ctx context.Context, c Commander) error
+
+	// Close releases the CLI.  The Runner can't be used afterwards,
+	// unless it says otherwise.
+	Close() error
+}
+
+// The Runners in this package.
+var (
+	_ Runner = &ProcRunner{}
+	_ Runner = &ProcRunnerPool{}
+	_ Runner = &ReplayRunner{}
+)
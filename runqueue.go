@@ -0,0 +1,86 @@
+package clirunner
+
+import (
+	"context"
+	"sync"
+)
+
+// runQueue lines up the runs asked of a ProcRunner, so that they take
+// turns at the CLI in the order they were asked for, rather than all but
+// one of them failing.  The zero value is an empty queue.
+type runQueue struct {
+	m    sync.Mutex
+	busy bool // some run has its turn
+	// waiting holds a channel per waiting run, closed when it's that
+	// run's turn, first come first served.
+	waiting []chan struct{}
+}
+
+// enter waits for the caller's turn, returning the context's error, and
+// giving up its place in the queue, if the context is done first.  A nil
+// error obliges the caller to call leave.
+func (q *runQueue) enter(ctx context.Context) error {
+	q.m.Lock()
+	if !q.busy {
+		q.busy = true
+		q.m.Unlock()
+		return nil
+	}
+	turn := make(chan struct{})
+	q.waiting = append(q.waiting, turn)
+	q.m.Unlock()
+	select {
+	case <-turn:
+		return nil
+	case <-ctx.Done():
+	}
+	q.m.Lock()
+	defer q.m.Unlock()
+	for i, c := range q.waiting {
+		if c == turn {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			return ctx.Err()
+		}
+	}
+	// The turn came anyway; pass it on.
+	q.handOff()
+	return ctx.Err()
+}
+
+// tryEnter takes the turn if nobody has it or is waiting for it,
+// returning false otherwise.  A true result obliges the caller to call
+// leave.
+func (q *runQueue) tryEnter() bool {
+	q.m.Lock()
+	defer q.m.Unlock()
+	if q.busy {
+		return false
+	}
+	q.busy = true
+	return true
+}
+
+// leave ends the caller's turn, giving it to the next waiting run.
+func (q *runQueue) leave() {
+	q.m.Lock()
+	defer q.m.Unlock()
+	q.handOff()
+}
+
+// handOff gives the turn to the first waiting run, if any.
+// The caller must hold m.
+func (q *runQueue) handOff() {
+	if len(q.waiting) == 0 {
+		q.busy = false
+		return
+	}
+	close(q.waiting[0])
+	q.waiting = q.waiting[1:]
+}
+
+// length returns the number of runs waiting their turn.
+func (q *runQueue) length() int {
+	q.m.Lock()
+	defer q.m.Unlock()
+	return len(q.waiting)
+}
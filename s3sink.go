@@ -0,0 +1,228 @@
+package clirunner
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Sink archives each run's output as an object in an S3-compatible
+// store (AWS S3, MinIO, Ceph, ...), keyed per SinkKey under Prefix, with
+// its RunReport, as JSON, in an object beside it with the suffix
+// ".status.json".  Output is spooled to a temporary file and uploaded as
+// the run ends, with a single PUT, signed with AWS Signature Version 4 and
+// addressed path-style, as every S3-compatible store supports.
+type S3Sink struct {
+	// Endpoint is the store's base URL.
+	// Example: "https://s3.us-east-1.amazonaws.com"
+	Endpoint string
+	// Region is the bucket's region.  Defaults to "us-east-1".
+	Region string
+	// Bucket is the bucket holding the archives.
+	Bucket string
+	// Prefix, if not empty, starts every key, e.g. "runs/".
+	Prefix string
+	// AccessKeyID, SecretAccessKey and SessionToken are the credentials.
+	// SessionToken is needed only for temporary credentials.
+	AccessKeyID, SecretAccessKey, SessionToken string
+	// Client makes the requests.  Defaults to a client giving up after a
+	// minute.
+	Client *http.Client
+	// TempDir holds the spooled output.  Defaults to os.TempDir.
+	TempDir string
+	// Clock, if not nil, tells the time to sign requests with, e.g. a
+	// FakeClock in tests.
+	Clock Clock
+}
+
+// Open starts spooling the run's output.
+func (s *S3Sink) Open(run SinkRun) (SinkWriter, error) {
+	if s.Endpoint == "" || s.Bucket == "" {
+		return nil, fmt.Errorf("S3Sink needs an Endpoint and a Bucket")
+	}
+	f, err := ioutil.TempFile(s.TempDir, "clirunner-sink-")
+	if err != nil {
+		return nil, err
+	}
+	w := &s3SinkWriter{s: s, key: s.Prefix + SinkKey(run), f: f,
+		h: sha256.New()}
+	w.w = bufio.NewWriter(io.MultiWriter(f, w.h))
+	return w, nil
+}
+
+type s3SinkWriter struct {
+	s   *S3Sink
+	key string
+	f   *os.File
+	h   hash.Hash // of what's written, as the upload's signature needs it
+	w   *bufio.Writer
+}
+
+func (w *s3SinkWriter) WriteLine(l Line) error {
+	return writeArchivedLine(w.w, l)
+}
+
+// Close uploads the output, then the status.
+func (w *s3SinkWriter) Close(r RunReport) error {
+	defer func() {
+		_ = w.f.Close()
+		_ = os.Remove(w.f.Name())
+	}()
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	size, err := w.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = w.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err = w.s.put(w.key, w.f, size, w.h.Sum(nil)); err != nil {
+		return err
+	}
+	status, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(status)
+	return w.s.put(w.key+".status.json",
+		bytes.NewReader(status), int64(len(status)), sum[:])
+}
+
+// put uploads an object, given its content's SHA-256.
+func (s *S3Sink) put(key string, body io.Reader, size int64, sum []byte) error {
+	u, err := url.Parse(strings.TrimSuffix(s.Endpoint, "/"))
+	if err != nil {
+		return fmt.Errorf("bad S3Sink Endpoint; %w", err)
+	}
+	u.Path += "/" + s.Bucket + "/" + key
+	// Send the path as it's signed.
+	u.RawPath = sigV4Path(u.Path)
+	req, err := http.NewRequest(http.MethodPut, u.String(), ioutil.NopCloser(body))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if strings.HasSuffix(key, ".json") {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	s.sign(req, hex.EncodeToString(sum), clockOrReal(s.Clock).Now())
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: time.Minute}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("uploading %s; %w", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("uploading %s; %s: %s",
+			key, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// sign adds AWS Signature Version 4 headers to the request, whose body has
+// the given hex SHA-256.
+func (s *S3Sink) sign(req *http.Request, payloadHash string, now time.Time) {
+	region := s.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+	request, signed := sigV4Request(req, payloadHash)
+	scope := day + "/" + region + "/s3/aws4_request"
+	toSign := sigV4StringToSign(amzDate, scope, request)
+	signature := hex.EncodeToString(
+		hmacSHA256(sigV4Key(s.SecretAccessKey, day, region, "s3"), toSign))
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKeyID, scope, signed, signature))
+}
+
+// sigV4Request returns the Signature Version 4 canonical request for the
+// request, whose body has the given hex SHA-256, and its signed headers,
+// i.e. all of them.
+func sigV4Request(req *http.Request, payloadHash string) (string, string) {
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonical strings.Builder
+	for _, k := range names {
+		canonical.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+	return strings.Join([]string{req.Method, sigV4Path(req.URL.Path),
+		req.URL.RawQuery, canonical.String(), signed, payloadHash}, "\n"), signed
+}
+
+// sigV4StringToSign returns the Signature Version 4 string to sign for
+// the canonical request.
+func sigV4StringToSign(amzDate, scope, request string) string {
+	requestHash := sha256.Sum256([]byte(request))
+	return "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" +
+		hex.EncodeToString(requestHash[:])
+}
+
+// sigV4Path returns the path as S3's Signature Version 4 has it, with
+// each segment URI-encoded: every byte but the unreserved characters of
+// RFC 3986 is escaped, uppercase, and nothing is encoded twice.
+func sigV4Path(path string) string {
+	if path == "" {
+		return "/"
+	}
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// sigV4Key derives the Signature Version 4 signing key.
+func sigV4Key(secret, day, region, service string) []byte {
+	k := hmacSHA256([]byte("AWS4"+secret), day)
+	k = hmacSHA256(k, region)
+	k = hmacSHA256(k, service)
+	return hmacSHA256(k, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
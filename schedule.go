@@ -0,0 +1,164 @@
+package clirunner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule says when a scheduled Commander should next run.
+type Schedule interface {
+	// Next returns the first run time strictly after the given time.
+	// A zero time means never.
+	Next(after time.Time) time.Time
+}
+
+// Every is a Schedule that runs at a fixed interval, measured from
+// the previous run time.  A non-positive interval never runs.
+type Every time.Duration
+
+// Next implements Schedule.
+func (e Every) Next(after time.Time) time.Time {
+	if e <= 0 {
+		return time.Time{}
+	}
+	return after.Add(time.Duration(e))
+}
+
+// cronSchedule is a Schedule parsed from a standard five field cron
+// expression.  Each field is a bit set of allowed values.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// If either day field is unrestricted, a day must match both;
+	// otherwise it need only match one (the traditional cron rule).
+	domStar, dowStar bool
+}
+
+// cronField describes the allowed range of a cron field.
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = [5]cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// cronSearchLimit bounds the search for a matching time, so that
+// impossible expressions like "0 0 30 2 *" don't search forever.
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// ParseCron parses a five field cron expression (minute, hour, day of
+// month, month, day of week), e.g. "*/15 9-17 * * 1-5".  Each field may
+// be "*", a number, a range "a-b", or a comma separated list of these,
+// and each of those may have a "/step" suffix.  Day of week is 0-7, with
+// both 0 and 7 meaning Sunday.  Times are computed in the location of
+// the time given to Next.
+func ParseCron(spec string) (Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf(
+			"cron expression %q has %d fields, want %d",
+			spec, len(fields), len(cronFields))
+	}
+	var bits [5]uint64
+	for i, f := range fields {
+		b, err := parseCronField(f, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %w", spec, err)
+		}
+		bits[i] = b
+	}
+	// Sunday is both 0 and 7.
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &cronSchedule{
+		minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3],
+		dow:     bits[4],
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(f string, cf cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(f, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			rng = part[:i]
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("bad step in %s field %q", cf.name, part)
+			}
+			step = n
+		}
+		lo, hi := cf.min, cf.max
+		if rng != "*" {
+			var err error
+			bounds := strings.SplitN(rng, "-", 2)
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("bad value in %s field %q", cf.name, part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("bad value in %s field %q", cf.name, part)
+				}
+			}
+		}
+		if lo < cf.min || hi > cf.max || lo > hi {
+			return 0, fmt.Errorf(
+				"%s field %q out of range %d-%d", cf.name, part, cf.min, cf.max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Next implements Schedule.
+func (cs *cronSchedule) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronSearchLimit)
+	for t.Before(limit) {
+		if !has(cs.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !cs.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !has(cs.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if !has(cs.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (cs *cronSchedule) dayMatches(t time.Time) bool {
+	dom := has(cs.dom, t.Day())
+	dow := has(cs.dow, int(t.Weekday()))
+	if cs.domStar || cs.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
@@ -0,0 +1,86 @@
+package clirunner_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvery_Next(t *testing.T) {
+	start := time.Date(2021, 11, 3, 14, 30, 0, 0, time.UTC)
+	assert.Equal(t, start.Add(time.Minute), Every(time.Minute).Next(start))
+	assert.True(t, Every(0).Next(start).IsZero())
+}
+
+func TestParseCron(t *testing.T) {
+	// A Wednesday.
+	start := time.Date(2021, 11, 3, 14, 30, 10, 0, time.UTC)
+	testCases := map[string]struct {
+		spec      string
+		expectErr string
+		expected  time.Time
+	}{
+		"everyMinute": {
+			spec:     "* * * * *",
+			expected: time.Date(2021, 11, 3, 14, 31, 0, 0, time.UTC),
+		},
+		"quarterHours": {
+			spec:     "*/15 * * * *",
+			expected: time.Date(2021, 11, 3, 14, 45, 0, 0, time.UTC),
+		},
+		"tomorrowMorning": {
+			spec:     "0 9 * * *",
+			expected: time.Date(2021, 11, 4, 9, 0, 0, 0, time.UTC),
+		},
+		"weekdaysOnly": {
+			spec:     "0 9 * * 1-5",
+			expected: time.Date(2021, 11, 4, 9, 0, 0, 0, time.UTC),
+		},
+		"sundayAsSeven": {
+			spec:     "0 0 * * 7",
+			expected: time.Date(2021, 11, 7, 0, 0, 0, 0, time.UTC),
+		},
+		"domOrDow": {
+			spec:     "0 0 1 * 5",
+			expected: time.Date(2021, 11, 5, 0, 0, 0, 0, time.UTC),
+		},
+		"nextYear": {
+			spec:     "30 6 15 1,7 *",
+			expected: time.Date(2022, 1, 15, 6, 30, 0, 0, time.UTC),
+		},
+		"never": {
+			spec: "0 0 30 2 *",
+		},
+		"tooFewFields": {
+			spec:      "* * * *",
+			expectErr: "has 4 fields, want 5",
+		},
+		"outOfRange": {
+			spec:      "0 24 * * *",
+			expectErr: `hour field "24" out of range 0-23`,
+		},
+		"badStep": {
+			spec:      "*/0 * * * *",
+			expectErr: `bad step in minute field "*/0"`,
+		},
+		"badValue": {
+			spec:      "* * * jan *",
+			expectErr: `bad value in month field "jan"`,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			s, err := ParseCron(tc.spec)
+			if tc.expectErr != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tc.expectErr)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, s.Next(start))
+		})
+	}
+}
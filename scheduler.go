@@ -0,0 +1,148 @@
+package clirunner
+
+import (
+	"sync"
+	"time"
+)
+
+// Scheduler runs registered Commanders on a Runner according to their
+// Schedules, handing each outcome to a callback.  This saves periodic
+// polling jobs from each needing their own ticker plumbing.
+//
+// Jobs run one at a time, in the Scheduler's own goroutine, since a
+// ProcRunner runs only one command at a time.  A job that comes due
+// while another is running waits its turn; a job that falls behind
+// doesn't run repeatedly to catch up.  A job that collides with some
+// other user of a ProcRunner waits its turn there.
+type Scheduler struct {
+	runner    Runner
+	timeOut   time.Duration // passed to RunIt
+	mu        sync.Mutex    // guards jobs
+	jobs      []*scheduledJob
+	wake      chan struct{} // signals that jobs changed
+	stop      chan struct{} // closed by Stop
+	done      chan struct{} // closed when the loop exits
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// JobCallback receives a scheduled Commander after a run, along with the
+// error from RunIt, if any.  It's called from the Scheduler's goroutine,
+// so it should return promptly.
+type JobCallback func(c Commander, err error)
+
+type scheduledJob struct {
+	schedule Schedule
+	cmdr     Commander
+	callback JobCallback
+	next     time.Time // zero means never
+}
+
+// NewScheduler returns a Scheduler that runs jobs on the given Runner,
+// using the given timeOut for each run.  Call Start to start it.
+func NewScheduler(r Runner, timeOut time.Duration) *Scheduler {
+	return &Scheduler{
+		runner:  r,
+		timeOut: timeOut,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Add registers a Commander to run per the Schedule.  The Commander is
+// Reset before each run, so the callback sees the results of one run.
+// The callback may be nil.  Jobs may be added before or after Start.
+func (s *Scheduler) Add(sched Schedule, c Commander, cb JobCallback) {
+	s.mu.Lock()
+	s.jobs = append(s.jobs, &scheduledJob{
+		schedule: sched, cmdr: c, callback: cb,
+		next: sched.Next(time.Now()),
+	})
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start starts running jobs.  Calls after the first are ignored.
+func (s *Scheduler) Start() {
+	s.startOnce.Do(func() {
+		go s.loop()
+	})
+}
+
+// Stop stops running jobs, waiting for a job in progress to finish.
+// It doesn't close the Runner.  A stopped Scheduler can't be restarted.
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	// If never started, make sure it never will be.
+	s.startOnce.Do(func() { close(s.done) })
+	<-s.done
+}
+
+func (s *Scheduler) loop() {
+	defer close(s.done)
+	for {
+		var timer *time.Timer
+		var fire <-chan time.Time
+		if next := s.nextRunTime(); !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			fire = timer.C
+		}
+		select {
+		case <-s.stop:
+		case <-s.wake:
+		case now := <-fire:
+			s.runDue(now)
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+	}
+}
+
+// nextRunTime returns the earliest time a job is due, or zero if none is.
+func (s *Scheduler) nextRunTime() (next time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		if !j.next.IsZero() && (next.IsZero() || j.next.Before(next)) {
+			next = j.next
+		}
+	}
+	return
+}
+
+// runDue runs, in order of registration, the jobs due at the given time.
+func (s *Scheduler) runDue(now time.Time) {
+	var due []*scheduledJob
+	s.mu.Lock()
+	for _, j := range s.jobs {
+		if !j.next.IsZero() && !j.next.After(now) {
+			due = append(due, j)
+			j.next = j.schedule.Next(now)
+		}
+	}
+	s.mu.Unlock()
+	for _, j := range due {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		j.cmdr.Reset()
+		err := s.runner.RunIt(j.cmdr, s.timeOut)
+		if j.callback != nil {
+			j.callback(j.cmdr, err)
+		}
+	}
+}
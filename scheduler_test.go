@@ -0,0 +1,56 @@
+package clirunner_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/monopole/clirunner/internal/testcli/tstcli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduler(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+	})
+	assert.NoError(t, err)
+	var mu sync.Mutex
+	var results []string
+	s := NewScheduler(runner, testingTimeout)
+	s.Add(
+		Every(100*time.Millisecond),
+		NewHoardingCommander(tstcli.CmdQuery+" limit 1"),
+		func(c Commander, err error) {
+			assert.NoError(t, err)
+			mu.Lock()
+			results = append(results, c.(*HoardingCommander).Result())
+			mu.Unlock()
+		})
+	// Never runs.
+	s.Add(Every(0), NewHoardingCommander(tstcli.CmdQuery+" limit 2"), nil)
+	s.Start()
+	time.Sleep(550 * time.Millisecond)
+	s.Stop()
+	mu.Lock()
+	defer mu.Unlock()
+	assert.GreaterOrEqual(t, len(results), 3)
+	for _, r := range results {
+		// Reset between runs, so each result is from one run.
+		assert.Equal(t, 1, strings.Count(r, "\n"))
+	}
+	assert.NoError(t, runner.Close())
+}
+
+func TestScheduler_StopWithoutStart(t *testing.T) {
+	s := NewScheduler(nil, testingTimeout)
+	s.Stop()
+	// Start after Stop does nothing.
+	s.Start()
+	s.Stop()
+}
@@ -0,0 +1,247 @@
+package clirunner
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// sealedMagic starts every sealed stream, naming its format.
+var sealedMagic = []byte("clirunner-sealed-v1\n")
+
+const (
+	// sealedChunkSize is the most plaintext sealed in one chunk.
+	sealedChunkSize = 64 * 1024
+	// sealedPrefixSize is the size of a stream's random nonce prefix; the
+	// rest of each chunk's nonce is its index and whether it's the last.
+	sealedPrefixSize = 7
+)
+
+// ErrSealedTruncated is returned reading a sealed stream that ends before
+// its last chunk, e.g. because the writer was never closed.
+var ErrSealedTruncated = errors.New("sealed stream truncated")
+
+// SealedWriter encrypts what's written to it with AES-GCM, in chunks,
+// each authenticated on its own, so that a session's capture can be kept
+// at rest without exposing its commands and output.  Use it as a runner's
+// DebugWriter, or wherever else a session is recorded, e.g.
+//
+//	f, _ := os.Create("session.sealed")
+//	w, _ := NewSealedWriter(f, key)
+//	defer w.Close()
+//	params.DebugWriter = w
+//
+// Read the result back with NewSealedReader and the same key.  Reordered,
+// altered or missing chunks are detected, as is a stream that was cut
+// short.
+//
+// Writes are buffered up to a chunk; Flush seals what's buffered at once,
+// and Close seals the last chunk.  A SealedWriter is safe for concurrent
+// use, and doesn't close the writer it wraps.
+type SealedWriter struct {
+	m      sync.Mutex
+	w      io.Writer
+	aead   cipher.AEAD
+	prefix []byte
+	index  uint32
+	buf    []byte
+	err    error // sticky
+	closed bool
+}
+
+// newSealingAEAD returns AES-GCM with the given key, of 16, 24 or 32 bytes.
+func newSealingAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// NewSealedWriter returns a SealedWriter writing to w with the given AES
+// key, of 16, 24 or 32 bytes.  It writes the stream's header at once.
+func NewSealedWriter(w io.Writer, key []byte) (*SealedWriter, error) {
+	aead, err := newSealingAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, sealedPrefixSize)
+	if _, err = rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	header := append(append([]byte(nil), sealedMagic...), prefix...)
+	if _, err = w.Write(header); err != nil {
+		return nil, err
+	}
+	return &SealedWriter{w: w, aead: aead, prefix: prefix}, nil
+}
+
+// Write buffers p, sealing each full chunk.
+func (s *SealedWriter) Write(p []byte) (int, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.closed {
+		return 0, fmt.Errorf("sealed writer is closed")
+	}
+	n := len(p)
+	for len(p) > 0 && s.err == nil {
+		k := sealedChunkSize - len(s.buf)
+		if k > len(p) {
+			k = len(p)
+		}
+		s.buf = append(s.buf, p[:k]...)
+		p = p[k:]
+		if len(s.buf) == sealedChunkSize {
+			s.seal(false)
+		}
+	}
+	if s.err != nil {
+		return 0, s.err
+	}
+	return n, nil
+}
+
+// Flush seals whatever is buffered, so that it's written.
+func (s *SealedWriter) Flush() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.closed {
+		return fmt.Errorf("sealed writer is closed")
+	}
+	if len(s.buf) > 0 && s.err == nil {
+		s.seal(false)
+	}
+	return s.err
+}
+
+// Close seals the last chunk.  Without it, the stream reads as truncated.
+func (s *SealedWriter) Close() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.err == nil {
+		s.seal(true)
+	}
+	return s.err
+}
+
+// seal writes the buffer as the next chunk.  The caller must hold m.
+func (s *SealedWriter) seal(last bool) {
+	sealed := s.aead.Seal(nil, sealedNonce(s.prefix, s.index, last), s.buf, nil)
+	s.buf = s.buf[:0]
+	s.index++
+	if s.index == 0 {
+		s.err = fmt.Errorf("sealed stream too long")
+		return
+	}
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(sealed)))
+	if _, err := s.w.Write(append(size[:], sealed...)); err != nil {
+		s.err = err
+	}
+}
+
+// sealedNonce returns the nonce of a chunk.
+func sealedNonce(prefix []byte, index uint32, last bool) []byte {
+	nonce := make([]byte, sealedPrefixSize+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[sealedPrefixSize:], index)
+	if last {
+		nonce[sealedPrefixSize+4] = 1
+	}
+	return nonce
+}
+
+// sealedReader decrypts a stream written by a SealedWriter.
+type sealedReader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	index  uint32
+	plain  []byte // decrypted, not yet read
+	done   bool   // the last chunk was read
+}
+
+// NewSealedReader returns a reader of the plaintext of a stream written by
+// a SealedWriter with the given key.  Reading returns an error, rather
+// than bad data, if the stream was altered, and ErrSealedTruncated if it
+// was cut short.
+func NewSealedReader(r io.Reader, key []byte) (io.Reader, error) {
+	aead, err := newSealingAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(r)
+	header := make([]byte, len(sealedMagic)+sealedPrefixSize)
+	if _, err = io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("reading sealed stream header; %w", err)
+	}
+	if !bytes.Equal(header[:len(sealedMagic)], sealedMagic) {
+		return nil, fmt.Errorf("not a sealed stream")
+	}
+	return &sealedReader{
+		r: br, aead: aead, prefix: header[len(sealedMagic):]}, nil
+}
+
+func (s *sealedReader) Read(p []byte) (int, error) {
+	for len(s.plain) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.plain)
+	s.plain = s.plain[n:]
+	return n, nil
+}
+
+// next decrypts the next chunk.
+func (s *sealedReader) next() error {
+	var size [4]byte
+	if _, err := io.ReadFull(s.r, size[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrSealedTruncated
+		}
+		return err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > sealedChunkSize+uint32(s.aead.Overhead()) {
+		return fmt.Errorf("sealed chunk %d is too big", s.index)
+	}
+	sealed := make([]byte, n)
+	if _, err := io.ReadFull(s.r, sealed); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrSealedTruncated
+		}
+		return err
+	}
+	// A chunk opens as the last or not; try the usual case first.
+	plain, err := s.aead.Open(
+		nil, sealedNonce(s.prefix, s.index, false), sealed, nil)
+	if err != nil {
+		plain, err = s.aead.Open(
+			nil, sealedNonce(s.prefix, s.index, true), sealed, nil)
+		if err != nil {
+			return fmt.Errorf("sealed chunk %d fails authentication", s.index)
+		}
+		s.done = true
+		if _, err = s.r.Peek(1); err != io.EOF {
+			return fmt.Errorf("data follows the last sealed chunk")
+		}
+	}
+	s.index++
+	s.plain = plain
+	return nil
+}
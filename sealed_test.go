@@ -0,0 +1,112 @@
+package clirunner_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/monopole/clirunner/internal/testcli/tstcli"
+	"github.com/stretchr/testify/assert"
+)
+
+var sealingKey = []byte("0123456789abcdef0123456789abcdef")
+
+func sealed(t *testing.T, chunks ...string) []byte {
+	var b bytes.Buffer
+	w, err := NewSealedWriter(&b, sealingKey)
+	assert.NoError(t, err)
+	for _, c := range chunks {
+		_, err = io.WriteString(w, c)
+		assert.NoError(t, err)
+		assert.NoError(t, w.Flush())
+	}
+	assert.NoError(t, w.Close())
+	return b.Bytes()
+}
+
+func unseal(data, key []byte) (string, error) {
+	r, err := NewSealedReader(bytes.NewReader(data), key)
+	if err != nil {
+		return "", err
+	}
+	plain, err := io.ReadAll(r)
+	return string(plain), err
+}
+
+func TestSealedWriter(t *testing.T) {
+	big := strings.Repeat("select * from secrets;\n", 10000)
+	testCases := map[string]struct {
+		chunks []string
+	}{
+		"empty": {},
+		"one":   {chunks: []string{"select 1;\n"}},
+		"many":  {chunks: []string{"a\n", "", "b\n", "c\n"}},
+		"big":   {chunks: []string{big, big}},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			data := sealed(t, tc.chunks...)
+			assert.NotContains(t, string(data), "select")
+			got, err := unseal(data, sealingKey)
+			assert.NoError(t, err)
+			assert.Equal(t, strings.Join(tc.chunks, ""), got)
+		})
+	}
+}
+
+func TestSealedReader_Errors(t *testing.T) {
+	data := sealed(t, "one\n", "two\n")
+
+	_, err := unseal(data, []byte("fedcba9876543210fedcba9876543210"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "fails authentication")
+
+	altered := append([]byte(nil), data...)
+	altered[len(altered)-1] ^= 1
+	_, err = unseal(altered, sealingKey)
+	assert.Error(t, err)
+
+	// Cut short within a chunk, or at a chunk boundary.
+	_, err = unseal(data[:len(data)-5], sealingKey)
+	assert.ErrorIs(t, err, ErrSealedTruncated)
+	var b bytes.Buffer
+	w, err := NewSealedWriter(&b, sealingKey)
+	assert.NoError(t, err)
+	_, err = io.WriteString(w, "one\n")
+	assert.NoError(t, err)
+	assert.NoError(t, w.Flush())
+	got, err := unseal(b.Bytes(), sealingKey)
+	assert.ErrorIs(t, err, ErrSealedTruncated)
+	assert.Equal(t, "one\n", got)
+
+	_, err = unseal([]byte("plain text"), sealingKey)
+	assert.Error(t, err)
+	_, err = NewSealedWriter(io.Discard, []byte("short"))
+	assert.Error(t, err)
+}
+
+func TestRunner_DebugWriter_Sealed(t *testing.T) {
+	var b bytes.Buffer
+	w, err := NewSealedWriter(&b, sealingKey)
+	assert.NoError(t, err)
+	runner, err := NewProcRunner(&Parameters{
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+		DebugWriter: w,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, runner.RunIt(
+		NewHoardingCommander(tstcli.CmdQuery+" limit 1"), time.Minute))
+	assert.NoError(t, runner.Close())
+	assert.NoError(t, w.Close())
+	assert.NotContains(t, b.String(), tstcli.CmdQuery)
+	got, err := unseal(b.Bytes(), sealingKey)
+	assert.NoError(t, err)
+	assert.Contains(t, got, tstcli.CmdQuery+" limit 1")
+}
@@ -0,0 +1,114 @@
+package clirunner
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// redactedSecret replaces secrets in debug output, reports and errors.
+const redactedSecret = "****"
+
+// AddSecret registers secrets, e.g. passwords or tokens that commands
+// carry, so that from then on they're replaced with "****" in the runner's
+// debug output (see Parameters.DebugWriter), in its RunReports, and in the
+// errors its runs return.  It's for secrets learned after the runner was
+// made; see Parameters.Secrets.  Secrets are never forgotten, and empty
+// ones are ignored.
+//
+// The Commanders themselves, and the errors they wrap, see the output as
+// it is; it's what the runner says about them that's redacted.
+func (pr *ProcRunner) AddSecret(secrets ...string) {
+	pr.secrets.add(secrets...)
+}
+
+// redactor replaces secrets with redactedSecret.  It's shared with any warm
+// standby.
+type redactor struct {
+	m       sync.RWMutex
+	secrets []string // longest first, so that none is left half redacted
+}
+
+// add registers secrets.
+func (r *redactor) add(secrets ...string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	for _, s := range secrets {
+		if s != "" && !r.has(s) {
+			r.secrets = append(r.secrets, s)
+		}
+	}
+	sort.SliceStable(r.secrets, func(i, j int) bool {
+		return len(r.secrets[i]) > len(r.secrets[j])
+	})
+}
+
+// has returns true if the secret is registered.  The caller must hold m.
+func (r *redactor) has(secret string) bool {
+	for _, s := range r.secrets {
+		if s == secret {
+			return true
+		}
+	}
+	return false
+}
+
+// redact returns the string with the secrets replaced.
+func (r *redactor) redact(s string) string {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, redactedSecret)
+	}
+	return s
+}
+
+// redactBytes returns the bytes with the secrets replaced.
+func (r *redactor) redactBytes(b []byte) []byte {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	for _, secret := range r.secrets {
+		b = bytes.ReplaceAll(b, []byte(secret), []byte(redactedSecret))
+	}
+	return b
+}
+
+// redactErr returns the error, wrapped to redact its message if that has
+// secrets in it.
+func (r *redactor) redactErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	if redacted := r.redact(msg); redacted != msg {
+		return &redactedError{err: err, msg: redacted}
+	}
+	return err
+}
+
+// redactedError is an error whose message has its secrets redacted.  The
+// wrapped error, found with errors.As, isn't.
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string { return e.msg }
+
+func (e *redactedError) Unwrap() error { return e.err }
+
+// redactingWriter redacts what it writes.  A log.Logger writes each entry
+// whole, so no secret is split between writes.
+type redactingWriter struct {
+	w io.Writer
+	r *redactor
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := w.w.Write(w.r.redactBytes(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,68 @@
+package clirunner_test
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use.
+type lockedBuffer struct {
+	m sync.Mutex
+	b bytes.Buffer
+}
+
+func (l *lockedBuffer) Write(p []byte) (int, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.b.Write(p)
+}
+
+func (l *lockedBuffer) String() string {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.b.String()
+}
+
+func TestRunner_Secrets(t *testing.T) {
+	var debug lockedBuffer
+	h := makeHarness(t, func(p *Parameters) {
+		p.Secrets = []string{"hunter2"}
+		p.DebugWriter = &debug
+	})
+	h.Runner.AddSecret("t0ken", "")
+
+	// The Commander sees the output as it is.
+	c := NewHoardingCommander("login hunter2")
+	result := runAsync(h, c, time.Hour)
+	expectCommands(t, h, "login hunter2", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("welcome, hunter2", "Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	assert.Equal(t, "welcome, hunter2\n", c.Result())
+	r, _ := h.Runner.LastRunReport()
+	assert.Equal(t, "login ****", r.Command)
+
+	// Errors are redacted, but still tell what happened.
+	result = runAsync(h, NewHoardingCommander("use t0ken"), time.Minute)
+	expectCommands(t, h, "use t0ken", "echo Rumpelstiltskin")
+	h.Clock.AwaitTimers(1)
+	h.Clock.Advance(time.Minute)
+	err := <-result
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `"use ****"`)
+	assert.NotContains(t, err.Error(), "t0ken")
+	assert.Contains(t, err.Error(), "expired before detection")
+	r, _ = h.Runner.LastRunReport()
+	assert.Equal(t, "use ****", r.Command)
+	assert.NotContains(t, r.Err.Error(), "t0ken")
+	_ = h.Runner.Close()
+
+	assert.Contains(t, debug.String(), "login ****")
+	assert.NotContains(t, debug.String(), "hunter2")
+	assert.NotContains(t, debug.String(), "t0ken")
+}
@@ -2,9 +2,14 @@ package clirunner
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"regexp"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,6 +17,9 @@ const (
 	// defaultSentinelDuration is short for a human, but long enough for simple,
 	// quick commands (the kind one wants as a sentinel) to finish.
 	defaultSentinelDuration = 3 * time.Second
+	// exitGracePeriod is how long to wait, after the subprocess exits, for
+	// its output streams to close too.
+	exitGracePeriod = 100 * time.Millisecond
 	// lineFeed makes it easier to find places where a linefeed is used.
 	lineFeed = '\n'
 )
@@ -24,26 +32,213 @@ const (
 // commands to appear on stdOut and/or stdErr.  When these sentinel values are
 // seen, one knows that theCmdr must be done.
 type sentinelFilter struct {
-	stdIn       io.Writer  // presumably the stdIn of some process.
-	theCmdr     Commander  // the command we're running
-	cmdrLock    sync.Mutex // lock on theCmdr to coordinate writing
-	outSentinel Commander  // for stdOut (required; command can be empty)
-	errSentinel Commander  // for stdErr (optional but recommended)
-	terminator  byte       // command line terminator (a convenience)
-	running     bool       // true if a command is running.
+	stdIn       io.Writer        // presumably the stdIn of some process.
+	theCmdr     Commander        // the command we're running
+	cmdrLock    sync.Mutex       // lock on theCmdr to coordinate writing
+	outSentinel SentinelStrategy // for stdOut (required)
+	errSentinel SentinelStrategy // for stdErr (optional but recommended)
+	issuedOut   string           // the out sentinel command last issued
+	terminator  byte             // command line terminator (a convenience)
+	running     int32            // 1 if a command is running; use atomically.
+	// pending delivers the outcome of the most recent sentinel search.
+	pending <-chan error
+	// canceled is closed to cancel the current run; cancelCause says why.
+	canceled    chan struct{}
+	cancelCause error
+	cancelOnce  *sync.Once
+	logger      *log.Logger // debug output
+	lineLogger  *log.Logger // debug output about lines of output
+	// emptyPolicy says what BeginRun does with an empty command.
+	emptyPolicy EmptyCommandPolicy
+	// errPrefix is the Parameters' ErrPrefix, which a Commander2 doesn't
+	// get.  errContinuing is true if the last line of stdErr delivered was
+	// a piece continued by the next.  Guarded by cmdrLock.
+	errPrefix     []byte
+	errContinuing bool
+	counts        lineCounts // lines delivered to theCmdr; guarded by cmdrLock
+	// phaseCmdr, if not nil, gets lines seen after the first sentinel
+	// match of a run; inPhase is true after that match.  Guarded by cmdrLock.
+	phaseCmdr Commander
+	inPhase   bool
+	// check, if not nil, has the CLI report on each command's output;
+	// tally holds the report, once seen.  Guarded by cmdrLock.
+	check *OutputCheck
+	tally *OutputTally
+	// detached is true once the lines of an expired or canceled run are no
+	// longer delivered to its Commander.  Guarded by cmdrLock.
+	detached bool
+	// flush is closed when a run expires or is canceled, asking the stream
+	// filters to deliver the lines already buffered; flushed is done when
+	// they have.
+	flush   chan struct{}
+	flushed *sync.WaitGroup
+	// passThruStop, if not nil, stops the passThru of the previous run.
+	// Guarded by cmdrLock.
+	passThruStop chan struct{}
+	// limit, if not nil, is the OutputLimit of runs whose Commander doesn't
+	// say otherwise; runLimit is the limit of the current run.  overLimit
+	// is true once the current run exceeded its limit, and limitHit is
+	// closed then if the run is to be aborted.  Guarded by cmdrLock.
+	limit     *OutputLimit
+	runLimit  *OutputLimit
+	overLimit bool
+	limitHit  chan struct{}
+	// sampling, if not nil, is the LineSampling of runs whose Commander
+	// doesn't say otherwise; sampler samples the current run, if not nil.
+	// Guarded by cmdrLock.
+	sampling *LineSampling
+	sampler  *lineSampler
+	// spoolMemory and spoolDir configure the spool of a Spooler's run;
+	// spool is that of the current run, if it's a Spooler's.
+	spoolMemory int
+	spoolDir    string
+	spool       *spool
+	spooler     Spooler
+	// errPolicy, if not nil, is the ErrSentinelPolicy of runs whose
+	// Commander doesn't say otherwise; runErrPolicy is that of the current
+	// run.
+	errPolicy    *ErrSentinelPolicy
+	runErrPolicy *ErrSentinelPolicy
+	// warnings about the current run, for its RunReport.  Guarded by
+	// cmdrLock.
+	warnings []string
+	// times are when the current run reached its phases.  Guarded by
+	// cmdrLock.
+	times runTimes
+	// expect checks the output of the current run against its Commander's
+	// Expectation, if any.  Guarded by cmdrLock.
+	expect *expectChecker
+	// overlay holds the commands issued around the current run's command,
+	// if any.
+	overlay *CommandOverlay
+	// exitCode is the exit status of the last command, if the sentinels
+	// know it.
+	exitCode *int
+	// tap, if not nil, gets the lines delivered in the current run, as
+	// they arrive.  Guarded by cmdrLock.
+	tap *lineQueue
+	// sink, if not nil, archives the lines of the current run.  Guarded by
+	// cmdrLock.
+	sink SinkWriter
+	// exited, if not nil, is closed when the subprocess writing the
+	// streams exits, even if the streams stay open.
+	exited <-chan struct{}
+	// outClosed, if not nil, is closed when the subprocess closes its
+	// stdOut, and reaped when it's been waited for, with its streams
+	// closed.  outGone is true once stdOut closed while the subprocess
+	// kept running.  Guarded by cmdrLock.
+	outClosed, reaped <-chan struct{}
+	outGone           bool
+	// tail holds the most recent lines of the current run, up to tailSize,
+	// for timeout errors.  Guarded by cmdrLock.
+	tail     *lineRing
+	tailSize int
+	// fatal, if not empty, has patterns matching lines that mean the
+	// session is dead.  fatalLine is the first line of the current run to
+	// match one, and fatalHit is closed then.  Guarded by cmdrLock.
+	fatal        []*regexp.Regexp
+	fatalLine    *Line
+	fatalPattern *regexp.Regexp
+	fatalHit     chan struct{}
+	// truncation, if not empty, has patterns matching lines by which the
+	// CLI says it cut the output short.  truncLine is the first line of
+	// the current run to match one.  Guarded by cmdrLock.
+	truncation       []*regexp.Regexp
+	failOnTruncation bool
+	truncLine        *Line
+	truncPattern     *regexp.Regexp
+	// clock times the runs.
+	clock Clock
+	// discard, if not nil, lets the stream scanners drop the lines of a
+	// run whose Commander discards them.
+	discard *discardSlot
+	// pieces, if not nil, marks the pieces of split lines that are
+	// continued.
+	pieces *pieceMarks
+	// stamps, if not nil, stamps lines as they're read, for LineWriters.
+	stamps *lineStamps
+	// extras are the CLI's ExtraStreams; extraErr is the first error
+	// delivering them in the current run.  Guarded by cmdrLock.
+	extras   []extraStream
+	extraErr error
+}
+
+// lineSource reads the lines of one stream in one run.  If asked to flush,
+// it acknowledges once nothing is buffered in its channel, so that the
+// lines that arrived before a run was cut short are all delivered.
+type lineSource struct {
+	ch      <-chan []byte
+	flush   <-chan struct{} // nil once acknowledged
+	flushed *sync.WaitGroup // acknowledges the flush
+	stop    <-chan struct{} // if not nil, ends the source when closed
+	// ended, if not nil, is closed once the lines on ch are all that will
+	// come, so the source ends when they're read.
+	ended <-chan struct{}
+}
+
+// next returns the next line, or false if there are no more.
+func (s *lineSource) next() ([]byte, bool) {
+	for {
+		// Once stopped, a line that's also ready belongs to someone else.
+		select {
+		case <-s.stop:
+			return nil, false
+		default:
+		}
+		select {
+		case line, ok := <-s.ch:
+			return line, ok
+		case <-s.flush:
+			select {
+			case line, ok := <-s.ch:
+				return line, ok
+			default:
+				s.ackFlush()
+			}
+		case <-s.stop:
+			return nil, false
+		case <-s.ended:
+			select {
+			case line, ok := <-s.ch:
+				return line, ok
+			default:
+				return nil, false
+			}
+		}
+	}
+}
+
+// ackFlush acknowledges a flush request, pending or not.  Idempotent.
+func (s *lineSource) ackFlush() {
+	if s.flushed != nil {
+		s.flush = nil
+		s.flushed.Done()
+		s.flushed = nil
+	}
+}
+
+// lineCounts counts lines (and their bytes) delivered to a Commander,
+// including those a LineSampling kept from it.
+type lineCounts struct {
+	linesOut, linesErr int
+	bytesOut, bytesErr int
 }
 
 // makeSentinelFilter returns an instance of sentinelFilter.
 func makeSentinelFilter(
-	os Commander, es Commander, t byte) *sentinelFilter {
+	os SentinelStrategy, es SentinelStrategy, t byte) *sentinelFilter {
 	if os == nil {
 		panic("must have an outSentinel")
 	}
-	if es != nil && os.String() == es.String() {
+	if es != nil && strategiesConflict(os, es) {
 		panic("the out and err sentinel commands must differ")
 		// The success criterion - the things being looked for - should also differ.
 	}
-	return &sentinelFilter{outSentinel: os, errSentinel: es, terminator: t}
+	return &sentinelFilter{
+		outSentinel: os, errSentinel: es, terminator: t,
+		logger: newDebugLogger(nil), lineLogger: newDebugLogger(nil),
+		clock: realClock{},
+	}
 }
 
 // BeginRun writes the command string to the given writer, presumably
@@ -51,20 +246,129 @@ func makeSentinelFilter(
 // It assures the command string is properly terminated.
 // It returns the actual command sent (possibly with different termination),
 // and any writer error.
+//
+// An empty command is handled according to the filter's EmptyCommandPolicy.
 func (cw *sentinelFilter) BeginRun(c Commander, w io.Writer) (string, error) {
-	cw.stdIn = w
-	cw.theCmdr = c
-	return cw.issueCommand(c.String())
+	cw.cmdrLock.Lock()
+	cw.counts = lineCounts{}
+	cw.exitCode = nil
+	cw.tail = newLineRing(cw.tailSize)
+	cw.fatalLine, cw.fatalPattern = nil, nil
+	cw.truncLine, cw.truncPattern = nil, nil
+	cw.fatalHit = make(chan struct{})
+	cw.inPhase = false
+	cw.tally = nil
+	cw.detached = false
+	cw.runLimit = limitFor(c, cw.limit)
+	cw.overLimit = false
+	cw.limitHit = make(chan struct{})
+	cw.sampler = samplerFor(c, cw.sampling)
+	if cw.spool != nil {
+		cw.spool.discard()
+	}
+	cw.spool, cw.spooler = nil, spoolerOf(c)
+	if cw.spooler != nil {
+		cw.spool = newSpool(cw.spoolMemory, cw.spoolDir)
+	}
+	cw.expect = expectationFor(c)
+	cw.runErrPolicy = errPolicyFor(c, cw.errPolicy)
+	cw.overlay = nil
+	if len(c.String()) > 0 {
+		cw.overlay = overlayFor(c)
+	}
+	cw.warnings = nil
+	cw.times = runTimes{}
+	cw.errContinuing = false
+	cw.extraErr = nil
+	if cw.pieces != nil {
+		cw.pieces.reset()
+	}
+	if cw.stamps != nil {
+		_, lw := c.(LineWriter)
+		cw.stamps.reset(lw)
+	}
+	cw.stopPassThruLocked()
+	if len(c.String()) > 0 || cw.emptyPolicy != EmptyCommandError {
+		// Set under the lock, as a passThru may still be delivering.
+		cw.theCmdr = c
+	}
+	cw.cmdrLock.Unlock()
+	cw.canceled = make(chan struct{})
+	cw.cancelOnce = &sync.Once{}
+	if len(c.String()) > 0 {
+		cw.stdIn = w
+		for _, pre := range cw.overlay.pre() {
+			if _, err := cw.issueCommand(pre); err != nil {
+				return "", err
+			}
+		}
+		defer cw.stamp(&cw.times.written)
+		return cw.issueCommand(c.String())
+	}
+	switch cw.emptyPolicy {
+	case EmptyCommandError:
+		return "", fmt.Errorf("empty command not allowed")
+	case EmptyCommandNewline:
+		cw.stdIn = w
+		return cw.writeToStdIn(string(lineFeed))
+	default:
+		cw.stdIn = w
+		// Nothing to send, but the run is underway; sentinels will follow.
+		atomic.StoreInt32(&cw.running, 1)
+		return "", nil
+	}
+}
+
+// swapSentinels replaces the sentinels with those offered by the Commander,
+// if it implements SentinelSwapper.
+func (cw *sentinelFilter) swapSentinels(c Commander) error {
+	var swapper SentinelSwapper
+	for ; c != nil && swapper == nil; c = unwrap(c) {
+		swapper, _ = c.(SentinelSwapper)
+	}
+	if swapper == nil {
+		return nil
+	}
+	newOut, newErr := swapper.NewSentinels()
+	out, es := cw.outSentinel, cw.errSentinel
+	if newOut != nil {
+		out = StrategyFromCommander(newOut)
+	}
+	if newErr != nil {
+		es = StrategyFromCommander(newErr)
+	}
+	return cw.setSentinels(out, es)
+}
+
+// setSentinels replaces the sentinels, checking that they differ.
+func (cw *sentinelFilter) setSentinels(out, es SentinelStrategy) error {
+	if es != nil && strategiesConflict(out, es) {
+		return fmt.Errorf(
+			"the out and err sentinel commands must differ; both are %q",
+			out.IssueAfter(""))
+	}
+	cw.logger.Printf("using sentinels out=%v err=%v", out, es)
+	out.Reset()
+	if es != nil {
+		es.Reset()
+	}
+	cw.outSentinel = out
+	cw.errSentinel = es
+	return nil
 }
 
 func (cw *sentinelFilter) issueCommand(c string) (string, error) {
 	if len(c) == 0 {
 		return "", nil
 	}
-	logger.Printf("issueCommand called with: %q\n", c)
-	fullCmd := assureCmdLineTermination([]byte(c), cw.terminator)
+	cw.logger.Printf("issueCommand called with: %q\n", c)
+	return cw.writeToStdIn(assureCmdLineTermination([]byte(c), cw.terminator))
+}
+
+// writeToStdIn writes a fully terminated command line to stdIn.
+func (cw *sentinelFilter) writeToStdIn(fullCmd string) (string, error) {
 	n, err := io.WriteString(cw.stdIn, fullCmd)
-	logger.Printf("wrote command to subprocess stdIn: %q\n", fullCmd)
+	cw.logger.Printf("wrote command to subprocess stdIn: %q\n", fullCmd)
 
 	if err != nil || n != len(fullCmd) {
 		err = fmt.Errorf(
@@ -72,22 +376,41 @@ func (cw *sentinelFilter) issueCommand(c string) (string, error) {
 	}
 	// Can call BeginRun even while running, otherwise we couldn't send sentinel
 	// commands to follow a 'normal' command.
-	cw.running = true
+	atomic.StoreInt32(&cw.running, 1)
 	return fullCmd, err
 }
 
 func (cw *sentinelFilter) resetFilter() {
-	cw.running = false
+	atomic.StoreInt32(&cw.running, 0)
 	cw.outSentinel.Reset()
 	if cw.errSentinel != nil {
 		cw.errSentinel.Reset()
 	}
 }
 
+// cancelRun makes a pending or future IssueSentinelsAndFilter or
+// awaitRecovery call for the current run return a RunCanceledError with the
+// given cause.
+func (cw *sentinelFilter) cancelRun(cause error) {
+	if cw.cancelOnce == nil {
+		return
+	}
+	cw.cancelOnce.Do(func() {
+		cw.cancelCause = cause
+		close(cw.canceled)
+	})
+}
+
+// canceledError returns the error for a canceled run.
+func (cw *sentinelFilter) canceledError() error {
+	return &RunCanceledError{
+		Command: cw.theCmdr.String(), Cause: cw.cancelCause}
+}
+
 // isRunning returns true if we've called BeginRun but not yet seen a sentinel
 // to indicate a completion.
 func (cw *sentinelFilter) isRunning() bool {
-	return cw.running
+	return atomic.LoadInt32(&cw.running) == 1
 }
 
 // IssueSentinelsAndFilter defines command completion.
@@ -111,141 +434,650 @@ func (cw *sentinelFilter) IssueSentinelsAndFilter(
 	chOut <-chan []byte, // scan this for command output
 	chErr <-chan []byte, // scan this for command errors
 	timeOut time.Duration, // time limit on finding the sentinel value
-) (err error) {
+) error {
+	return cw.issueSentinelsAndFilterContext(
+		context.Background(), chOut, chErr, timeOut)
+}
+
+// issueSentinelsAndFilterContext is IssueSentinelsAndFilter, but the
+// context's deadline, if any, supersedes timeOut.  If the context is
+// canceled first, it returns a RunCanceledError whose Cause is the
+// context's error, leaving the filter running as it does on expiration.
+func (cw *sentinelFilter) issueSentinelsAndFilterContext(
+	ctx context.Context, chOut <-chan []byte, chErr <-chan []byte,
+	timeOut time.Duration) (err error) {
 	if !cw.isRunning() {
 		return fmt.Errorf("nothing is running")
 	}
-	defer cw.resetFilter()
+	expired := false
+	defer func() {
+		// On expiration, leave the filter running; the caller might interrupt
+		// the command and call awaitRecovery.
+		if !expired {
+			cw.exitCode = exitCodeOf(cw.outSentinel, cw.errSentinel)
+			cw.resetFilter()
+		}
+	}()
+	if deadline, ok := ctx.Deadline(); ok {
+		timeOut = time.Until(deadline)
+		if timeOut <= 0 {
+			// Already expired; zero would mean the default.
+			timeOut = time.Nanosecond
+		}
+	}
 	if timeOut == 0 {
 		timeOut = defaultSentinelDuration
 	}
-	logger.Printf("entering IssueSentinelsAndFilter with timeOut = %s", timeOut)
-	logger.Printf("out sentinel = %q", cw.outSentinel.String())
+	if err = cw.swapSentinels(cw.theCmdr); err != nil {
+		return
+	}
+	cw.logger.Printf("entering IssueSentinelsAndFilter with timeOut = %s", timeOut)
 
 	// If this is empty, the client is presumably depending on the CLI to send
 	// a prompt, and the outSentinel knows how to recognize the prompt.
-	if _, err = cw.issueCommand(cw.outSentinel.String()); err != nil {
-		return
+	//
+	// A failure to issue a sentinel command usually means the subprocess
+	// already died (e.g. a broken pipe).  Keep filtering anyway, so that the
+	// Commander sees all the output the subprocess managed to produce, and so
+	// the error reported is the more informative closed stream error.
+	var issueErr error
+	if cw.check != nil {
+		_, issueErr = cw.issueCommand(cw.check.Command)
 	}
-	if err != nil {
-		logger.Printf("issueCommand err = %s", err.Error())
-		return err
+	for _, post := range cw.overlay.post() {
+		if issueErr == nil {
+			_, issueErr = cw.issueCommand(post)
+		}
 	}
-
-	// Send the error sentinel command (if non-empty).  This should be a command
-	// that does nothing more than generate some harmless error message on stdErr,
-	// e.g. an attempt to use a non-existent command.
+	cw.issuedOut = cw.outSentinel.IssueAfter(cw.theCmdr.String())
+	cw.logger.Printf("out sentinel = %q", cw.issuedOut)
+	sentinels := []string{cw.issuedOut}
 	if cw.errSentinel != nil {
-		logger.Printf("err sentinel = %v", cw.errSentinel.String())
-		if _, err = cw.issueCommand(cw.errSentinel.String()); err != nil {
-			return
+		// Send the error sentinel command (if non-empty).  This should be a
+		// command that does nothing more than generate some harmless error
+		// message on stdErr, e.g. an attempt to use a non-existent command.
+		c := cw.errSentinel.IssueAfter(cw.theCmdr.String())
+		cw.logger.Printf("err sentinel = %q", c)
+		if cw.runErrPolicy.issueFirst() {
+			sentinels = []string{c, cw.issuedOut}
+		} else {
+			sentinels = append(sentinels, c)
+		}
+	}
+	for _, c := range sentinels {
+		if issueErr == nil {
+			_, issueErr = cw.issueCommand(c)
 		}
 	}
+	if issueErr != nil {
+		cw.logger.Printf("issueCommand err = %s", issueErr.Error())
+	} else {
+		cw.stamp(&cw.times.issued)
+	}
+	if cw.startDiscarding() {
+		defer cw.stopDiscarding()
+	}
 
-	done := make(chan error)
+	done := make(chan error, 1)
+	cw.pending = done
+	cw.flush = make(chan struct{})
+	cw.flushed = &sync.WaitGroup{}
+	cw.flushed.Add(2 + len(cw.extras))
 	go cw.filterForSentinels(done, chOut, chErr)
 
-	logger.Printf("Waiting %s to see sentinel\n", timeOut)
+	cw.logger.Printf("Waiting %s to see sentinel\n", timeOut)
+	// abandoned is true if the Commander is to get nothing more.
+	abandoned := false
 
+	timer := cw.clock.NewTimer(timeOut)
+	defer timer.Stop()
 	select {
-	case <-time.After(timeOut):
+	case <-timer.C():
+		expired = true
+		cw.flushPending()
 		err = cw.expirationError(timeOut)
+	case <-ctx.Done():
+		expired = true
+		cw.flushPending()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = cw.expirationError(timeOut)
+		} else {
+			err = &RunCanceledError{
+				Command: cw.theCmdr.String(), Cause: ctx.Err()}
+		}
+	case <-cw.canceled:
+		cw.flushPending()
+		abandoned = true
+		err = cw.canceledError()
+	case <-cw.limitHit:
+		// Nothing more will be delivered, so there's nothing to flush.
+		expired = true
+		err = cw.limitError()
+	case <-cw.fatalHit:
+		// The session is dead; its output is of no further interest.
+		abandoned = true
+		err = cw.fatalError()
+	case <-cw.exited:
+		abandoned, err = cw.awaitStreamsClosed(done)
 	case err = <-done: // This is the one we want, hopefully with err==nil
+		if err == nil {
+			cw.stamp(&cw.times.sentinels)
+		}
+		if err == nil && (cw.errSentinel == nil || len(cw.extras) > 0) {
+			// Streams without sentinels have no end; deliver what they've
+			// buffered, so the Commander has what arrived in time.
+			cw.flushPending()
+		}
+	}
+	// The Commander holds the output that arrived in time, however the
+	// run ended, so that includes the end of any sample.
+	if dErr := cw.drainSample(); err == nil {
+		err = dErr
+	}
+	if sErr := cw.readSpool(); err == nil {
+		err = sErr
+	}
+	if abandoned {
+		cw.detach()
+	}
+	if err == nil {
+		err = issueErr
+	}
+	if err == nil {
+		err = cw.extraError()
+	}
+	if err == nil && cw.isOverLimit() {
+		err = cw.limitError()
+	}
+	if err == nil {
+		err = cw.verifyOutput()
+	}
+	if err == nil {
+		err = cw.checkExpectation()
+	}
+	if err == nil {
+		err = cw.truncationError()
 	}
 	return
 }
 
+// awaitStreamsClosed waits briefly, after the subprocess exited, for the
+// sentinel search to end.  Normally the streams close right behind the
+// subprocess, and the search ends with the sentinels or a closed stream
+// error.  If they don't close, the search is abandoned, keeping the output
+// that arrived before the exit, and returning true.
+func (cw *sentinelFilter) awaitStreamsClosed(done <-chan error) (bool, error) {
+	select {
+	case err := <-done:
+		return false, err
+	case <-time.After(exitGracePeriod):
+		cw.logger.Println("subprocess exited, but its streams are open")
+		cw.flushPending()
+		return true, &SubprocessExitedError{Command: cw.theCmdr.String()}
+	}
+}
+
+// flushPending waits (briefly) for the lines already buffered to be
+// delivered to the Commander, so that the Commander of a run cut short
+// holds all the output that arrived in time.
+func (cw *sentinelFilter) flushPending() {
+	close(cw.flush)
+	flushed := make(chan struct{})
+	go func(wg *sync.WaitGroup) {
+		wg.Wait()
+		close(flushed)
+	}(cw.flushed)
+	select {
+	case <-flushed:
+	case <-time.After(defaultSentinelDuration):
+		cw.logger.Println("gave up waiting for flush")
+	}
+}
+
+// detach stops delivering lines to the Commander of a run cut short, so
+// that it holds only the output that arrived in time, and can be used
+// safely by the caller.
+func (cw *sentinelFilter) detach() {
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	cw.detached = true
+}
+
+// drainSample delivers the lines held back by the run's sampler, if any.
+func (cw *sentinelFilter) drainSample() error {
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	if cw.sampler == nil || cw.detached {
+		return nil
+	}
+	for _, line := range cw.sampler.drain() {
+		if err := cw.write(StreamOut, line, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isOverLimit returns true if the current run exceeded its OutputLimit.
+func (cw *sentinelFilter) isOverLimit() bool {
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	return cw.overLimit
+}
+
+// limitError returns the error for a run that exceeded its OutputLimit.
+func (cw *sentinelFilter) limitError() error {
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	return &OutputLimitError{
+		Command: cw.theCmdr.String(), Limit: *cw.runLimit}
+}
+
+// checkFatal notes the first line of a run matching a fatal pattern.
+// The caller must hold cmdrLock.
+func (cw *sentinelFilter) checkFatal(stream Stream, line []byte) {
+	if cw.fatalLine != nil {
+		return
+	}
+	for _, re := range cw.fatal {
+		if re.Match(line) {
+			cw.logger.Printf("fatal line on std%s: %q", stream, string(line))
+			cw.fatalLine = &Line{
+				Data: append([]byte(nil), line...), Stream: stream}
+			cw.fatalPattern = re
+			close(cw.fatalHit)
+			return
+		}
+	}
+}
+
+// fatalError returns the error for a run that saw a fatal line.
+func (cw *sentinelFilter) fatalError() error {
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	return &FatalLineError{
+		Command: cw.theCmdr.String(),
+		Line:    *cw.fatalLine,
+		Pattern: cw.fatalPattern.String(),
+	}
+}
+
+// verifyOutput compares the output the CLI reported, if there's an
+// OutputCheck, with what the Commander received.
+func (cw *sentinelFilter) verifyOutput() error {
+	if cw.check == nil {
+		return nil
+	}
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	received := OutputTally{
+		Lines: cw.counts.linesOut,
+		Bytes: cw.counts.bytesOut + cw.counts.linesOut,
+	}
+	if cw.tally != nil && cw.tally.matches(received) {
+		return nil
+	}
+	return &OutputMismatchError{
+		Command:  cw.theCmdr.String(),
+		Reported: cw.tally,
+		Received: received,
+	}
+}
+
+// checkExpectation returns an ExpectationError if the output of the run
+// falls short of its Commander's Expectation.
+func (cw *sentinelFilter) checkExpectation() error {
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	return cw.expect.check(cw.theCmdr.String())
+}
+
+// takeTally returns true if the line is the output report of the
+// OutputCheck, recording the report.
+func (cw *sentinelFilter) takeTally(line []byte) bool {
+	if cw.check == nil {
+		return false
+	}
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	if cw.tally != nil {
+		return false
+	}
+	t, ok := cw.check.Parse(line)
+	if ok {
+		cw.logger.Printf("output report %+v", t)
+		cw.tally = &t
+	}
+	return ok
+}
+
+// awaitRecovery waits the given duration for the sentinels of a run that
+// expired in IssueSentinelsAndFilter, presumably after something was done
+// to unstick the command.  The filter is reset if the sentinels show up.
+func (cw *sentinelFilter) awaitRecovery(d time.Duration) error {
+	if !cw.isRunning() {
+		return fmt.Errorf("nothing is running")
+	}
+	timer := cw.clock.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return fmt.Errorf("no sentinel within %s of interrupt", d)
+	case <-cw.canceled:
+		cw.resetFilter()
+		return cw.canceledError()
+	case err := <-cw.pending:
+		if err != nil {
+			return err
+		}
+	}
+	cw.resetFilter()
+	return nil
+}
+
 // filterForSentinels returns after sentinel success on both stdOut and stdErr.
 func (cw *sentinelFilter) filterForSentinels(
 	done chan<- error, chOut <-chan []byte, chErr <-chan []byte,
 ) {
 	defer close(done)
-	var errOut, errErr error
+	var errOut, errErr, errPass error
 	var scanWg sync.WaitGroup
 	scanWg.Add(1)
 
-	go cw.filterForSentinel("Out", &errOut, &scanWg, cw.outSentinel, chOut)
-	if cw.errSentinel != nil {
+	var passThruDone chan struct{}
+	outEnded, over := make(chan struct{}), make(chan struct{})
+	defer close(over)
+	go cw.watchOutClosed(outEnded, over)
+	go cw.filterForSentinel(StreamOut, &errOut, &scanWg, cw.outSentinel,
+		&lineSource{ch: chOut, flush: cw.flush, flushed: cw.flushed,
+			ended: outEnded})
+	errSrc := &lineSource{ch: chErr, flush: cw.flush, flushed: cw.flushed}
+	// Streams without sentinels are passed through until the next run
+	// begins, passing along any stragglers.
+	optional := cw.errSentinel != nil && cw.runErrPolicy.optional()
+	var stop chan struct{}
+	if cw.errSentinel == nil || optional || len(cw.extras) > 0 {
+		stop = make(chan struct{})
+		cw.cmdrLock.Lock()
+		cw.passThruStop = stop
+		cw.cmdrLock.Unlock()
+	}
+	for _, x := range cw.extras {
+		go cw.passThruExtra(x.name, &lineSource{ch: x.ch,
+			flush: cw.flush, flushed: cw.flushed, stop: stop})
+	}
+	// An optional err sentinel is awaited only briefly after the out
+	// sentinel, so its filter has a way to stop.
+	var errStop, errDone chan struct{}
+	switch {
+	case optional:
+		errStop, errDone = make(chan struct{}), make(chan struct{})
+		errSrc.stop = errStop
+		go func() {
+			defer close(errDone)
+			var wg sync.WaitGroup
+			wg.Add(1)
+			cw.filterForSentinel(
+				StreamErr, &errErr, &wg, cw.errSentinel, errSrc)
+		}()
+	case cw.errSentinel != nil:
 		scanWg.Add(1)
-		go cw.filterForSentinel("Err", &errErr, &scanWg, cw.errSentinel, chErr)
-	} else {
-		go cw.passThru("Err", &errErr, chErr)
+		go cw.filterForSentinel(
+			StreamErr, &errErr, &scanWg, cw.errSentinel, errSrc)
+	default:
+		errSrc.stop = stop
+		passThruDone = make(chan struct{})
+		go cw.passThru(StreamErr, &errPass, errSrc, passThruDone)
 	}
 	scanWg.Wait()
+	errOut = cw.outGoneError(errOut, optional)
+	if optional {
+		if errOut == nil {
+			cw.awaitErrSentinel(errDone, errStop, &errErr, chErr, stop)
+		} else {
+			close(errStop)
+			<-errDone
+		}
+	}
+	var sce *streamClosedError
+	if passThruDone != nil && errors.As(errOut, &sce) {
+		// The subprocess is gone, so stdErr is closing too.  Let the
+		// Commander see everything that was sent to it.
+		<-passThruDone
+	}
+	if passThruDone != nil {
+		// The passThru's error can only be read once it's done.
+		select {
+		case <-passThruDone:
+			errErr = errPass
+		default:
+		}
+	}
 	if errOut != nil {
-		logger.Println("filterForSentinels found errOut = " + errOut.Error())
+		cw.logger.Println("filterForSentinels found errOut = " + errOut.Error())
 		done <- errOut
 		return
 	}
 	if errErr != nil {
-		logger.Println("filterForSentinels found errErr = " + errOut.Error())
+		cw.logger.Println("filterForSentinels found errErr = " + errErr.Error())
 		done <- errErr
 	}
 }
 
 func (cw *sentinelFilter) filterForSentinel(
-	title string, err *error,
-	wg *sync.WaitGroup, sentinel Commander, ch <-chan []byte) {
+	stream Stream, err *error,
+	wg *sync.WaitGroup, sentinel SentinelStrategy, src *lineSource) {
 	defer wg.Done()
-	logger.Printf("starting %q filter for command %q", title, sentinel)
+	defer src.ackFlush()
+	cw.logger.Printf("starting %q filter for sentinel %v", stream, sentinel)
 	for {
-		line, stillOpen := <-ch
-		logger.Printf("outCh returns line: %s", string(line))
+		line, stillOpen := src.next()
+		cw.lineLogger.Printf("outCh returns line: %s", string(line))
 		if !stillOpen {
-			logger.Println("outCh appears closed")
-			*err = fmt.Errorf(
-				"std%s closed while or before running %q, no sentinel detected",
-				title, cw.theCmdr.String())
+			cw.logger.Println("outCh appears closed")
+			*err = &streamClosedError{
+				stream: stream.String(), cmd: cw.theCmdr.String()}
 			return
 		}
 		panicIfNotActuallyALine(line)
-		if !sentinel.Success() {
-			logger.Printf("sending line %q to sentinel\n", string(line))
-			// Send the line to the sentinel value detector first,
-			// to see if we're done.
-			if _, *err = sentinel.Write(line); *err != nil {
-				logger.Printf("Catastrophe err=%s\n", *err)
-				// Catastrophe of some kind.
-				return
-			}
+		if stream == StreamOut && cw.takeTally(line) {
+			continue
 		}
-		if sentinel.Success() {
-			logger.Printf("sentinel success!\n")
+		cw.lineLogger.Printf("sending line %q to sentinel\n", string(line))
+		// Send the line to the sentinel value detector first,
+		// to see if we're done.
+		if sentinel.Match(Line{Data: line, Stream: stream}) {
+			cw.logger.Printf("sentinel success!\n")
+			cw.enterSentinelPhase()
 			// The line has the sentinel value; we're done.
 			return
 		}
 		// Pass the line to the current commander for processing.
-		cw.cmdrLock.Lock()
-		// There are two threads that might write this.
-		if _, *err = cw.theCmdr.Write(line); *err != nil {
+		if *err = cw.deliver(stream, line); *err != nil {
 			// Catastrophe of some kind.
-			cw.cmdrLock.Unlock()
 			return
 		}
-		cw.cmdrLock.Unlock()
 	}
 }
 
+// enterSentinelPhase notes that a sentinel was seen, so the command is done
+// and any further lines before the other sentinel are stragglers.
+func (cw *sentinelFilter) enterSentinelPhase() {
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	cw.inPhase = true
+}
+
+// deliver passes a line from the given stream to the current Commander,
+// counting it.  Stragglers go to the phaseCmdr instead, if there is one.
+func (cw *sentinelFilter) deliver(stream Stream, line []byte) error {
+	// There are two threads that might write this.
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	continued := cw.pieces != nil && cw.pieces.take(line)
+	first := true
+	if stream == StreamErr {
+		first = !cw.errContinuing
+		cw.errContinuing = continued
+	}
+	if cw.detached {
+		cw.lineLogger.Printf("dropping late line on std%s: %q", stream, string(line))
+		return nil
+	}
+	if cw.fatalLine != nil {
+		// The session is dead; nothing after the fatal line matters.
+		return nil
+	}
+	if cw.tail != nil {
+		cw.tail.add(Line{Data: line, Stream: stream})
+	}
+	cw.checkFatal(stream, line)
+	cw.checkTruncation(stream, line)
+	if cw.inPhase && cw.phaseCmdr != nil {
+		cw.lineLogger.Printf("straggler on std%s: %q", stream, string(line))
+		_, err := cw.phaseCmdr.Write(line)
+		return err
+	}
+	cw.archive(Line{Data: line, Stream: stream})
+	if cw.overLimit {
+		return nil
+	}
+	if cw.runLimit.exceededBy(cw.counts, len(line)) {
+		cw.logger.Printf("output limit exceeded on std%s", stream)
+		cw.overLimit = true
+		if cw.runLimit.Policy == OutputLimitAbort {
+			close(cw.limitHit)
+		}
+		return nil
+	}
+	if cw.tap != nil {
+		cw.addToTap(Line{Data: line, Stream: stream},
+			lineMark{cut: cw.prefixCut(stream, line, first), continued: continued})
+	}
+	now := cw.clock.Now()
+	if cw.times.firstLine.IsZero() {
+		cw.times.firstLine = now
+	}
+	cw.times.lastLine = now
+	defer func() { cw.times.parsing += cw.clock.Now().Sub(now) }()
+	cw.expect.observe(stream, line)
+	if stream == StreamErr {
+		cw.counts.linesErr++
+		cw.counts.bytesErr += len(line)
+	} else {
+		cw.counts.linesOut++
+		cw.counts.bytesOut += len(line)
+		if cw.sampler != nil {
+			for _, l := range cw.sampler.take(line) {
+				if err := cw.write(stream, l, true); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if cw.spool != nil {
+			cw.spool.add(line, continued)
+			return nil
+		}
+	}
+	if w, ok := cw.theCmdr.(ContinuedWriter); ok && continued {
+		return w.WriteContinued(line)
+	}
+	return cw.write(stream, line, first)
+}
+
+// stopPassThru stops the passThru of the previous run, if any, leaving
+// the lines that follow in the channels.
+func (cw *sentinelFilter) stopPassThru() {
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	cw.stopPassThruLocked()
+}
+
+// stopPassThruLocked is stopPassThru for a caller holding cmdrLock.
+func (cw *sentinelFilter) stopPassThruLocked() {
+	if cw.passThruStop != nil {
+		close(cw.passThruStop)
+		cw.passThruStop = nil
+	}
+}
+
+// setTap sets the tap of the current run.
+func (cw *sentinelFilter) setTap(tap *lineQueue) {
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	cw.tap = tap
+	if tap != nil && tap.recording && cw.stamps != nil {
+		// Its lines are stamped for whoever gets them.
+		cw.stamps.reset(true)
+	}
+}
+
+// addToTap passes a line to the tap.  A recorder gets the line's stamp and
+// marks too.  The caller must hold cmdrLock.
+func (cw *sentinelFilter) addToTap(l Line, mark lineMark) {
+	if !cw.tap.recording {
+		cw.tap.add(l)
+		return
+	}
+	var st lineStamp
+	if _, ok := cw.theCmdr.(LineWriter); ok {
+		// Leave the stamp for the Commander.
+		st = cw.stamps.peek(l.Data, cw.clock.Now())
+	} else {
+		st = cw.stamps.take(l.Data, cw.clock.Now())
+	}
+	l.Seq, l.Time = st.seq, st.at
+	cw.tap.record(l, mark)
+}
+
+// prefixCut returns the length of the ErrPrefix a Commander2 wouldn't get
+// of the line.  The caller must hold cmdrLock.
+func (cw *sentinelFilter) prefixCut(stream Stream, line []byte, first bool) int {
+	if stream != StreamErr || !first || !bytes.HasPrefix(line, cw.errPrefix) {
+		return 0
+	}
+	return len(cw.errPrefix)
+}
+
+// lineCounts returns the counts of lines delivered in the current run.
+func (cw *sentinelFilter) lineCounts() lineCounts {
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	return cw.counts
+}
+
 func (cw *sentinelFilter) passThru(
-	title string, err *error, ch <-chan []byte) {
+	stream Stream, err *error, src *lineSource, done chan<- struct{}) {
+	defer close(done)
+	defer src.ackFlush()
 	for {
-		line, stillOpen := <-ch
+		line, stillOpen := src.next()
 		if !stillOpen {
 			return
 		}
 		panicIfNotActuallyALine(line)
 		// Pass the line to the current commander for processing.
-		cw.cmdrLock.Lock()
-		// There are two threads that might write this.
-		if _, *err = cw.theCmdr.Write(line); *err != nil {
+		if *err = cw.deliver(stream, line); *err != nil {
 			// Catastrophe of some kind.
-			cw.cmdrLock.Unlock()
 			return
 		}
-		cw.cmdrLock.Unlock()
 	}
 }
 
+// streamClosedError reports that the subprocess closed one of its output
+// streams before the sentinel value was seen on it.
+type streamClosedError struct {
+	stream string // "Out" or "Err"
+	cmd    string // the command that was running
+}
+
+func (e *streamClosedError) Error() string {
+	return fmt.Sprintf(
+		"std%s closed while or before running %q, no sentinel detected",
+		e.stream, e.cmd)
+}
+
 // Paranoia check; make sure all lines coming back are indeed "lines"
 // in the sense that they do not contain a linefeed.
 func panicIfNotActuallyALine(line []byte) {
@@ -257,24 +1089,56 @@ func panicIfNotActuallyALine(line []byte) {
 	}
 }
 
-func (cw *sentinelFilter) expirationError(d time.Duration) error {
-	c := cw.theCmdr.String()
+// sentinelTimeoutError reports that a command's sentinels weren't detected
+// before the run's deadline.
+type sentinelTimeoutError struct {
+	cmd      string        // the command that was running
+	sentinel string        // the out sentinel command, empty for a prompt
+	timeOut  time.Duration // the deadline that expired
+	tail     []Line        // the most recent lines of output
+}
+
+func (e *sentinelTimeoutError) Error() string {
 	msg := fmt.Sprintf(
-		"in command %q, time %s expired before detection of ", c, d)
-	if cw.outSentinel.String() == "" {
-		return fmt.Errorf(msg + "prompt")
+		"in command %q, time %s expired before detection of ", e.cmd, e.timeOut)
+	if e.sentinel == "" {
+		msg += "prompt"
+	} else {
+		msg += fmt.Sprintf("output from sentinel command %q", e.sentinel)
+	}
+	return msg + "; " + describeTail(e.tail)
+}
+
+func (cw *sentinelFilter) expirationError(d time.Duration) error {
+	return &sentinelTimeoutError{
+		cmd:      cw.theCmdr.String(),
+		sentinel: cw.issuedOut,
+		timeOut:  d,
+		tail:     cw.recentLines(),
+	}
+}
+
+// recentLines returns the most recent lines of the current run.
+func (cw *sentinelFilter) recentLines() []Line {
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	if cw.tail == nil {
+		return nil
 	}
-	return fmt.Errorf(
-		msg+"output from sentinel command %q", cw.outSentinel.String())
+	return cw.tail.contents()
 }
 
 // assureCmdLineTermination assures that the last characters of a command line
-// are correct.
+// are correct.  An empty line yields a bare linefeed; there's nothing there to
+// terminate.
 func assureCmdLineTermination(c []byte, terminator byte) string {
-	if c[len(c)-1] == lineFeed {
+	if len(c) > 0 && c[len(c)-1] == lineFeed {
 		// Slice it off avoid confusion, replace momentarily.  Cap() unchanged.
 		c = c[:len(c)-1]
 	}
+	if len(c) == 0 {
+		return string(lineFeed)
+	}
 	if terminator > 0 && c[len(c)-1] != terminator {
 		c = append(c, terminator)
 	}
@@ -2,6 +2,9 @@ package clirunner
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,8 +14,14 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// makeTestFilter makes a filter using the default strategy.
+func makeTestFilter(out, es Commander, t byte) *sentinelFilter {
+	return makeSentinelFilter(
+		StrategyFromCommander(out), StrategyFromCommander(es), t)
+}
+
 func TestSentinelFilter_BeginRun(t *testing.T) {
-	cw := makeSentinelFilter(tstcli.MakeOutSentinelCommander(), nil, ';')
+	cw := makeTestFilter(tstcli.MakeOutSentinelCommander(), nil, ';')
 	assert.False(t, cw.isRunning())
 	cmdr := &cmdrs.KondoCommander{Command: "kondo"}
 	var stdIn bytes.Buffer
@@ -23,10 +32,52 @@ func TestSentinelFilter_BeginRun(t *testing.T) {
 	assert.True(t, cw.isRunning())
 }
 
+func TestSentinelFilter_BeginRun_emptyCommand(t *testing.T) {
+	testCases := map[string]struct {
+		policy        EmptyCommandPolicy
+		expectErr     bool
+		expectRunning bool
+		expectStdIn   string
+	}{
+		"noOp": {
+			policy:        EmptyCommandNoOp,
+			expectRunning: true,
+			expectStdIn:   "",
+		},
+		"error": {
+			policy:        EmptyCommandError,
+			expectErr:     true,
+			expectRunning: false,
+			expectStdIn:   "",
+		},
+		"newline": {
+			policy:        EmptyCommandNewline,
+			expectRunning: true,
+			expectStdIn:   "\n",
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			cw := makeTestFilter(tstcli.MakeOutSentinelCommander(), nil, ';')
+			cw.emptyPolicy = tc.policy
+			var stdIn bytes.Buffer
+			c, err := cw.BeginRun(&cmdrs.KondoCommander{}, &stdIn)
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectStdIn, c)
+			assert.Equal(t, tc.expectStdIn, stdIn.String())
+			assert.Equal(t, tc.expectRunning, cw.isRunning())
+		})
+	}
+}
+
 func TestSentinelFilter_WatchAndWait_timeout(t *testing.T) {
 	sentinel := tstcli.MakeOutSentinelCommander()
 	cmdr := cmdrs.NewHoardingCommander("hoard")
-	cw := makeSentinelFilter(sentinel, nil, ';')
+	cw := makeTestFilter(sentinel, nil, ';')
 	var stdIn bytes.Buffer
 	_, err := cw.BeginRun(cmdr, &stdIn)
 	assert.NoError(t, err)
@@ -41,10 +92,100 @@ func TestSentinelFilter_WatchAndWait_timeout(t *testing.T) {
 		"time 1s expired before detection of output from sentinel command")
 }
 
+// slowCommander hoards lines, slowly.
+type slowCommander struct {
+	*cmdrs.HoardingCommander
+}
+
+func (c *slowCommander) Write(data []byte) (int, error) {
+	time.Sleep(5 * time.Millisecond)
+	return c.HoardingCommander.Write(data)
+}
+
+func TestSentinelFilter_WatchAndWait_timeoutFlushes(t *testing.T) {
+	sentinel := tstcli.MakeOutSentinelCommander()
+	cmdr := &slowCommander{cmdrs.NewHoardingCommander("hoard")}
+	cw := makeTestFilter(sentinel, nil, ';')
+	var stdIn bytes.Buffer
+	_, err := cw.BeginRun(cmdr, &stdIn)
+	assert.NoError(t, err)
+	// All this arrives before the deadline, but the Commander is too slow
+	// to handle it before the deadline.
+	stdOut := make(chan []byte, 100)
+	var expected string
+	for i := 0; i < 20; i++ {
+		line := fmt.Sprintf("line %d", i)
+		stdOut <- []byte(line)
+		expected += line + "\n"
+	}
+	stdErr := make(chan []byte, 100)
+	stdErr <- []byte("complaint")
+	expected += "complaint\n"
+	err = cw.IssueSentinelsAndFilter(stdOut, stdErr, 20*time.Millisecond)
+	var te *sentinelTimeoutError
+	assert.True(t, errors.As(err, &te))
+	// Compare sans order, since stdErr and stdOut interleave.
+	assert.ElementsMatch(t,
+		strings.Split(expected, "\n"), strings.Split(cmdr.Result(), "\n"))
+	// Once detached, as ProcRunner does, lines arriving after the deadline
+	// aren't delivered.
+	cw.detach()
+	stdOut <- []byte("late")
+	stdErr <- []byte("late")
+	time.Sleep(50 * time.Millisecond)
+	assert.NotContains(t, cmdr.Result(), "late")
+}
+
+func TestSentinelFilter_WatchAndWait_timeoutTail(t *testing.T) {
+	sentinel := tstcli.MakeOutSentinelCommander()
+	cmdr := cmdrs.NewHoardingCommander("hoard")
+	cw := makeTestFilter(sentinel, nil, ';')
+	cw.tailSize = 2
+	var stdIn bytes.Buffer
+	_, err := cw.BeginRun(cmdr, &stdIn)
+	assert.NoError(t, err)
+	err = cw.IssueSentinelsAndFilter(
+		make(chan []byte), make(chan []byte), 10*time.Millisecond)
+	assert.Contains(t, err.Error(), "; no output seen")
+
+	_, err = cw.BeginRun(cmdr, &stdIn)
+	assert.NoError(t, err)
+	stdOut := make(chan []byte, 10)
+	for _, l := range []string{"one", "two", "Password: "} {
+		stdOut <- []byte(l)
+	}
+	err = cw.IssueSentinelsAndFilter(stdOut, make(chan []byte), 20*time.Millisecond)
+	var te *sentinelTimeoutError
+	assert.True(t, errors.As(err, &te))
+	assert.Equal(t, []Line{
+		{Data: []byte("two"), Stream: StreamOut},
+		{Data: []byte("Password: "), Stream: StreamOut},
+	}, te.tail)
+	assert.Contains(t, err.Error(),
+		`; last 2 lines of output: stdOut "two", stdOut "Password: "`)
+}
+
+func TestLineRing(t *testing.T) {
+	r := newLineRing(3)
+	assert.Empty(t, r.contents())
+	for _, l := range []string{"a", "b", "c", "d", "e"} {
+		r.add(Line{Data: []byte(l)})
+	}
+	var got []string
+	for _, l := range r.contents() {
+		got = append(got, string(l.Data))
+	}
+	assert.Equal(t, []string{"c", "d", "e"}, got)
+
+	r = newLineRing(0)
+	r.add(Line{Data: []byte("a")})
+	assert.Empty(t, r.contents())
+}
+
 func TestSentinelFilter_WatchAndWait_noTimeout(t *testing.T) {
 	sentinel := tstcli.MakeOutSentinelCommander()
 	cmdr := cmdrs.NewHoardingCommander("hoard")
-	cw := makeSentinelFilter(sentinel, nil, ';')
+	cw := makeTestFilter(sentinel, nil, ';')
 	var stdIn bytes.Buffer
 	_, err := cw.BeginRun(cmdr, &stdIn)
 	assert.NoError(t, err)
@@ -74,7 +215,7 @@ func TestSentinelFilter_WatchAndWait_bothOutAndError(t *testing.T) {
 	outSentinel := tstcli.MakeOutSentinelCommander()
 	errSentinel := tstcli.MakeErrSentinelCommander()
 	cmdr := cmdrs.NewHoardingCommander("hoard")
-	cw := makeSentinelFilter(outSentinel, errSentinel, ';')
+	cw := makeTestFilter(outSentinel, errSentinel, ';')
 	var stdIn bytes.Buffer
 	_, err := cw.BeginRun(cmdr, &stdIn)
 	assert.NoError(t, err)
@@ -111,11 +252,284 @@ oh no some error from command n!
 `[1:], cmdr.Result())
 }
 
+// swappingCommander is a command that changes the CLI's prompt.
+func TestSentinelFilter_WatchAndWait_stragglers(t *testing.T) {
+	outSentinel := tstcli.MakeOutSentinelCommander()
+	errSentinel := tstcli.MakeErrSentinelCommander()
+	cmdr := cmdrs.NewHoardingCommander("hoard")
+	stragglers := cmdrs.NewHoardingCommander("")
+	cw := makeTestFilter(outSentinel, errSentinel, ';')
+	cw.phaseCmdr = stragglers
+	var stdIn bytes.Buffer
+	_, err := cw.BeginRun(cmdr, &stdIn)
+	assert.NoError(t, err)
+	stdOut := make(chan []byte)
+	stdErr := make(chan []byte)
+	go func() {
+		stdOut <- []byte("output from command n")
+		stdOut <- []byte(outSentinel.Value)
+		// Only send stdErr lines once the out sentinel has been seen.
+		time.Sleep(100 * time.Millisecond)
+		stdErr <- []byte("late error from command n")
+		stdErr <- []byte(errSentinel.Value)
+	}()
+	assert.NoError(t, cw.IssueSentinelsAndFilter(stdOut, stdErr, 1*time.Second))
+	assert.Equal(t, "output from command n\n", cmdr.Result())
+	assert.Equal(t, "late error from command n\n", stragglers.Result())
+	assert.Equal(t, 1, cw.lineCounts().linesOut)
+	assert.Equal(t, 0, cw.lineCounts().linesErr)
+}
+
+// limitedCommander hoards lines, up to a limit of its own.
+type limitedCommander struct {
+	*cmdrs.HoardingCommander
+	limit *OutputLimit
+}
+
+func (c *limitedCommander) OutputLimit() *OutputLimit {
+	return c.limit
+}
+
+func TestSentinelFilter_WatchAndWait_outputLimit(t *testing.T) {
+	testCases := map[string]struct {
+		dflt      *OutputLimit
+		own       *OutputLimit
+		expectOut string
+		expectErr bool
+	}{
+		"noLimit": {
+			expectOut: "line 0\nline 1\nline 2\n",
+		},
+		"lines": {
+			dflt:      &OutputLimit{MaxLines: 2},
+			expectOut: "line 0\nline 1\n",
+			expectErr: true,
+		},
+		"bytes": {
+			dflt:      &OutputLimit{MaxBytes: 11},
+			expectOut: "line 0\n",
+			expectErr: true,
+		},
+		"notExceeded": {
+			dflt:      &OutputLimit{MaxLines: 3, MaxBytes: 18},
+			expectOut: "line 0\nline 1\nline 2\n",
+		},
+		"commanderOverrides": {
+			dflt:      &OutputLimit{MaxLines: 1},
+			own:       &OutputLimit{MaxLines: 2},
+			expectOut: "line 0\nline 1\n",
+			expectErr: true,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			sentinel := tstcli.MakeOutSentinelCommander()
+			hoard := cmdrs.NewHoardingCommander("hoard")
+			var cmdr Commander = hoard
+			if tc.own != nil {
+				cmdr = &limitedCommander{HoardingCommander: hoard, limit: tc.own}
+			}
+			cw := makeTestFilter(sentinel, nil, ';')
+			cw.limit = tc.dflt
+			var stdIn bytes.Buffer
+			_, err := cw.BeginRun(cmdr, &stdIn)
+			assert.NoError(t, err)
+			stdOut := make(chan []byte, 10)
+			for i := 0; i < 3; i++ {
+				stdOut <- []byte(fmt.Sprintf("line %d", i))
+			}
+			stdOut <- []byte(sentinel.Value)
+			err = cw.IssueSentinelsAndFilter(stdOut, nil, 1*time.Second)
+			if tc.expectErr {
+				var le *OutputLimitError
+				assert.True(t, errors.As(err, &le))
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectOut, hoard.Result())
+		})
+	}
+}
+
+func TestSentinelFilter_WatchAndWait_outputLimitAbort(t *testing.T) {
+	sentinel := tstcli.MakeOutSentinelCommander()
+	cmdr := cmdrs.NewHoardingCommander("hoard")
+	cw := makeTestFilter(sentinel, nil, ';')
+	cw.limit = &OutputLimit{MaxLines: 2, Policy: OutputLimitAbort}
+	var stdIn bytes.Buffer
+	_, err := cw.BeginRun(cmdr, &stdIn)
+	assert.NoError(t, err)
+	stdOut := make(chan []byte, 10)
+	for i := 0; i < 3; i++ {
+		stdOut <- []byte(fmt.Sprintf("line %d", i))
+	}
+	// No sentinel; the run ends anyway, well before the deadline.
+	start := time.Now()
+	err = cw.IssueSentinelsAndFilter(stdOut, nil, 5*time.Second)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	var le *OutputLimitError
+	assert.True(t, errors.As(err, &le))
+	assert.Equal(t, "line 0\nline 1\n", cmdr.Result())
+	assert.True(t, cw.isRunning())
+}
+
+func TestSentinelFilter_WatchAndWait_lineSampling(t *testing.T) {
+	sentinel := tstcli.MakeOutSentinelCommander()
+	cmdr := cmdrs.NewHoardingCommander("hoard")
+	cw := makeTestFilter(sentinel, nil, ';')
+	cw.sampling = &LineSampling{First: 1, Every: 4, Last: 1}
+	var stdIn bytes.Buffer
+	_, err := cw.BeginRun(cmdr, &stdIn)
+	assert.NoError(t, err)
+	stdOut := make(chan []byte, 20)
+	for i := 0; i < 10; i++ {
+		stdOut <- []byte(fmt.Sprintf("line %d", i))
+	}
+	stdOut <- []byte(sentinel.Value)
+	stdErr := make(chan []byte, 1)
+	stdErr <- []byte("complaint")
+	assert.NoError(t, cw.IssueSentinelsAndFilter(stdOut, stdErr, 1*time.Second))
+	AssertEqualAnyOrder(t, `
+line 0
+line 1
+line 5
+line 9
+complaint
+`[1:], cmdr.Result())
+	// Everything is counted.
+	assert.Equal(t, 10, cw.lineCounts().linesOut)
+	assert.Equal(t, 1, cw.lineCounts().linesErr)
+}
+
+func TestSentinelFilter_WatchAndWait_outputCheck(t *testing.T) {
+	testCases := map[string]struct {
+		tally     string
+		expectErr string
+	}{
+		"match": {
+			tally: "tally 2",
+		},
+		"mismatch": {
+			tally:     "tally 3",
+			expectErr: "CLI reported 3 lines, -1 bytes; received 2 lines, 44 bytes",
+		},
+		"missing": {
+			expectErr: "no output report seen; received 2 lines, 44 bytes",
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			sentinel := tstcli.MakeOutSentinelCommander()
+			cmdr := cmdrs.NewHoardingCommander("hoard")
+			cw := makeTestFilter(sentinel, nil, 0)
+			cw.check = &OutputCheck{
+				Command: "tally",
+				Parse: func(line []byte) (OutputTally, bool) {
+					var n int
+					if _, err := fmt.Sscanf(string(line), "tally %d", &n); err != nil {
+						return OutputTally{}, false
+					}
+					return OutputTally{Lines: n, Bytes: -1}, true
+				},
+			}
+			var stdIn bytes.Buffer
+			_, err := cw.BeginRun(cmdr, &stdIn)
+			assert.NoError(t, err)
+			stdOut := make(chan []byte)
+			go func() {
+				stdOut <- []byte("these lines represent output")
+				stdOut <- []byte("from command n")
+				if tc.tally != "" {
+					stdOut <- []byte(tc.tally)
+				}
+				stdOut <- []byte(sentinel.Value)
+			}()
+			err = cw.IssueSentinelsAndFilter(stdOut, make(chan []byte), time.Second)
+			assert.Equal(t, "hoard\ntally\n"+sentinel.Command+"\n", stdIn.String())
+			assert.Equal(t, "these lines represent output\nfrom command n\n",
+				cmdr.Result())
+			if tc.expectErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var me *OutputMismatchError
+			if assert.True(t, errors.As(err, &me)) {
+				assert.Contains(t, err.Error(), tc.expectErr)
+			}
+		})
+	}
+}
+
+type swappingCommander struct {
+	cmdrs.HoardingCommander
+	newOut *cmdrs.SimpleSentinelCommander
+}
+
+func (c *swappingCommander) NewSentinels() (Commander, Commander) {
+	return c.newOut, nil
+}
+
+func TestSentinelFilter_WatchAndWait_swapSentinel(t *testing.T) {
+	oldSentinel := tstcli.MakeOutSentinelCommander()
+	newSentinel := &cmdrs.SimpleSentinelCommander{
+		Command: "", // rely on the new prompt
+		Value:   "newPrompt>",
+	}
+	cmdr := &swappingCommander{
+		HoardingCommander: *cmdrs.NewHoardingCommander("set prompt newPrompt>"),
+		newOut:            newSentinel,
+	}
+	cw := makeTestFilter(oldSentinel, nil, ';')
+	var stdIn bytes.Buffer
+	_, err := cw.BeginRun(cmdr, &stdIn)
+	assert.NoError(t, err)
+	stdOut := make(chan []byte)
+	go func() {
+		stdOut <- []byte("prompt changed")
+		// The old sentinel value should be ignored.
+		stdOut <- []byte(oldSentinel.Value)
+		stdOut <- []byte("newPrompt>")
+	}()
+	assert.NoError(t, cw.IssueSentinelsAndFilter(stdOut, nil, 1*time.Second))
+	// No sentinel command was issued, since the new sentinel relies on a prompt.
+	assert.Equal(t, "set prompt newPrompt>;\n", stdIn.String())
+	assert.Equal(t, `
+prompt changed
+`[1:]+oldSentinel.Value+"\n", cmdr.Result())
+
+	// The new sentinel stays in effect for the next run.
+	next := cmdrs.NewHoardingCommander("hoard")
+	_, err = cw.BeginRun(next, &stdIn)
+	assert.NoError(t, err)
+	go func() {
+		stdOut <- []byte("some data")
+		stdOut <- []byte("newPrompt>")
+	}()
+	assert.NoError(t, cw.IssueSentinelsAndFilter(stdOut, nil, 1*time.Second))
+	assert.Equal(t, "some data\n", next.Result())
+}
+
+func TestSentinelFilter_swapSentinels_mustDiffer(t *testing.T) {
+	errSentinel := tstcli.MakeErrSentinelCommander()
+	cw := makeTestFilter(tstcli.MakeOutSentinelCommander(), errSentinel, ';')
+	cmdr := &swappingCommander{
+		HoardingCommander: *cmdrs.NewHoardingCommander("whatever"),
+		newOut: &cmdrs.SimpleSentinelCommander{
+			Command: errSentinel.Command,
+		},
+	}
+	err := cw.swapSentinels(cmdr)
+	if !assert.Error(t, err) {
+		t.Fatalf("expected error")
+	}
+	assert.Contains(t, err.Error(), "must differ")
+}
+
 func TestSentinelFilter_WatchAndWait_diesBeforeSentinel(t *testing.T) {
 	outSentinel := tstcli.MakeOutSentinelCommander()
 	errSentinel := tstcli.MakeErrSentinelCommander()
 	cmdr := cmdrs.NewHoardingCommander("hoard")
-	cw := makeSentinelFilter(outSentinel, errSentinel, ';')
+	cw := makeTestFilter(outSentinel, errSentinel, ';')
 	var stdIn bytes.Buffer
 	_, err := cw.BeginRun(cmdr, &stdIn)
 	assert.NoError(t, err)
@@ -191,6 +605,16 @@ func TestAssureCmdLineTermination(t *testing.T) {
 			term:     empty,
 			expected: "hey\n",
 		},
+		"empty": {
+			line:     "",
+			term:     ';',
+			expected: "\n",
+		},
+		"justLineFeed": {
+			line:     "\n",
+			term:     ';',
+			expected: "\n",
+		},
 	}
 	for n, tc := range testCases {
 		t.Run(n, func(t *testing.T) {
@@ -0,0 +1,257 @@
+package clirunner
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// SentinelStrategy decides when a command has completed, by optionally
+// issuing commands after it that provoke recognizable output, and by
+// recognizing that output.
+//
+// A ProcRunner uses one SentinelStrategy for stdOut (required) and another
+// for stdErr (optional).  Lines arriving on a stream are offered to the
+// stream's strategy via Match until Match returns true; lines for which Match
+// returns false are passed to the Commander.  The command is complete when
+// every strategy in use has matched.
+//
+// The default strategy, made from a sentinel Commander by
+// StrategyFromCommander, issues the Commander's command (e.g. an echo, or
+// nothing at all to rely on a prompt) and matches when the Commander reports
+// Success.  Implement this interface for more exotic completion schemes, e.g.
+// counting braces, or looking for protocol trailers.
+type SentinelStrategy interface {
+	// IssueAfter returns a command to send to the CLI immediately after the
+	// given command, or an empty string to send nothing.
+	IssueAfter(cmd string) string
+
+	// Match examines a line of output, returning true if it signals
+	// completion.  A line that signals completion isn't passed to the
+	// Commander, and no further lines on the stream are offered to Match.
+	Match(line Line) bool
+
+	// Reset prepares the strategy for another command.
+	Reset()
+}
+
+// StrategyFromCommander returns a SentinelStrategy that issues the
+// Commander's command after every command, and matches when the Commander
+// reports Success after being handed a line.  A nil Commander yields nil.
+func StrategyFromCommander(c Commander) SentinelStrategy {
+	if c == nil {
+		return nil
+	}
+	return &commanderStrategy{cmdr: c}
+}
+
+// commanderStrategy adapts a sentinel Commander to SentinelStrategy.
+type commanderStrategy struct {
+	cmdr Commander
+}
+
+// IssueAfter returns the sentinel Commander's command.
+func (s *commanderStrategy) IssueAfter(_ string) string {
+	return s.cmdr.String()
+}
+
+// Match writes the line to the sentinel Commander and reports its Success.
+// A write error is treated as a non-match; the sentinel Commanders in
+// cmdrs don't fail on write.
+func (s *commanderStrategy) Match(line Line) bool {
+	if _, err := s.cmdr.Write(line.Data); err != nil {
+		return false
+	}
+	return s.cmdr.Success()
+}
+
+// Screen returns the sentinel Commander's screen, if it's a
+// SentinelScreener.
+func (s *commanderStrategy) Screen() func(line []byte) bool {
+	if sc, ok := s.cmdr.(SentinelScreener); ok {
+		return sc.Screen()
+	}
+	return nil
+}
+
+// Reset resets the sentinel Commander.
+func (s *commanderStrategy) Reset() {
+	s.cmdr.Reset()
+}
+
+// String returns the sentinel Commander's command, for debugging.
+func (s *commanderStrategy) String() string {
+	return s.cmdr.String()
+}
+
+// TokenPlaceholder marks where a token strategy's template gets the token.
+const TokenPlaceholder = "{{token}}"
+
+// NewTokenStrategy returns a SentinelStrategy that, for every command, makes
+// a fresh random token, and issues the template with the token in place of
+// TokenPlaceholder, e.g. "echo {{token}}".  It matches the line holding the
+// token, so a fixed sentinel value appearing in real output can't end a
+// command early.  A line that's just the issued command, i.e. the CLI
+// echoing it, doesn't match.
+//
+// It returns an error if the template lacks the placeholder.
+func NewTokenStrategy(template string) (SentinelStrategy, error) {
+	if !strings.Contains(template, TokenPlaceholder) {
+		return nil, fmt.Errorf(
+			"sentinel template %q lacks %s", template, TokenPlaceholder)
+	}
+	return &tokenStrategy{template: template}, nil
+}
+
+// tokenStrategy issues a sentinel command with a fresh token every time.
+type tokenStrategy struct {
+	template string
+	token    []byte // the current token, nil until issued
+	issued   []byte // the current sentinel command
+}
+
+// tokenCount distinguishes tokens if random ones are unavailable.
+var tokenCount int64
+
+// newToken returns a token that's unlikely to appear in CLI output.
+func newToken() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("sentinel-%d-%d",
+			time.Now().UnixNano(), atomic.AddInt64(&tokenCount, 1))
+	}
+	return "sentinel-" + hex.EncodeToString(b)
+}
+
+// IssueAfter returns the template with a fresh token.
+func (s *tokenStrategy) IssueAfter(_ string) string {
+	token := newToken()
+	issued := strings.ReplaceAll(s.template, TokenPlaceholder, token)
+	s.token, s.issued = []byte(token), []byte(issued)
+	return issued
+}
+
+// Match returns true if the line holds the current token, but isn't an
+// echo of the sentinel command.
+func (s *tokenStrategy) Match(line Line) bool {
+	if s.token == nil || !bytes.Contains(line.Data, s.token) {
+		return false
+	}
+	data := bytes.TrimSpace(line.Data)
+	return bytes.Equal(data, s.token) || !bytes.Equal(data, s.issued)
+}
+
+// Screen passes only lines holding the current token.
+func (s *tokenStrategy) Screen() func(line []byte) bool {
+	token := s.token
+	if token == nil {
+		return nil
+	}
+	return func(line []byte) bool { return bytes.Contains(line, token) }
+}
+
+// Reset forgets the current token.
+func (s *tokenStrategy) Reset() {
+	s.token, s.issued = nil, nil
+}
+
+// String returns the template, for debugging.
+func (s *tokenStrategy) String() string {
+	return s.template
+}
+
+// ExitCoder is an optional interface for a SentinelStrategy that learns the
+// exit status of each command, e.g. an ExitCodeSentinel.  The status is
+// reported in the command's RunReport.
+type ExitCoder interface {
+	// ExitCode returns the exit status of the command just completed, and
+	// false if it isn't known.
+	ExitCode() (int, bool)
+}
+
+// DefaultExitCodeTemplate suits sh, bash, zsh and the like.
+const DefaultExitCodeTemplate = "echo " + TokenPlaceholder + " RC=$?"
+
+// exitCodePattern finds the exit status following the token.
+var exitCodePattern = regexp.MustCompile(`RC=(-?\d+)`)
+
+// ExitCodeSentinel is a SentinelStrategy for shell-like CLIs that keep the
+// exit status of the last command, e.g. in $? for sh.  Like the strategy
+// made by NewTokenStrategy, it issues its template with a fresh token after
+// every command.  The template must have the CLI print the token followed
+// by "RC=" and the status, e.g. DefaultExitCodeTemplate.  The status is then
+// available from ExitCode, and in the command's RunReport.
+type ExitCodeSentinel struct {
+	tokenStrategy
+	code  int
+	known bool
+}
+
+// NewExitCodeSentinel returns an ExitCodeSentinel issuing the given template,
+// or DefaultExitCodeTemplate if it's empty.  It returns an error if the
+// template lacks TokenPlaceholder.
+func NewExitCodeSentinel(template string) (*ExitCodeSentinel, error) {
+	if template == "" {
+		template = DefaultExitCodeTemplate
+	}
+	if !strings.Contains(template, TokenPlaceholder) {
+		return nil, fmt.Errorf(
+			"sentinel template %q lacks %s", template, TokenPlaceholder)
+	}
+	return &ExitCodeSentinel{tokenStrategy: tokenStrategy{template: template}}, nil
+}
+
+// IssueAfter returns the template with a fresh token, forgetting the
+// previous command's status.
+func (s *ExitCodeSentinel) IssueAfter(cmd string) string {
+	s.code, s.known = 0, false
+	return s.tokenStrategy.IssueAfter(cmd)
+}
+
+// Match returns true if the line holds the current token, noting the
+// exit status that follows it, if any.
+func (s *ExitCodeSentinel) Match(line Line) bool {
+	if !s.tokenStrategy.Match(line) {
+		return false
+	}
+	rest := line.Data[bytes.Index(line.Data, s.token)+len(s.token):]
+	if m := exitCodePattern.FindSubmatch(rest); m != nil {
+		if code, err := strconv.Atoi(string(m[1])); err == nil {
+			s.code, s.known = code, true
+		}
+	}
+	return true
+}
+
+// ExitCode returns the exit status of the command just completed, and
+// false if it isn't known.
+func (s *ExitCodeSentinel) ExitCode() (int, bool) {
+	return s.code, s.known
+}
+
+// exitCodeOf returns the exit status known to any of the strategies, or
+// nil if none knows it.
+func exitCodeOf(strategies ...SentinelStrategy) *int {
+	for _, s := range strategies {
+		if ec, ok := s.(ExitCoder); ok {
+			if code, known := ec.ExitCode(); known {
+				return &code
+			}
+		}
+	}
+	return nil
+}
+
+// strategiesConflict returns true if both strategies are known to issue the
+// same sentinel command, which would make their output indistinguishable.
+func strategiesConflict(out, es SentinelStrategy) bool {
+	o, ok1 := out.(*commanderStrategy)
+	e, ok2 := es.(*commanderStrategy)
+	return ok1 && ok2 && o.cmdr.String() == e.cmdr.String()
+}
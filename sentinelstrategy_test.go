@@ -0,0 +1,159 @@
+package clirunner_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/monopole/clirunner/internal/testcli/tstcli"
+	"github.com/stretchr/testify/assert"
+)
+
+// trailerStrategy has the CLI echo a trailer that mentions the command.
+type trailerStrategy struct {
+	trailer []byte
+}
+
+func (s *trailerStrategy) IssueAfter(cmd string) string {
+	s.trailer = []byte("end of " + cmd)
+	return tstcli.CmdEcho + " end of " + cmd
+}
+
+func (s *trailerStrategy) Match(line Line) bool {
+	return line.Stream == StreamOut && bytes.Equal(line.Data, s.trailer)
+}
+
+func (s *trailerStrategy) Reset() {
+	s.trailer = nil
+}
+
+func TestStrategyFromCommander(t *testing.T) {
+	assert.Nil(t, StrategyFromCommander(nil))
+	s := StrategyFromCommander(tstcli.MakeOutSentinelCommander())
+	assert.Equal(t, tstcli.CmdEcho+" Rumpelstiltskin", s.IssueAfter("whatever"))
+	assert.False(t, s.Match(Line{Data: []byte("hello")}))
+	assert.True(t, s.Match(Line{Data: []byte("Rumpelstiltskin")}))
+	s.Reset()
+	assert.False(t, s.Match(Line{Data: []byte("hello")}))
+}
+
+func TestRunner_Run_CustomStrategy(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutStrategy: &trailerStrategy{},
+	})
+	assert.NoError(t, err)
+	commander := NewHoardingCommander(tstcli.CmdQuery + " limit 2")
+	assert.NoError(t, runner.RunIt(commander, testingTimeout))
+	assert.Equal(t, `
+Cempedak_|_Bamberga_|_4_|_00000000000000000000000000000001
+Buddha's hand_|_Hermione_|_6_|_00000000000000000000000000000002
+`[1:], commander.Result())
+	assert.NoError(t, runner.Close())
+}
+
+func TestNewTokenStrategy(t *testing.T) {
+	_, err := NewTokenStrategy(tstcli.CmdEcho + " Rumpelstiltskin")
+	assert.Error(t, err)
+
+	s, err := NewTokenStrategy(tstcli.CmdEcho + " " + TokenPlaceholder)
+	assert.NoError(t, err)
+	assert.False(t, s.Match(Line{Data: []byte("")}))
+	c1 := s.IssueAfter("whatever")
+	token1 := strings.TrimPrefix(c1, tstcli.CmdEcho+" ")
+	assert.NotEqual(t, c1, token1)
+	assert.False(t, s.Match(Line{Data: []byte("hello")}))
+	assert.False(t, s.Match(Line{Data: []byte(c1)}), "an echo isn't a match")
+	assert.True(t, s.Match(Line{Data: []byte(token1)}))
+	assert.True(t, s.Match(Line{Data: []byte("> " + token1)}))
+	s.Reset()
+	assert.False(t, s.Match(Line{Data: []byte(token1)}))
+
+	c2 := s.IssueAfter("whatever")
+	assert.NotEqual(t, c1, c2)
+	assert.False(t, s.Match(Line{Data: []byte(token1)}))
+
+	// With nothing around the token, an echo looks like the token.
+	s, err = NewTokenStrategy(TokenPlaceholder)
+	assert.NoError(t, err)
+	assert.True(t, s.Match(Line{Data: []byte(s.IssueAfter("x"))}))
+}
+
+func TestRunner_Run_TokenStrategy(t *testing.T) {
+	s, err := NewTokenStrategy(tstcli.CmdEcho + " " + TokenPlaceholder)
+	assert.NoError(t, err)
+	runner, err := NewProcRunner(&Parameters{
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutStrategy: s,
+	})
+	assert.NoError(t, err)
+	// A fixed sentinel value in the output doesn't end the command.
+	commander := NewHoardingCommander(
+		tstcli.CmdEcho + " Rumpelstiltskin")
+	for i := 0; i < 2; i++ {
+		commander.Reset()
+		assert.NoError(t, runner.RunIt(commander, testingTimeout))
+		assert.Equal(t, "Rumpelstiltskin\n", commander.Result())
+	}
+	assert.NoError(t, runner.Close())
+}
+
+func TestExitCodeSentinel(t *testing.T) {
+	_, err := NewExitCodeSentinel("echo RC=$?")
+	assert.Error(t, err)
+
+	s, err := NewExitCodeSentinel("")
+	assert.NoError(t, err)
+	c := s.IssueAfter("false")
+	token := strings.TrimSuffix(strings.TrimPrefix(c, "echo "), " RC=$?")
+	_, known := s.ExitCode()
+	assert.False(t, known)
+	assert.False(t, s.Match(Line{Data: []byte("RC=3")}))
+	assert.False(t, s.Match(Line{Data: []byte(c)}), "an echo isn't a match")
+	assert.True(t, s.Match(Line{Data: []byte(token + " RC=3")}))
+	code, known := s.ExitCode()
+	assert.True(t, known)
+	assert.Equal(t, 3, code)
+
+	// The status is forgotten when the next command is issued.
+	c = s.IssueAfter("true")
+	_, known = s.ExitCode()
+	assert.False(t, known)
+	token = strings.TrimSuffix(strings.TrimPrefix(c, "echo "), " RC=$?")
+	assert.True(t, s.Match(Line{Data: []byte(token + " RC=")}))
+	_, known = s.ExitCode()
+	assert.False(t, known)
+}
+
+func TestRunner_Run_ExitCodeSentinel(t *testing.T) {
+	s, err := NewExitCodeSentinel("")
+	assert.NoError(t, err)
+	runner, err := NewProcRunner(&Parameters{
+		Path:        "sh",
+		ExitCommand: "exit",
+		OutStrategy: s,
+	})
+	assert.NoError(t, err)
+	testCases := []struct {
+		command  string
+		expected int
+	}{
+		{command: "true", expected: 0},
+		{command: "false", expected: 1},
+		{command: "(exit 42)", expected: 42},
+	}
+	for _, tc := range testCases {
+		assert.NoError(t, runner.RunIt(NewHoardingCommander(tc.command), testingTimeout))
+		r, _ := runner.LastRunReport()
+		if assert.NotNil(t, r.ExitCode, tc.command) {
+			assert.Equal(t, tc.expected, *r.ExitCode, tc.command)
+		}
+	}
+	assert.NoError(t, runner.Close())
+}
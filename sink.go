@@ -0,0 +1,172 @@
+package clirunner
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// Sink archives the raw output of runs, e.g. to local files or object
+// storage, as part of each run.  See Parameters.OutputSink.
+type Sink interface {
+	// Open begins archiving a run, before its command is issued,
+	// returning where the run's lines go.
+	Open(run SinkRun) (SinkWriter, error)
+}
+
+// SinkRun identifies a run to a Sink.
+type SinkRun struct {
+	// Runner is the runner's Parameters.Name.
+	Runner string
+	// Command is the command run, with any Secrets redacted.
+	Command string
+	// Start is when the run began.
+	Start time.Time
+}
+
+// SinkWriter archives the output of one run.  Its methods are called from
+// one goroutine at a time.
+type SinkWriter interface {
+	// WriteLine archives a line of output, as it arrives.  An error stops
+	// the archiving of the run, and becomes one of its Warnings.
+	WriteLine(l Line) error
+	// Close ends the archiving, given the run's report, with its status.
+	// An error is only logged, as the run is over.
+	Close(r RunReport) error
+}
+
+// NopSink archives nothing.
+type NopSink struct{}
+
+// Open returns a SinkWriter that drops everything.
+func (NopSink) Open(SinkRun) (SinkWriter, error) { return nopSinkWriter{}, nil }
+
+type nopSinkWriter struct{}
+
+func (nopSinkWriter) WriteLine(Line) error  { return nil }
+func (nopSinkWriter) Close(RunReport) error { return nil }
+
+// unsafeKeyChars are the characters kept out of archive names.
+var unsafeKeyChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// SinkKey returns a name for the run's archive, unique per runner and
+// start time, e.g. "mysql/20240102T030405.000000006Z".
+func SinkKey(run SinkRun) string {
+	runner := unsafeKeyChars.ReplaceAllString(run.Runner, "_")
+	if runner == "" {
+		runner = "_"
+	}
+	return runner + "/" + run.Start.UTC().Format("20060102T150405.000000000Z")
+}
+
+// writeArchivedLine writes the line as it came from the CLI.  Lines from
+// ExtraStreams are tagged with the stream's name, as they'd otherwise be
+// indistinguishable; give the runner an ErrPrefix to tag stdErr's.
+func writeArchivedLine(w *bufio.Writer, l Line) error {
+	if l.Stream == StreamExtra {
+		if _, err := w.WriteString(l.Name + ": "); err != nil {
+			return err
+		}
+	}
+	if _, err := w.Write(l.Data); err != nil {
+		return err
+	}
+	return w.WriteByte('\n')
+}
+
+// FileSink archives each run's output to a file in Dir, named per
+// SinkKey, with its RunReport, as JSON, in a file beside it with the
+// suffix ".status.json".
+type FileSink struct {
+	// Dir is the directory holding the archives.  It's created if need be.
+	Dir string
+}
+
+// Open creates the run's file.
+func (s *FileSink) Open(run SinkRun) (SinkWriter, error) {
+	path := filepath.Join(s.Dir, filepath.FromSlash(SinkKey(run)))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSinkWriter{path: path, f: f, w: bufio.NewWriter(f)}, nil
+}
+
+type fileSinkWriter struct {
+	path string
+	f    *os.File
+	w    *bufio.Writer
+}
+
+func (w *fileSinkWriter) WriteLine(l Line) error {
+	return writeArchivedLine(w.w, l)
+}
+
+func (w *fileSinkWriter) Close(r RunReport) error {
+	err := w.w.Flush()
+	if cErr := w.f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return fmt.Errorf("archiving output to %s; %w", w.path, err)
+	}
+	status, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(w.path+".status.json", status, 0o644)
+}
+
+// openSink begins archiving a run per the Parameters' OutputSink,
+// returning nil if there's none or it fails.
+func (pr *ProcRunner) openSink(cmdr Commander, start time.Time) SinkWriter {
+	if pr.params.OutputSink == nil {
+		return nil
+	}
+	w, err := pr.params.OutputSink.Open(SinkRun{Runner: pr.params.Name,
+		Command: pr.secrets.redact(cmdr.String()), Start: start})
+	if err != nil {
+		pr.logger.Printf("not archiving output; %s\n", err.Error())
+		return nil
+	}
+	return w
+}
+
+// closeSink ends archiving a run, if it was archived.
+func (pr *ProcRunner) closeSink(w SinkWriter, r RunReport) {
+	if w == nil {
+		return
+	}
+	if err := w.Close(r); err != nil {
+		pr.logger.Printf("archiving output; %s\n", err.Error())
+	}
+}
+
+// setSink sets the SinkWriter of the current run.
+func (cw *sentinelFilter) setSink(w SinkWriter) {
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	cw.sink = w
+}
+
+// archive passes the line to the current run's SinkWriter, if any.  After
+// a failure, the run's lines aren't archived.  The caller must hold
+// cmdrLock.
+func (cw *sentinelFilter) archive(l Line) {
+	if cw.sink == nil {
+		return
+	}
+	if err := cw.sink.WriteLine(l); err != nil {
+		cw.sink = nil
+		w := fmt.Sprintf("archiving output stopped; %s", err.Error())
+		cw.logger.Printf("warning: %s\n", w)
+		cw.warnings = append(cw.warnings, w)
+	}
+}
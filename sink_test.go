@@ -0,0 +1,119 @@
+package clirunner_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+func sinkHarness(t *testing.T, sink Sink) *Harness {
+	return makeHarness(t, func(p *Parameters) {
+		p.Name = "db"
+		p.OutputSink = sink
+	})
+}
+
+func TestRunner_FileSink(t *testing.T) {
+	dir := t.TempDir()
+	h := sinkHarness(t, &FileSink{Dir: dir})
+	c := NewHoardingCommander("query")
+	result := runAsync(h, c, time.Minute)
+	expectCommands(t, h, "query", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("row1"))
+	assert.NoError(t, h.Err("careful"))
+	assert.NoError(t, h.Out("row2", "Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+
+	path := filepath.Join(dir, filepath.FromSlash(
+		SinkKey(SinkRun{Runner: "db", Start: HarnessEpoch})))
+	out, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t,
+		[]string{"row1", "careful", "row2"}, strings.Split(strings.TrimSuffix(string(out), "\n"), "\n"))
+	status, err := os.ReadFile(path + ".status.json")
+	assert.NoError(t, err)
+	var r struct {
+		Command string `json:"command"`
+		Success bool   `json:"success"`
+	}
+	assert.NoError(t, json.Unmarshal(status, &r))
+	assert.Equal(t, "query", r.Command)
+	assert.True(t, r.Success)
+	assert.NoError(t, h.Runner.Close())
+}
+
+func TestRunner_FileSinkDiscarder(t *testing.T) {
+	dir := t.TempDir()
+	h := sinkHarness(t, &FileSink{Dir: dir})
+	c := &KondoCommander{Command: "load"}
+	assert.True(t, c.Discard())
+	result := runAsync(h, c, time.Minute)
+	expectCommands(t, h, "load", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("a", "b", "c", "Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+
+	// The Commander discards its output, but the sink still gets it.
+	path := filepath.Join(dir, filepath.FromSlash(
+		SinkKey(SinkRun{Runner: "db", Start: HarnessEpoch})))
+	out, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "a\nb\nc\n", string(out))
+	assert.NoError(t, h.Runner.Close())
+}
+
+// failingSink fails to archive the second line.
+type failingSink struct {
+	lines  []string
+	closed bool
+}
+
+func (s *failingSink) Open(SinkRun) (SinkWriter, error) { return s, nil }
+
+func (s *failingSink) WriteLine(l Line) error {
+	if len(s.lines) == 1 {
+		return errors.New("disk full")
+	}
+	s.lines = append(s.lines, string(l.Data))
+	return nil
+}
+
+func (s *failingSink) Close(RunReport) error {
+	s.closed = true
+	return nil
+}
+
+func TestRunner_SinkFailureIsAWarning(t *testing.T) {
+	sink := &failingSink{}
+	h := sinkHarness(t, sink)
+	c := NewHoardingCommander("query")
+	result := runAsync(h, c, time.Minute)
+	expectCommands(t, h, "query", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("row1", "row2", "row3", "Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	assert.Equal(t, "row1\nrow2\nrow3\n", c.Result())
+	assert.Equal(t, []string{"row1"}, sink.lines)
+	assert.True(t, sink.closed)
+	r, _ := h.Runner.LastRunReport()
+	assert.Equal(t,
+		[]string{"archiving output stopped; disk full"}, r.Warnings)
+	assert.NoError(t, h.Runner.Close())
+}
+
+func TestRunner_NopSink(t *testing.T) {
+	h := sinkHarness(t, NopSink{})
+	c := NewHoardingCommander("query")
+	result := runAsync(h, c, time.Minute)
+	expectCommands(t, h, "query", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("row1", "Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	assert.Equal(t, "row1\n", c.Result())
+	assert.NoError(t, h.Runner.Close())
+}
@@ -0,0 +1,66 @@
+//go:build go1.21
+// +build go1.21
+
+package clirunner
+
+import (
+	"context"
+	"log/slog"
+)
+
+// slogRunLogger is a RunLogger emitting slog records.
+type slogRunLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogRunLogger returns a RunLogger that emits one record per run to
+// the given logger (or slog.Default() if nil), with the run's attributes in
+// a group named for the runner, e.g.
+//
+//	msg=run myCli.command="show tables" myCli.durationMs=12.5 ...
+//
+// Failed runs are logged at LevelError, the rest at LevelInfo.
+func NewSlogRunLogger(l *slog.Logger) RunLogger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return &slogRunLogger{logger: l}
+}
+
+// LogRun emits a record for the run.
+func (l *slogRunLogger) LogRun(runner string, r RunReport) {
+	level := slog.LevelInfo
+	if r.Err != nil {
+		level = slog.LevelError
+	}
+	ctx := context.Background()
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+	attrs := []any{
+		slog.String("command", r.Command),
+		slog.Float64("durationMs", durationMs(r.Duration)),
+		slog.Int("linesOut", r.LinesOut),
+		slog.Int("linesErr", r.LinesErr),
+		slog.Bool("sentinelFound", !r.Truncated),
+		slog.Bool("success", r.Success),
+	}
+	if r.ExitCode != nil {
+		attrs = append(attrs, slog.Int("exitCode", *r.ExitCode))
+	}
+	if r.OutputTruncated {
+		attrs = append(attrs, slog.Bool("outputTruncated", true))
+	}
+	if r.Err != nil {
+		attrs = append(attrs, slog.String("error", r.Err.Error()))
+	}
+	if p := r.Phases; p != (RunPhases{}) {
+		attrs = append(attrs, slog.Group("phases",
+			slog.Float64("writtenMs", durationMs(p.Written)),
+			slog.Float64("firstLineMs", durationMs(p.FirstLine)),
+			slog.Float64("lastLineMs", durationMs(p.LastLine)),
+			slog.Float64("sentinelsMs", durationMs(p.Sentinels)),
+			slog.Float64("parsingMs", durationMs(p.Parsing))))
+	}
+	l.logger.LogAttrs(ctx, level, "run", slog.Group(runner, attrs...))
+}
@@ -0,0 +1,52 @@
+//go:build go1.21
+// +build go1.21
+
+package clirunner_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/monopole/clirunner/internal/testcli/tstcli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunner_Run_SlogRunLogger(t *testing.T) {
+	var buf bytes.Buffer
+	runner, err := NewProcRunner(&Parameters{
+		Name:        "alice",
+		RunLogger:   NewSlogRunLogger(slog.New(slog.NewJSONHandler(&buf, nil))),
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+	})
+	assert.NoError(t, err)
+	c := NewHoardingCommander(tstcli.CmdQuery + " limit 2")
+	assert.NoError(t, runner.RunIt(c, testingTimeout))
+	assert.NoError(t, runner.Close())
+
+	var record struct {
+		Level string
+		Msg   string
+		Alice struct {
+			Command       string
+			DurationMs    float64
+			LinesOut      int
+			SentinelFound bool
+			Error         string
+		} `json:"alice"`
+	}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record), buf.String())
+	assert.Equal(t, "INFO", record.Level)
+	assert.Equal(t, "run", record.Msg)
+	assert.Equal(t, tstcli.CmdQuery+" limit 2", record.Alice.Command)
+	assert.Equal(t, 2, record.Alice.LinesOut)
+	assert.True(t, record.Alice.SentinelFound)
+	assert.Greater(t, record.Alice.DurationMs, 0.0)
+	assert.Empty(t, record.Alice.Error)
+}
@@ -0,0 +1,78 @@
+package clirunner
+
+import (
+	"fmt"
+	"time"
+)
+
+// Snapshot records a ProcRunner's session, i.e. its configuration and the
+// context established by the commands it ran, so that an equivalent
+// session can be built later, or elsewhere, with Restore, e.g. to resume
+// work after a deploy, or to migrate it to another host.
+//
+// A Snapshot's JSON form holds all but its Parameters, which hold
+// Commanders and such.  To restore a decoded Snapshot, set its Parameters
+// to those of the CLI on the new host first; the WorkingDir and Context of
+// the Snapshot override theirs.
+//
+// SubSessions aren't recorded; a restored session starts at the top level.
+type Snapshot struct {
+	// Name is the runner's name.
+	Name string `json:"name"`
+	// Taken is when the Snapshot was taken.
+	Taken time.Time `json:"taken"`
+	// Parameters are a copy of the runner's Parameters.  The sentinel
+	// Commanders in them are the runner's own, so a runner restored from
+	// them shouldn't run at the same time as the original.
+	Parameters *Parameters `json:"-"`
+	// WorkingDir is the CLI's working directory, per WorkingDir.
+	WorkingDir string `json:"workingDir,omitempty"`
+	// SetupCommands are the Parameters' SetupCommands, for reference;
+	// Restore uses those of Parameters.
+	SetupCommands []string `json:"setupCommands,omitempty"`
+	// Context is the session context tracked by the Parameters'
+	// ContextTracker, in the order it was established.
+	Context []ContextEntry `json:"context,omitempty"`
+}
+
+// Snapshot returns a Snapshot of the runner's session.  If a command is
+// running, the Snapshot doesn't reflect any context it changes.
+func (pr *ProcRunner) Snapshot() *Snapshot {
+	pr.mutexState.Lock()
+	defer pr.mutexState.Unlock()
+	s := &Snapshot{
+		Name:          pr.params.Name,
+		Taken:         pr.filter.clock.Now(),
+		Parameters:    pr.params.copy(),
+		WorkingDir:    pr.params.WorkingDir,
+		SetupCommands: append([]string(nil), pr.params.SetupCommands...),
+	}
+	if ct := pr.params.ContextTracker; ct != nil {
+		s.Context = ct.Entries()
+	}
+	return s
+}
+
+// Restore returns a new ProcRunner with the session recorded in the
+// Snapshot.  As with any new ProcRunner, its CLI starts on the first run,
+// running SetupCommands and then replaying the Snapshot's Context, so the
+// commands that follow find the session as they left it.
+//
+// The new runner tracks context with a ContextTracker of its own, with
+// the rules of the Parameters' tracker; if they have none, the tracker has
+// no rules, replaying the Context but tracking nothing new.
+func Restore(s *Snapshot) (*ProcRunner, error) {
+	if s == nil || s.Parameters == nil {
+		return nil, fmt.Errorf("provide a Snapshot with Parameters")
+	}
+	p := s.Parameters.copy()
+	p.WorkingDir = s.WorkingDir
+	ct := p.ContextTracker
+	if ct == nil && len(s.Context) > 0 {
+		ct = &ContextTracker{}
+	}
+	if ct != nil {
+		p.ContextTracker = ct.withEntries(s.Context)
+	}
+	return NewProcRunner(p)
+}
@@ -0,0 +1,75 @@
+package clirunner_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/monopole/clirunner/internal/testcli/tstcli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunner_Snapshot_Restore(t *testing.T) {
+	start, dir := t.TempDir(), t.TempDir()
+	// Resolve symlinks (e.g. macOS' /var), since the CLI reports real paths.
+	dir, err := filepath.EvalSymlinks(dir)
+	assert.NoError(t, err)
+	ct, err := NewContextTracker(ContextRule{
+		Key:     "dir",
+		Pattern: regexp.MustCompile(`^` + tstcli.CmdCd + `\s+(\S+)$`),
+	})
+	assert.NoError(t, err)
+	params := func() *Parameters {
+		return &Parameters{
+			Path:           tstcli.TestCliPath,
+			Args:           []string{"--" + tstcli.FlagDisablePrompt},
+			ExitCommand:    tstcli.CmdQuit,
+			OutSentinel:    tstcli.MakeOutSentinelCommander(),
+			WorkingDir:     start,
+			SetupCommands:  []string{tstcli.CmdEcho + " ready"},
+			ContextTracker: ct,
+		}
+	}
+	runner, err := NewProcRunner(params())
+	assert.NoError(t, err)
+	assert.NoError(t, runner.RunIt(
+		NewHoardingCommander(tstcli.CmdCd+" "+dir), testingTimeout))
+	snap := runner.Snapshot()
+	assert.NoError(t, runner.Close())
+	assert.Equal(t, start, snap.WorkingDir)
+	assert.Equal(t, []string{tstcli.CmdEcho + " ready"}, snap.SetupCommands)
+	assert.Equal(t, []ContextEntry{
+		{Key: "dir", Value: dir, Command: tstcli.CmdCd + " " + dir},
+	}, snap.Context)
+
+	pwd := func(r *ProcRunner) string {
+		c := NewHoardingCommander(tstcli.CmdPwd)
+		assert.NoError(t, r.RunIt(c, testingTimeout))
+		return c.Result()
+	}
+	restored, err := Restore(snap)
+	assert.NoError(t, err)
+	assert.Equal(t, dir+"\n", pwd(restored))
+	assert.NoError(t, restored.Close())
+
+	// Via JSON, as if on another host.
+	data, err := json.Marshal(snap)
+	assert.NoError(t, err)
+	var decoded Snapshot
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	_, err = Restore(&decoded)
+	assert.Error(t, err)
+	p := params()
+	p.WorkingDir = os.TempDir()
+	p.ContextTracker = nil
+	decoded.Parameters = p
+	restored, err = Restore(&decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, start, restored.WorkingDir())
+	assert.Equal(t, dir+"\n", pwd(restored))
+	assert.NoError(t, restored.Close())
+}
@@ -0,0 +1,160 @@
+package clirunner
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Splitter is a Commander that runs a batch of statements as one command,
+// and dispatches the output of each statement to that statement's own
+// Commander.
+//
+// The command is the String of each child Commander, joined by Joiner,
+// e.g. "select 1; select 2" for a SQL client.  The CLI's output is split
+// into sections, one per statement, in one of two ways:
+//
+//   - Separator: a line recognized by Separator ends the current section.
+//     The first section starts with the first line of output.
+//   - Echo: if the CLI echoes each statement before running it (e.g. the
+//     verbose mode of many SQL clients), a line matching the next child's
+//     command starts that child's section.  Lines before the first echo
+//     are discarded.
+//
+// Separator and echo lines aren't passed to any child.  If both are
+// configured, either kind of line moves on to the next section.
+type Splitter struct {
+	// Children receive the sections of output, in order.
+	Children []Commander
+
+	// Joiner joins the children's commands into one command.
+	// If empty, "\n" is used, i.e. one statement per line.
+	Joiner string
+
+	// Separator, if not nil, recognizes a line that ends a section.
+	Separator func(line []byte) bool
+
+	// Echoed, if true, means a line that matches the next child's command,
+	// ignoring surrounding whitespace, starts that child's section.
+	Echoed bool
+
+	// began is true once the first section has begun.
+	began bool
+	// current is the index of the child owning the current section.
+	current int
+	// extra counts lines that arrived after the last child's section ended.
+	extra int
+}
+
+// NewSplitter returns a Splitter that splits the output of the children's
+// batched commands on lines recognized by separator.
+func NewSplitter(
+	joiner string, separator func(line []byte) bool,
+	children ...Commander) *Splitter {
+	return &Splitter{
+		Children:  children,
+		Joiner:    joiner,
+		Separator: separator,
+	}
+}
+
+// NewEchoSplitter returns a Splitter that splits the output of the
+// children's batched commands on the CLI's echo of each statement.
+func NewEchoSplitter(joiner string, children ...Commander) *Splitter {
+	return &Splitter{
+		Children: children,
+		Joiner:   joiner,
+		Echoed:   true,
+	}
+}
+
+// String returns the children's commands, joined by Joiner.
+func (s *Splitter) String() string {
+	joiner := s.Joiner
+	if joiner == "" {
+		joiner = "\n"
+	}
+	cmds := make([]string, len(s.Children))
+	for i, c := range s.Children {
+		cmds[i] = c.String()
+	}
+	return strings.Join(cmds, joiner)
+}
+
+// Write sends the line to the child owning the current section, or moves
+// on to the next section if the line is a separator or an echo.
+// It returns the child's error, if any.
+func (s *Splitter) Write(line []byte) (int, error) {
+	if !s.began && !s.Echoed {
+		s.began = true
+	}
+	if s.Echoed && s.isEchoOfNext(line) {
+		if s.began {
+			s.current++
+		}
+		s.began = true
+		return 0, nil
+	}
+	if s.Separator != nil && s.Separator(line) {
+		if s.began {
+			s.current++
+		}
+		return 0, nil
+	}
+	if !s.began {
+		return 0, nil
+	}
+	if s.current >= len(s.Children) {
+		s.extra++
+		return 0, nil
+	}
+	return s.Children[s.current].Write(line)
+}
+
+// isEchoOfNext returns true if the line echoes the next child's command.
+func (s *Splitter) isEchoOfNext(line []byte) bool {
+	next := 0
+	if s.began {
+		next = s.current + 1
+	}
+	if next >= len(s.Children) {
+		return false
+	}
+	return bytes.Equal(
+		bytes.TrimSpace(line),
+		[]byte(strings.TrimSpace(s.Children[next].String())))
+}
+
+// Success returns true if every child saw its section and succeeded, and
+// no output arrived beyond the last section.
+func (s *Splitter) Success() bool {
+	if s.extra > 0 || s.Sections() < len(s.Children) {
+		return false
+	}
+	for _, c := range s.Children {
+		if !c.Success() {
+			return false
+		}
+	}
+	return true
+}
+
+// Sections returns the number of sections seen so far.
+func (s *Splitter) Sections() int {
+	if !s.began {
+		return 0
+	}
+	if s.current >= len(s.Children) {
+		return len(s.Children)
+	}
+	return s.current + 1
+}
+
+// Reset resets the children, and the splitting state.
+func (s *Splitter) Reset() {
+	for _, c := range s.Children {
+		c.Reset()
+	}
+	s.began = false
+	s.current = 0
+	s.extra = 0
+}
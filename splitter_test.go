@@ -0,0 +1,114 @@
+package clirunner_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+func isDashes(line []byte) bool {
+	return bytes.Equal(line, []byte("----"))
+}
+
+func TestSplitter(t *testing.T) {
+	testCases := map[string]struct {
+		makeSplitter  func(a, b Commander) *Splitter
+		lines         []string
+		expectA       string
+		expectB       string
+		expectSuccess bool
+	}{
+		"separated": {
+			makeSplitter: func(a, b Commander) *Splitter {
+				return NewSplitter("; ", isDashes, a, b)
+			},
+			lines:         []string{"a1", "a2", "----", "b1"},
+			expectA:       "a1\na2\n",
+			expectB:       "b1\n",
+			expectSuccess: true,
+		},
+		"trailingSeparator": {
+			makeSplitter: func(a, b Commander) *Splitter {
+				return NewSplitter("; ", isDashes, a, b)
+			},
+			lines:         []string{"a1", "----", "b1", "----"},
+			expectA:       "a1\n",
+			expectB:       "b1\n",
+			expectSuccess: true,
+		},
+		"missingSection": {
+			makeSplitter: func(a, b Commander) *Splitter {
+				return NewSplitter("; ", isDashes, a, b)
+			},
+			lines:   []string{"a1", "a2"},
+			expectA: "a1\na2\n",
+		},
+		"extraSection": {
+			makeSplitter: func(a, b Commander) *Splitter {
+				return NewSplitter("; ", isDashes, a, b)
+			},
+			lines:   []string{"a1", "----", "b1", "----", "c1"},
+			expectA: "a1\n",
+			expectB: "b1\n",
+		},
+		"echoed": {
+			makeSplitter: func(a, b Commander) *Splitter {
+				return NewEchoSplitter("; ", a, b)
+			},
+			lines:         []string{"banner", "select a", "a1", " select b ", "b1", "b2"},
+			expectA:       "a1\n",
+			expectB:       "b1\nb2\n",
+			expectSuccess: true,
+		},
+		"echoedOutOfOrder": {
+			makeSplitter: func(a, b Commander) *Splitter {
+				return NewEchoSplitter("; ", a, b)
+			},
+			lines:   []string{"select b", "b1", "select a", "a1"},
+			expectA: "a1\n",
+		},
+		"echoedRepeat": {
+			makeSplitter: func(a, b Commander) *Splitter {
+				return NewEchoSplitter("; ", a, b)
+			},
+			lines:   []string{"select a", "select a", "select b"},
+			expectA: "select a\n",
+			// Both sections seen, and hoarders always succeed.
+			expectSuccess: true,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			a := NewHoardingCommander("select a")
+			b := NewHoardingCommander("select b")
+			s := tc.makeSplitter(a, b)
+			assert.Equal(t, "select a; select b", s.String())
+			for _, l := range tc.lines {
+				_, err := s.Write([]byte(l))
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectA, a.Result())
+			assert.Equal(t, tc.expectB, b.Result())
+			assert.Equal(t, tc.expectSuccess, s.Success())
+			s.Reset()
+			assert.Equal(t, 0, s.Sections())
+			assert.Equal(t, "", a.Result())
+		})
+	}
+}
+
+func TestSplitter_DefaultJoiner(t *testing.T) {
+	s := &Splitter{
+		Children: []Commander{
+			NewHoardingCommander("one"), NewHoardingCommander("two")},
+		Echoed: true,
+	}
+	assert.Equal(t, "one\ntwo", s.String())
+	_, _ = s.Write([]byte("ignored"))
+	assert.Equal(t, 0, s.Sections())
+	_, _ = s.Write([]byte("one"))
+	assert.Equal(t, 1, s.Sections())
+}
@@ -0,0 +1,125 @@
+package clirunner
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+)
+
+// Spooler is an optional interface for a Commander of commands whose
+// output is too big to hold, e.g. a query returning millions of rows.  The
+// lines of stdOut of a Spooler's runs are spooled rather than written to
+// it: kept in memory up to the Parameters' SpoolMemory, and the rest in a
+// temporary file in SpoolDir.  Once the run ends, however it ends, the
+// Spooler reads the output that arrived from the spool, one line per line,
+// and the file is removed.  So the CLI's output is drained as fast as it
+// comes, and the Spooler can parse it as a stream.
+//
+// Lines of stdErr aren't spooled; they go to the Commander as usual.
+type Spooler interface {
+	// ReadSpool reads the output of a run.  The reader is only valid
+	// during the call.  An error fails the run with a SpoolError, but
+	// unlike an error from Write, leaves the runner usable.
+	ReadSpool(r io.Reader) error
+}
+
+// defaultSpoolMemory is the SpoolMemory if Parameters don't say.
+const defaultSpoolMemory = 1 << 20
+
+// spoolerOf returns the Commander, or one it wraps, that's a Spooler, or
+// nil if none is.
+func spoolerOf(c Commander) Spooler {
+	for ; c != nil; c = unwrap(c) {
+		if s, ok := c.(Spooler); ok {
+			return s
+		}
+	}
+	return nil
+}
+
+// spool holds the output of a Spooler's run.
+type spool struct {
+	mem []byte
+	max int
+	dir string
+	f   *os.File
+	w   *bufio.Writer
+	err error // the first error spooling, after which nothing's spooled
+}
+
+func newSpool(max int, dir string) *spool {
+	if max <= 0 {
+		max = defaultSpoolMemory
+	}
+	return &spool{max: max, dir: dir}
+}
+
+// add spools a line, or a piece of one that's continued.
+func (s *spool) add(line []byte, continued bool) {
+	if s.err != nil {
+		return
+	}
+	if s.f == nil && len(s.mem)+len(line)+1 > s.max {
+		if s.f, s.err = os.CreateTemp(s.dir, "clirunner-spool-*"); s.err != nil {
+			return
+		}
+		s.w = bufio.NewWriter(s.f)
+		_, s.err = s.w.Write(s.mem)
+		s.mem = nil
+	}
+	if s.f == nil {
+		s.mem = append(s.mem, line...)
+		if !continued {
+			s.mem = append(s.mem, lineFeed)
+		}
+		return
+	}
+	if _, s.err = s.w.Write(line); s.err == nil && !continued {
+		s.err = s.w.WriteByte(lineFeed)
+	}
+}
+
+// readTo gives the spooled output to the Spooler, then discards it.
+func (s *spool) readTo(sp Spooler) error {
+	defer s.discard()
+	if s.err != nil {
+		return s.err
+	}
+	if s.f == nil {
+		return sp.ReadSpool(bytes.NewReader(s.mem))
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return sp.ReadSpool(bufio.NewReader(s.f))
+}
+
+// discard removes the spool's file, if any.
+func (s *spool) discard() {
+	s.mem = nil
+	if s.f != nil {
+		_ = s.f.Close()
+		_ = os.Remove(s.f.Name())
+		s.f = nil
+	}
+}
+
+// readSpool ends the spooling of the current run, if any, giving what was
+// spooled to the Spooler.
+func (cw *sentinelFilter) readSpool() error {
+	cw.cmdrLock.Lock()
+	s, sp, cmd := cw.spool, cw.spooler, cw.theCmdr.String()
+	cw.spool, cw.spooler = nil, nil
+	cw.cmdrLock.Unlock()
+	if s == nil {
+		return nil
+	}
+	if err := s.readTo(sp); err != nil {
+		return &SpoolError{Command: cmd, Cause: err}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package clirunner_test
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+// spoolCommander reads its output from the spool, noting how many files
+// the spool directory held meanwhile.
+type spoolCommander struct {
+	*HoardingCommander
+	dir    string
+	spool  string
+	files  int
+	failed error
+}
+
+func (c *spoolCommander) ReadSpool(r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	c.spool = string(b)
+	infos, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	c.files = len(infos)
+	return c.failed
+}
+
+func TestRunner_Spooler(t *testing.T) {
+	dir := t.TempDir()
+	h := makeHarness(t, func(p *Parameters) {
+		p.SpoolMemory = 16
+		p.SpoolDir = dir
+		p.MaxLineBytes = 16
+		p.LongLines = LongLinesSplit
+	})
+	run := func(c *spoolCommander, lines ...string) error {
+		result := runAsync(h, c, time.Minute)
+		expectCommands(t, h, "query", "echo Rumpelstiltskin")
+		assert.NoError(t, h.Out(append(lines, "Rumpelstiltskin")...))
+		return <-result
+	}
+
+	// Small output stays in memory.
+	c := &spoolCommander{HoardingCommander: NewHoardingCommander("query"),
+		dir: dir}
+	assert.NoError(t, run(c, "row1"))
+	assert.Equal(t, "row1\n", c.spool)
+	assert.Equal(t, 0, c.files)
+	assert.Empty(t, c.Result())
+
+	// The rest goes to a file, removed once read.  Split lines are whole.
+	c = &spoolCommander{HoardingCommander: NewHoardingCommander("query"),
+		dir: dir}
+	assert.NoError(t, run(c, "row1", "row2", "row3", "a much longer row4", "row5"))
+	assert.Equal(t, "row1\nrow2\nrow3\na much longer row4\nrow5\n", c.spool)
+	assert.Equal(t, 1, c.files)
+	infos, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, infos)
+
+	boom := errors.New("boom")
+	c = &spoolCommander{HoardingCommander: NewHoardingCommander("query"),
+		dir: dir, failed: boom}
+	err = run(c, "row1")
+	assert.ErrorIs(t, err, boom)
+	var se *SpoolError
+	assert.True(t, errors.As(err, &se))
+	assert.Equal(t, "idle", h.Runner.Report().State)
+	assert.NoError(t, h.Runner.Close())
+}
@@ -0,0 +1,133 @@
+package clirunner
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// RunnerStatus is a snapshot of a ProcRunner for a status page, e.g. a
+// health endpoint.  Unlike a SessionReport, it holds no history, so it's
+// cheap to take often.  It marshals to JSON.
+type RunnerStatus struct {
+	// Name is the runner's name.
+	Name string
+	// State is the runner's current state, e.g. "idle".
+	State string
+	// Command is the command running, if any.
+	Command string
+	// Uptime is how long the current CLI subprocess has been up, or zero
+	// if there's none.
+	Uptime time.Duration
+	// LastError is the runner's most recent infrastructure error, if any.
+	LastError error
+	// Queued counts the runs waiting for the current run to finish.
+	Queued int
+}
+
+// runnerStatusJSON is the JSON form of RunnerStatus.
+type runnerStatusJSON struct {
+	Name      string  `json:"name"`
+	State     string  `json:"state"`
+	Command   string  `json:"command,omitempty"`
+	UptimeMs  float64 `json:"uptimeMs"`
+	LastError string  `json:"lastError,omitempty"`
+	Queued    int     `json:"queued"`
+}
+
+// MarshalJSON renders the status with the uptime in milliseconds and the
+// error as a string.
+func (s RunnerStatus) MarshalJSON() ([]byte, error) {
+	j := runnerStatusJSON{
+		Name:     s.Name,
+		State:    s.State,
+		Command:  s.Command,
+		UptimeMs: durationMs(s.Uptime),
+		Queued:   s.Queued,
+	}
+	if s.LastError != nil {
+		j.LastError = s.LastError.Error()
+	}
+	return json.Marshal(j)
+}
+
+// Status returns a RunnerStatus on the runner.  The command is redacted
+// per the Parameters' Secrets.
+func (pr *ProcRunner) Status() RunnerStatus {
+	pr.mutexState.Lock()
+	defer pr.mutexState.Unlock()
+	state := pr.getState()
+	s := RunnerStatus{
+		Name:      pr.params.Name,
+		State:     state.String(),
+		Command:   pr.secrets.redact(pr.filter.runningCommand()),
+		LastError: pr.lastError(),
+		Queued:    pr.queue.length() + pr.flights.length(),
+	}
+	if state != stateUninitialized && pr.startup != nil {
+		s.Uptime = pr.filter.clock.Now().Sub(pr.startup.Start)
+	}
+	return s
+}
+
+// runningCommand returns the command of the run underway, if any.
+func (cw *sentinelFilter) runningCommand() string {
+	if !cw.isRunning() {
+		return ""
+	}
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	if cw.theCmdr == nil {
+		return ""
+	}
+	return cw.theCmdr.String()
+}
+
+// PoolStatus is a snapshot of a ProcRunnerPool for a status page, with a
+// RunnerStatus per runner.  It marshals to JSON.
+type PoolStatus struct {
+	PoolReport
+	// Runners describe the runners in the pool, oldest first.
+	Runners []RunnerStatus
+}
+
+// poolStatusJSON is the JSON form of PoolStatus.
+type poolStatusJSON struct {
+	Size     int            `json:"size"`
+	Idle     int            `json:"idle"`
+	Busy     int            `json:"busy"`
+	Waiting  int            `json:"waiting"`
+	Draining bool           `json:"draining,omitempty"`
+	Runners  []RunnerStatus `json:"runners"`
+}
+
+// MarshalJSON renders the status with an empty list of runners, rather
+// than null, if there are none.
+func (s PoolStatus) MarshalJSON() ([]byte, error) {
+	j := poolStatusJSON{
+		Size:     s.Size,
+		Idle:     s.Idle,
+		Busy:     s.Busy,
+		Waiting:  s.Waiting,
+		Draining: s.Draining,
+		Runners:  s.Runners,
+	}
+	if j.Runners == nil {
+		j.Runners = []RunnerStatus{}
+	}
+	return json.Marshal(j)
+}
+
+// Status returns a PoolStatus on the pool.  The runners are asked for
+// their status after the pool's counts are taken, so a runner that's
+// just been handed out or closed may disagree with them.
+func (p *ProcRunnerPool) Status() PoolStatus {
+	p.mu.Lock()
+	s := PoolStatus{PoolReport: p.reportLocked()}
+	runners := append([]*ProcRunner(nil), p.runners...)
+	p.mu.Unlock()
+	s.Runners = make([]RunnerStatus, len(runners))
+	for i, pr := range runners {
+		s.Runners[i] = pr.Status()
+	}
+	return s
+}
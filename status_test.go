@@ -0,0 +1,71 @@
+package clirunner_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/monopole/clirunner/internal/testcli/tstcli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcRunner_Status(t *testing.T) {
+	h := makeHarness(t)
+	s := h.Runner.Status()
+	assert.Equal(t, "uninitialized", s.State)
+	assert.Equal(t, time.Duration(0), s.Uptime)
+
+	result := runAsync(h, NewHoardingCommander("list"), time.Hour)
+	expectCommands(t, h, "list", "echo Rumpelstiltskin")
+	h.Clock.AwaitTimers(1)
+	h.Clock.Advance(time.Second)
+	s = h.Runner.Status()
+	assert.Equal(t, "running", s.State)
+	assert.Equal(t, "list", s.Command)
+	assert.Equal(t, time.Second, s.Uptime)
+	assert.NoError(t, h.Out("Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+
+	s = h.Runner.Status()
+	assert.Equal(t, "idle", s.State)
+	assert.Empty(t, s.Command)
+	b, err := json.Marshal(s)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"name":"harness","state":"idle","uptimeMs":1000,"queued":0}`,
+		string(b))
+	assert.NoError(t, h.Runner.Close())
+	assert.Equal(t, "uninitialized", h.Runner.Status().State)
+}
+
+func TestProcRunnerPool_Status(t *testing.T) {
+	pool, err := NewProcRunnerPool(poolParams(2, 0, nil))
+	assert.NoError(t, err)
+	b, err := json.Marshal(pool.Status())
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"size":0,"idle":0,"busy":0,"waiting":0,"runners":[]}`,
+		string(b))
+
+	// Hold one runner with a slow command.
+	done := make(chan error, 1)
+	go func() {
+		done <- pool.RunIt(NewHoardingCommander(
+			tstcli.CmdSleep+" 300ms"), testingTimeout)
+	}()
+	s := pool.Status()
+	for len(s.Runners) == 0 || s.Runners[0].State != "running" {
+		time.Sleep(time.Millisecond)
+		s = pool.Status()
+	}
+	assert.Equal(t, 1, s.Busy)
+	assert.Equal(t, tstcli.CmdSleep+" 300ms", s.Runners[0].Command)
+	assert.True(t, s.Runners[0].Uptime > 0)
+	assert.NoError(t, <-done)
+
+	s = pool.Status()
+	assert.Equal(t, 1, s.Idle)
+	assert.Equal(t, "idle", s.Runners[0].State)
+	assert.NoError(t, pool.Close())
+	assert.Empty(t, pool.Status().Runners)
+}
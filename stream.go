@@ -0,0 +1,170 @@
+package clirunner
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Stream is like RunIt, but returns at once, delivering each line of the
+// command's output on the returned channel as it arrives, e.g. to show the
+// progress of a long command, or to process its output incrementally.  The
+// Commander gets the output too, as usual.
+//
+// The channel delivers the lines the Commander would get, apart from any
+// LineSampling, so it stops delivering if an OutputLimit is exceeded.  It's
+// closed once the run is over and all of its lines are delivered;
+// LastRunReport then says how the run went.  A slow reader doesn't hold up
+// the run, but the caller must drain the channel.
+//
+// If something else is running, Stream waits for the command's turn, as
+// RunIt does.  It returns an error, and no channel, if the command couldn't
+// be run at all, e.g. because the runner is in its error state.
+func (pr *ProcRunner) Stream(
+	cmdr Commander, timeOut time.Duration) (<-chan Line, error) {
+	if cmdr == nil {
+		return nil, fmt.Errorf("provide a Commander")
+	}
+	ch := make(chan Line)
+	if _, err := pr.runBackground(cmdr, timeOut, newLineQueue(ch)); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// runBackground runs the Commander in a goroutine of its own, feeding the
+// queue, which it closes when the run is over.  It returns once the command
+// is sent to the CLI, with a channel getting the outcome of the run, or
+// with the error that kept the command from being sent.
+func (pr *ProcRunner) runBackground(cmdr Commander,
+	timeOut time.Duration, q *lineQueue) (<-chan error, error) {
+	result := make(chan error, 1)
+	go func() {
+		err := pr.run(context.Background(), cmdr, timeOut, q)
+		q.close()
+		result <- err
+	}()
+	select {
+	case <-q.started:
+		return result, nil
+	case err := <-result:
+		select {
+		case <-q.started:
+			// It ran, and was quick about it.
+			result <- err
+			return result, nil
+		default:
+			return nil, err
+		}
+	}
+}
+
+// lineQueue passes lines from a sentinelFilter to a channel, queueing as
+// many as need be, so that the filter never waits on the channel's reader.
+type lineQueue struct {
+	m      sync.Mutex
+	cond   *sync.Cond
+	lines  []Line
+	closed bool
+	// started is closed once the command is sent to the CLI.
+	started   chan struct{}
+	startOnce sync.Once
+	discard   bool // lines aren't wanted
+	// recording is true for a recorder, which keeps the marks of its lines
+	// too, in marks.
+	recording bool
+	marks     []lineMark
+}
+
+// lineMark is what a recorder knows of a line, beyond the Line itself, so
+// as to deliver it as the filter would have.
+type lineMark struct {
+	// cut is the length of the ErrPrefix the line starts with, which a
+	// Commander2 doesn't get.
+	cut int
+	// continued is true for a piece of a line continued by the next.
+	continued bool
+}
+
+// newLineQueue returns a lineQueue feeding the given channel, which it
+// closes once the queue is closed and emptied.  If the channel is nil, the
+// lines are dropped; the queue just says when the command was sent.
+func newLineQueue(ch chan<- Line) *lineQueue {
+	q := &lineQueue{started: make(chan struct{}), discard: ch == nil}
+	q.cond = sync.NewCond(&q.m)
+	if ch != nil {
+		go q.pump(ch)
+	}
+	return q
+}
+
+// newLineRecorder returns a lineQueue keeping its lines for taken.
+func newLineRecorder() *lineQueue {
+	q := &lineQueue{started: make(chan struct{}), recording: true}
+	q.cond = sync.NewCond(&q.m)
+	return q
+}
+
+// taken returns the lines queued, and not yet pumped, so far, with their
+// marks if it's a recorder.
+func (q *lineQueue) taken() ([]Line, []lineMark) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	return q.lines, q.marks
+}
+
+// start notes that the command was sent to the CLI.
+func (q *lineQueue) start() {
+	q.startOnce.Do(func() { close(q.started) })
+}
+
+// add queues a line, unless the queue is closed.
+func (q *lineQueue) add(l Line) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	if q.closed || q.discard {
+		return
+	}
+	q.lines = append(q.lines, l)
+	q.cond.Signal()
+}
+
+// record queues a line, with its marks, unless the queue is closed.
+func (q *lineQueue) record(l Line, mark lineMark) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	if q.closed || q.discard {
+		return
+	}
+	q.lines = append(q.lines, l)
+	q.marks = append(q.marks, mark)
+}
+
+// close stops the queue accepting lines.
+func (q *lineQueue) close() {
+	q.m.Lock()
+	defer q.m.Unlock()
+	q.closed = true
+	q.cond.Signal()
+}
+
+// pump sends the queued lines to the channel.
+func (q *lineQueue) pump(ch chan<- Line) {
+	defer close(ch)
+	for {
+		q.m.Lock()
+		for len(q.lines) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		lines, closed := q.lines, q.closed
+		q.lines = nil
+		q.m.Unlock()
+		for _, l := range lines {
+			ch <- l
+		}
+		if closed && len(lines) == 0 {
+			return
+		}
+	}
+}
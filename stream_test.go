@@ -0,0 +1,98 @@
+package clirunner_test
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/monopole/clirunner/internal/testcli/tstcli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunner_Stream(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+	})
+	assert.NoError(t, err)
+
+	_, err = runner.Stream(nil, testingTimeout)
+	assert.Error(t, err)
+
+	commander := NewHoardingCommander(tstcli.CmdQuery + " limit 5")
+	lines, err := runner.Stream(commander, testingTimeout)
+	assert.NoError(t, err)
+
+	var b strings.Builder
+	for l := range lines {
+		assert.Equal(t, StreamOut, l.Stream)
+		b.Write(l.Data)
+		b.WriteByte('\n')
+	}
+	assert.Equal(t, commander.Result(), b.String())
+	assert.Equal(t, 5, strings.Count(b.String(), "\n"))
+	report, ok := runner.LastRunReport()
+	assert.True(t, ok)
+	assert.NoError(t, report.Err)
+	assert.Equal(t, 5, report.LinesOut)
+
+	// A failed run is reported when the stream ends.
+	lines, err = runner.Stream(
+		NewHoardingCommander(tstcli.CmdSleep+" 2s"), testingTimeout/10)
+	assert.NoError(t, err)
+	for range lines {
+	}
+	report, _ = runner.LastRunReport()
+	assert.Error(t, report.Err)
+	assert.NoError(t, runner.Restart())
+}
+
+func TestRunner_Follow(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+		// Assure the complaint about the interrupt is swept up.
+		ErrSentinel:     tstcli.MakeErrSentinelCommander(),
+		InterruptSignal: os.Interrupt,
+	})
+	assert.NoError(t, err)
+
+	// Without sentinels, following goes on until it's told to stop, and
+	// commands sent meanwhile run afterwards.
+	s, err := runner.StartExpect()
+	assert.NoError(t, err)
+	assert.NoError(t, s.Send(tstcli.CmdFollow+" 10ms"))
+	_, err = s.Expect(
+		regexp.MustCompile("^"+tstcli.FollowPrefix+"3$"), testingTimeout)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Send(tstcli.CmdEcho+" after"))
+	assert.NoError(t, s.Send(tstcli.CmdStop))
+	m, err := s.Expect(regexp.MustCompile("^after$"), testingTimeout)
+	assert.NoError(t, err)
+	for _, l := range m.Before {
+		assert.True(t, strings.HasPrefix(string(l.Data), tstcli.FollowPrefix))
+	}
+	assert.NoError(t, s.Close())
+
+	// With sentinels, following outlasts any time limit, and is interrupted.
+	follower := NewHoardingCommander(tstcli.CmdFollow + " 10ms")
+	err = runner.RunIt(follower, 500*time.Millisecond)
+	var recovered *TimeoutButRecoveredError
+	if !assert.True(t, errors.As(err, &recovered)) {
+		t.Fatalf("expected TimeoutButRecoveredError, got %v", err)
+	}
+	assert.True(t,
+		strings.HasPrefix(follower.Result(), tstcli.FollowPrefix+"1\n"))
+	// The complaint, on stdErr, might beat the last lines on stdOut.
+	assert.Contains(t, follower.Result(), tstcli.CmdFollow+" interrupted\n")
+	assert.NoError(t, runner.Close())
+}
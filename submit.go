@@ -0,0 +1,63 @@
+package clirunner
+
+import (
+	"context"
+)
+
+// Run is a run started by Submit.
+type Run struct {
+	cmdr Commander
+	done chan struct{}
+	err  error // set before done is closed
+}
+
+// Submit is like RunIt with a zero timeOut, i.e. the default time limit,
+// or the Commander's TimeoutHint, but returns at once, as soon as the
+// command is sent to the CLI, with a Run to collect the outcome later.
+// Meanwhile, the runner is in its running state, as during RunIt.
+//
+// If something else is running, Submit waits for the command's turn, as
+// RunIt does.  It returns an error, and no Run, if the command couldn't be
+// run at all, e.g. because the runner is in its error state.
+func (pr *ProcRunner) Submit(cmdr Commander) (*Run, error) {
+	result, err := pr.runBackground(cmdr, 0, newLineQueue(nil))
+	if err != nil {
+		return nil, err
+	}
+	r := &Run{cmdr: cmdr, done: make(chan struct{})}
+	go func() {
+		r.err = <-result
+		close(r.done)
+	}()
+	return r, nil
+}
+
+// Commander returns the Commander of the run, which holds its output once
+// the run is done.
+func (r *Run) Commander() Commander { return r.cmdr }
+
+// Done returns a channel closed when the run is over.
+func (r *Run) Done() <-chan struct{} { return r.done }
+
+// Err returns what RunIt would have returned, once the run is over, and
+// nil before then.
+func (r *Run) Err() error {
+	select {
+	case <-r.done:
+		return r.err
+	default:
+		return nil
+	}
+}
+
+// Wait waits for the run to be over, returning what RunIt would have
+// returned, or for the context to be done, returning its error.  The run
+// carries on regardless of the context.
+func (r *Run) Wait(ctx context.Context) error {
+	select {
+	case <-r.done:
+		return r.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
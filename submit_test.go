@@ -0,0 +1,56 @@
+package clirunner_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/monopole/clirunner/internal/testcli/tstcli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunner_Submit(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+	})
+	assert.NoError(t, err)
+
+	commander := NewHoardingCommander(tstcli.CmdSleep + " 200ms")
+	run, err := runner.Submit(commander)
+	assert.NoError(t, err)
+	assert.Equal(t, "running", runner.Report().State)
+	assert.NoError(t, run.Err())
+
+	// Giving up on waiting doesn't stop the run.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, run.Wait(ctx))
+
+	assert.NoError(t, run.Wait(context.Background()))
+	<-run.Done()
+	assert.NoError(t, run.Err())
+	assert.Equal(t, "idle", runner.Report().State)
+
+	commander = NewHoardingCommander(tstcli.CmdQuery + " limit 3")
+	run, err = runner.Submit(commander)
+	assert.NoError(t, err)
+	assert.NoError(t, run.Wait(context.Background()))
+	assert.Equal(t, 3, strings.Count(commander.Result(), "\n"))
+	assert.Equal(t, commander, run.Commander())
+
+	// A failed run is reported by the Run.
+	run, err = runner.Submit(WithTimeoutHint(
+		NewHoardingCommander(tstcli.CmdSleep+" 2s"), testingTimeout/10))
+	assert.NoError(t, err)
+	<-run.Done()
+	assert.Error(t, run.Err())
+	assert.Equal(t, run.Err(), run.Wait(context.Background()))
+	assert.NoError(t, runner.Restart())
+	assert.NoError(t, runner.Close())
+}
@@ -0,0 +1,180 @@
+package clirunner
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/monopole/clirunner/cmdrs"
+)
+
+// SubSession describes a nested interpreter that a CLI can drop into,
+// e.g. a shell escape like "\! bash", or a "debug mode" with its own
+// prompt.  While in it, commands are terminated and completion is detected
+// per the SubSession rather than per Parameters.
+type SubSession struct {
+	// EnterCommand makes the CLI start the nested interpreter.
+	// It's terminated per the enclosing session.
+	// Example: "\! bash"
+	EnterCommand string
+
+	// ExitCommand makes the nested interpreter exit, returning to the
+	// enclosing session.  It's terminated per this SubSession.
+	// Example: "exit"
+	ExitCommand string
+
+	// OutSentinel, ErrSentinel, OutStrategy and ErrStrategy detect command
+	// completion in the nested interpreter, as their counterparts in
+	// Parameters do for the CLI.  Specify OutSentinel or OutStrategy.
+	OutSentinel Commander
+	ErrSentinel Commander
+	OutStrategy SentinelStrategy
+	ErrStrategy SentinelStrategy
+
+	// CommandTerminator, if not 0, is appended to every command in the
+	// nested interpreter.
+	CommandTerminator byte
+}
+
+// Validate looks for trouble.
+func (s *SubSession) Validate() error {
+	if s.EnterCommand == "" {
+		return fmt.Errorf("must specify an EnterCommand")
+	}
+	if s.ExitCommand == "" {
+		return fmt.Errorf("must specify an ExitCommand")
+	}
+	if s.OutSentinel == nil && s.OutStrategy == nil {
+		return fmt.Errorf("must specify OutSentinel or OutStrategy")
+	}
+	if s.OutSentinel != nil && s.OutStrategy != nil {
+		return fmt.Errorf("specify only one of OutSentinel and OutStrategy")
+	}
+	if s.ErrSentinel != nil && s.ErrStrategy != nil {
+		return fmt.Errorf("specify only one of ErrSentinel and ErrStrategy")
+	}
+	return nil
+}
+
+// strategies returns the sentinel strategies to use for stdOut and stdErr.
+// The latter might be nil.
+func (s *SubSession) strategies() (
+	out SentinelStrategy, es SentinelStrategy) {
+	out, es = s.OutStrategy, s.ErrStrategy
+	if out == nil {
+		out = StrategyFromCommander(s.OutSentinel)
+	}
+	if es == nil {
+		es = StrategyFromCommander(s.ErrSentinel)
+	}
+	return
+}
+
+// enclosingSession holds what's needed to return to the session enclosing
+// a SubSession.
+type enclosingSession struct {
+	sub         *SubSession
+	outSentinel SentinelStrategy
+	errSentinel SentinelStrategy
+	terminator  byte
+}
+
+// EnterSubSession issues the SubSession's EnterCommand, and from then on
+// terminates commands and detects their completion per the SubSession,
+// until ExitSubSession is called.  SubSessions can nest.
+//
+// Restarting the CLI subprocess leaves all SubSessions, since a fresh CLI
+// is in its top level interpreter.  If entering fails, the ProcRunner
+// enters its error state, since it no longer knows which interpreter
+// it's talking to.
+func (pr *ProcRunner) EnterSubSession(
+	s *SubSession, timeOut time.Duration) error {
+	if s == nil {
+		return fmt.Errorf("provide a SubSession")
+	}
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	pr.mutexState.Lock()
+	defer pr.mutexState.Unlock()
+	switch pr.getState() {
+	case stateRunning:
+		return fmt.Errorf("cannot enter sub-session while running")
+	case stateError:
+		return fmt.Errorf("cannot enter sub-session in error state")
+	case stateUninitialized:
+		if err := pr.launch(); err != nil {
+			pr.enterStateError(err)
+			return err
+		}
+		pr.prepareStandby()
+	}
+	pr.sentinelMu.Lock()
+	pr.subSessions = append(pr.subSessions, &enclosingSession{
+		sub:         s,
+		outSentinel: pr.filter.outSentinel,
+		errSentinel: pr.filter.errSentinel,
+		terminator:  pr.filter.terminator,
+	})
+	pr.sentinelMu.Unlock()
+	out, es := s.strategies()
+	if err := pr.runTransition(
+		s.EnterCommand, out, es, s.CommandTerminator, timeOut); err != nil {
+		pr.enterStateError(err)
+		return err
+	}
+	return nil
+}
+
+// ExitSubSession issues the ExitCommand of the innermost SubSession, and
+// returns to terminating commands and detecting their completion per the
+// enclosing session.  Failure is handled as in EnterSubSession.
+func (pr *ProcRunner) ExitSubSession(timeOut time.Duration) error {
+	pr.mutexState.Lock()
+	defer pr.mutexState.Unlock()
+	switch pr.getState() {
+	case stateRunning:
+		return fmt.Errorf("cannot exit sub-session while running")
+	case stateError:
+		return fmt.Errorf("cannot exit sub-session in error state")
+	}
+	n := len(pr.subSessions)
+	if n == 0 {
+		return fmt.Errorf("not in a sub-session")
+	}
+	enc := pr.subSessions[n-1]
+	pr.subSessions = pr.subSessions[:n-1]
+	if err := pr.runTransition(
+		enc.sub.ExitCommand, enc.outSentinel, enc.errSentinel,
+		enc.terminator, timeOut); err != nil {
+		pr.enterStateError(err)
+		return err
+	}
+	return nil
+}
+
+// SubSessionDepth returns the number of SubSessions entered and not exited.
+func (pr *ProcRunner) SubSessionDepth() int {
+	pr.mutexState.Lock()
+	defer pr.mutexState.Unlock()
+	return len(pr.subSessions)
+}
+
+// runTransition issues a command that changes the CLI's interpreter, then
+// detects its completion with the given sentinels and terminator, which
+// remain in effect.  The command itself is terminated per the current
+// interpreter.  The caller must hold mutexState.
+func (pr *ProcRunner) runTransition(
+	c string, out, es SentinelStrategy, t byte, timeOut time.Duration) error {
+	pr.sentinelMu.Lock()
+	defer pr.sentinelMu.Unlock()
+	if _, err := pr.filter.BeginRun(
+		&cmdrs.KondoCommander{Command: c}, pr.stdIn); err != nil {
+		return err
+	}
+	if err := pr.filter.setSentinels(out, es); err != nil {
+		pr.filter.resetFilter()
+		return err
+	}
+	pr.filter.terminator = t
+	return pr.filter.IssueSentinelsAndFilter(pr.chOut, pr.chErr, timeOut)
+}
@@ -0,0 +1,104 @@
+package clirunner_test
+
+import (
+	"testing"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/monopole/clirunner/internal/testcli/tstcli"
+	"github.com/stretchr/testify/assert"
+)
+
+// makeTestSubSession makes a SubSession that the testcli can "enter",
+// using a different sentinel and terminator than the top level.
+func makeTestSubSession() *SubSession {
+	return &SubSession{
+		EnterCommand: tstcli.CmdEcho + " entering",
+		ExitCommand:  tstcli.CmdEcho + " leaving",
+		OutSentinel: &SimpleSentinelCommander{
+			Command: tstcli.CmdEcho + " Rapunzel",
+			Value:   "Rapunzel",
+		},
+		CommandTerminator: ';',
+	}
+}
+
+func TestSubSession_Validate(t *testing.T) {
+	testCases := map[string]struct {
+		mutate    func(s *SubSession)
+		expectErr string
+	}{
+		"ok": {
+			mutate: func(s *SubSession) {},
+		},
+		"noEnter": {
+			mutate:    func(s *SubSession) { s.EnterCommand = "" },
+			expectErr: "must specify an EnterCommand",
+		},
+		"noExit": {
+			mutate:    func(s *SubSession) { s.ExitCommand = "" },
+			expectErr: "must specify an ExitCommand",
+		},
+		"noOut": {
+			mutate:    func(s *SubSession) { s.OutSentinel = nil },
+			expectErr: "must specify OutSentinel or OutStrategy",
+		},
+		"bothOut": {
+			mutate: func(s *SubSession) {
+				s.OutStrategy = StrategyFromCommander(tstcli.MakeOutSentinelCommander())
+			},
+			expectErr: "specify only one of OutSentinel and OutStrategy",
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			s := makeTestSubSession()
+			tc.mutate(s)
+			err := s.Validate()
+			if tc.expectErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tc.expectErr)
+			}
+		})
+	}
+}
+
+func TestRunner_SubSession(t *testing.T) {
+	runner, err := NewProcRunner(&Parameters{
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+	})
+	assert.NoError(t, err)
+	assert.Error(t, runner.ExitSubSession(testingTimeout))
+
+	assert.NoError(t, runner.EnterSubSession(makeTestSubSession(), testingTimeout))
+	assert.Equal(t, 1, runner.SubSessionDepth())
+	commander := NewHoardingCommander(tstcli.CmdEcho + " inside")
+	assert.NoError(t, runner.RunIt(commander, testingTimeout))
+	assert.Equal(t, "inside\n", commander.Result())
+
+	// Nest another.
+	assert.NoError(t, runner.EnterSubSession(&SubSession{
+		EnterCommand: tstcli.CmdEcho + " deeper",
+		ExitCommand:  tstcli.CmdEcho + " shallower",
+		OutSentinel:  tstcli.MakeOutSentinelCommander(),
+	}, testingTimeout))
+	assert.Equal(t, 2, runner.SubSessionDepth())
+	assert.NoError(t, runner.ExitSubSession(testingTimeout))
+
+	assert.NoError(t, runner.ExitSubSession(testingTimeout))
+	assert.Equal(t, 0, runner.SubSessionDepth())
+	commander = NewHoardingCommander(tstcli.CmdEcho + " outside")
+	assert.NoError(t, runner.RunIt(commander, testingTimeout))
+	assert.Equal(t, "outside\n", commander.Result())
+
+	// Close leaves any sub-sessions.
+	assert.NoError(t, runner.EnterSubSession(makeTestSubSession(), testingTimeout))
+	assert.NoError(t, runner.Close())
+	assert.Equal(t, 0, runner.SubSessionDepth())
+}
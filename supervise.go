@@ -0,0 +1,215 @@
+package clirunner
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Supervision has a ProcRunner relaunch its CLI whenever the CLI exits
+// unexpectedly, e.g. crashes, rather than leaving the runner in its error
+// state until the next run, or a call to Restart.  Exits the runner asks
+// for (Close, Restart, etc.) and CLIs it abandons (e.g. after a timeout)
+// aren't relaunched.
+//
+// A relaunch takes its turn like a run, after any run underway, and
+// ahead of those asked for later; they find the new CLI, past its
+// SetupCommands, tracked context and InitCommands.
+type Supervision struct {
+	// MaxRestarts is the most relaunches in a row, i.e. without a run
+	// succeeding in between; after that, the runner is left in its error
+	// state.  Zero means no limit.
+	//
+	// Example: 5
+	MaxRestarts int
+
+	// RestartBudget, if positive, is the most relaunches within any
+	// RestartWindow, whether runs succeed in between or not.  After that,
+	// the runner is left in its error state, and runs fail with a
+	// RestartBudgetExhaustedError until Restart, so that a CLI that keeps
+	// crashing doesn't hammer a broken backend.
+	//
+	// Example: 10
+	RestartBudget int
+
+	// RestartWindow is the period the RestartBudget covers.
+	//
+	// Example: time.Hour
+	RestartWindow time.Duration
+
+	// Backoff is the delay before the first relaunch in a row; each next
+	// one waits twice as long as the last.  Zero relaunches at once.
+	//
+	// Example: time.Second
+	Backoff time.Duration
+
+	// MaxBackoff, if positive, caps the delay.
+	//
+	// Example: time.Minute
+	MaxBackoff time.Duration
+
+	// InitCommands are run, in order, on each relaunched CLI, after its
+	// SetupCommands and tracked context, e.g. to reload state a crash lost.
+	// Their output is discarded.
+	InitCommands []string
+}
+
+func (s *Supervision) validate() error {
+	if s.MaxRestarts < 0 {
+		return fmt.Errorf("Supervision MaxRestarts can't be negative")
+	}
+	if s.Backoff < 0 || s.MaxBackoff < 0 {
+		return fmt.Errorf("Supervision backoff can't be negative")
+	}
+	if s.RestartBudget < 0 {
+		return fmt.Errorf("Supervision RestartBudget can't be negative")
+	}
+	if s.RestartBudget > 0 && s.RestartWindow <= 0 {
+		return fmt.Errorf(
+			"Supervision RestartWindow must be positive with a RestartBudget")
+	}
+	return nil
+}
+
+// backoff returns the delay before the n'th relaunch in a row, from 1.
+func (s *Supervision) backoff(n int) time.Duration {
+	d := s.Backoff
+	for i := 1; i < n && d > 0; i++ {
+		if s.MaxBackoff > 0 && d >= s.MaxBackoff {
+			break
+		}
+		d *= 2
+	}
+	if s.MaxBackoff > 0 && d > s.MaxBackoff {
+		d = s.MaxBackoff
+	}
+	return d
+}
+
+// supervise starts watching the subprocess just launched or adopted, if
+// Parameters ask for Supervision.  The caller must hold mutexState.
+func (pr *ProcRunner) supervise() {
+	if pr.params.Supervise == nil || pr.isStandby {
+		return
+	}
+	go pr.watchCrash(pr.proc, pr.exited)
+}
+
+// watchCrash relaunches the CLI if the given subprocess exits while it's
+// still the runner's, and the runner didn't end it.
+func (pr *ProcRunner) watchCrash(p process, exited <-chan struct{}) {
+	<-exited
+	// Wait for any run underway to end, and keep later ones waiting.
+	_ = pr.queue.enter(context.Background())
+	defer pr.queue.leave()
+	// ours says the subprocess is still the runner's, and unwanted by it.
+	// After a failed relaunch, it's the one that failed.
+	retrying := false
+	ours := func() bool {
+		return pr.proc == p && (retrying || pr.leaving != p)
+	}
+	for {
+		pr.mutexState.Lock()
+		if !ours() {
+			pr.mutexState.Unlock()
+			return
+		}
+		sup := pr.params.Supervise
+		clock := clockOrReal(pr.params.Clock)
+		pr.mutexState.Unlock()
+		if sup == nil {
+			return
+		}
+		n := int(atomic.AddInt32(&pr.restarts, 1))
+		if sup.MaxRestarts > 0 && n > sup.MaxRestarts {
+			pr.logger.Printf("CLI exited; %d restarts in a row, giving up\n",
+				sup.MaxRestarts)
+			return
+		}
+		if !pr.spendRestart(p, sup, clock.Now()) {
+			return
+		}
+		if d := sup.backoff(n); d > 0 {
+			pr.logger.Printf("CLI exited; relaunching in %s\n", d)
+			<-clock.NewTimer(d).C()
+		}
+		pr.mutexState.Lock()
+		if !ours() {
+			// Closed or restarted meanwhile.
+			pr.mutexState.Unlock()
+			return
+		}
+		err := pr.relaunch(sup)
+		if err == nil {
+			pr.mutexState.Unlock()
+			return
+		}
+		pr.logger.Printf("relaunch failed: %s\n", err.Error())
+		pr.enterStateError(err)
+		p, retrying = pr.proc, true
+		pr.mutexState.Unlock()
+	}
+}
+
+// spendRestart notes a relaunch of the given subprocess' replacement at
+// the given time, returning false, and leaving the runner in its error
+// state, if the RestartBudget is used up.
+func (pr *ProcRunner) spendRestart(
+	p process, sup *Supervision, now time.Time) bool {
+	if sup.RestartBudget <= 0 {
+		return true
+	}
+	pr.mutexState.Lock()
+	defer pr.mutexState.Unlock()
+	recent := pr.relaunches[:0]
+	for _, t := range pr.relaunches {
+		if now.Sub(t) < sup.RestartWindow {
+			recent = append(recent, t)
+		}
+	}
+	pr.relaunches = recent
+	if len(recent) < sup.RestartBudget {
+		pr.relaunches = append(pr.relaunches, now)
+		return true
+	}
+	err := &RestartBudgetExhaustedError{
+		Restarts: len(recent), Window: sup.RestartWindow}
+	pr.logger.Printf("CLI exited; %s\n", err.Error())
+	if pr.proc == p {
+		if pr.infraErrors == nil {
+			pr.infraErrors = &errorTracker{}
+		}
+		pr.enterStateError(err)
+	}
+	return false
+}
+
+// relaunch replaces the subprocess that exited, failing over to a warm
+// standby if there is one, and runs the InitCommands.  The caller must
+// hold mutexState.
+func (pr *ProcRunner) relaunch(sup *Supervision) error {
+	pr.logger.Println("relaunching CLI")
+	if pr.standby != nil {
+		if err := pr.failover(); err != nil {
+			return err
+		}
+	} else {
+		// As Restart does; the exit is no news.
+		pr.proc = nil
+		pr.infraErrors = nil
+		if err := pr.launch(); err != nil {
+			pr.abandonSubprocess()
+			return err
+		}
+		pr.prepareStandby()
+	}
+	for _, c := range sup.InitCommands {
+		pr.logger.Printf("running init command %q\n", c)
+		if err := pr.runInternal(c); err != nil {
+			pr.abandonSubprocess()
+			return fmt.Errorf("running init command %q; %w", c, err)
+		}
+	}
+	return nil
+}
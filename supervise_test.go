@@ -0,0 +1,124 @@
+package clirunner_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+// awaitState waits for the runner to reach the given state.
+func awaitState(t *testing.T, h *Harness, state string) {
+	deadline := time.Now().Add(testingTimeout)
+	for h.Runner.Report().State != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("runner never got to state %s", state)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRunner_Supervise(t *testing.T) {
+	h := makeHarness(t, func(p *Parameters) {
+		p.Supervise = &Supervision{
+			MaxRestarts:  2,
+			Backoff:      time.Second,
+			InitCommands: []string{"reload"},
+		}
+	})
+	run := func(cmd string) {
+		result := runAsync(h, NewHoardingCommander(cmd), time.Minute)
+		expectCommands(t, h, cmd, "echo Rumpelstiltskin")
+		assert.NoError(t, h.Out("Rumpelstiltskin"))
+		assert.NoError(t, <-result)
+	}
+	// crash ends the CLI, and awaits the relaunch after the given backoff.
+	crash := func(backoff time.Duration) {
+		h.Exit(errors.New("segmentation fault"))
+		h.Clock.AwaitTimers(1)
+		h.Clock.Advance(backoff)
+		expectCommands(t, h, "reload", "echo Rumpelstiltskin")
+		assert.NoError(t, h.Out("Rumpelstiltskin"))
+		awaitState(t, h, "idle")
+	}
+
+	run("list")
+	crash(time.Second)
+	assert.Equal(t, 2, h.Starts())
+	run("list")
+
+	// The backoff doubles while the CLI keeps crashing, up to a limit.
+	crash(time.Second)
+	crash(2 * time.Second)
+	assert.Equal(t, 4, h.Starts())
+	h.Exit(errors.New("segmentation fault"))
+	awaitState(t, h, "error")
+	assert.Equal(t, 0, h.Clock.Timers())
+	assert.Equal(t, 4, h.Starts())
+	assert.Error(t, h.Runner.Close())
+
+	// Exits the runner asks for aren't crashes.
+	run("list")
+	assert.Equal(t, 5, h.Starts())
+	assert.NoError(t, h.Runner.Close())
+	expectCommands(t, h, "quit")
+	awaitState(t, h, "uninitialized")
+	assert.Equal(t, 0, h.Clock.Timers())
+	assert.Equal(t, 5, h.Starts())
+}
+
+func TestRunner_SuperviseRestartBudget(t *testing.T) {
+	h := makeHarness(t, func(p *Parameters) {
+		p.Supervise = &Supervision{RestartBudget: 2, RestartWindow: time.Hour}
+	})
+	run := func(cmd string) {
+		result := runAsync(h, NewHoardingCommander(cmd), time.Minute)
+		expectCommands(t, h, cmd, "echo Rumpelstiltskin")
+		assert.NoError(t, h.Out("Rumpelstiltskin"))
+		assert.NoError(t, <-result)
+	}
+	// crash ends the CLI, and awaits its relaunch.
+	crash := func() {
+		starts := h.Starts()
+		h.Exit(errors.New("segmentation fault"))
+		deadline := time.Now().Add(testingTimeout)
+		for h.Starts() == starts {
+			if time.Now().After(deadline) {
+				t.Fatal("CLI never relaunched")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		awaitState(t, h, "idle")
+	}
+
+	// Successful runs in between don't refill the budget.
+	run("list")
+	crash()
+	run("list")
+	crash()
+	run("list")
+	h.Exit(errors.New("segmentation fault"))
+	awaitState(t, h, "error")
+	assert.Equal(t, 3, h.Starts())
+	var be *RestartBudgetExhaustedError
+	err := h.Runner.RunIt(NewHoardingCommander("list"), time.Minute)
+	assert.True(t, errors.As(err, &be))
+	assert.Equal(t, 2, be.Restarts)
+	assert.Equal(t, time.Hour, be.Window)
+
+	// Restart refills it.
+	assert.NoError(t, h.Runner.Restart())
+	run("list")
+	crash()
+	assert.Equal(t, 5, h.Starts())
+
+	// Relaunches older than the window don't count.
+	h.Clock.Advance(time.Hour)
+	crash()
+	crash()
+	assert.Equal(t, 7, h.Starts())
+	_ = h.Runner.Close()
+}
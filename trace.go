@@ -0,0 +1,50 @@
+package clirunner
+
+import (
+	"context"
+	"time"
+)
+
+// RunTracer traces runs, e.g. as OpenTelemetry spans, for a ProcRunner
+// embedded in an instrumented service.  See Parameters.RunTracer.
+//
+// An OpenTelemetry adapter is a few lines:
+//
+//	type otelTracer struct{ tracer trace.Tracer }
+//
+//	func (t otelTracer) StartRun(ctx context.Context,
+//		command string, timeOut time.Duration) func(RunReport) {
+//		_, span := t.tracer.Start(ctx, "clirunner.run", trace.WithAttributes(
+//			attribute.String("command", command),
+//			attribute.Int64("timeoutMs", timeOut.Milliseconds())))
+//		return func(r RunReport) {
+//			span.SetAttributes(attribute.Int("bytesRead", r.BytesOut+r.BytesErr))
+//			if r.Err != nil {
+//				span.RecordError(r.Err)
+//				span.SetStatus(codes.Error, r.Err.Error())
+//			}
+//			span.End()
+//		}
+//	}
+type RunTracer interface {
+	// StartRun is called as a run begins, before its command is issued,
+	// with the context of the run, the command, and the time limit, where
+	// zero means the default or the context's deadline.  It returns the
+	// function to call once the sentinels are seen or the run fails.
+	StartRun(ctx context.Context,
+		command string, timeOut time.Duration) (end func(RunReport))
+}
+
+// startTrace starts tracing a run, returning the function ending the trace.
+func (pr *ProcRunner) startTrace(ctx context.Context,
+	cmdr Commander, timeOut time.Duration) func(RunReport) {
+	if pr.params.RunTracer == nil {
+		return func(RunReport) {}
+	}
+	end := pr.params.RunTracer.StartRun(
+		ctx, pr.secrets.redact(cmdr.String()), timeOut)
+	if end == nil {
+		return func(RunReport) {}
+	}
+	return end
+}
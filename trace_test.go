@@ -0,0 +1,63 @@
+package clirunner_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/monopole/clirunner/internal/testcli/tstcli"
+	"github.com/stretchr/testify/assert"
+)
+
+// span is what fakeTracer learns about a run.
+type span struct {
+	command string
+	timeOut time.Duration
+	report  *RunReport
+}
+
+type fakeTracer struct {
+	spans []*span
+}
+
+func (t *fakeTracer) StartRun(
+	_ context.Context, command string, timeOut time.Duration) func(RunReport) {
+	s := &span{command: command, timeOut: timeOut}
+	t.spans = append(t.spans, s)
+	return func(r RunReport) { s.report = &r }
+}
+
+func TestRunner_Run_RunTracer(t *testing.T) {
+	tracer := &fakeTracer{}
+	runner, err := NewProcRunner(&Parameters{
+		RunTracer:   tracer,
+		Path:        tstcli.TestCliPath,
+		Args:        []string{"--" + tstcli.FlagDisablePrompt},
+		ExitCommand: tstcli.CmdQuit,
+		OutSentinel: tstcli.MakeOutSentinelCommander(),
+	})
+	assert.NoError(t, err)
+	c := NewHoardingCommander(tstcli.CmdQuery + " limit 2")
+	assert.NoError(t, runner.RunIt(c, testingTimeout))
+	assert.Error(t, runner.RunIt(nil, testingTimeout))
+	assert.NoError(t, runner.RunIt(
+		WithTimeoutHint(c, time.Minute), 0))
+	assert.NoError(t, runner.Close())
+
+	// The nil Commander is rejected before any trace.
+	if !assert.Len(t, tracer.spans, 2) {
+		return
+	}
+	s := tracer.spans[0]
+	assert.Equal(t, tstcli.CmdQuery+" limit 2", s.command)
+	assert.Equal(t, testingTimeout, s.timeOut)
+	if assert.NotNil(t, s.report) {
+		assert.NoError(t, s.report.Err)
+		assert.Equal(t, 2, s.report.LinesOut)
+		assert.Greater(t, s.report.BytesOut, 0)
+	}
+	assert.Equal(t, time.Minute, tracer.spans[1].timeOut)
+	assert.NotNil(t, tracer.spans[1].report)
+}
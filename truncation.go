@@ -0,0 +1,42 @@
+package clirunner
+
+// checkTruncation notes the first line of a run matching a truncation
+// pattern, warning of it.  The caller must hold cmdrLock.
+func (cw *sentinelFilter) checkTruncation(stream Stream, line []byte) {
+	if cw.truncLine != nil {
+		return
+	}
+	for _, re := range cw.truncation {
+		if re.Match(line) {
+			cw.logger.Printf("truncation line on std%s: %q", stream, string(line))
+			cw.truncLine = &Line{
+				Data: append([]byte(nil), line...), Stream: stream}
+			cw.truncPattern = re
+			cw.warnings = append(cw.warnings,
+				"the CLI truncated the output: "+string(line))
+			return
+		}
+	}
+}
+
+// outputTruncated returns true if the current run saw a truncation line.
+func (cw *sentinelFilter) outputTruncated() bool {
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	return cw.truncLine != nil
+}
+
+// truncationError returns an OutputTruncatedError if the current run saw a
+// truncation line, and that fails runs.
+func (cw *sentinelFilter) truncationError() error {
+	cw.cmdrLock.Lock()
+	defer cw.cmdrLock.Unlock()
+	if cw.truncLine == nil || !cw.failOnTruncation {
+		return nil
+	}
+	return &OutputTruncatedError{
+		Command: cw.theCmdr.String(),
+		Line:    *cw.truncLine,
+		Pattern: cw.truncPattern.String(),
+	}
+}
@@ -0,0 +1,79 @@
+package clirunner_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTruncationHarness(t *testing.T, fail bool) *Harness {
+	return makeHarness(t, func(p *Parameters) {
+		p.TruncationPatterns = []*regexp.Regexp{
+			regexp.MustCompile(`^size \d+ limit`),
+			regexp.MustCompile(`(?i)output truncated`),
+		}
+		p.FailOnTruncation = fail
+	})
+}
+
+func TestRunner_Truncation(t *testing.T) {
+	h := makeTruncationHarness(t, false)
+	c := NewHoardingCommander("select")
+	result := runAsync(h, c, time.Minute)
+	expectCommands(t, h, "select", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("row 1", "size 128000 limit reached", "Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	assert.Equal(t, "row 1\nsize 128000 limit reached\n", c.Result())
+	r, _ := h.Runner.LastRunReport()
+	assert.True(t, r.OutputTruncated)
+	assert.False(t, r.Truncated)
+	assert.Equal(t, []string{
+		"the CLI truncated the output: size 128000 limit reached"}, r.Warnings)
+
+	// The next run starts afresh.
+	result = runAsync(h, NewHoardingCommander("select"), time.Minute)
+	expectCommands(t, h, "select", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("row 1", "Rumpelstiltskin"))
+	assert.NoError(t, <-result)
+	r, _ = h.Runner.LastRunReport()
+	assert.False(t, r.OutputTruncated)
+	assert.Empty(t, r.Warnings)
+	assert.NoError(t, h.Runner.Close())
+}
+
+func TestRunner_FailOnTruncation(t *testing.T) {
+	h := makeTruncationHarness(t, true)
+	c := NewHoardingCommander("select")
+	result := runAsync(h, c, time.Minute)
+	expectCommands(t, h, "select", "echo Rumpelstiltskin")
+	assert.NoError(t, h.Out("row 1", "(Output Truncated)", "row 2", "Rumpelstiltskin"))
+	err := <-result
+	var te *OutputTruncatedError
+	assert.True(t, errors.As(err, &te))
+	assert.Equal(t, "select", te.Command)
+	assert.Equal(t, "(Output Truncated)", string(te.Line.Data))
+	assert.Equal(t, StreamOut, te.Line.Stream)
+	assert.Equal(t, "(?i)output truncated", te.Pattern)
+	assert.Equal(t, "row 1\n(Output Truncated)\nrow 2\n", c.Result())
+	// The CLI is fine.
+	assert.Equal(t, "idle", h.Runner.Report().State)
+	r, _ := h.Runner.LastRunReport()
+	assert.True(t, r.OutputTruncated)
+	assert.NoError(t, h.Runner.Close())
+}
+
+func TestParameters_TruncationPatterns(t *testing.T) {
+	p := Parameters{
+		Path:               "/bin/sh",
+		OutSentinel:        &SimpleSentinelCommander{Command: "echo hi", Value: "hi"},
+		TruncationPatterns: []*regexp.Regexp{nil},
+	}
+	err := p.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "TruncationPatterns entry 0 is nil")
+}
@@ -0,0 +1,129 @@
+package clirunner
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync/atomic"
+)
+
+// Verbosity says how much debug output a runner writes to its
+// Parameters.DebugWriter.  It can be changed while the runner is in use,
+// with SetVerbosity, e.g. to trace a misbehaving session without
+// restarting anything.
+type Verbosity int
+
+const (
+	// VerbosityDefault is VerbosityLines.
+	VerbosityDefault Verbosity = iota
+	// VerbosityOff writes nothing.
+	VerbosityOff
+	// VerbosityCommands writes the commands issued, sentinels seen, state
+	// changes and trouble, but not the lines of output.
+	VerbosityCommands
+	// VerbosityLines writes everything, including every line of output.
+	VerbosityLines
+)
+
+func (v Verbosity) String() string {
+	switch v {
+	case VerbosityDefault:
+		return "Default"
+	case VerbosityOff:
+		return "Off"
+	case VerbosityCommands:
+		return "Commands"
+	case VerbosityLines:
+		return "Lines"
+	default:
+		return fmt.Sprintf("Verbosity(%d)", int(v))
+	}
+}
+
+// validate looks for trouble.
+func (v Verbosity) validate() error {
+	if v < VerbosityDefault || v > VerbosityLines {
+		return fmt.Errorf("unknown %s", v)
+	}
+	return nil
+}
+
+// verbosityLevel holds a runner's current Verbosity.  It's shared with
+// any warm standby.
+type verbosityLevel struct {
+	v int32 // atomic
+}
+
+func (l *verbosityLevel) set(v Verbosity) { atomic.StoreInt32(&l.v, int32(v)) }
+
+// get returns the Verbosity, never VerbosityDefault.
+func (l *verbosityLevel) get() Verbosity {
+	v := Verbosity(atomic.LoadInt32(&l.v))
+	if v == VerbosityDefault {
+		return VerbosityLines
+	}
+	return v
+}
+
+// gatedWriter writes only while the Verbosity is at least min.
+type gatedWriter struct {
+	w     io.Writer
+	level *verbosityLevel
+	min   Verbosity
+}
+
+func (g *gatedWriter) Write(p []byte) (int, error) {
+	if g.level.get() < g.min {
+		return len(p), nil
+	}
+	return g.w.Write(p)
+}
+
+// SetVerbosity changes how much debug output the runner writes, at once,
+// even in the middle of a run.  It has no effect without a
+// Parameters.DebugWriter, so to trace on demand, give the runner one and
+// a Parameters.Verbosity of VerbosityOff, and raise it when needed.
+// Reconfigure resets it to the new Parameters' Verbosity.
+func (pr *ProcRunner) SetVerbosity(v Verbosity) error {
+	if err := v.validate(); err != nil {
+		return err
+	}
+	pr.verbosity.set(v)
+	return nil
+}
+
+// Verbosity returns the runner's current Verbosity, never VerbosityDefault.
+func (pr *ProcRunner) Verbosity() Verbosity {
+	return pr.verbosity.get()
+}
+
+// CycleVerbosityOnSignal raises the runner's Verbosity each time the
+// process gets one of the given signals, e.g. syscall.SIGUSR1, going from
+// VerbosityLines back to VerbosityOff, so an operator can turn tracing of
+// a live session on and off again with kill.  Call the returned function
+// to stop.
+func CycleVerbosityOnSignal(pr *ProcRunner, sig ...os.Signal) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sig...)
+	go func() {
+		for {
+			select {
+			case <-ch:
+				v := pr.Verbosity() + 1
+				if v > VerbosityLines {
+					v = VerbosityOff
+				}
+				_ = pr.SetVerbosity(v)
+				pr.logger.Printf("verbosity now %s\n", v)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
@@ -0,0 +1,40 @@
+package clirunner_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunner_SetVerbosity(t *testing.T) {
+	var debug lockedBuffer
+	h := makeHarness(t, func(p *Parameters) {
+		p.DebugWriter = &debug
+		p.Verbosity = VerbosityOff
+	})
+	run := func(cmd, out string) {
+		result := runAsync(h, NewHoardingCommander(cmd), time.Hour)
+		expectCommands(t, h, cmd, "echo Rumpelstiltskin")
+		assert.NoError(t, h.Out(out, "Rumpelstiltskin"))
+		assert.NoError(t, <-result)
+	}
+	assert.Equal(t, VerbosityOff, h.Runner.Verbosity())
+	run("first", "one")
+	assert.Empty(t, debug.String())
+
+	assert.NoError(t, h.Runner.SetVerbosity(VerbosityCommands))
+	run("second", "two")
+	assert.Contains(t, debug.String(), `"second"`)
+	assert.NotContains(t, debug.String(), "two")
+
+	assert.NoError(t, h.Runner.SetVerbosity(VerbosityDefault))
+	assert.Equal(t, VerbosityLines, h.Runner.Verbosity())
+	run("third", "three")
+	assert.Contains(t, debug.String(), "three")
+
+	assert.Error(t, h.Runner.SetVerbosity(Verbosity(-1)))
+	assert.NoError(t, h.Runner.Close())
+}
@@ -0,0 +1,26 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package clirunner_test
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCycleVerbosityOnSignal(t *testing.T) {
+	h := makeHarness(t)
+	assert.NoError(t, h.Runner.SetVerbosity(VerbosityCommands))
+	stop := CycleVerbosityOnSignal(h.Runner, syscall.SIGUSR1)
+	defer stop()
+	for _, want := range []Verbosity{VerbosityLines, VerbosityOff} {
+		assert.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR1))
+		assert.Eventually(t, func() bool {
+			return h.Runner.Verbosity() == want
+		}, testingTimeout, time.Millisecond)
+	}
+}
@@ -0,0 +1,186 @@
+package clirunner
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// WorkRecord is what a WorkSet's Journal says of an item, as of the last
+// change of its status.
+type WorkRecord struct {
+	// Item is the item's index in the WorkSet.
+	Item int
+	// Command is the item's command, i.e. its Commander's String.
+	Command string
+	Status  WorkStatus
+	// Err is the text of the item's error, if any.
+	Err string
+	// Start and Duration are as in WorkResult.
+	Start    time.Time
+	Duration time.Duration
+	// Checkpoint is the Checkpoint of the item's Commander, if it
+	// succeeded and is a Checkpointer.
+	Checkpoint []byte
+}
+
+// workRecordJSON is the JSON form of a WorkRecord, a line of a Journal.
+type workRecordJSON struct {
+	Item       int        `json:"item"`
+	Command    string     `json:"command"`
+	Status     string     `json:"status"`
+	Err        string     `json:"error,omitempty"`
+	Start      *time.Time `json:"start,omitempty"`
+	DurationMs float64    `json:"durationMs,omitempty"`
+	Checkpoint []byte     `json:"checkpoint,omitempty"`
+}
+
+func (r WorkRecord) toJSON() workRecordJSON {
+	j := workRecordJSON{Item: r.Item, Command: r.Command,
+		Status: r.Status.String(), Err: r.Err,
+		DurationMs: durationMs(r.Duration), Checkpoint: r.Checkpoint}
+	if !r.Start.IsZero() {
+		j.Start = &r.Start
+	}
+	return j
+}
+
+func (j workRecordJSON) record() (WorkRecord, error) {
+	r := WorkRecord{Item: j.Item, Command: j.Command, Err: j.Err,
+		Duration:   time.Duration(j.DurationMs * float64(time.Millisecond)),
+		Checkpoint: j.Checkpoint}
+	if j.Start != nil {
+		r.Start = *j.Start
+	}
+	for s := WorkPending; s <= WorkCanceled; s++ {
+		if s.String() == j.Status {
+			r.Status = s
+			return r, nil
+		}
+	}
+	return r, fmt.Errorf("unknown work status %q", j.Status)
+}
+
+// recordOf returns the WorkRecord of the i'th result, checkpointing its
+// Commander if it succeeded.  An error checkpointing leaves the record
+// without a Checkpoint.
+func recordOf(i int, r WorkResult) (WorkRecord, error) {
+	rec := WorkRecord{Item: i, Command: r.Item.Commander.String(),
+		Status: r.Status, Start: r.Start, Duration: r.Duration}
+	if r.Err != nil {
+		rec.Err = r.Err.Error()
+	}
+	if r.Status != WorkSucceeded {
+		return rec, nil
+	}
+	cp := checkpointerOf(r.Item.Commander)
+	if cp == nil {
+		return rec, nil
+	}
+	data, err := cp.Checkpoint()
+	if err != nil {
+		return rec, fmt.Errorf("checkpointing work item %d (%q); %w",
+			i, rec.Command, err)
+	}
+	rec.Checkpoint = data
+	return rec, nil
+}
+
+// ReadWorkJournal returns the latest record of each item in a WorkSet's
+// Journal, in item order, e.g. to see which commands of an interrupted
+// batch are unfinished.  A torn last line, from a crash mid-write, is
+// ignored.
+func ReadWorkJournal(path string) ([]WorkRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	latest := map[int]WorkRecord{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	var bad error
+	for scanner.Scan() {
+		if bad != nil {
+			// Only the last line may be torn.
+			return nil, bad
+		}
+		var j workRecordJSON
+		if err = json.Unmarshal(scanner.Bytes(), &j); err != nil {
+			bad = fmt.Errorf("bad line in work journal %s; %w", path, err)
+			continue
+		}
+		r, err := j.record()
+		if err != nil {
+			return nil, fmt.Errorf("in work journal %s, %w", path, err)
+		}
+		latest[r.Item] = r
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	result := make([]WorkRecord, 0, len(latest))
+	for _, r := range latest {
+		result = append(result, r)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Item < result[j].Item })
+	return result, nil
+}
+
+// workJournal appends WorkRecords to a Journal.
+type workJournal struct {
+	path string
+	f    *os.File
+}
+
+// openWorkJournal starts a Journal afresh, holding the given records,
+// written to a temporary file that replaces the old Journal, so that a
+// crash leaves one or the other.
+func openWorkJournal(path string, records []WorkRecord) (*workJournal, error) {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	j := &workJournal{path: path, f: f}
+	for _, r := range records {
+		if err = j.record(r); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	// Windows can't rename an open file.
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err == nil {
+		j.f, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return nil, fmt.Errorf("writing work journal %s; %w", path, err)
+	}
+	return j, nil
+}
+
+// record appends a record.
+func (j *workJournal) record(r WorkRecord) error {
+	b, err := json.Marshal(r.toJSON())
+	if err != nil {
+		return err
+	}
+	_, err = j.f.Write(append(b, '\n'))
+	return err
+}
+
+func (j *workJournal) close() error {
+	return j.f.Close()
+}
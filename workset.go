@@ -0,0 +1,353 @@
+package clirunner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// WorkSet runs a batch of Commanders, each on its own Runner, several at a
+// time, collecting the outcomes in WorkResults, e.g. to query a fleet of
+// databases, each through its own ProcRunner.
+//
+// Items on the same ProcRunner take turns there, as any runs do, holding
+// up a worker each while they wait, so spread a batch across runners, or
+// use a ProcRunnerPool as the Runner.
+type WorkSet struct {
+	// Workers is the most items run at once.  If not positive, one.
+	Workers int
+
+	// TimeOut, if positive, limits the context of each item's RunContext.
+	TimeOut time.Duration
+
+	// Journal, if not empty, is a file recording the items' commands and
+	// progress as they run, so that a batch cut short, e.g. by a crash of
+	// the process running it, can be resumed by a WorkSet with the same
+	// items and Journal, which reruns only the items that didn't succeed.
+	// Resumed items' Commanders are restored if they're Checkpointers.
+	// See ReadWorkJournal.  Commands are recorded as is, Secrets and all.
+	// Remove the file to start the batch afresh.
+	Journal string
+
+	items []WorkItem
+}
+
+// WorkItem is a Commander to run on a Runner.
+type WorkItem struct {
+	Runner    Runner
+	Commander Commander
+}
+
+// WorkStatus says how far along a WorkItem is.
+type WorkStatus int
+
+const (
+	// WorkPending means the item hasn't started.
+	WorkPending WorkStatus = iota
+	// WorkRunning means the item is running.
+	WorkRunning
+	// WorkSucceeded means the item ran without error.
+	WorkSucceeded
+	// WorkFailed means the item's run returned an error.
+	WorkFailed
+	// WorkCanceled means the item never ran, since the context was done
+	// first.
+	WorkCanceled
+)
+
+func (s WorkStatus) String() string {
+	switch s {
+	case WorkPending:
+		return "pending"
+	case WorkRunning:
+		return "running"
+	case WorkSucceeded:
+		return "succeeded"
+	case WorkFailed:
+		return "failed"
+	case WorkCanceled:
+		return "canceled"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+// WorkResult is the outcome of a WorkItem, so far.
+type WorkResult struct {
+	Item   WorkItem
+	Status WorkStatus
+	// Err is what the run returned, or the context's error if the item
+	// was canceled.
+	Err error
+	// Start is when the item started running, and Duration how long it
+	// ran, once it's done.
+	Start    time.Time
+	Duration time.Duration
+	// Resumed is true if the item succeeded before, per the Journal, so
+	// it wasn't run again, and its Commander holds nothing, unless it's a
+	// Checkpointer, restored from its Checkpoint.
+	Resumed bool
+}
+
+// Add adds an item to the set, returning its index in the WorkResults.
+func (w *WorkSet) Add(r Runner, c Commander) int {
+	w.items = append(w.items, WorkItem{Runner: r, Commander: c})
+	return len(w.items) - 1
+}
+
+// Start starts running the items, in the order added, returning at once
+// with the WorkResults, which fill in as the items run.  Once the context
+// is done, items that haven't started are canceled, and those running are
+// canceled too.  Items added after Start aren't run.
+func (w *WorkSet) Start(ctx context.Context) *WorkResults {
+	items := append([]WorkItem(nil), w.items...)
+	results := &WorkResults{
+		results: make([]WorkResult, len(items)),
+		done:    make(chan struct{}),
+	}
+	for i, item := range items {
+		results.results[i].Item = item
+	}
+	results.openJournal(w.Journal)
+	workers := w.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				w.runItem(ctx, results, i)
+			}
+		}()
+	}
+	go func() {
+		for i := range items {
+			if results.results[i].Resumed {
+				continue
+			}
+			select {
+			case next <- i:
+			case <-ctx.Done():
+				results.update(i, func(r *WorkResult) {
+					r.Status, r.Err = WorkCanceled, ctx.Err()
+				})
+			}
+		}
+		close(next)
+		wg.Wait()
+		results.closeJournal()
+		close(results.done)
+	}()
+	return results
+}
+
+// Run is Start, waiting for all the items to be done.
+func (w *WorkSet) Run(ctx context.Context) *WorkResults {
+	results := w.Start(ctx)
+	<-results.Done()
+	return results
+}
+
+// runItem runs the i'th item, recording its outcome.
+func (w *WorkSet) runItem(ctx context.Context, results *WorkResults, i int) {
+	if err := ctx.Err(); err != nil {
+		results.update(i, func(r *WorkResult) {
+			r.Status, r.Err = WorkCanceled, err
+		})
+		return
+	}
+	start := time.Now()
+	var item WorkItem
+	results.update(i, func(r *WorkResult) {
+		r.Status, r.Start, item = WorkRunning, start, r.Item
+	})
+	runCtx := ctx
+	if w.TimeOut > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, w.TimeOut)
+		defer cancel()
+	}
+	err := item.Runner.RunContext(runCtx, item.Commander)
+	results.update(i, func(r *WorkResult) {
+		r.Status, r.Err, r.Duration = WorkSucceeded, err, time.Since(start)
+		if err != nil {
+			r.Status = WorkFailed
+		}
+	})
+}
+
+// WorkResults holds the outcomes of a WorkSet's items, by index.  It's
+// safe for concurrent use while the items run.
+type WorkResults struct {
+	m       sync.Mutex
+	results []WorkResult
+	done    chan struct{} // closed once every item is done
+	// journal, if not nil, records the changes to the results, and
+	// journalErr is the first error doing so.
+	journal    *workJournal
+	journalErr error
+}
+
+// update changes the i'th result, recording it in the journal.
+func (r *WorkResults) update(i int, f func(*WorkResult)) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	f(&r.results[i])
+	if r.journal == nil {
+		return
+	}
+	rec, err := recordOf(i, r.results[i])
+	if err != nil && r.journalErr == nil {
+		r.journalErr = err
+	}
+	if err = r.journal.record(rec); err != nil {
+		r.journalFailed(err)
+	}
+}
+
+// openJournal resumes the results recorded in the journal at path, if
+// any, marking those that succeeded as Resumed, and restoring their
+// Checkpointers, then starts the journal afresh with all of them.  Items
+// are matched by index and command.
+func (r *WorkResults) openJournal(path string) {
+	if path == "" {
+		return
+	}
+	old, err := ReadWorkJournal(path)
+	if err != nil && !os.IsNotExist(err) {
+		r.journalErr = err
+	}
+	records := make([]WorkRecord, len(r.results))
+	for _, rec := range old {
+		if rec.Item >= len(r.results) || rec.Status != WorkSucceeded {
+			continue
+		}
+		res := &r.results[rec.Item]
+		if res.Item.Commander.String() != rec.Command ||
+			!r.restore(res.Item.Commander, rec) {
+			continue
+		}
+		res.Status, res.Start, res.Duration = WorkSucceeded, rec.Start, rec.Duration
+		res.Resumed = true
+		// Kept as is, with its Checkpoint.
+		records[rec.Item] = rec
+	}
+	for i, res := range r.results {
+		if !res.Resumed {
+			// Not yet run, so there's nothing to checkpoint.
+			records[i], _ = recordOf(i, res)
+		}
+	}
+	if r.journal, err = openWorkJournal(path, records); err != nil {
+		r.journalFailed(err)
+	}
+}
+
+// restore restores a Commander that's a Checkpointer from the record's
+// Checkpoint, returning false if it can't be, so that its item is run
+// again.
+func (r *WorkResults) restore(c Commander, rec WorkRecord) bool {
+	cp := checkpointerOf(c)
+	if cp == nil {
+		return true
+	}
+	if rec.Checkpoint == nil {
+		return false
+	}
+	if err := cp.Restore(rec.Checkpoint); err != nil {
+		if r.journalErr == nil {
+			r.journalErr = fmt.Errorf("restoring work item %d (%q); %w",
+				rec.Item, rec.Command, err)
+		}
+		return false
+	}
+	return true
+}
+
+// journalFailed stops journaling after an error.  The caller must hold m,
+// once the items run.
+func (r *WorkResults) journalFailed(err error) {
+	if r.journalErr == nil {
+		r.journalErr = err
+	}
+	if r.journal != nil {
+		_ = r.journal.close()
+		r.journal = nil
+	}
+}
+
+// closeJournal closes the journal, if any.
+func (r *WorkResults) closeJournal() {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.journal == nil {
+		return
+	}
+	if err := r.journal.close(); err != nil && r.journalErr == nil {
+		r.journalErr = fmt.Errorf("closing work journal %s; %w",
+			r.journal.path, err)
+	}
+	r.journal = nil
+}
+
+// JournalErr returns the first error reading or writing the WorkSet's
+// Journal, after which the items' progress isn't recorded, or else the
+// first error checkpointing or restoring a Checkpointer.  The items run
+// regardless.
+func (r *WorkResults) JournalErr() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.journalErr
+}
+
+// Done returns a channel closed once every item is done.
+func (r *WorkResults) Done() <-chan struct{} { return r.done }
+
+// Len returns the number of items.
+func (r *WorkResults) Len() int { return len(r.results) }
+
+// Get returns the outcome of the i'th item so far.  The Commander holds
+// the item's output once the item is done.
+func (r *WorkResults) Get(i int) WorkResult {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.results[i]
+}
+
+// All returns the outcomes of all the items so far.
+func (r *WorkResults) All() []WorkResult {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return append([]WorkResult(nil), r.results...)
+}
+
+// Counts returns the number of items with each status.
+func (r *WorkResults) Counts() map[WorkStatus]int {
+	r.m.Lock()
+	defer r.m.Unlock()
+	counts := map[WorkStatus]int{}
+	for _, res := range r.results {
+		counts[res.Status]++
+	}
+	return counts
+}
+
+// Err returns the error of the first item, in order, that failed or was
+// canceled, or nil if none did, so far.
+func (r *WorkResults) Err() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	for i, res := range r.results {
+		if res.Err != nil {
+			return fmt.Errorf("work item %d (%q): %w",
+				i, res.Item.Commander.String(), res.Err)
+		}
+	}
+	return nil
+}
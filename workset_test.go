@@ -0,0 +1,290 @@
+package clirunner_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/monopole/clirunner"
+	. "github.com/monopole/clirunner/cmdrs"
+	"github.com/stretchr/testify/assert"
+)
+
+// gatedRunner runs a Commander by waiting for the gate to open, tracking
+// how many runs are underway at once.
+type gatedRunner struct {
+	m         sync.Mutex
+	gate      chan struct{}
+	running   int
+	most      int
+	startedCh chan string
+}
+
+func (g *gatedRunner) RunIt(c Commander, _ time.Duration) error {
+	g.m.Lock()
+	g.running++
+	if g.running > g.most {
+		g.most = g.running
+	}
+	g.m.Unlock()
+	g.startedCh <- c.String()
+	<-g.gate
+	g.m.Lock()
+	g.running--
+	g.m.Unlock()
+	if c.String() == "bad" {
+		return fmt.Errorf("bad command")
+	}
+	return nil
+}
+
+func (g *gatedRunner) RunContext(_ context.Context, c Commander) error {
+	return g.RunIt(c, 0)
+}
+
+func (g *gatedRunner) Close() error { return nil }
+
+func TestWorkSet(t *testing.T) {
+	g := &gatedRunner{gate: make(chan struct{}), startedCh: make(chan string)}
+	ws := &WorkSet{Workers: 2}
+	for _, c := range []string{"a", "bad", "c", "d"} {
+		ws.Add(g, NewHoardingCommander(c))
+	}
+	results := ws.Start(context.Background())
+	assert.Equal(t, 4, results.Len())
+
+	// The first two run at once; the others wait.
+	assert.ElementsMatch(t, []string{"a", "bad"},
+		[]string{<-g.startedCh, <-g.startedCh})
+	select {
+	case c := <-g.startedCh:
+		t.Fatalf("%q started beyond the worker limit", c)
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Equal(t, WorkRunning, results.Get(0).Status)
+	assert.Equal(t, WorkPending, results.Get(2).Status)
+	assert.Equal(t, map[WorkStatus]int{WorkRunning: 2, WorkPending: 2},
+		results.Counts())
+
+	close(g.gate)
+	<-g.startedCh
+	<-g.startedCh
+	<-results.Done()
+	assert.Equal(t, 2, g.most)
+	assert.Equal(t, map[WorkStatus]int{WorkSucceeded: 3, WorkFailed: 1},
+		results.Counts())
+	assert.Equal(t, "failed", results.Get(1).Status.String())
+	assert.EqualError(t, results.Err(), `work item 1 ("bad"): bad command`)
+}
+
+func TestWorkSet_Canceled(t *testing.T) {
+	g := &gatedRunner{gate: make(chan struct{}), startedCh: make(chan string)}
+	ws := &WorkSet{}
+	ws.Add(g, NewHoardingCommander("a"))
+	ws.Add(g, NewHoardingCommander("b"))
+	ctx, cancel := context.WithCancel(context.Background())
+	results := ws.Start(ctx)
+	assert.Equal(t, "a", <-g.startedCh)
+	cancel()
+	close(g.gate)
+	<-results.Done()
+	assert.Equal(t, WorkSucceeded, results.Get(0).Status)
+	assert.Equal(t, WorkCanceled, results.Get(1).Status)
+	assert.ErrorIs(t, results.Get(1).Err, context.Canceled)
+}
+
+func TestWorkSet_ProcRunners(t *testing.T) {
+	ws := &WorkSet{Workers: 2, TimeOut: testingTimeout}
+	var runners []*ProcRunner
+	for i := 0; i < 2; i++ {
+		runner, err := NewProcRunner(&Parameters{
+			Path:        "sh",
+			Env:         []string{fmt.Sprintf("WHO=%d", i)},
+			ExitCommand: "exit",
+			OutSentinel: &SimpleSentinelCommander{
+				Command: "echo Rumpelstiltskin",
+				Value:   "Rumpelstiltskin",
+			},
+		})
+		assert.NoError(t, err)
+		runners = append(runners, runner)
+		ws.Add(runner, NewHoardingCommander(`echo "hi $WHO"`))
+	}
+	results := ws.Run(context.Background())
+	assert.NoError(t, results.Err())
+	for i, r := range results.All() {
+		assert.Equal(t, WorkSucceeded, r.Status)
+		assert.Equal(t, fmt.Sprintf("hi %d\n", i),
+			r.Item.Commander.(*HoardingCommander).Result())
+	}
+	for _, runner := range runners {
+		assert.NoError(t, runner.Close())
+	}
+}
+
+// listRunner runs a Commander by noting its command, and writing it back
+// as its output, failing those in fail.
+type listRunner struct {
+	m    sync.Mutex
+	ran  []string
+	fail map[string]bool
+}
+
+func (l *listRunner) RunIt(c Commander, _ time.Duration) error {
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.ran = append(l.ran, c.String())
+	if _, err := c.Write([]byte(c.String())); err != nil {
+		return err
+	}
+	if l.fail[c.String()] {
+		return fmt.Errorf("%s failed", c)
+	}
+	return nil
+}
+
+func (l *listRunner) RunContext(_ context.Context, c Commander) error {
+	return l.RunIt(c, 0)
+}
+
+func (l *listRunner) Close() error { return nil }
+
+func TestWorkSet_Journal(t *testing.T) {
+	journal := filepath.Join(t.TempDir(), "batch.journal")
+	batch := func(r Runner, cmds ...string) *WorkSet {
+		ws := &WorkSet{Journal: journal}
+		for _, c := range cmds {
+			ws.Add(r, NewHoardingCommander(c))
+		}
+		return ws
+	}
+	first := &listRunner{fail: map[string]bool{"b": true}}
+	results := batch(first, "a", "b", "c").Run(context.Background())
+	assert.NoError(t, results.JournalErr())
+	assert.Equal(t, []string{"a", "b", "c"}, first.ran)
+	records, err := ReadWorkJournal(journal)
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, WorkRecord{Item: 1, Command: "b", Status: WorkFailed,
+		Err: "b failed", Start: records[1].Start, Duration: records[1].Duration},
+		records[1])
+	assert.Equal(t, WorkSucceeded, records[2].Status)
+
+	// A crash mid-write leaves a torn line, which is ignored.
+	f, err := os.OpenFile(journal, os.O_APPEND|os.O_WRONLY, 0)
+	assert.NoError(t, err)
+	_, err = f.WriteString(`{"item":0,"comm`)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	// Resuming reruns what failed, and what changed.
+	second := &listRunner{}
+	results = batch(second, "a", "b", "c2").Run(context.Background())
+	assert.NoError(t, results.JournalErr())
+	assert.NoError(t, results.Err())
+	assert.Equal(t, []string{"b", "c2"}, second.ran)
+	assert.True(t, results.Get(0).Resumed)
+	assert.Equal(t, WorkSucceeded, results.Get(0).Status)
+	assert.False(t, results.Get(1).Resumed)
+	records, err = ReadWorkJournal(journal)
+	assert.NoError(t, err)
+	for i, c := range []string{"a", "b", "c2"} {
+		assert.Equal(t, c, records[i].Command)
+		assert.Equal(t, WorkSucceeded, records[i].Status)
+	}
+
+	// Nothing's left to run.
+	third := &listRunner{}
+	results = batch(third, "a", "b", "c2").Run(context.Background())
+	assert.Empty(t, third.ran)
+	assert.Equal(t, map[WorkStatus]int{WorkSucceeded: 3}, results.Counts())
+
+	assert.NoError(t, os.WriteFile(journal, []byte("nonsense\n{}\n"), 0o600))
+	_, err = ReadWorkJournal(journal)
+	assert.Error(t, err)
+	results = batch(third, "a").Run(context.Background())
+	assert.Error(t, results.JournalErr())
+	assert.Equal(t, []string{"a"}, third.ran)
+}
+
+// tallyCommander totals the numbers in its output, checkpointing the total.
+type tallyCommander struct {
+	command string
+	total   int
+}
+
+func (c *tallyCommander) String() string { return c.command }
+
+func (c *tallyCommander) Write(p []byte) (int, error) {
+	n, err := strconv.Atoi(string(p))
+	c.total += n
+	return len(p), err
+}
+
+func (c *tallyCommander) Success() bool { return true }
+
+func (c *tallyCommander) Reset() { c.total = 0 }
+
+func (c *tallyCommander) Checkpoint() ([]byte, error) {
+	return []byte(strconv.Itoa(c.total)), nil
+}
+
+func (c *tallyCommander) Restore(data []byte) (err error) {
+	c.total, err = strconv.Atoi(string(data))
+	return err
+}
+
+func TestWorkSet_JournalCheckpoints(t *testing.T) {
+	journal := filepath.Join(t.TempDir(), "batch.journal")
+	batch := func(r Runner, cmds ...string) (*WorkSet, func() int) {
+		ws := &WorkSet{Journal: journal}
+		var tallies []*tallyCommander
+		for _, cmd := range cmds {
+			c := &tallyCommander{command: cmd}
+			tallies = append(tallies, c)
+			ws.Add(r, c)
+		}
+		return ws, func() (sum int) {
+			for _, c := range tallies {
+				sum += c.total
+			}
+			return sum
+		}
+	}
+	ws, _ := batch(&listRunner{fail: map[string]bool{"4": true}}, "1", "2", "4")
+	results := ws.Run(context.Background())
+	assert.NoError(t, results.JournalErr())
+	records, err := ReadWorkJournal(journal)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("2"), records[1].Checkpoint)
+	assert.Nil(t, records[2].Checkpoint)
+
+	// The resumed items' totals are restored, and kept for the next time.
+	second := &listRunner{}
+	ws, sum := batch(second, "1", "2", "4")
+	results = ws.Run(context.Background())
+	assert.NoError(t, results.JournalErr())
+	assert.Equal(t, []string{"4"}, second.ran)
+	assert.Equal(t, 7, sum())
+	third := &listRunner{}
+	ws, sum = batch(third, "1", "2", "4")
+	ws.Run(context.Background())
+	assert.Empty(t, third.ran)
+	assert.Equal(t, 7, sum())
+
+	// An item that can't be restored is run again.
+	assert.NoError(t, os.WriteFile(journal,
+		[]byte(`{"item":0,"command":"1","status":"succeeded","checkpoint":"eA=="}`+"\n"),
+		0o600))
+	fourth := &listRunner{}
+	ws, sum = batch(fourth, "1")
+	results = ws.Run(context.Background())
+	assert.Error(t, results.JournalErr())
+	assert.Equal(t, []string{"1"}, fourth.ran)
+	assert.Equal(t, 1, sum())
+}